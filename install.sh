@@ -7,12 +7,17 @@ SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
 echo "Building claudex-server..."
 cd "$SCRIPT_DIR/server"
 go build -o "$CLAUDEX_DIR/claudex-server" .
+go build -o "$CLAUDEX_DIR/claudexctl" ./cmd/claudexctl
 
 # Copy web files
 echo "Copying web files..."
 rm -rf "$CLAUDEX_DIR/web"
 cp -r "$SCRIPT_DIR/web" "$CLAUDEX_DIR/web"
 
+# Copy statusline command for Claude Code's statusLine hook
+cp "$SCRIPT_DIR/statusline.sh" "$CLAUDEX_DIR/statusline.sh"
+chmod +x "$CLAUDEX_DIR/statusline.sh"
+
 # Create config if not exists
 if [ ! -f "$CLAUDEX_DIR/config.json" ]; then
     echo '{"port": 9090}' > "$CLAUDEX_DIR/config.json"
@@ -22,9 +27,12 @@ fi
 # Create sessions dir if not exists
 mkdir -p "$CLAUDEX_DIR/sessions"
 
-# Install launchd service
-PLIST="$HOME/Library/LaunchAgents/com.claudex.server.plist"
-cat > "$PLIST" << 'EOF'
+PORT=$(grep -o '"port":[^,}]*' "$CLAUDEX_DIR/config.json" | grep -o '[0-9]*')
+
+if [ "$(uname)" = "Darwin" ]; then
+    # Install launchd service
+    PLIST="$HOME/Library/LaunchAgents/com.claudex.server.plist"
+    cat > "$PLIST" << 'EOF'
 <?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
 <plist version="1.0">
@@ -49,12 +57,50 @@ cat > "$PLIST" << 'EOF'
 </plist>
 EOF
 
-# Replace placeholder with actual path
-sed -i '' "s|CLAUDEX_DIR|$CLAUDEX_DIR|g" "$PLIST"
+    # Replace placeholder with actual path
+    sed -i '' "s|CLAUDEX_DIR|$CLAUDEX_DIR|g" "$PLIST"
+
+    # Reload service
+    echo "Reloading service..."
+    launchctl unload "$PLIST" 2>/dev/null || true
+    launchctl load "$PLIST"
+elif command -v systemctl > /dev/null; then
+    # Install a systemd user service, started on the first connection
+    UNIT_DIR="$HOME/.config/systemd/user"
+    mkdir -p "$UNIT_DIR"
+    cat > "$UNIT_DIR/claudex.socket" << EOF
+[Unit]
+Description=claudex server socket
+
+[Socket]
+ListenStream=${PORT:-9090}
+
+[Install]
+WantedBy=sockets.target
+EOF
+    cat > "$UNIT_DIR/claudex.service" << 'EOF'
+[Unit]
+Description=claudex server
+Requires=claudex.socket
+After=claudex.socket
+
+[Service]
+Type=notify
+ExecStart=%h/.claudex/claudex-server
+WorkingDirectory=%h/.claudex
+Restart=on-failure
+WatchdogSec=30
+KillMode=mixed
+TimeoutStopSec=30
 
-# Reload service
-echo "Reloading service..."
-launchctl unload "$PLIST" 2>/dev/null || true
-launchctl load "$PLIST"
+[Install]
+WantedBy=default.target
+EOF
+
+    echo "Reloading service..."
+    systemctl --user daemon-reload
+    systemctl --user enable --now claudex.socket
+    systemctl --user try-restart claudex.service
+fi
 
-echo "Done! Server running at http://localhost:$(grep -o '"port":[^,}]*' "$CLAUDEX_DIR/config.json" | grep -o '[0-9]*')"
+echo "Done! Server running at http://localhost:${PORT:-9090}"
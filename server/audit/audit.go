@@ -0,0 +1,133 @@
+// Package audit keeps an append-only record of what was typed into each
+// session and by whom: one JSONL file per session, never rewritten.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event kinds
+const (
+	KindInput          = "input"           // Terminal input from a client
+	KindPolicyOverride = "policy_override" // A held line confirmed past the command policy
+	KindInterrupt      = "interrupt"       // Escape sent through the REST API, with the follow-up typed after it
+	KindRun            = "run"             // A command run in a role's pane through the REST API
+	KindPermission     = "permission"      // A permission prompt answered through the API (Decision)
+	KindMacro          = "macro"           // A step of a macro replayed through the API
+)
+
+// Actor identifies who sent an input
+type Actor struct {
+	Source     string `json:"source"`                // "websocket", "grpc", "rest", or "dependency" for prompts typed when a dependency is met
+	Connection string `json:"connection,omitempty"`  // WebSocket connection ID, stable while it is open
+	User       string `json:"user,omitempty"`        // X-Claudex-User of the connection or request
+	RemoteAddr string `json:"remote_addr,omitempty"` // Client address
+	Admin      bool   `json:"admin,omitempty"`       // Authenticated with the admin token
+}
+
+// Event is one audited input
+type Event struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id"`
+	Kind      string    `json:"kind"`
+	Actor
+	Input    string `json:"input"`              // As sent by the client, before the command policy
+	Role     string `json:"role,omitempty"`     // Pane role a run command went to
+	Decision string `json:"decision,omitempty"` // Command policy decision the input matched
+	Blocked  bool   `json:"blocked,omitempty"`  // A line was held back by unavailable services
+}
+
+// Config controls the audit log
+type Config struct {
+	Disabled bool `json:"disabled,omitempty"` // Don't record input at all
+}
+
+// Log appends events to <dir>/<session-id>.jsonl
+type Log struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New returns a log writing under dir
+func New(dir string) *Log {
+	return &Log{dir: dir}
+}
+
+// path returns a session's file, rejecting IDs that would escape dir
+func (l *Log) path(sessionID string) (string, error) {
+	if sessionID == "" || sessionID != filepath.Base(sessionID) {
+		return "", fmt.Errorf("invalid session id: %q", sessionID)
+	}
+	return filepath.Join(l.dir, sessionID+".jsonl"), nil
+}
+
+// Record appends an event, stamping its time if unset
+func (l *Log) Record(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	path, err := l.path(e.SessionID)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Read returns a session's events after since, oldest first, at most limit
+// of them (0: all). A session without input has no events.
+func (l *Log) Read(sessionID string, since time.Time, limit int) ([]Event, error) {
+	path, err := l.path(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Event{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	events := []Event{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // Pastes make long lines
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // A line cut short by a crash
+		}
+		if !e.Time.After(since) {
+			continue
+		}
+		events = append(events, e)
+		if limit > 0 && len(events) == limit {
+			break
+		}
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,47 @@
+package claude
+
+import (
+	"math"
+	"strings"
+)
+
+// Context window sizes of Claude models, in tokens
+const (
+	DefaultContextWindow = 200_000
+	LongContextWindow    = 1_000_000 // Models run with the 1M context beta ("sonnet[1m]")
+)
+
+// ContextUsage is how full the context window was on the latest reply
+type ContextUsage struct {
+	Tokens  int     `json:"tokens"`  // Input tokens of the reply, cache reads and writes included
+	Window  int     `json:"window"`  // Context window of the model
+	Percent float64 `json:"percent"` // Tokens as a percentage of Window
+}
+
+// ContextWindowFor returns the context window of a model. The transcript
+// doesn't say whether the 1M beta is on, so a context already larger than
+// the default window means it is.
+func ContextWindowFor(model string, tokens int) int {
+	if strings.HasSuffix(model, "[1m]") || tokens > DefaultContextWindow {
+		return LongContextWindow
+	}
+	return DefaultContextWindow
+}
+
+// NewContextUsage returns the use of a window by tokens
+func NewContextUsage(tokens, window int) *ContextUsage {
+	return &ContextUsage{
+		Tokens:  tokens,
+		Window:  window,
+		Percent: math.Round(float64(tokens)/float64(window)*1000) / 10,
+	}
+}
+
+// contextUsage returns the context a reply's usage says was sent to the model
+func contextUsage(model string, usage *TokenUsage) *ContextUsage {
+	tokens := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	if tokens == 0 {
+		return nil
+	}
+	return NewContextUsage(tokens, ContextWindowFor(model, tokens))
+}
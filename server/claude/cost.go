@@ -0,0 +1,286 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+}
+
+// Pricing maps model name prefixes to prices. The longest matching prefix wins,
+// so "claude-opus-4-5" can be priced differently from "claude-opus-4".
+type Pricing map[string]ModelPrice
+
+// DefaultPricing holds list prices for current Claude models
+var DefaultPricing = Pricing{
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.5},
+	"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.5},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-haiku-4-5":  {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.1},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+}
+
+var (
+	pricingMu sync.RWMutex
+	pricing   = DefaultPricing
+)
+
+// SetPricing overrides or extends the default pricing table
+func SetPricing(overrides Pricing) {
+	merged := make(Pricing, len(DefaultPricing)+len(overrides))
+	for model, price := range DefaultPricing {
+		merged[model] = price
+	}
+	for model, price := range overrides {
+		merged[model] = price
+	}
+
+	pricingMu.Lock()
+	defer pricingMu.Unlock()
+	pricing = merged
+}
+
+// PriceFor returns the price of a model
+func PriceFor(model string) (ModelPrice, bool) {
+	pricingMu.RLock()
+	defer pricingMu.RUnlock()
+
+	var best string
+	for prefix := range pricing {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return pricing[best], true
+}
+
+// ModelUsage is the token usage and cost of one model in a transcript
+type ModelUsage struct {
+	Model                    string  `json:"model"`
+	Messages                 int     `json:"messages"`
+	InputTokens              int     `json:"input_tokens"`
+	OutputTokens             int     `json:"output_tokens"`
+	CacheCreationInputTokens int     `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int     `json:"cache_read_input_tokens"`
+	CostUSD                  float64 `json:"cost_usd"`
+	Priced                   bool    `json:"priced"` // False if the model isn't in the pricing table
+}
+
+// CostReport breaks down the usage of a Claude session by model
+type CostReport struct {
+	SessionID    string        `json:"session_id"`
+	Model        string        `json:"model,omitempty"` // Model of the latest reply
+	Models       []ModelUsage  `json:"models"`
+	InputTokens  int           `json:"input_tokens"`
+	OutputTokens int           `json:"output_tokens"`
+	TotalTokens  int           `json:"total_tokens"` // Including cache reads and writes
+	CostUSD      float64       `json:"cost_usd"`
+	Context      *ContextUsage `json:"context,omitempty"` // Context window use on the latest reply
+}
+
+// add accumulates a message's usage
+func (u *ModelUsage) add(usage *TokenUsage) {
+	u.Messages++
+	u.InputTokens += usage.InputTokens
+	u.OutputTokens += usage.OutputTokens
+	u.CacheCreationInputTokens += usage.CacheCreationInputTokens
+	u.CacheReadInputTokens += usage.CacheReadInputTokens
+}
+
+// price computes the cost from the accumulated tokens
+func (u *ModelUsage) price() {
+	p, ok := PriceFor(u.Model)
+	u.Priced = ok
+	u.CostUSD = (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheCreationInputTokens)*p.CacheWrite +
+		float64(u.CacheReadInputTokens)*p.CacheRead) / 1e6
+}
+
+// costParse is a transcript read up to offset, kept so that lines Claude
+// appends later are all that has to be read
+type costParse struct {
+	mu       sync.Mutex
+	offset   int64     // Bytes read: always the end of a complete line
+	modTime  time.Time // Of the file when last read
+	report   *CostReport
+	messages map[string]costMessage
+	order    []string // Message IDs in the order first seen
+	session  string
+	model    string
+	context  *ContextUsage
+}
+
+// costMessage is one assistant message's model and final usage
+type costMessage struct {
+	model string
+	usage TokenUsage
+}
+
+var (
+	costCacheMu sync.Mutex
+	costCache   = make(map[string]*costParse)
+)
+
+// GetCostReport computes the usage and cost of a Claude session in a
+// directory (the most recent one if sessionID is empty)
+func GetCostReport(workDir, sessionID string) (*CostReport, error) {
+	path, err := FindTranscript(workDir, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return CostReportForTranscript(path)
+}
+
+// CostReportForTranscript computes the usage and cost of a transcript file.
+// Results are cached until the file changes, and a file that grew is only
+// read from where the last read stopped.
+func CostReportForTranscript(path string) (*CostReport, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	costCacheMu.Lock()
+	parse, ok := costCache[path]
+	if !ok {
+		parse = &costParse{}
+		costCache[path] = parse
+	}
+	costCacheMu.Unlock()
+
+	parse.mu.Lock()
+	defer parse.mu.Unlock()
+	if parse.report != nil && parse.offset == stat.Size() && parse.modTime.Equal(stat.ModTime()) {
+		return parse.report, nil
+	}
+	if stat.Size() < parse.offset {
+		// Rewritten rather than appended to
+		parse.offset, parse.messages, parse.order = 0, nil, nil
+		parse.session, parse.model, parse.context = "", "", nil
+	}
+	if err := parse.read(path); err != nil {
+		return nil, err
+	}
+	parse.modTime = stat.ModTime()
+	parse.report = parse.build()
+	return parse.report, nil
+}
+
+// ForgetTranscript drops what is cached about a transcript, for a session
+// that is gone
+func ForgetTranscript(path string) {
+	costCacheMu.Lock()
+	delete(costCache, path)
+	costCacheMu.Unlock()
+	transcriptCacheMu.Lock()
+	delete(transcriptCache, path)
+	transcriptCacheMu.Unlock()
+}
+
+// read parses the complete lines after the offset
+func (p *costParse) read(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(p.offset, io.SeekStart); err != nil {
+		return err
+	}
+	if p.messages == nil {
+		p.messages = make(map[string]costMessage)
+	}
+
+	reader := bufio.NewReaderSize(file, 1024*1024)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A line without its newline is still being written; it is
+			// read whole next time
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		p.offset += int64(len(data))
+		p.add(data)
+	}
+}
+
+// add takes the usage of one transcript line.
+// Claude writes one line per content block, each repeating the usage of
+// the whole message, so usage is taken once per message ID.
+func (p *costParse) add(data []byte) {
+	var line TranscriptLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return
+	}
+	if p.session == "" {
+		p.session = line.SessionID
+	}
+	if line.Type != "assistant" || line.Message.Usage == nil {
+		return
+	}
+	// Replies Claude Code makes up itself (e.g. for API errors) aren't a model's
+	if line.Message.Model != "" && line.Message.Model != "<synthetic>" {
+		p.model = line.Message.Model
+		if usage := contextUsage(line.Message.Model, line.Message.Usage); usage != nil && !line.IsSidechain {
+			p.context = usage
+		}
+	}
+
+	id := line.Message.ID
+	if id == "" {
+		id = line.UUID
+	}
+	if _, seen := p.messages[id]; !seen {
+		p.order = append(p.order, id)
+	}
+	// Later lines carry the final usage of a streamed message
+	p.messages[id] = costMessage{model: line.Message.Model, usage: *line.Message.Usage}
+}
+
+// build sums the usage read so far per model
+func (p *costParse) build() *CostReport {
+	report := &CostReport{SessionID: p.session, Model: p.model, Context: p.context, Models: []ModelUsage{}}
+	byModel := make(map[string]*ModelUsage)
+	for _, id := range p.order {
+		msg := p.messages[id]
+		u, ok := byModel[msg.model]
+		if !ok {
+			u = &ModelUsage{Model: msg.model}
+			byModel[msg.model] = u
+		}
+		u.add(&msg.usage)
+	}
+
+	for _, u := range byModel {
+		u.price()
+		report.Models = append(report.Models, *u)
+		report.InputTokens += u.InputTokens
+		report.OutputTokens += u.OutputTokens
+		report.TotalTokens += u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+		report.CostUSD += u.CostUSD
+	}
+	sort.Slice(report.Models, func(i, j int) bool {
+		return report.Models[i].CostUSD > report.Models[j].CostUSD
+	})
+	return report
+}
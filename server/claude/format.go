@@ -0,0 +1,57 @@
+package claude
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Claude Code has written message content in more than one shape over time.
+// These types accept every known shape so a line isn't dropped for using an
+// older or newer one.
+
+// Contents is a message's content blocks. Older transcripts store user
+// messages as a plain string, which is read as a single text block.
+type Contents []ContentBlock
+
+// UnmarshalJSON accepts either an array of blocks or a plain string
+func (c *Contents) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Contents{{Type: "text", Text: text}}
+		return nil
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*c = blocks
+	return nil
+}
+
+// Text is a string that may also be stored as an array of text blocks
+// (e.g. tool results in newer transcripts)
+type Text string
+
+// UnmarshalJSON accepts either a string or an array of {"type": "text"} blocks
+func (t *Text) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = Text(s)
+		return nil
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	var parts []string
+	for _, b := range blocks {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		}
+	}
+	*t = Text(strings.Join(parts, "\n"))
+	return nil
+}
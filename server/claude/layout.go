@@ -0,0 +1,214 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Layout identifies how Claude Code stores the sessions of a project on disk.
+// It has changed across Claude Code versions.
+type Layout string
+
+const (
+	LayoutIndexed     Layout = "indexed"     // sessions-index.json plus <session id>.jsonl transcripts
+	LayoutFlat        Layout = "flat"        // <session id>.jsonl transcripts without an index
+	LayoutNone        Layout = "none"        // Claude hasn't recorded any session for the directory yet
+	LayoutUnsupported Layout = "unsupported" // Something is there, but not in a format we understand
+)
+
+// LayoutInfo describes the detected layout of a project directory
+type LayoutInfo struct {
+	Layout       Layout `json:"layout"`
+	ProjectDir   string `json:"projectDir"`
+	IndexVersion int    `json:"indexVersion,omitempty"`
+	Reason       string `json:"reason,omitempty"` // Why the layout is unsupported
+}
+
+// UnsupportedLayoutError is returned when Claude's on-disk layout can't be read
+type UnsupportedLayoutError struct {
+	Info LayoutInfo
+}
+
+func (e *UnsupportedLayoutError) Error() string {
+	return fmt.Sprintf("unsupported Claude Code layout in %s: %s", e.Info.ProjectDir, e.Info.Reason)
+}
+
+// indexParsers maps the known sessions-index.json versions to their parsers
+var indexParsers = map[int]func(data []byte, projectDir string) ([]SessionEntry, error){
+	1: parseIndexV1,
+}
+
+// DetectLayout inspects the Claude project directory of a working directory
+func DetectLayout(workDir string) LayoutInfo {
+	projectDir := ResolveProjectDir(workDir)
+	info := LayoutInfo{Layout: LayoutNone, ProjectDir: projectDir}
+
+	entries, err := os.ReadDir(projectDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			info.Layout = LayoutUnsupported
+			info.Reason = err.Error()
+		}
+		return info
+	}
+
+	if data, err := os.ReadFile(filepath.Join(projectDir, "sessions-index.json")); err == nil {
+		var header struct {
+			Version int `json:"version"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			info.Layout = LayoutUnsupported
+			info.Reason = "unreadable sessions-index.json: " + err.Error()
+			return info
+		}
+		info.IndexVersion = header.Version
+		if _, ok := indexParsers[header.Version]; !ok {
+			info.Layout = LayoutUnsupported
+			info.Reason = fmt.Sprintf("unknown sessions-index.json version %d", header.Version)
+			return info
+		}
+		info.Layout = LayoutIndexed
+		return info
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jsonl") {
+			info.Layout = LayoutFlat
+			return info
+		}
+	}
+	if len(entries) > 0 {
+		info.Layout = LayoutUnsupported
+		info.Reason = "no sessions-index.json or .jsonl transcripts found"
+	}
+	return info
+}
+
+// ListSessions returns the Claude sessions recorded for a directory, most
+// recently modified first. An unsupported layout yields an UnsupportedLayoutError.
+func ListSessions(workDir string) ([]SessionEntry, LayoutInfo, error) {
+	info := DetectLayout(workDir)
+
+	var entries []SessionEntry
+	var err error
+	switch info.Layout {
+	case LayoutNone:
+		return nil, info, nil
+	case LayoutIndexed:
+		var data []byte
+		data, err = os.ReadFile(filepath.Join(info.ProjectDir, "sessions-index.json"))
+		if err == nil {
+			entries, err = indexParsers[info.IndexVersion](data, info.ProjectDir)
+		}
+	case LayoutFlat:
+		entries, err = scanTranscripts(info.ProjectDir)
+	default:
+		return nil, info, &UnsupportedLayoutError{Info: info}
+	}
+	if err != nil {
+		return nil, info, err
+	}
+
+	// Paths that encode to the same name share a project directory
+	matching := entries[:0]
+	for _, entry := range entries {
+		if entry.ProjectPath == "" || sameDir(entry.ProjectPath, workDir) {
+			matching = append(matching, entry)
+		}
+	}
+	entries = matching
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FileMtime > entries[j].FileMtime
+	})
+	return entries, info, nil
+}
+
+// parseIndexV1 reads a version 1 sessions-index.json
+func parseIndexV1(data []byte, projectDir string) ([]SessionEntry, error) {
+	var index SessionIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	for i := range index.Entries {
+		entry := &index.Entries[i]
+		if entry.FullPath == "" {
+			entry.FullPath = filepath.Join(projectDir, entry.SessionID+".jsonl")
+		}
+		if entry.FileMtime == 0 {
+			if stat, err := os.Stat(entry.FullPath); err == nil {
+				entry.FileMtime = stat.ModTime().UnixMilli()
+			}
+		}
+	}
+	return index.Entries, nil
+}
+
+// scanTranscripts builds session entries from the transcript files themselves
+// (layouts without an index)
+func scanTranscripts(projectDir string) ([]SessionEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(projectDir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []SessionEntry{}
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		entry := SessionEntry{
+			SessionID: strings.TrimSuffix(filepath.Base(path), ".jsonl"),
+			FullPath:  path,
+			FileMtime: stat.ModTime().UnixMilli(),
+			Modified:  stat.ModTime().UTC().Format(time.RFC3339),
+		}
+		summarizeTranscript(path, &entry)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// summarizeTranscript fills index-like fields from the start of a transcript
+func summarizeTranscript(path string, entry *SessionEntry) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 1024*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+
+	for i := 0; i < 50 && scanner.Scan(); i++ {
+		var line TranscriptLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		if entry.Created == "" && line.Timestamp != "" {
+			entry.Created = line.Timestamp
+		}
+		if entry.ProjectPath == "" && line.Cwd != "" {
+			entry.ProjectPath = line.Cwd
+		}
+		if entry.GitBranch == "" && line.GitBranch != "" {
+			entry.GitBranch = line.GitBranch
+		}
+		if entry.FirstPrompt == "" && line.Type == "user" {
+			for _, block := range line.Message.Content {
+				if block.Type == "text" && block.Text != "" {
+					entry.FirstPrompt = block.Text
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MCP server scopes, as in claude mcp add --scope
+const (
+	MCPScopeLocal   = "local"   // ~/.claude.json, for one directory only (Claude's default)
+	MCPScopeProject = "project" // .mcp.json in the directory, shared through the repository
+	MCPScopeUser    = "user"    // ~/.claude.json, for every directory
+)
+
+// mcpScopes are the scopes in the order Claude gives them precedence
+var mcpScopes = []string{MCPScopeLocal, MCPScopeProject, MCPScopeUser}
+
+// validMCPName matches the server names claude mcp add accepts
+var validMCPName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ErrMCPServerNotFound is returned when removing a server no scope has
+var ErrMCPServerNotFound = errors.New("MCP server not found")
+
+// MCPRedacted stands in for env and header values in listed servers, which
+// often hold tokens. Adding a server with it keeps the value the server has.
+const MCPRedacted = "********"
+
+// mcpMu serializes our edits of Claude's config files
+var mcpMu sync.Mutex
+
+// MCPServer is an MCP server Claude starts in a directory
+type MCPServer struct {
+	Name    string            `json:"name"`
+	Scope   string            `json:"scope"`
+	Type    string            `json:"type,omitempty"`    // "stdio" (default), "sse" or "http"
+	Command string            `json:"command,omitempty"` // stdio: program to run
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"` // sse and http: server address
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// mcpEntry is a server as Claude's config files store it, under its name
+type mcpEntry struct {
+	Type    string            `json:"type,omitempty"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// ValidMCPScope reports whether scope is local, project or user
+func ValidMCPScope(scope string) bool {
+	return slices.Contains(mcpScopes, scope)
+}
+
+// Validate checks the name, scope and that the server has what its type needs
+func (s *MCPServer) Validate() error {
+	if !validMCPName.MatchString(s.Name) {
+		return fmt.Errorf("invalid MCP server name %q (letters, digits, - and _)", s.Name)
+	}
+	if !ValidMCPScope(s.Scope) {
+		return fmt.Errorf("unknown scope %q (local, project or user)", s.Scope)
+	}
+	switch s.Type {
+	case "", "stdio":
+		if s.Command == "" {
+			return fmt.Errorf("a stdio server needs a command")
+		}
+	case "sse", "http":
+		if s.URL == "" {
+			return fmt.Errorf("an %s server needs a url", s.Type)
+		}
+	default:
+		return fmt.Errorf("unknown server type %q (stdio, sse or http)", s.Type)
+	}
+	return nil
+}
+
+// claudeConfigPath returns ~/.claude.json, which holds the user and local scopes
+func claudeConfigPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".claude.json")
+}
+
+// ListMCPServers returns the MCP servers Claude would start in workDir, from
+// every scope, sorted by scope precedence and name. Env and header values
+// are redacted.
+func ListMCPServers(workDir string) ([]MCPServer, error) {
+	servers := []MCPServer{}
+	for _, scope := range mcpScopes {
+		entries, err := readMCPScope(workDir, scope)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			e := entries[name]
+			servers = append(servers, MCPServer{
+				Name: name, Scope: scope, Type: e.Type, Command: e.Command, Args: e.Args,
+				Env: redactValues(e.Env), URL: e.URL, Headers: redactValues(e.Headers),
+			})
+		}
+	}
+	return servers, nil
+}
+
+// redactValues returns values with every value replaced by MCPRedacted
+func redactValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(values))
+	for k := range values {
+		redacted[k] = MCPRedacted
+	}
+	return redacted
+}
+
+// unredactValues puts back the current values where values has MCPRedacted
+func unredactValues(values, current map[string]string) map[string]string {
+	for k, v := range values {
+		if v == MCPRedacted {
+			values[k] = current[k]
+		}
+	}
+	return values
+}
+
+// AddMCPServer adds the server to its scope's config for workDir, replacing
+// one of the same name. The change goes through claude mcp (claudeBin), as
+// Claude rewrites ~/.claude.json while it runs and editing the file behind
+// its back could lose either write. Claude picks the server up the next
+// time it starts.
+func AddMCPServer(claudeBin, workDir string, s MCPServer) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	mcpMu.Lock()
+	defer mcpMu.Unlock()
+	entries, err := readMCPScope(workDir, s.Scope)
+	if err != nil {
+		return err
+	}
+	current, exists := entries[s.Name]
+	entry := mcpEntry{
+		Type: s.Type, Command: s.Command, Args: s.Args, URL: s.URL,
+		Env: unredactValues(s.Env, current.Env), Headers: unredactValues(s.Headers, current.Headers),
+	}
+	if entry.Type == "" {
+		entry.Type = "stdio"
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		if err := runClaudeMCP(claudeBin, workDir, "remove", "--scope", s.Scope, s.Name); err != nil {
+			return err
+		}
+	}
+	return runClaudeMCP(claudeBin, workDir, "add-json", "--scope", s.Scope, s.Name, string(data))
+}
+
+// RemoveMCPServer removes the named server from scope, or from every scope
+// that has it when scope is empty, through claude mcp (claudeBin)
+func RemoveMCPServer(claudeBin, workDir, name, scope string) error {
+	scopes := mcpScopes
+	if scope != "" {
+		if !ValidMCPScope(scope) {
+			return fmt.Errorf("unknown scope %q (local, project or user)", scope)
+		}
+		scopes = []string{scope}
+	}
+
+	mcpMu.Lock()
+	defer mcpMu.Unlock()
+	removed := false
+	for _, scope := range scopes {
+		entries, err := readMCPScope(workDir, scope)
+		if err != nil {
+			return err
+		}
+		if _, ok := entries[name]; !ok {
+			continue
+		}
+		if err := runClaudeMCP(claudeBin, workDir, "remove", "--scope", scope, name); err != nil {
+			return err
+		}
+		removed = true
+	}
+	if !removed {
+		return ErrMCPServerNotFound
+	}
+	return nil
+}
+
+// runClaudeMCP runs claude mcp with args in workDir
+func runClaudeMCP(claudeBin, workDir string, args ...string) error {
+	cmd := exec.Command(claudeBin, append([]string{"mcp"}, args...)...)
+	cmd.Dir = workDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("claude mcp %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// readMCPScope returns the servers a scope's config defines for workDir
+func readMCPScope(workDir, scope string) (map[string]mcpEntry, error) {
+	path := claudeConfigPath()
+	if scope == MCPScopeProject {
+		path = filepath.Join(workDir, ".mcp.json")
+	}
+
+	doc := map[string]json.RawMessage{}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &doc); err != nil || doc == nil {
+			return nil, fmt.Errorf("reading %s: not a JSON object", path)
+		}
+	case os.IsNotExist(err):
+	default:
+		return nil, err
+	}
+
+	// Local servers live under projects.<workDir>, the rest at the top level
+	parent := doc
+	if scope == MCPScopeLocal {
+		projects := map[string]json.RawMessage{}
+		if raw, ok := doc["projects"]; ok {
+			if err := json.Unmarshal(raw, &projects); err != nil || projects == nil {
+				return nil, fmt.Errorf("reading %s: projects is not a JSON object", path)
+			}
+		}
+		parent = map[string]json.RawMessage{}
+		if raw, ok := projects[workDir]; ok {
+			if err := json.Unmarshal(raw, &parent); err != nil || parent == nil {
+				return nil, fmt.Errorf("reading %s: project %s is not a JSON object", path, workDir)
+			}
+		}
+	}
+	servers := map[string]json.RawMessage{}
+	if raw, ok := parent["mcpServers"]; ok {
+		if err := json.Unmarshal(raw, &servers); err != nil {
+			return nil, fmt.Errorf("reading %s: mcpServers: %w", path, err)
+		}
+	}
+
+	entries := map[string]mcpEntry{}
+	for name, raw := range servers {
+		var e mcpEntry
+		if json.Unmarshal(raw, &e) == nil {
+			entries[name] = e
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,117 @@
+package claude
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Narration kinds
+const (
+	NarrationUserSaid      = "user_said"
+	NarrationAssistantSaid = "assistant_said"
+	NarrationQuestion      = "question_asked"
+	NarrationToolRan       = "tool_ran"
+	NarrationToolFailed    = "tool_failed"
+)
+
+// maxNarrationText caps quoted text so a long answer doesn't flood a screen reader
+const maxNarrationText = 2000
+
+// Narration is a semantically labeled transcript event with a plain
+// sentence meant for screen readers and text-only clients
+type Narration struct {
+	Kind      string `json:"kind"`
+	Timestamp string `json:"timestamp"`
+	Text      string `json:"text"`
+	Tool      string `json:"tool,omitempty"`
+	Target    string `json:"target,omitempty"`
+}
+
+// Narrate describes a transcript line as zero or more narration events.
+// Thinking, successful tool output and internal messages are left out.
+func Narrate(line TranscriptLine) []Narration {
+	var events []Narration
+	add := func(kind, text string) *Narration {
+		events = append(events, Narration{Kind: kind, Timestamp: line.Timestamp, Text: text})
+		return &events[len(events)-1]
+	}
+
+	switch line.Type {
+	case "user":
+		for _, block := range line.Message.Content {
+			switch block.Type {
+			case "text":
+				text := strings.TrimSpace(block.Text)
+				// Command wrappers and other injected context start with a tag
+				if text == "" || strings.HasPrefix(text, "<") {
+					continue
+				}
+				add(NarrationUserSaid, "You said: "+clip(text))
+			case "tool_result":
+				if block.IsError {
+					add(NarrationToolFailed, "The tool failed: "+clip(firstLine(string(block.Content))))
+				}
+			}
+		}
+
+	case "assistant":
+		for _, block := range line.Message.Content {
+			switch block.Type {
+			case "text":
+				text := strings.TrimSpace(block.Text)
+				if text == "" {
+					continue
+				}
+				if strings.HasSuffix(text, "?") {
+					add(NarrationQuestion, "Claude asks: "+clip(text))
+				} else {
+					add(NarrationAssistantSaid, "Claude said: "+clip(text))
+				}
+			case "tool_use":
+				target := extractToolTarget(block.Name, block.Input)
+				n := add(NarrationToolRan, describeTool(block.Name, target))
+				n.Tool = block.Name
+				n.Target = target
+			}
+		}
+	}
+	return events
+}
+
+// describeTool phrases a tool call as a sentence
+func describeTool(tool, target string) string {
+	verbs := map[string]string{
+		"Read":     "is reading",
+		"Write":    "is writing",
+		"Edit":     "is editing",
+		"Bash":     "is running the command",
+		"Glob":     "is looking for files matching",
+		"Grep":     "is searching for",
+		"Task":     "started a subtask:",
+		"WebFetch": "is fetching",
+	}
+	verb, ok := verbs[tool]
+	if !ok || target == "" {
+		return fmt.Sprintf("Claude is using the %s tool.", tool)
+	}
+	return fmt.Sprintf("Claude %s %s.", verb, target)
+}
+
+// firstLine returns the first non-empty line of text
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// clip shortens text to maxNarrationText runes
+func clip(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxNarrationText {
+		return text
+	}
+	return string(runes[:maxNarrationText]) + "…"
+}
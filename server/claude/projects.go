@@ -0,0 +1,133 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// resolvedDirs caches project directories found by scanning (work dir -> project dir)
+var (
+	resolvedMu   sync.Mutex
+	resolvedDirs = make(map[string]string)
+)
+
+// EncodeProjectPath encodes a working directory the way Claude Code names its
+// project directories: every character other than an ASCII letter or digit
+// becomes "-". Different paths can share an encoding ("/a-b" and "/a/b"), so
+// sessions inside a project directory must still be matched by their cwd.
+func EncodeProjectPath(workDir string) string {
+	var b strings.Builder
+	b.Grow(len(workDir))
+	for _, r := range workDir {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// projectsRoot returns ~/.claude/projects
+func projectsRoot() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".claude", "projects")
+}
+
+// ResolveProjectDir finds the Claude project directory holding the sessions of
+// workDir. It uses the encoded name when that directory exists and otherwise
+// scans all project directories for transcripts recorded in workDir (covering
+// encodings we don't reproduce, such as shortened long paths).
+func ResolveProjectDir(workDir string) string {
+	projectDir := GetClaudeProjectDir(workDir)
+	if _, err := os.Stat(projectDir); err == nil {
+		return projectDir
+	}
+
+	resolvedMu.Lock()
+	cached, ok := resolvedDirs[workDir]
+	resolvedMu.Unlock()
+	if ok {
+		if _, err := os.Stat(cached); err == nil {
+			return cached
+		}
+	}
+
+	dirs, err := os.ReadDir(projectsRoot())
+	if err != nil {
+		return projectDir
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		candidate := filepath.Join(projectsRoot(), dir.Name())
+		if cwd := projectCwd(candidate); cwd != "" && sameDir(cwd, workDir) {
+			resolvedMu.Lock()
+			resolvedDirs[workDir] = candidate
+			resolvedMu.Unlock()
+			return candidate
+		}
+	}
+	return projectDir
+}
+
+// projectCwd returns the cwd recorded by the newest transcript in a project directory
+func projectCwd(projectDir string) string {
+	paths, _ := filepath.Glob(filepath.Join(projectDir, "*.jsonl"))
+	type file struct {
+		path  string
+		mtime int64
+	}
+	files := make([]file, 0, len(paths))
+	for _, path := range paths {
+		if stat, err := os.Stat(path); err == nil {
+			files = append(files, file{path, stat.ModTime().UnixNano()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mtime > files[j].mtime })
+
+	for _, f := range files {
+		if cwd := transcriptCwd(f.path); cwd != "" {
+			return cwd
+		}
+	}
+	return ""
+}
+
+// transcriptCwd returns the first cwd recorded in a transcript
+func transcriptCwd(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024)
+	for i := 0; i < 50 && scanner.Scan(); i++ {
+		var line struct {
+			Cwd string `json:"cwd"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &line) == nil && line.Cwd != "" {
+			return line.Cwd
+		}
+	}
+	return ""
+}
+
+// sameDir reports whether two paths refer to the same directory
+func sameDir(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if a == b {
+		return true
+	}
+	ra, errA := filepath.EvalSymlinks(a)
+	rb, errB := filepath.EvalSymlinks(b)
+	return errA == nil && errB == nil && ra == rb
+}
@@ -0,0 +1,131 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetRadius is how much context is kept on each side of a search match
+const snippetRadius = 60
+
+// SearchMatch is a transcript entry that matched a search
+type SearchMatch struct {
+	UUID      string `json:"uuid"`
+	Timestamp string `json:"timestamp"`
+	Kind      string `json:"kind"`           // "prompt", "text" or "tool"
+	Tool      string `json:"tool,omitempty"` // Tool name for "tool" matches
+	Snippet   string `json:"snippet"`
+}
+
+// SearchTranscript finds user prompts, assistant text and tool commands in a
+// transcript containing query (case-insensitive). At most limit matches are
+// returned (all if limit <= 0).
+func SearchTranscript(path, query string, limit int) ([]SearchMatch, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	needle := strings.ToLower(query)
+	matches := []SearchMatch{}
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 1024*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+
+	for scanner.Scan() {
+		var line TranscriptLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+
+		for _, block := range line.Message.Content {
+			var kind, tool, text string
+			switch {
+			case block.Type == "text" && line.Type == "user":
+				kind, text = "prompt", block.Text
+			case block.Type == "text" && line.Type == "assistant":
+				kind, text = "text", block.Text
+			case block.Type == "tool_use":
+				kind, tool, text = "tool", block.Name, toolCommand(block.Name, block.Input)
+			default:
+				continue
+			}
+
+			snippet, ok := matchSnippet(text, needle)
+			if !ok {
+				continue
+			}
+			matches = append(matches, SearchMatch{
+				UUID:      line.UUID,
+				Timestamp: line.Timestamp,
+				Kind:      kind,
+				Tool:      tool,
+				Snippet:   snippet,
+			})
+			if limit > 0 && len(matches) >= limit {
+				return matches, nil
+			}
+		}
+	}
+	return matches, scanner.Err()
+}
+
+// toolCommand returns the searchable part of a tool call (untruncated)
+func toolCommand(toolName string, input json.RawMessage) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal(input, &data); err != nil {
+		return ""
+	}
+	for _, key := range []string{"command", "file_path", "pattern", "url", "description", "prompt"} {
+		if value, ok := data[key].(string); ok {
+			return value
+		}
+	}
+	return extractToolTarget(toolName, input)
+}
+
+// matchSnippet returns the text around the first occurrence of needle (already lowercased)
+func matchSnippet(text, needle string) (string, bool) {
+	if needle == "" {
+		return "", false
+	}
+	lower := strings.ToLower(text)
+	i := strings.Index(lower, needle)
+	if i < 0 {
+		return "", false
+	}
+	if i > len(text) {
+		// Lowercasing changed byte lengths, so the position is only approximate
+		i = len(text)
+	}
+
+	start := i - snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := i + len(needle) + snippetRadius
+	if end > len(text) {
+		end = len(text)
+	}
+	// Don't cut UTF-8 sequences in half
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	snippet := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet, true
+}
@@ -0,0 +1,49 @@
+package claude
+
+import (
+	"os"
+	"time"
+)
+
+// TranscriptSummary is what claudex derives from a transcript (usage, cost
+// and tool totals), small enough to store instead of re-reading the JSONL
+type TranscriptSummary struct {
+	ClaudeSessionID string        `json:"claude_session_id"`
+	Size            int64         `json:"size"`     // Transcript size when summarized
+	ModTime         time.Time     `json:"mod_time"` // Transcript mtime when summarized
+	ComputedAt      time.Time     `json:"computed_at"`
+	Cost            *CostReport   `json:"cost"`
+	ToolCalls       int           `json:"tool_calls"`
+	Tools           []ToolSummary `json:"tools"`
+}
+
+// ComputeSummary reads a transcript and summarizes it
+func ComputeSummary(claudeSessionID, path string) (*TranscriptSummary, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	cost, err := CostReportForTranscript(path)
+	if err != nil {
+		return nil, err
+	}
+	tools, totals, err := ToolTimeline(path)
+	if err != nil {
+		return nil, err
+	}
+	return &TranscriptSummary{
+		ClaudeSessionID: claudeSessionID,
+		Size:            stat.Size(),
+		ModTime:         stat.ModTime(),
+		ComputedAt:      time.Now(),
+		Cost:            cost,
+		ToolCalls:       len(tools),
+		Tools:           totals,
+	}, nil
+}
+
+// Current reports whether the transcript at path is unchanged since the summary
+func (s *TranscriptSummary) Current(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.Size() == s.Size && stat.ModTime().Equal(s.ModTime)
+}
@@ -0,0 +1,97 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// TailInterval is how often a tailed transcript is checked for new lines
+const TailInterval = 500 * time.Millisecond
+
+// TailTranscript follows a transcript and calls onLine for every complete
+// line, starting with the last backlog lines already in the file. resolve
+// returns the current transcript path; when it changes (Claude started a new
+// session) tailing continues from the beginning of the new file. It returns
+// when stop is closed.
+func TailTranscript(resolve func() (string, error), backlog int, stop <-chan struct{}, onLine func(TranscriptLine)) {
+	var path string
+	var offset int64
+	var partial []byte
+	first := true
+
+	ticker := time.NewTicker(TailInterval)
+	defer ticker.Stop()
+
+	for {
+		if current, err := resolve(); err == nil && current != path {
+			path = current
+			offset = 0
+			partial = nil
+		}
+
+		if path != "" {
+			lines, newOffset, rest := readNewLines(path, offset, partial)
+			offset, partial = newOffset, rest
+			if first && backlog >= 0 && len(lines) > backlog {
+				lines = lines[len(lines)-backlog:]
+			}
+			for _, raw := range lines {
+				var line TranscriptLine
+				if err := json.Unmarshal(raw, &line); err == nil {
+					onLine(line)
+				}
+			}
+			first = false
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readNewLines reads complete lines appended after offset. An incomplete last
+// line is returned as rest and prepended on the next read.
+func readNewLines(path string, offset int64, partial []byte) (lines [][]byte, newOffset int64, rest []byte) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, offset, partial
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, offset, partial
+	}
+	if stat.Size() < offset {
+		// Truncated or replaced: start over
+		offset = 0
+		partial = nil
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, partial
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, offset, partial
+	}
+	newOffset = offset + int64(len(data))
+
+	data = append(partial, data...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimSpace(data[:i]); len(line) > 0 {
+			lines = append(lines, line)
+		}
+		data = data[i+1:]
+	}
+	return lines, newOffset, append([]byte(nil), data...)
+}
@@ -0,0 +1,105 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// ToolSummary aggregates the executions of one tool
+type ToolSummary struct {
+	Name            string `json:"name"`
+	Count           int    `json:"count"`
+	Errors          int    `json:"errors"`
+	TotalDurationMs int64  `json:"totalDurationMs"`
+}
+
+// ToolTimeline lists every tool execution in a transcript in start order,
+// plus per-tool totals sorted by time spent
+func ToolTimeline(path string) ([]ToolInfo, []ToolSummary, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	tools := []ToolInfo{}
+	index := make(map[string]int) // tool_use ID -> position in tools
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 1024*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+
+	for scanner.Scan() {
+		var line TranscriptLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		for _, block := range line.Message.Content {
+			switch block.Type {
+			case "tool_use":
+				if _, seen := index[block.ID]; seen {
+					continue
+				}
+				index[block.ID] = len(tools)
+				tools = append(tools, ToolInfo{
+					ID:        block.ID,
+					Name:      block.Name,
+					Target:    extractToolTarget(block.Name, block.Input),
+					Status:    "running",
+					StartTime: line.Timestamp,
+				})
+
+			case "tool_result":
+				i, ok := index[block.ToolUseID]
+				if !ok {
+					continue
+				}
+				tool := &tools[i]
+				tool.EndTime = line.Timestamp
+				tool.Status = "completed"
+				if block.IsError {
+					tool.Status = "error"
+				}
+				tool.DurationMs = durationMs(tool.StartTime, tool.EndTime)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	byName := make(map[string]*ToolSummary)
+	for _, tool := range tools {
+		s, ok := byName[tool.Name]
+		if !ok {
+			s = &ToolSummary{Name: tool.Name}
+			byName[tool.Name] = s
+		}
+		s.Count++
+		if tool.Status == "error" {
+			s.Errors++
+		}
+		s.TotalDurationMs += tool.DurationMs
+	}
+	summary := make([]ToolSummary, 0, len(byName))
+	for _, s := range byName {
+		summary = append(summary, *s)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].TotalDurationMs > summary[j].TotalDurationMs
+	})
+	return tools, summary, nil
+}
+
+// durationMs returns the milliseconds between two transcript timestamps (0 if unparseable)
+func durationMs(start, end string) int64 {
+	s, err1 := time.Parse(time.RFC3339Nano, start)
+	e, err2 := time.Parse(time.RFC3339Nano, end)
+	if err1 != nil || err2 != nil || e.Before(s) {
+		return 0
+	}
+	return e.Sub(s).Milliseconds()
+}
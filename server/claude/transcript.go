@@ -3,13 +3,41 @@ package claude
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	parseErrorMu      sync.RWMutex
+	parseErrorHandler func(path string, err error)
 )
 
+// SetParseErrorHandler sets a function called when a transcript can't be parsed cleanly
+func SetParseErrorHandler(handler func(path string, err error)) {
+	parseErrorMu.Lock()
+	defer parseErrorMu.Unlock()
+	parseErrorHandler = handler
+}
+
+// reportParseError passes a transcript parse error to the handler, if any
+func reportParseError(path string, err error) {
+	parseErrorMu.RLock()
+	handler := parseErrorHandler
+	parseErrorMu.RUnlock()
+
+	if handler != nil {
+		handler(path, err)
+	}
+}
+
 // SessionIndex represents the sessions-index.json structure
 type SessionIndex struct {
 	Version int            `json:"version"`
@@ -18,43 +46,43 @@ type SessionIndex struct {
 
 // SessionEntry represents a session in the index
 type SessionEntry struct {
-	SessionID   string `json:"sessionId"`
-	FullPath    string `json:"fullPath"`
-	FileMtime   int64  `json:"fileMtime"`
-	FirstPrompt string `json:"firstPrompt"`
-	MessageCount int   `json:"messageCount"`
-	Created     string `json:"created"`
-	Modified    string `json:"modified"`
-	GitBranch   string `json:"gitBranch"`
-	ProjectPath string `json:"projectPath"`
-	IsSidechain bool   `json:"isSidechain"`
+	SessionID    string `json:"sessionId"`
+	FullPath     string `json:"fullPath"`
+	FileMtime    int64  `json:"fileMtime"`
+	FirstPrompt  string `json:"firstPrompt"`
+	MessageCount int    `json:"messageCount"`
+	Created      string `json:"created"`
+	Modified     string `json:"modified"`
+	GitBranch    string `json:"gitBranch"`
+	ProjectPath  string `json:"projectPath"`
+	IsSidechain  bool   `json:"isSidechain"`
 }
 
 // TranscriptLine represents a line in the JSONL transcript
 type TranscriptLine struct {
-	ParentUUID  string          `json:"parentUuid"`
-	IsSidechain bool            `json:"isSidechain"`
-	UserType    string          `json:"userType"`
-	Cwd         string          `json:"cwd"`
-	SessionID   string          `json:"sessionId"`
-	Version     string          `json:"version"`
-	GitBranch   string          `json:"gitBranch"`
-	Slug        string          `json:"slug"`
-	Type        string          `json:"type"` // "assistant" or "user"
-	Message     TranscriptMsg   `json:"message"`
-	UUID        string          `json:"uuid"`
-	Timestamp   string          `json:"timestamp"`
-	ToolResult  *ToolUseResult  `json:"toolUseResult,omitempty"`
+	ParentUUID  string         `json:"parentUuid"`
+	IsSidechain bool           `json:"isSidechain"`
+	UserType    string         `json:"userType"`
+	Cwd         string         `json:"cwd"`
+	SessionID   string         `json:"sessionId"`
+	Version     string         `json:"version"`
+	GitBranch   string         `json:"gitBranch"`
+	Slug        string         `json:"slug"`
+	Type        string         `json:"type"` // "assistant" or "user"
+	Message     TranscriptMsg  `json:"message"`
+	UUID        string         `json:"uuid"`
+	Timestamp   string         `json:"timestamp"`
+	ToolResult  *ToolUseResult `json:"toolUseResult,omitempty"`
 }
 
 // TranscriptMsg represents the message in a transcript line
 type TranscriptMsg struct {
-	Model      string         `json:"model"`
-	ID         string         `json:"id"`
-	Role       string         `json:"role"`
-	Content    []ContentBlock `json:"content"`
-	StopReason *string        `json:"stop_reason"`
-	Usage      *TokenUsage    `json:"usage"`
+	Model      string      `json:"model"`
+	ID         string      `json:"id"`
+	Role       string      `json:"role"`
+	Content    Contents    `json:"content"`
+	StopReason *string     `json:"stop_reason"`
+	Usage      *TokenUsage `json:"usage"`
 }
 
 // ContentBlock represents a content block (tool_use, tool_result, text, thinking)
@@ -64,7 +92,7 @@ type ContentBlock struct {
 	Name      string          `json:"name,omitempty"`
 	Input     json.RawMessage `json:"input,omitempty"`
 	ToolUseID string          `json:"tool_use_id,omitempty"`
-	Content   string          `json:"content,omitempty"`
+	Content   Text            `json:"content,omitempty"`
 	IsError   bool            `json:"is_error,omitempty"`
 	Text      string          `json:"text,omitempty"`
 	Thinking  string          `json:"thinking,omitempty"`
@@ -88,67 +116,156 @@ type TokenUsage struct {
 
 // ClaudeState represents the current state of a Claude Code session
 type ClaudeState struct {
-	Status         string       `json:"status"` // "idle", "thinking", "executing", "waiting_input"
-	CurrentTool    string       `json:"currentTool,omitempty"`
-	ToolTarget     string       `json:"toolTarget,omitempty"`
-	LastActivity   string       `json:"lastActivity,omitempty"`
-	Cwd            string       `json:"cwd,omitempty"`
-	GitBranch      string       `json:"gitBranch,omitempty"`
-	Model          string       `json:"model,omitempty"`
-	TokensUsed     int          `json:"tokensUsed,omitempty"`
-	SessionID      string       `json:"sessionId,omitempty"`
-	PendingTools   []ToolInfo   `json:"pendingTools,omitempty"`
-	RecentTools    []ToolInfo   `json:"recentTools,omitempty"`
+	Status        string        `json:"status"`           // "idle", "thinking", "executing", "waiting_input", "unsupported"
+	Layout        Layout        `json:"layout,omitempty"` // Set when the on-disk layout is unsupported
+	Error         string        `json:"error,omitempty"`
+	CurrentTool   string        `json:"currentTool,omitempty"`
+	ToolTarget    string        `json:"toolTarget,omitempty"`
+	LastActivity  string        `json:"lastActivity,omitempty"`
+	Cwd           string        `json:"cwd,omitempty"`
+	GitBranch     string        `json:"gitBranch,omitempty"`
+	Model         string        `json:"model,omitempty"`
+	TokensUsed    int           `json:"tokensUsed,omitempty"`
+	SessionID     string        `json:"sessionId,omitempty"`
+	PendingTools  []ToolInfo    `json:"pendingTools,omitempty"`
+	RecentTools   []ToolInfo    `json:"recentTools,omitempty"`
+	AskedQuestion bool          `json:"askedQuestion,omitempty"` // Waiting on a reply that ends with a question
+	Context       *ContextUsage `json:"context,omitempty"`       // Context window use on the latest reply
 }
 
 // ToolInfo represents info about a tool use
 type ToolInfo struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Target    string `json:"target,omitempty"`
-	Status    string `json:"status"` // "running", "completed", "error"
-	StartTime string `json:"startTime,omitempty"`
-	EndTime   string `json:"endTime,omitempty"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Target     string `json:"target,omitempty"`
+	Status     string `json:"status"` // "running", "completed", "error"
+	StartTime  string `json:"startTime,omitempty"`
+	EndTime    string `json:"endTime,omitempty"`
+	DurationMs int64  `json:"durationMs,omitempty"`
 }
 
-// GetClaudeProjectDir returns the encoded directory path for a given working directory
+// GetClaudeProjectDir returns the encoded directory path for a given working directory.
+// Use ResolveProjectDir to find where existing sessions actually live.
 func GetClaudeProjectDir(workDir string) string {
-	// Claude Code encodes paths by replacing / with -
-	encoded := strings.ReplaceAll(workDir, "/", "-")
-	homeDir, _ := os.UserHomeDir()
-	return filepath.Join(homeDir, ".claude", "projects", encoded)
+	return filepath.Join(projectsRoot(), EncodeProjectPath(workDir))
 }
 
 // FindActiveSession finds the most recently modified session for a directory
 func FindActiveSession(workDir string) (*SessionEntry, error) {
-	projectDir := GetClaudeProjectDir(workDir)
-	indexPath := filepath.Join(projectDir, "sessions-index.json")
-
-	data, err := os.ReadFile(indexPath)
+	entries, _, err := ListSessions(workDir)
 	if err != nil {
 		return nil, err
 	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
 
-	var index SessionIndex
-	if err := json.Unmarshal(data, &index); err != nil {
-		return nil, err
+// ErrInvalidSessionID is returned for a Claude session ID that isn't a UUID
+var ErrInvalidSessionID = errors.New("invalid Claude session ID")
+
+// ValidSessionID reports whether id is a Claude session ID: a UUID, so it
+// can't name a file outside the project directory
+func ValidSessionID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36 && id == filepath.Base(id)
+}
+
+// FindTranscript returns the transcript path of a Claude Code session in a
+// directory. With an empty sessionID the most recently active session is used.
+func FindTranscript(workDir, sessionID string) (string, error) {
+	if sessionID != "" && !ValidSessionID(sessionID) {
+		return "", ErrInvalidSessionID
+	}
+	if sessionID == "" {
+		entry, err := FindActiveSession(workDir)
+		if err != nil {
+			return "", err
+		}
+		if entry == nil {
+			return "", os.ErrNotExist
+		}
+		return entry.FullPath, nil
 	}
 
-	if len(index.Entries) == 0 {
-		return nil, nil
+	// Transcripts are stored as <project dir>/<session id>.jsonl
+	path := filepath.Join(ResolveProjectDir(workDir), sessionID+".jsonl")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
 	}
 
-	// Sort by modified time (most recent first)
-	sort.Slice(index.Entries, func(i, j int) bool {
-		return index.Entries[i].FileMtime > index.Entries[j].FileMtime
-	})
+	// Fall back to the index in case the file lives elsewhere
+	entries, _, err := ListSessions(workDir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.SessionID == sessionID {
+			return entry.FullPath, nil
+		}
+	}
+	return "", os.ErrNotExist
+}
 
-	return &index.Entries[0], nil
+// InstallTranscript copies a transcript into the Claude project directory of
+// workDir so the session can be resumed there. If sessionID is empty it is read
+// from the transcript. An existing transcript with the same ID is left alone.
+// It returns the Claude session ID.
+func InstallTranscript(workDir, sessionID string, r io.ReadSeeker) (string, error) {
+	if sessionID == "" {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 1024*1024), 10*1024*1024)
+		for scanner.Scan() && sessionID == "" {
+			var line TranscriptLine
+			if json.Unmarshal(scanner.Bytes(), &line) == nil {
+				sessionID = line.SessionID
+			}
+		}
+		if sessionID == "" {
+			return "", fmt.Errorf("transcript has no session ID")
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	if !ValidSessionID(sessionID) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSessionID, sessionID)
+	}
+
+	projectDir := GetClaudeProjectDir(workDir)
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(projectDir, sessionID+".jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return sessionID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return sessionID, nil
 }
 
 // GetClaudeState reads the transcript and determines current state
 func GetClaudeState(workDir string) (*ClaudeState, error) {
 	session, err := FindActiveSession(workDir)
+	var unsupported *UnsupportedLayoutError
+	if errors.As(err, &unsupported) {
+		// Make it visible instead of reporting an idle session
+		return &ClaudeState{
+			Status: "unsupported",
+			Layout: unsupported.Info.Layout,
+			Error:  unsupported.Info.Reason,
+		}, nil
+	}
 	if err != nil || session == nil {
 		return &ClaudeState{Status: "idle"}, nil
 	}
@@ -165,8 +282,53 @@ func GetClaudeState(workDir string) (*ClaudeState, error) {
 	return state, nil
 }
 
-// parseTranscript reads and parses a JSONL transcript file
+// transcriptCacheEntry is the state read from a transcript at a given size
+// and mtime
+type transcriptCacheEntry struct {
+	size    int64
+	modTime time.Time
+	state   *ClaudeState
+}
+
+var (
+	transcriptCacheMu sync.Mutex
+	transcriptCache   = make(map[string]transcriptCacheEntry)
+)
+
+// parseTranscript returns the state of a JSONL transcript file, reading it
+// again only when it changed
 func parseTranscript(path string) (*ClaudeState, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	transcriptCacheMu.Lock()
+	cached, ok := transcriptCache[path]
+	transcriptCacheMu.Unlock()
+	if !ok || cached.size != stat.Size() || !cached.modTime.Equal(stat.ModTime()) {
+		state, err := readTranscript(path)
+		if err != nil {
+			return nil, err
+		}
+		cached = transcriptCacheEntry{size: stat.Size(), modTime: stat.ModTime(), state: state}
+		transcriptCacheMu.Lock()
+		transcriptCache[path] = cached
+		transcriptCacheMu.Unlock()
+	}
+
+	state := *cached.state
+	// Check if session is stale (no activity in last 5 minutes)
+	if state.LastActivity != "" {
+		lastTime, err := time.Parse(time.RFC3339, state.LastActivity)
+		if err == nil && time.Since(lastTime) > 5*time.Minute {
+			state.Status = "idle"
+		}
+	}
+	return &state, nil
+}
+
+// readTranscript reads and parses a JSONL transcript file
+func readTranscript(path string) (*ClaudeState, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -190,13 +352,18 @@ func parseTranscript(path string) (*ClaudeState, error) {
 	buf := make([]byte, 0, 1024*1024)
 	scanner.Buffer(buf, 10*1024*1024)
 
+	var malformed int
+	var lastMalformed bool
 	for scanner.Scan() {
 		var line TranscriptLine
 		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			malformed++
+			lastMalformed = true
 			continue
 		}
 
 		lastLine = line
+		lastMalformed = false
 
 		// Update cwd and model from any line
 		if line.Cwd != "" {
@@ -209,6 +376,12 @@ func parseTranscript(path string) (*ClaudeState, error) {
 		// Track token usage
 		if line.Message.Usage != nil {
 			totalTokens += line.Message.Usage.InputTokens + line.Message.Usage.OutputTokens
+			// Subagents and replies Claude Code makes up have their own context
+			if line.Type == "assistant" && !line.IsSidechain && line.Message.Model != "<synthetic>" {
+				if usage := contextUsage(line.Message.Model, line.Message.Usage); usage != nil {
+					state.Context = usage
+				}
+			}
 		}
 
 		// Process content blocks
@@ -240,6 +413,16 @@ func parseTranscript(path string) (*ClaudeState, error) {
 		}
 	}
 
+	// The last line may still be being written by Claude
+	if lastMalformed {
+		malformed--
+	}
+	if err := scanner.Err(); err != nil {
+		reportParseError(path, err)
+	} else if malformed > 0 {
+		reportParseError(path, fmt.Errorf("%d malformed line(s)", malformed))
+	}
+
 	state.TokensUsed = totalTokens
 	state.LastActivity = lastLine.Timestamp
 
@@ -271,6 +454,7 @@ func parseTranscript(path string) (*ClaudeState, error) {
 			// Check stop_reason
 			if lastLine.Message.StopReason != nil && *lastLine.Message.StopReason == "end_turn" {
 				state.Status = "waiting_input"
+				state.AskedQuestion = endsWithQuestion(lastLine.Message.Content)
 			} else {
 				state.Status = "thinking"
 			}
@@ -280,15 +464,17 @@ func parseTranscript(path string) (*ClaudeState, error) {
 		state.Status = "thinking"
 	}
 
-	// Check if session is stale (no activity in last 5 minutes)
-	if state.LastActivity != "" {
-		lastTime, err := time.Parse(time.RFC3339, state.LastActivity)
-		if err == nil && time.Since(lastTime) > 5*time.Minute {
-			state.Status = "idle"
+	return state, nil
+}
+
+// endsWithQuestion reports whether the last text block of a message is a question
+func endsWithQuestion(content Contents) bool {
+	for i := len(content) - 1; i >= 0; i-- {
+		if content[i].Type == "text" {
+			return strings.HasSuffix(strings.TrimSpace(content[i].Text), "?")
 		}
 	}
-
-	return state, nil
+	return false
 }
 
 // extractToolTarget extracts a meaningful target from tool input
@@ -0,0 +1,225 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	sessionA = "0b6f7c1e-1d2a-4c3b-9e8f-1a2b3c4d5e6f"
+	sessionB = "7d9e0f1a-2b3c-4d5e-8f9a-0b1c2d3e4f5a"
+)
+
+// fixture is a fake home directory with a working directory whose Claude
+// sessions are written by the test
+type fixture struct {
+	t       *testing.T
+	home    string
+	workDir string
+}
+
+func newFixture(t *testing.T) *fixture {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	workDir := filepath.Join(home, "src", "app")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{t: t, home: home, workDir: workDir}
+}
+
+// projectDir returns the project directory Claude uses for the working directory
+func (f *fixture) projectDir() string {
+	return filepath.Join(f.home, ".claude", "projects", EncodeProjectPath(f.workDir))
+}
+
+// writeFile writes a file under the project directory (or dir, if set) and
+// sets its mtime to age ago
+func (f *fixture) writeFile(dir, name, content string, age time.Duration) string {
+	f.t.Helper()
+	if dir == "" {
+		dir = f.projectDir()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		f.t.Fatal(err)
+	}
+	return path
+}
+
+// transcript writes the transcript of a session recorded in cwd
+func (f *fixture) transcript(dir, sessionID, cwd string, age time.Duration) string {
+	f.t.Helper()
+	line, _ := json.Marshal(map[string]any{
+		"type":      "user",
+		"sessionId": sessionID,
+		"cwd":       cwd,
+		"gitBranch": "main",
+		"timestamp": time.Now().Add(-age).UTC().Format(time.RFC3339),
+		"message":   map[string]any{"role": "user", "content": []map[string]string{{"type": "text", "text": "hello"}}},
+	})
+	return f.writeFile(dir, sessionID+".jsonl", string(line)+"\n", age)
+}
+
+func TestDetectLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		layout Layout
+		reason string
+	}{
+		{"no project directory", nil, LayoutNone, ""},
+		{"empty project directory", map[string]string{}, LayoutNone, ""},
+		{"flat", map[string]string{sessionA + ".jsonl": "{}\n"}, LayoutFlat, ""},
+		{"indexed", map[string]string{"sessions-index.json": `{"version":1,"entries":[]}`}, LayoutIndexed, ""},
+		{"unknown index version", map[string]string{"sessions-index.json": `{"version":7}`}, LayoutUnsupported, "unknown sessions-index.json version 7"},
+		{"unreadable index", map[string]string{"sessions-index.json": `{`}, LayoutUnsupported, "unreadable sessions-index.json: unexpected end of JSON input"},
+		{"no transcripts", map[string]string{"notes.txt": "x"}, LayoutUnsupported, "no sessions-index.json or .jsonl transcripts found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			if tt.files != nil {
+				os.MkdirAll(f.projectDir(), 0755)
+			}
+			for name, content := range tt.files {
+				f.writeFile("", name, content, 0)
+			}
+			info := DetectLayout(f.workDir)
+			if info.Layout != tt.layout || info.Reason != tt.reason {
+				t.Errorf("layout = %q (%q), want %q (%q)", info.Layout, info.Reason, tt.layout, tt.reason)
+			}
+			if info.ProjectDir != f.projectDir() {
+				t.Errorf("project dir = %q, want %q", info.ProjectDir, f.projectDir())
+			}
+		})
+	}
+}
+
+func TestFindActiveSession(t *testing.T) {
+	t.Run("no sessions", func(t *testing.T) {
+		f := newFixture(t)
+		entry, err := FindActiveSession(f.workDir)
+		if entry != nil || err != nil {
+			t.Errorf("got %+v, %v; want nil, nil", entry, err)
+		}
+	})
+
+	t.Run("newest flat transcript", func(t *testing.T) {
+		f := newFixture(t)
+		f.transcript("", sessionA, f.workDir, time.Hour)
+		f.transcript("", sessionB, f.workDir, time.Minute)
+		entry, err := FindActiveSession(f.workDir)
+		if err != nil || entry == nil {
+			t.Fatalf("got %+v, %v", entry, err)
+		}
+		if entry.SessionID != sessionB || entry.GitBranch != "main" || entry.FirstPrompt != "hello" {
+			t.Errorf("entry = %+v, want %s on main starting with hello", entry, sessionB)
+		}
+	})
+
+	t.Run("transcripts of another directory with the same encoding", func(t *testing.T) {
+		f := newFixture(t)
+		f.transcript("", sessionA, f.workDir, time.Hour)
+		f.transcript("", sessionB, f.workDir+"-other", time.Minute)
+		entry, err := FindActiveSession(f.workDir)
+		if err != nil || entry == nil || entry.SessionID != sessionA {
+			t.Errorf("got %+v, %v; want %s", entry, err, sessionA)
+		}
+	})
+
+	t.Run("newest indexed session", func(t *testing.T) {
+		f := newFixture(t)
+		pathA := f.transcript("", sessionA, f.workDir, time.Minute)
+		pathB := f.transcript("", sessionB, f.workDir, time.Hour)
+		index, _ := json.Marshal(map[string]any{
+			"version": 1,
+			"entries": []map[string]any{
+				{"sessionId": sessionA, "fullPath": pathA, "fileMtime": 1000, "projectPath": f.workDir},
+				{"sessionId": sessionB, "fullPath": pathB, "fileMtime": 2000, "projectPath": f.workDir},
+			},
+		})
+		f.writeFile("", "sessions-index.json", string(index), 0)
+		entry, err := FindActiveSession(f.workDir)
+		if err != nil || entry == nil || entry.SessionID != sessionB {
+			t.Errorf("got %+v, %v; want %s, newest by the index", entry, err, sessionB)
+		}
+	})
+
+	t.Run("unsupported layout", func(t *testing.T) {
+		f := newFixture(t)
+		f.writeFile("", "sessions-index.json", `{"version":2}`, 0)
+		_, err := FindActiveSession(f.workDir)
+		var unsupported *UnsupportedLayoutError
+		if !errors.As(err, &unsupported) || unsupported.Info.IndexVersion != 2 {
+			t.Errorf("err = %v, want an UnsupportedLayoutError for version 2", err)
+		}
+	})
+}
+
+func TestFindTranscript(t *testing.T) {
+	f := newFixture(t)
+	pathA := f.transcript("", sessionA, f.workDir, time.Hour)
+	pathB := f.transcript("", sessionB, f.workDir, time.Minute)
+
+	tests := []struct {
+		name      string
+		sessionID string
+		path      string
+		err       error
+	}{
+		{"by ID", sessionA, pathA, nil},
+		{"most recent", "", pathB, nil},
+		{"unknown ID", "1e2d3c4b-5a69-4788-9faa-bbccddeeff00", "", os.ErrNotExist},
+		{"path", "../../" + sessionA, "", ErrInvalidSessionID},
+		{"not a UUID", "notes", "", ErrInvalidSessionID},
+		{"braced UUID", "{" + sessionA + "}", "", ErrInvalidSessionID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := FindTranscript(f.workDir, tt.sessionID)
+			if path != tt.path || !errors.Is(err, tt.err) {
+				t.Errorf("got %q, %v; want %q, %v", path, err, tt.path, tt.err)
+			}
+		})
+	}
+}
+
+func TestFindTranscriptElsewhere(t *testing.T) {
+	t.Run("listed in the index", func(t *testing.T) {
+		f := newFixture(t)
+		elsewhere := f.transcript(filepath.Join(f.home, "archive"), sessionA, f.workDir, time.Minute)
+		index, _ := json.Marshal(map[string]any{
+			"version": 1,
+			"entries": []map[string]any{{"sessionId": sessionA, "fullPath": elsewhere, "fileMtime": 1000}},
+		})
+		f.writeFile("", "sessions-index.json", string(index), 0)
+		if path, err := FindTranscript(f.workDir, sessionA); path != elsewhere || err != nil {
+			t.Errorf("got %q, %v; want %q", path, err, elsewhere)
+		}
+	})
+
+	t.Run("project directory under another name", func(t *testing.T) {
+		f := newFixture(t)
+		// Claude shortens long paths, so the directory isn't always the encoded one
+		dir := filepath.Join(f.home, ".claude", "projects", "-shortened-app")
+		path := f.transcript(dir, sessionA, f.workDir, time.Minute)
+		if got, err := FindTranscript(f.workDir, sessionA); got != path || err != nil {
+			t.Errorf("got %q, %v; want %q", got, err, path)
+		}
+		if info := DetectLayout(f.workDir); info.Layout != LayoutFlat || info.ProjectDir != dir {
+			t.Errorf("layout = %q in %q, want %q in %q", info.Layout, info.ProjectDir, LayoutFlat, dir)
+		}
+	})
+}
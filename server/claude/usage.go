@@ -0,0 +1,182 @@
+package claude
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DayUsage is the usage of a transcript on one day
+type DayUsage struct {
+	Day          string         `json:"day,omitempty"` // YYYY-MM-DD in UTC
+	Messages     int            `json:"messages"`
+	InputTokens  int            `json:"input_tokens"`
+	OutputTokens int            `json:"output_tokens"`
+	TotalTokens  int            `json:"total_tokens"` // Including cache reads and writes
+	CostUSD      float64        `json:"cost_usd"`
+	ToolCalls    int            `json:"tool_calls"`
+	Tools        map[string]int `json:"tools"` // Calls per tool
+}
+
+// Add accumulates another day's usage into u
+func (u *DayUsage) Add(o DayUsage) {
+	u.Messages += o.Messages
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.TotalTokens += o.TotalTokens
+	u.CostUSD += o.CostUSD
+	u.ToolCalls += o.ToolCalls
+	if u.Tools == nil {
+		u.Tools = make(map[string]int)
+	}
+	for name, n := range o.Tools {
+		u.Tools[name] += n
+	}
+}
+
+// dailyCache holds daily usage per transcript until the file changes
+var (
+	dailyCacheMu sync.Mutex
+	dailyCache   = make(map[string]dailyCacheEntry)
+)
+
+type dailyCacheEntry struct {
+	size    int64
+	modTime time.Time
+	days    []DayUsage
+}
+
+// DailyUsage breaks a transcript's usage down by day, oldest first. Results
+// are cached until the file changes.
+func DailyUsage(path string) ([]DayUsage, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyCacheMu.Lock()
+	cached, ok := dailyCache[path]
+	dailyCacheMu.Unlock()
+	if ok && cached.size == stat.Size() && cached.modTime.Equal(stat.ModTime()) {
+		return cached.days, nil
+	}
+
+	days, err := buildDailyUsage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dailyCacheMu.Lock()
+	dailyCache[path] = dailyCacheEntry{size: stat.Size(), modTime: stat.ModTime(), days: days}
+	dailyCacheMu.Unlock()
+	return days, nil
+}
+
+// buildDailyUsage reads a transcript and sums usage and tool calls per day
+func buildDailyUsage(path string) ([]DayUsage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// As for cost reports, a message's usage is repeated on each of its
+	// lines and counted once, on the day the message started
+	type message struct {
+		day   string
+		model string
+		usage TokenUsage
+	}
+	messages := make(map[string]message)
+	var order []string
+	byDay := make(map[string]*DayUsage)
+	day := func(name string) *DayUsage {
+		u, ok := byDay[name]
+		if !ok {
+			u = &DayUsage{Day: name, Tools: make(map[string]int)}
+			byDay[name] = u
+		}
+		return u
+	}
+	toolSeen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 1024*1024)
+	scanner.Buffer(buf, 10*1024*1024)
+
+	for scanner.Scan() {
+		var line TranscriptLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, line.Timestamp)
+		if err != nil || line.Type != "assistant" {
+			continue
+		}
+		name := t.UTC().Format(time.DateOnly)
+
+		for _, block := range line.Message.Content {
+			if block.Type == "tool_use" && !toolSeen[block.ID] {
+				toolSeen[block.ID] = true
+				u := day(name)
+				u.ToolCalls++
+				u.Tools[block.Name]++
+			}
+		}
+
+		if line.Message.Usage == nil {
+			continue
+		}
+		id := line.Message.ID
+		if id == "" {
+			id = line.UUID
+		}
+		msg, seen := messages[id]
+		if !seen {
+			order = append(order, id)
+			msg.day = name
+		}
+		msg.model = line.Message.Model
+		msg.usage = *line.Message.Usage
+		messages[id] = msg
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Price each day's messages per model
+	models := make(map[string]map[string]*ModelUsage) // day -> model -> usage
+	for _, id := range order {
+		msg := messages[id]
+		if models[msg.day] == nil {
+			models[msg.day] = make(map[string]*ModelUsage)
+		}
+		m, ok := models[msg.day][msg.model]
+		if !ok {
+			m = &ModelUsage{Model: msg.model}
+			models[msg.day][msg.model] = m
+		}
+		m.add(&msg.usage)
+	}
+	for name, byModel := range models {
+		u := day(name)
+		for _, m := range byModel {
+			m.price()
+			u.Messages += m.Messages
+			u.InputTokens += m.InputTokens
+			u.OutputTokens += m.OutputTokens
+			u.TotalTokens += m.InputTokens + m.OutputTokens + m.CacheCreationInputTokens + m.CacheReadInputTokens
+			u.CostUSD += m.CostUSD
+		}
+	}
+
+	days := make([]DayUsage, 0, len(byDay))
+	for _, u := range byDay {
+		days = append(days, *u)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days, nil
+}
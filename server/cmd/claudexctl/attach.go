@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+
+	"claudex/session"
+	"claudex/ws"
+)
+
+// detachKey ends an attach without touching the session (Ctrl-], as telnet)
+const detachKey = 0x1d
+
+// runAttach connects this terminal to a session: keystrokes go to the
+// session raw, its output comes back, and window size changes follow along.
+// A stopped session is started first.
+func runAttach(c *client, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: claudexctl attach <id>")
+	}
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return errors.New("attach needs a terminal")
+	}
+	sess, err := c.find(args[0])
+	if err != nil {
+		return err
+	}
+	wc, err := c.connect(false)
+	if err != nil {
+		return err
+	}
+	defer wc.Close()
+
+	cols, rows, err := term.GetSize(out)
+	if err != nil {
+		return err
+	}
+	size := ws.ResizeData{Rows: uint16(rows), Cols: uint16(cols)}
+	if sess.Status == session.StatusStopped || sess.Status == session.StatusError {
+		err = wc.send("start", sess.ID, ws.StartData{Rows: size.Rows, Cols: size.Cols}) // Subscribes too
+	} else if err = wc.send("subscribe", sess.ID, nil); err == nil {
+		err = wc.send("resize", sess.ID, size)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Attached to %s (%s). Press Ctrl-] to detach.\r\n", sess.Name, sess.ID)
+	saved, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, saved)
+
+	go forwardResizes(wc, sess.ID, out)
+	detached := make(chan struct{})
+	go forwardInput(wc, sess.ID, detached)
+
+	ended := make(chan error, 1)
+	go func() { ended <- printOutput(wc, sess.ID) }()
+	select {
+	case <-detached:
+		fmt.Fprintf(os.Stderr, "\r\nDetached from %s\r\n", sess.Name)
+		return nil
+	case err := <-ended:
+		return err
+	}
+}
+
+// forwardInput sends keystrokes to the session until the detach key
+func forwardInput(wc *wsConn, sessionID string, detached chan<- struct{}) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(detached)
+			return
+		}
+		chunk := buf[:n]
+		i := bytes.IndexByte(chunk, detachKey)
+		if i >= 0 {
+			chunk = chunk[:i]
+		}
+		if len(chunk) > 0 {
+			wc.send("input", sessionID, string(chunk))
+		}
+		if i >= 0 {
+			close(detached)
+			return
+		}
+	}
+}
+
+// printOutput writes the session's output to the terminal until the session
+// stops or the connection drops
+func printOutput(wc *wsConn, sessionID string) error {
+	for {
+		msgType, raw, err := wc.receive()
+		if err != nil {
+			return fmt.Errorf("connection closed: %w", err)
+		}
+		switch msgType {
+		case "output":
+			var msg ws.OutputMessage
+			if json.Unmarshal(raw, &msg) != nil || msg.SessionID != sessionID {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(msg.Data)
+			if err == nil {
+				os.Stdout.Write(data)
+			}
+
+		case "screen":
+			// The rendered screen a new subscriber starts from
+			var msg ws.ScreenMessage
+			if json.Unmarshal(raw, &msg) != nil || msg.SessionID != sessionID {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(msg.Data)
+			if err == nil {
+				os.Stdout.Write(data)
+			}
+
+		case "status":
+			var msg ws.StatusMessage
+			if json.Unmarshal(raw, &msg) != nil || msg.SessionID != sessionID {
+				continue
+			}
+			switch msg.Status {
+			case session.StatusStopped:
+				fmt.Fprintf(os.Stderr, "\r\n[session stopped]\r\n")
+				return nil
+			case session.StatusError:
+				return fmt.Errorf("session failed: %s", msg.Reason)
+			}
+
+		case "control":
+			var msg ws.ControlMessage
+			if json.Unmarshal(raw, &msg) == nil && msg.SessionID == sessionID && msg.Event == ws.ControlDenied {
+				fmt.Fprintf(os.Stderr, "\r\n[input ignored: connection %s has control]\r\n", msg.Holder)
+			}
+
+		case "quota_exceeded":
+			return errors.New("session quota exceeded, cannot start")
+		}
+	}
+}
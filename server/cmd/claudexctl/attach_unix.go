@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+
+	"claudex/ws"
+)
+
+// forwardResizes reports the terminal's new size whenever the window changes
+func forwardResizes(wc *wsConn, sessionID string, fd int) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	for range winch {
+		if cols, rows, err := term.GetSize(fd); err == nil {
+			wc.send("resize", sessionID, ws.ResizeData{Rows: uint16(rows), Cols: uint16(cols)})
+		}
+	}
+}
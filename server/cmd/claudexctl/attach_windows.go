@@ -0,0 +1,5 @@
+package main
+
+// forwardResizes does nothing: Windows consoles don't signal size changes,
+// so the session keeps the size the attach started with
+func forwardResizes(wc *wsConn, sessionID string, fd int) {}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"claudex/session"
+	"claudex/ws"
+)
+
+// client talks to one claudex server over HTTP or a Unix socket
+type client struct {
+	base   *url.URL // Server URL, e.g. http://localhost:9090
+	socket string   // Unix socket to dial instead of the URL's host ("" for TCP)
+	header http.Header
+	http   *http.Client
+}
+
+func newClient(server, socket, user, token, adminToken string) (*client, error) {
+	base, err := url.Parse(server)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid server URL %q", server)
+	}
+	c := &client{base: base, socket: socket, header: http.Header{}, http: &http.Client{}}
+	if user != "" {
+		c.header.Set(ws.UserHeader, user)
+	}
+	if token != "" {
+		c.header.Set(session.UserTokenHeader, token)
+	}
+	if adminToken != "" {
+		c.header.Set(session.AdminHeader, adminToken)
+	}
+	if socket != "" {
+		c.http.Transport = &http.Transport{DialContext: c.dial}
+	}
+	return c, nil
+}
+
+// dial connects to the Unix socket, whatever address was asked for
+func (c *client) dial(ctx context.Context, _, _ string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", c.socket)
+}
+
+// sessionEntry is the part of a session the commands show
+type sessionEntry struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Status    session.Status `json:"status"`
+	Directory string         `json:"directory"`
+	Branch    string         `json:"branch,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+}
+
+// do sends a REST request below /api/v1 and decodes the JSON response into
+// out (if not nil). Error responses become errors with the server's message.
+func (c *client) do(method, path string, query url.Values, body, out any) error {
+	u := c.base.JoinPath(ws.APIPrefix, path)
+	u.RawQuery = query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header = c.header.Clone()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// sessions lists every session
+func (c *client) sessions() ([]sessionEntry, error) {
+	var list []sessionEntry
+	err := c.do(http.MethodGet, "/sessions", nil, nil, &list)
+	return list, err
+}
+
+// find resolves a session ID or unique ID prefix
+func (c *client) find(id string) (sessionEntry, error) {
+	list, err := c.sessions()
+	if err != nil {
+		return sessionEntry{}, err
+	}
+	var matches []sessionEntry
+	for _, s := range list {
+		if s.ID == id {
+			return s, nil
+		}
+		if strings.HasPrefix(s.ID, id) {
+			matches = append(matches, s)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return sessionEntry{}, fmt.Errorf("no session %q", id)
+	case 1:
+		return matches[0], nil
+	}
+	return sessionEntry{}, fmt.Errorf("%q matches %d sessions", id, len(matches))
+}
+
+// connect opens the WebSocket and exchanges hello messages. Status-only
+// connections get every session's status but no terminal output.
+func (c *client) connect(statusOnly bool) (*wsConn, error) {
+	u := *c.base
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u = *u.JoinPath("/ws")
+	if statusOnly {
+		u.RawQuery = "mode=status"
+	}
+
+	dialer := *websocket.DefaultDialer
+	if c.socket != "" {
+		dialer.NetDialContext = c.dial
+	}
+	conn, resp, err := dialer.Dial(u.String(), c.header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("connect %s: %s", u.String(), resp.Status)
+		}
+		return nil, fmt.Errorf("connect %s: %w", u.String(), err)
+	}
+	wc := &wsConn{conn: conn}
+	if err := wc.send("hello", "", ws.HelloData{Versions: []int{ws.ProtocolVersion}}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return wc, nil
+}
+
+// wsConn is a WebSocket connection safe for concurrent sends
+type wsConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+// send writes a client message with an optional data body
+func (wc *wsConn) send(msgType, sessionID string, data any) error {
+	msg := ws.Message{Type: msgType, SessionID: sessionID}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		msg.Data = raw
+	}
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	return wc.conn.WriteJSON(msg)
+}
+
+// receive reads the next server message, keeping the raw bytes for callers
+// that decode it into a specific type
+func (wc *wsConn) receive() (msgType string, raw []byte, err error) {
+	_, raw, err = wc.conn.ReadMessage()
+	if err != nil {
+		return "", nil, err
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(raw, &head)
+	return head.Type, raw, nil
+}
+
+func (wc *wsConn) Close() error {
+	return wc.conn.Close()
+}
@@ -0,0 +1,77 @@
+// Command claudexctl drives a claudex server from the command line: list and
+// create sessions, attach a terminal to one, stop it, and follow status
+// changes. It talks to the same REST and WebSocket API as the web frontend.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// commands maps each subcommand to its implementation and a one-line summary
+var commands = []struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *client, args []string) error
+}{
+	{"list", "[-status S] [-tag T] [-json]", "List sessions", runList},
+	{"create", "-dir DIR [-name NAME] [-cmd COMMAND] [-start]", "Create a session", runCreate},
+	{"attach", "<id>", "Attach this terminal to a session (Ctrl-] detaches)", runAttach},
+	{"stop", "<id>", "Stop a session", runStop},
+	{"tail-status", "[<id>...]", "Print status changes as they happen", runTailStatus},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: claudexctl [flags] <command> [args]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n  %-12s   %s\n", cmd.name, cmd.summary, "", cmd.args)
+	}
+	fmt.Fprintf(out, "\nSession IDs may be abbreviated to any unique prefix.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	server := flag.String("server", envOr("CLAUDEX_URL", "http://localhost:9090"), "Server URL ($CLAUDEX_URL)")
+	socket := flag.String("socket", os.Getenv("CLAUDEX_SOCKET"), "Connect through this Unix socket ($CLAUDEX_SOCKET)")
+	user := flag.String("user", os.Getenv("CLAUDEX_USER"), "User sent as X-Claudex-User ($CLAUDEX_USER)")
+	token := flag.String("token", os.Getenv("CLAUDEX_TOKEN"), "User token sent as X-Claudex-Token ($CLAUDEX_TOKEN)")
+	admin := flag.String("admin-token", os.Getenv("CLAUDEX_ADMIN_TOKEN"), "Admin token sent as X-Claudex-Admin ($CLAUDEX_ADMIN_TOKEN)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	c, err := newClient(*server, *socket, *user, *token, *admin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "claudexctl:", err)
+		os.Exit(2)
+	}
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(c, args); err != nil {
+			fmt.Fprintln(os.Stderr, "claudexctl:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "claudexctl: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// envOr returns an environment variable, or def when it is unset
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
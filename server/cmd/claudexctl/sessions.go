@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"claudex/session"
+	"claudex/ws"
+)
+
+// replyTimeout bounds how long create and stop wait for the server to confirm
+const replyTimeout = 30 * time.Second
+
+// runList prints the sessions as a table (or JSON)
+func runList(c *client, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var statuses, tags stringList
+	fs.Var(&statuses, "status", "Only sessions in this status (repeatable)")
+	fs.Var(&tags, "tag", "Only sessions with this tag (repeatable)")
+	asJSON := fs.Bool("json", false, "Print the sessions as JSON")
+	fs.Parse(args)
+
+	query := url.Values{"status": statuses, "tag": tags}
+	var list []sessionEntry
+	if err := c.do(http.MethodGet, "/sessions", query, nil, &list); err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(list)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tNAME\tDIRECTORY")
+	for _, s := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.ID, s.Status, s.Name, s.Directory)
+	}
+	return tw.Flush()
+}
+
+// runCreate creates a session in a directory and prints its ID
+func runCreate(c *client, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	dir := fs.String("dir", "", "Working directory of the session (required)")
+	name := fs.String("name", "", "Session name (default: the directory's name)")
+	command := fs.String("cmd", "", "Command typed into the shell once it starts, e.g. claude")
+	start := fs.Bool("start", false, "Start the session right away")
+	fs.Parse(args)
+
+	if *dir == "" {
+		return errors.New("create: -dir is required")
+	}
+	abs, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	if *name == "" {
+		*name = filepath.Base(abs)
+	}
+
+	var created sessionEntry
+	req := ws.CreateSessionRequest{Name: *name, Directory: abs, StartupCommand: *command}
+	if err := c.do(http.MethodPost, "/sessions/create", nil, req, &created); err != nil {
+		return err
+	}
+	if *start {
+		wc, err := c.connect(false)
+		if err != nil {
+			return err
+		}
+		defer wc.Close()
+		if err := wc.send("start", created.ID, ws.StartData{Rows: 24, Cols: 80}); err != nil {
+			return err
+		}
+		if _, err := waitForSessions(wc); err != nil {
+			return err
+		}
+	}
+	fmt.Println(created.ID)
+	return nil
+}
+
+// runStop stops a session and waits until the server reports it stopped
+func runStop(c *client, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: claudexctl stop <id>")
+	}
+	sess, err := c.find(args[0])
+	if err != nil {
+		return err
+	}
+	wc, err := c.connect(false)
+	if err != nil {
+		return err
+	}
+	defer wc.Close()
+
+	// Messages are handled in order, so the list sent back after stop
+	// reflects it
+	if err := wc.send("stop", sess.ID, nil); err != nil {
+		return err
+	}
+	summaries, err := waitForSessions(wc)
+	if err != nil {
+		return err
+	}
+	for _, s := range summaries {
+		if s.ID == sess.ID && s.Status != session.StatusStopped {
+			return fmt.Errorf("%s is %s, not stopped", sess.ID, s.Status)
+		}
+	}
+	fmt.Printf("Stopped %s (%s)\n", sess.Name, sess.ID)
+	return nil
+}
+
+// waitForSessions asks for the session list and waits for it. As the server
+// handles a connection's messages in order, the answer comes after
+// everything sent before.
+func waitForSessions(wc *wsConn) ([]ws.SessionSummary, error) {
+	if err := wc.send("list", "", nil); err != nil {
+		return nil, err
+	}
+	wc.conn.SetReadDeadline(time.Now().Add(replyTimeout))
+	defer wc.conn.SetReadDeadline(time.Time{})
+	for {
+		msgType, raw, err := wc.receive()
+		if err != nil {
+			return nil, err
+		}
+		if msgType == "quota_exceeded" {
+			var msg ws.QuotaExceededMessage
+			json.Unmarshal(raw, &msg)
+			if msg.Error != nil {
+				return nil, msg.Error
+			}
+			return nil, errors.New("session quota exceeded")
+		}
+		if msgType != "sessions" {
+			continue
+		}
+		var msg ws.SessionsMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, err
+		}
+		return msg.Sessions, nil
+	}
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
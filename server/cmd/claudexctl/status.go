@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"claudex/ws"
+)
+
+// runTailStatus prints a line per status change of every session, or only
+// of the given ones, until interrupted
+func runTailStatus(c *client, args []string) error {
+	only := make(map[string]bool)
+	for _, id := range args {
+		sess, err := c.find(id)
+		if err != nil {
+			return err
+		}
+		only[sess.ID] = true
+	}
+
+	wc, err := c.connect(true)
+	if err != nil {
+		return err
+	}
+	defer wc.Close()
+
+	names := make(map[string]string)
+	for {
+		msgType, raw, err := wc.receive()
+		if err != nil {
+			return fmt.Errorf("connection closed: %w", err)
+		}
+		switch msgType {
+		case "sessions":
+			// Sent on connect: show where every session stands
+			var msg ws.SessionsMessage
+			if json.Unmarshal(raw, &msg) != nil {
+				continue
+			}
+			for _, s := range msg.Sessions {
+				names[s.ID] = s.Name
+				if len(only) == 0 || only[s.ID] {
+					printStatus(s.StatusSince, s.ID, s.Name, string(s.Status), "")
+				}
+			}
+
+		case "status":
+			var msg ws.StatusMessage
+			if json.Unmarshal(raw, &msg) != nil || (len(only) > 0 && !only[msg.SessionID]) {
+				continue
+			}
+			detail := msg.Tool
+			if msg.Reason != "" {
+				detail = msg.Reason
+			}
+			printStatus(time.Now(), msg.SessionID, names[msg.SessionID], string(msg.Status), detail)
+		}
+	}
+}
+
+// printStatus prints one status line
+func printStatus(at time.Time, id, name, status, detail string) {
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	line := fmt.Sprintf("%s  %s  %-14s %s", at.Local().Format(time.TimeOnly), id, status, name)
+	if detail != "" {
+		line += "  (" + detail + ")"
+	}
+	fmt.Println(line)
+}
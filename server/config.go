@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"claudex/audit"
+	"claudex/claude"
+	"claudex/forge"
+	"claudex/logging"
+	"claudex/logsink"
+	"claudex/notify"
+	"claudex/session"
+	"claudex/ws"
+)
+
+// Shutdown timing: how long in-flight requests get to finish, and how long
+// session processes get after SIGHUP before they are killed
+const (
+	shutdownTimeout = 10 * time.Second
+	processGrace    = 5 * time.Second
+)
+
+type Config struct {
+	Port     int                    `json:"port"`
+	Bind     string                 `json:"bind,omitempty"`   // Address to listen on (default: all interfaces)
+	Listen   string                 `json:"listen,omitempty"` // "unix:///path/claudex.sock" serves on that socket instead of a TCP port
+	ReadOnly bool                   `json:"readonly"`         // Observer mode: no input, no start/stop, no git operations
+	Webhooks []notify.WebhookConfig `json:"webhooks,omitempty"`
+	Emails   []notify.EmailConfig   `json:"emails,omitempty"` // SMTP notifiers
+	PortPool session.PortPool       `json:"port_pool"`        // Per-session port blocks for parallel dev servers
+
+	StorageDir   string   `json:"storage_dir,omitempty"`   // Sessions, logs, audit, recordings and outbox (default ~/.claudex)
+	WebDir       string   `json:"web_dir,omitempty"`       // Web frontend to serve (default <storage_dir>/web)
+	Shell        string   `json:"shell,omitempty"`         // Login shell for sessions (default $SHELL, then /bin/zsh)
+	ClaudeBinary string   `json:"claude_binary,omitempty"` // Claude CLI (default "claude" on the PATH)
+	Timeouts     Timeouts `json:"timeouts,omitempty"`      // Shutdown and status detection timing
+
+	MetadataSchema  []session.MetadataField   `json:"metadata_schema,omitempty"`   // Extra known metadata keys
+	Pricing         claude.Pricing            `json:"pricing,omitempty"`           // USD per million tokens, by model prefix
+	Budget          session.Budget            `json:"budget,omitempty"`            // Default spend limit per session
+	Quotas          session.Quotas            `json:"quotas,omitempty"`            // Session limits, global and per owner
+	IdleStop        session.IdlePolicy        `json:"idle_stop,omitempty"`         // Stop sessions left without input
+	ColdAfterDays   int                       `json:"cold_after_days,omitempty"`   // Serve transcript summaries from storage after this much inactivity
+	Docker          session.DockerConfig      `json:"docker,omitempty"`            // Image and options for sandbox: docker sessions
+	LogSinks        []logsink.Config          `json:"log_sinks,omitempty"`         // Copy every session's output to files, syslog or Loki
+	Backend         string                    `json:"backend,omitempty"`           // "tmux" keeps sessions running across server restarts
+	ScrollbackMB    int                       `json:"scrollback_mb,omitempty"`     // Scrollback kept per session in memory and on disk (default 1)
+	ScrollbackMaxMB int                       `json:"scrollback_max_mb,omitempty"` // Most a session may ask for with its own scrollback_mb (0: 64)
+	Backpressure    ws.Backpressure           `json:"backpressure,omitempty"`      // Send queue per client and what to do when it fills
+	Logging         logging.Config            `json:"logging,omitempty"`           // Log level, format and per-session log files
+	GRPCPort        int                       `json:"grpc_port,omitempty"`         // Serve the gRPC API on this port (0: disabled)
+	AllowedOrigins  []string                  `json:"allowed_origins,omitempty"`   // Browser origins besides the server's own that may use the WebSocket and REST API
+	Dev             bool                      `json:"dev,omitempty"`               // Development mode: accept any origin
+	RateLimits      ws.RateLimits             `json:"rate_limits,omitempty"`       // Input and resize messages per connection and per session
+	Audit           audit.Config              `json:"audit,omitempty"`             // Record of what was typed into each session, by whom
+	Detection       session.DetectionPatterns `json:"detection,omitempty"`         // Extra output patterns for status detection
+	MergeBranch     string                    `json:"merge_branch,omitempty"`      // Branch experiments merge into (default: the repository's default branch)
+	TestCommands    map[string]string         `json:"test_commands,omitempty"`     // Command merges with require_tests run, by repository path
+	Forges          []forge.Config            `json:"forges,omitempty"`            // GitHub, GitLab and Gitea hosts pull requests are opened on
+	GitHub          *forge.Config             `json:"github,omitempty"`            // Deprecated: a GitHub entry in forges (token and api_url)
+}
+
+// Timeouts are durations like "30s" or "5m"; empty fields keep the defaults
+type Timeouts struct {
+	Shutdown      string `json:"shutdown,omitempty"`       // In-flight requests at shutdown (default 10s)
+	ProcessGrace  string `json:"process_grace,omitempty"`  // Session processes after SIGHUP before they are killed (default 5s)
+	Thinking      string `json:"thinking,omitempty"`       // Silence while thinking before a session counts as waiting (default 60s)
+	Executing     string `json:"executing,omitempty"`      // Tool run before a session counts as waiting (default 5m)
+	StartupPrompt string `json:"startup_prompt,omitempty"` // Wait for a shell prompt before typing the startup command anyway (default 5s)
+}
+
+// parsedTimeouts are Timeouts with the defaults filled in
+type parsedTimeouts struct {
+	shutdown     time.Duration
+	processGrace time.Duration
+	session      session.Timeouts
+}
+
+// parse checks every timeout, naming the bad ones
+func (t Timeouts) parse() (parsedTimeouts, error) {
+	var errs []error
+	duration := func(name, value string, def time.Duration) time.Duration {
+		if value == "" {
+			return def
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("timeouts.%s: %q is not a positive duration like \"30s\" or \"5m\"", name, value))
+			return def
+		}
+		return d
+	}
+	parsed := parsedTimeouts{
+		shutdown:     duration("shutdown", t.Shutdown, shutdownTimeout),
+		processGrace: duration("process_grace", t.ProcessGrace, processGrace),
+		session: session.Timeouts{
+			Thinking:      duration("thinking", t.Thinking, session.ThinkingTimeout),
+			Executing:     duration("executing", t.Executing, session.ExecutingTimeout),
+			StartupPrompt: duration("startup_prompt", t.StartupPrompt, session.StartupPromptTimeout),
+		},
+	}
+	return parsed, errors.Join(errs...)
+}
+
+// configPath is where the server reads its settings
+func configPath() string {
+	return os.ExpandEnv("$HOME/.claudex/config.json")
+}
+
+// readConfig reads config.json over the defaults and validates it; a missing
+// file gives the defaults. Errors name the file and, for bad JSON, the line.
+func readConfig() (Config, error) {
+	config := Config{Port: 9090} // defaults
+
+	path := configPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return config, err
+		}
+	} else if err := decodeConfig(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+
+	config.resolvePaths()
+	if err := config.validate(); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// decodeConfig parses config.json, rejecting unknown settings so typos
+// don't go unnoticed
+func decodeConfig(data []byte, config *Config) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		if decoder.More() {
+			return errors.New("unexpected data after the settings object")
+		}
+		return nil
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("the file ends before the settings are complete (missing } or ]?)")
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("line %d: %s", lineOf(data, syntaxErr.Offset), syntaxErr)
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "the settings"
+		}
+		return fmt.Errorf("line %d: %s should be %s, not a JSON %s",
+			lineOf(data, typeErr.Offset), field, typeErr.Type, typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("unknown setting %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+	return err
+}
+
+// lineOf returns the 1-based line of a byte offset
+func lineOf(data []byte, offset int64) int {
+	offset = min(offset, int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// resolvePaths fills in the default directories and expands ~ and $VARS
+func (c *Config) resolvePaths() {
+	if c.StorageDir == "" {
+		c.StorageDir = "~/.claudex"
+	}
+	c.StorageDir = expandPath(c.StorageDir)
+	if c.WebDir == "" {
+		c.WebDir = filepath.Join(c.StorageDir, "web")
+	}
+	c.WebDir = expandPath(c.WebDir)
+	c.Shell = expandPath(c.Shell)
+	if strings.ContainsRune(c.ClaudeBinary, filepath.Separator) {
+		c.ClaudeBinary = expandPath(c.ClaudeBinary)
+	}
+}
+
+// expandPath expands environment variables and a leading ~
+func expandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return path
+}
+
+// isHostname reports whether s looks like a DNS name
+func isHostname(s string) bool {
+	return strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.-") == "" &&
+		!strings.HasPrefix(s, "-") && !strings.HasPrefix(s, ".")
+}
+
+// storagePath returns a file or directory under storage_dir
+func (c Config) storagePath(name string) string {
+	return filepath.Join(c.StorageDir, name)
+}
+
+// forges returns the configured forges, with the deprecated github setting
+// as a last GitHub entry
+func (c Config) forges() []forge.Config {
+	forges := c.Forges
+	if c.GitHub != nil {
+		github := *c.GitHub
+		github.Type = forge.TypeGitHub
+		forges = append(forges[:len(forges):len(forges)], github)
+	}
+	return forges
+}
+
+// validate checks the settings the server can't start without getting
+// right, reporting every problem at once
+func (c Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port <= 65535, "port: %d is not a TCP port (1-65535)", c.Port)
+	check(c.GRPCPort >= 0 && c.GRPCPort <= 65535, "grpc_port: %d is not a TCP port (1-65535, or 0 to disable)", c.GRPCPort)
+	check(c.GRPCPort == 0 || c.GRPCPort != c.Port, "grpc_port: %d is already the HTTP port", c.GRPCPort)
+	if c.Listen != "" {
+		if err := validateListen(c.Listen); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	check(c.Bind == "" || net.ParseIP(c.Bind) != nil || isHostname(c.Bind),
+		"bind: %q is not a host name or IP address (e.g. \"127.0.0.1\")", c.Bind)
+
+	check(filepath.IsAbs(c.StorageDir), "storage_dir: %q must be an absolute path", c.StorageDir)
+	if info, err := os.Stat(c.StorageDir); err == nil {
+		check(info.IsDir(), "storage_dir: %s is not a directory", c.StorageDir)
+	}
+	if info, err := os.Stat(c.WebDir); err == nil {
+		check(info.IsDir(), "web_dir: %s is not a directory", c.WebDir)
+	} else {
+		// The default is allowed to be missing (API-only servers), a configured one isn't
+		check(c.WebDir == c.storagePath("web"), "web_dir: %v", err)
+	}
+
+	if c.Shell != "" {
+		info, err := os.Stat(c.Shell)
+		switch {
+		case !filepath.IsAbs(c.Shell):
+			check(false, "shell: %q must be an absolute path", c.Shell)
+		case err != nil:
+			check(false, "shell: %v", err)
+		default:
+			check(info.Mode().IsRegular() && info.Mode()&0111 != 0, "shell: %s is not an executable file", c.Shell)
+		}
+	}
+	if c.ClaudeBinary != "" {
+		_, err := exec.LookPath(c.ClaudeBinary)
+		check(err == nil, "claude_binary: %v", err)
+	}
+
+	check(c.ScrollbackMB >= 0, "scrollback_mb: must not be negative")
+	check(c.ScrollbackMaxMB >= 0, "scrollback_max_mb: must not be negative")
+	scrollbackMax := c.ScrollbackMaxMB
+	if scrollbackMax == 0 {
+		scrollbackMax = session.DefaultScrollbackMaxMB
+	}
+	check(c.ScrollbackMB <= scrollbackMax,
+		"scrollback_mb: %d is above scrollback_max_mb (%d)", c.ScrollbackMB, scrollbackMax)
+	check(c.ColdAfterDays >= 0, "cold_after_days: must not be negative")
+
+	if _, err := c.Timeouts.parse(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.RateLimits.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limits: %w", err))
+	}
+	if err := session.ValidateDetector(c.Detection.Detector); err != nil {
+		errs = append(errs, fmt.Errorf("detection.detector: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// loadConfig reads config.json at startup, exiting with every problem found
+// rather than running with settings the user didn't ask for
+func loadConfig() Config {
+	config, err := readConfig()
+	if err != nil {
+		// One problem per line
+		fmt.Fprintf(os.Stderr, "claudex: invalid config: %s\n", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+		os.Exit(1)
+	}
+	return config
+}
@@ -0,0 +1,228 @@
+// Package forge opens pull requests for experiment branches on the code
+// hosting service a repository lives on: GitHub, GitLab or Gitea.
+package forge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// httpClient is shared by all forge API calls
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Forge types
+const (
+	TypeGitHub = "github"
+	TypeGitLab = "gitlab"
+	TypeGitea  = "gitea"
+)
+
+// Provider opens pull requests (merge requests on GitLab) on one forge
+type Provider interface {
+	// CreatePullRequest opens a pull request, or returns the one already
+	// open for the head branch
+	CreatePullRequest(pr NewPullRequest) (*PullRequest, error)
+}
+
+// Config configures a forge and the repositories it serves
+type Config struct {
+	Type   string   `json:"type"`              // github, gitlab or gitea
+	Host   string   `json:"host,omitempty"`    // Host of the git remotes it serves (default github.com or gitlab.com; required for gitea)
+	Repos  []string `json:"repos,omitempty"`   // Only these repositories, as path patterns like "team/*" (default: all on the host)
+	Token  string   `json:"token"`             // Access token allowed to push pull requests
+	APIURL string   `json:"api_url,omitempty"` // API base URL (default derived from host)
+}
+
+// NewPullRequest describes the pull request to open
+type NewPullRequest struct {
+	Repo  string // Repository path on the forge, e.g. "owner/name"
+	Head  string // Branch with the changes
+	Base  string // Branch to merge into
+	Title string
+	Body  string
+	Draft bool
+}
+
+// PullRequest is a pull request opened on the forge, or the one already
+// open for the branch
+type PullRequest struct {
+	Number   int    `json:"number"`
+	URL      string `json:"url"`
+	Existing bool   `json:"existing,omitempty"` // Was already open, nothing was created
+}
+
+// Forges picks the configured forge for a repository
+type Forges struct {
+	entries []entry
+}
+
+// entry is a configured forge with its client
+type entry struct {
+	config   Config
+	provider Provider
+}
+
+// New creates the forge clients. Earlier entries win when several serve
+// the same repository.
+func New(configs []Config) (*Forges, error) {
+	f := &Forges{}
+	for i, c := range configs {
+		provider, err := newProvider(&c)
+		if err != nil {
+			return nil, fmt.Errorf("forges[%d]: %w", i, err)
+		}
+		for _, pattern := range c.Repos {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("forges[%d]: repos: bad pattern %q", i, pattern)
+			}
+		}
+		f.entries = append(f.entries, entry{config: c, provider: provider})
+	}
+	return f, nil
+}
+
+// newProvider fills in the defaults of a forge config and creates its client
+func newProvider(c *Config) (Provider, error) {
+	if c.Token == "" {
+		return nil, fmt.Errorf("%s: token is required", c.Type)
+	}
+	var defaultHost, apiPath string
+	switch c.Type {
+	case TypeGitHub:
+		defaultHost, apiPath = "github.com", "/api/v3" // The path is GitHub Enterprise's
+	case TypeGitLab:
+		defaultHost, apiPath = "gitlab.com", "/api/v4"
+	case TypeGitea:
+		apiPath = "/api/v1"
+	default:
+		return nil, fmt.Errorf("unknown type %q (github, gitlab or gitea)", c.Type)
+	}
+	if c.Host == "" {
+		c.Host = defaultHost
+	}
+	if c.Host == "" {
+		return nil, fmt.Errorf("%s: host is required", c.Type)
+	}
+	switch {
+	case c.APIURL != "":
+	case c.Type == TypeGitHub && c.Host == defaultHost:
+		c.APIURL = DefaultGitHubAPI
+	default:
+		c.APIURL = "https://" + c.Host + apiPath
+	}
+	if u, err := url.Parse(c.APIURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%s: api_url %q is not an absolute URL", c.Type, c.APIURL)
+	}
+	c.APIURL = strings.TrimRight(c.APIURL, "/")
+
+	switch c.Type {
+	case TypeGitHub:
+		return &GitHub{config: *c}, nil
+	case TypeGitLab:
+		return &GitLab{config: *c}, nil
+	}
+	return &Gitea{config: *c}, nil
+}
+
+// For returns the forge that serves a remote
+func (f *Forges) For(remote Remote) (Provider, error) {
+	if f != nil {
+		for _, e := range f.entries {
+			if e.serves(remote) {
+				return e.provider, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no forge configured for %s/%s", remote.Host, remote.Repo)
+}
+
+// serves reports whether the entry's forge hosts the remote's repository
+func (e entry) serves(remote Remote) bool {
+	if !strings.EqualFold(e.config.Host, remote.Host) {
+		return false
+	}
+	if len(e.config.Repos) == 0 {
+		return true
+	}
+	for _, pattern := range e.config.Repos {
+		if ok, _ := path.Match(pattern, remote.Repo); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Remote is a git remote URL split into the forge's host and the
+// repository path on it
+type Remote struct {
+	Host string
+	Repo string // "owner/name" (GitLab: "group/subgroup/name"), without .git
+}
+
+// ParseRemote splits a remote URL in any of git's forms: https://host/o/r,
+// ssh://git@host/o/r.git or git@host:o/r.git
+func ParseRemote(remote string) (Remote, error) {
+	remote = strings.TrimSpace(remote)
+	var host, repo string
+	if strings.Contains(remote, "://") {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return Remote{}, fmt.Errorf("remote %q: %w", remote, err)
+		}
+		host, repo = u.Hostname(), u.Path
+	} else if at, rest, ok := strings.Cut(remote, ":"); ok && !strings.Contains(at, "/") {
+		// scp-like syntax: [user@]host:path
+		_, host, _ = strings.Cut(at, "@")
+		if host == "" {
+			host = at
+		}
+		repo = rest
+	}
+	repo = strings.TrimSuffix(strings.Trim(repo, "/"), ".git")
+	if host == "" || !strings.Contains(repo, "/") {
+		return Remote{}, fmt.Errorf("remote %q is not a hosted repository URL", remote)
+	}
+	return Remote{Host: host, Repo: repo}, nil
+}
+
+// call sends an API request and decodes the JSON response into out. It
+// returns the HTTP status along with any error.
+func call(method, url string, headers map[string]string, body any, out any) (int, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
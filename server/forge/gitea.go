@@ -0,0 +1,74 @@
+package forge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Gitea opens pull requests through the Gitea (and Forgejo) REST API
+type Gitea struct {
+	config Config
+}
+
+// giteaPull is the part of a Gitea pull request we read
+type giteaPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
+// CreatePullRequest opens a pull request, or returns the one already open
+// for the head branch. Drafts get the "WIP:" title prefix Gitea keys on.
+func (g *Gitea) CreatePullRequest(pr NewPullRequest) (*PullRequest, error) {
+	title := pr.Title
+	if pr.Draft {
+		title = "WIP: " + title
+	}
+	var created giteaPull
+	status, err := g.call(http.MethodPost, "/repos/"+pr.Repo+"/pulls", map[string]any{
+		"head":  pr.Head,
+		"base":  pr.Base,
+		"title": title,
+		"body":  pr.Body,
+	}, &created)
+	if status == http.StatusConflict {
+		// A pull request for the branch is already open
+		if existing, _ := g.openPullRequest(pr.Repo, pr.Head); existing != nil {
+			return existing, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: created.Number, URL: created.HTMLURL}, nil
+}
+
+// openPullRequest returns the open pull request of a branch, or nil. The
+// list can't be filtered by branch, so only the first page is searched.
+func (g *Gitea) openPullRequest(repo, branch string) (*PullRequest, error) {
+	query := url.Values{"state": {"open"}, "limit": {"50"}}
+	var pulls []giteaPull
+	if _, err := g.call(http.MethodGet, "/repos/"+repo+"/pulls?"+query.Encode(), nil, &pulls); err != nil {
+		return nil, err
+	}
+	for _, p := range pulls {
+		if p.Head.Ref == branch {
+			return &PullRequest{Number: p.Number, URL: p.HTMLURL, Existing: true}, nil
+		}
+	}
+	return nil, nil
+}
+
+// call sends a Gitea API request
+func (g *Gitea) call(method, path string, body, out any) (int, error) {
+	status, err := call(method, g.config.APIURL+path, map[string]string{
+		"Authorization": "token " + g.config.Token,
+	}, body, out)
+	if err != nil {
+		err = fmt.Errorf("gitea: %w", err)
+	}
+	return status, err
+}
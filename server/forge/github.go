@@ -0,0 +1,72 @@
+package forge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultGitHubAPI is the API of github.com
+const DefaultGitHubAPI = "https://api.github.com"
+
+// GitHub opens pull requests through the GitHub REST API
+type GitHub struct {
+	config Config
+}
+
+// githubPull is the part of a GitHub pull request we read
+type githubPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+// CreatePullRequest opens a pull request, or returns the one already open
+// for the head branch
+func (g *GitHub) CreatePullRequest(pr NewPullRequest) (*PullRequest, error) {
+	var created githubPull
+	status, err := g.call(http.MethodPost, "/repos/"+pr.Repo+"/pulls", map[string]any{
+		"title": pr.Title,
+		"head":  pr.Head,
+		"base":  pr.Base,
+		"body":  pr.Body,
+		"draft": pr.Draft,
+	}, &created)
+	if status == http.StatusUnprocessableEntity {
+		// Also the answer when a pull request for the branch is already open
+		if existing, _ := g.openPullRequest(pr.Repo, pr.Head); existing != nil {
+			return existing, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: created.Number, URL: created.HTMLURL}, nil
+}
+
+// openPullRequest returns the open pull request of a branch, or nil
+func (g *GitHub) openPullRequest(repo, branch string) (*PullRequest, error) {
+	owner, _, _ := strings.Cut(repo, "/")
+	query := url.Values{"head": {owner + ":" + branch}, "state": {"open"}}
+	var pulls []githubPull
+	if _, err := g.call(http.MethodGet, "/repos/"+repo+"/pulls?"+query.Encode(), nil, &pulls); err != nil {
+		return nil, err
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return &PullRequest{Number: pulls[0].Number, URL: pulls[0].HTMLURL, Existing: true}, nil
+}
+
+// call sends a GitHub API request
+func (g *GitHub) call(method, path string, body, out any) (int, error) {
+	status, err := call(method, g.config.APIURL+path, map[string]string{
+		"Accept":               "application/vnd.github+json",
+		"Authorization":        "Bearer " + g.config.Token,
+		"X-GitHub-Api-Version": "2022-11-28",
+	}, body, out)
+	if err != nil {
+		err = fmt.Errorf("github: %w", err)
+	}
+	return status, err
+}
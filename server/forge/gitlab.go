@@ -0,0 +1,73 @@
+package forge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GitLab opens merge requests through the GitLab REST API
+type GitLab struct {
+	config Config
+}
+
+// gitlabMergeRequest is the part of a GitLab merge request we read
+type gitlabMergeRequest struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+}
+
+// CreatePullRequest opens a merge request, or returns the one already open
+// for the head branch. Drafts get the "Draft:" title prefix GitLab keys on.
+func (g *GitLab) CreatePullRequest(pr NewPullRequest) (*PullRequest, error) {
+	title := pr.Title
+	if pr.Draft {
+		title = "Draft: " + title
+	}
+	var created gitlabMergeRequest
+	status, err := g.call(http.MethodPost, g.project(pr.Repo)+"/merge_requests", map[string]any{
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+		"title":         title,
+		"description":   pr.Body,
+	}, &created)
+	if status == http.StatusConflict {
+		// Another open merge request already exists for this source branch
+		if existing, _ := g.openMergeRequest(pr.Repo, pr.Head); existing != nil {
+			return existing, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: created.IID, URL: created.WebURL}, nil
+}
+
+// openMergeRequest returns the open merge request of a branch, or nil
+func (g *GitLab) openMergeRequest(repo, branch string) (*PullRequest, error) {
+	query := url.Values{"source_branch": {branch}, "state": {"opened"}}
+	var mrs []gitlabMergeRequest
+	if _, err := g.call(http.MethodGet, g.project(repo)+"/merge_requests?"+query.Encode(), nil, &mrs); err != nil {
+		return nil, err
+	}
+	if len(mrs) == 0 {
+		return nil, nil
+	}
+	return &PullRequest{Number: mrs[0].IID, URL: mrs[0].WebURL, Existing: true}, nil
+}
+
+// project is the API path of a project, addressed by its full path
+func (g *GitLab) project(repo string) string {
+	return "/projects/" + url.PathEscape(repo)
+}
+
+// call sends a GitLab API request
+func (g *GitLab) call(method, path string, body, out any) (int, error) {
+	status, err := call(method, g.config.APIURL+path, map[string]string{
+		"PRIVATE-TOKEN": g.config.Token,
+	}, body, out)
+	if err != nil {
+		err = fmt.Errorf("gitlab: %w", err)
+	}
+	return status, err
+}
@@ -0,0 +1,303 @@
+// Package grpcapi serves the Claudex gRPC service (claudex.proto) for
+// tooling that wants typed, streaming access to sessions instead of the
+// WebSocket JSON protocol. It drives sessions through the WebSocket handler,
+// so both APIs share policies, quotas and subscribers' view of the output.
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative claudex.proto
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"claudex/audit"
+	"claudex/session"
+	"claudex/ws"
+)
+
+// Server implements the Claudex service
+type Server struct {
+	UnimplementedClaudexServer
+	handler *ws.Handler
+	manager *session.Manager
+}
+
+// NewGRPCServer returns a gRPC server with the Claudex service registered
+func NewGRPCServer(handler *ws.Handler, manager *session.Manager) *grpc.Server {
+	server := grpc.NewServer()
+	RegisterClaudexServer(server, &Server{handler: handler, manager: manager})
+	return server
+}
+
+// ListSessions returns the sessions matching the filters
+func (s *Server) ListSessions(ctx context.Context, req *ListSessionsRequest) (*ListSessionsResponse, error) {
+	opts := session.ListOptions{Tags: req.Tags}
+	for _, st := range req.Statuses {
+		opts.Statuses = append(opts.Statuses, session.Status(st))
+	}
+	sessions, _ := s.manager.ListPage(opts)
+
+	resp := &ListSessionsResponse{}
+	for _, sess := range sessions {
+		resp.Sessions = append(resp.Sessions, toSession(sess))
+	}
+	return resp, nil
+}
+
+// GetSession returns one session
+func (s *Server) GetSession(ctx context.Context, req *SessionRequest) (*Session, error) {
+	sess, ok := s.manager.Get(req.SessionId)
+	if !ok {
+		return nil, toStatus(ws.ErrSessionNotFound)
+	}
+	return toSession(sess), nil
+}
+
+// CreateSession creates a session for the user of the token metadata (admins
+// may name another owner)
+func (s *Server) CreateSession(ctx context.Context, req *CreateSessionRequest) (*Session, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	create := ws.CreateSessionRequest{
+		Name:           req.Name,
+		Directory:      req.Directory,
+		Owner:          req.Owner,
+		StartupCommand: req.StartupCommand,
+		Sandbox:        req.Sandbox,
+		Backend:        req.Backend,
+	}
+	if err := create.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	claim := s.manager.ClaimFor(header(ctx, session.AdminHeader), header(ctx, session.UserTokenHeader),
+		create.Owner, header(ctx, ws.UserHeader))
+	create.Owner = claim.Owner
+
+	sess, err := s.handler.CreateSession(create, claim)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if len(req.Tags) > 0 {
+		sess.SetTags(req.Tags)
+		s.manager.UpdateSession(sess)
+	}
+	return toSession(sess), nil
+}
+
+// DeleteSession deletes a session
+func (s *Server) DeleteSession(ctx context.Context, req *SessionRequest) (*emptypb.Empty, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, toStatus(s.handler.DeleteSession(req.SessionId))
+}
+
+// StartSession starts a session
+func (s *Server) StartSession(ctx context.Context, req *StartSessionRequest) (*emptypb.Empty, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	rows, cols, err := size(req.Rows, req.Cols)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, toStatus(s.handler.StartSession(req.SessionId, rows, cols, s.admin(ctx)))
+}
+
+// StopSession stops a session
+func (s *Server) StopSession(ctx context.Context, req *SessionRequest) (*emptypb.Empty, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, toStatus(s.handler.StopSession(req.SessionId))
+}
+
+// SendInput types into a session
+func (s *Server) SendInput(ctx context.Context, req *SendInputRequest) (*SendInputResponse, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	result, err := s.handler.SendInput(req.SessionId, string(req.Data), s.actor(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &SendInputResponse{}
+	if result != nil {
+		resp.PolicyDecision = string(result.Decision)
+		resp.PolicyPattern = result.Pattern
+	}
+	return resp, nil
+}
+
+// Resize changes a session's terminal size
+func (s *Server) Resize(ctx context.Context, req *ResizeRequest) (*emptypb.Empty, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+	rows, cols, err := size(req.Rows, req.Cols)
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 || cols == 0 {
+		return nil, status.Error(codes.InvalidArgument, "rows and cols are required")
+	}
+	return &emptypb.Empty{}, toStatus(s.handler.ResizeSession(req.SessionId, rows, cols))
+}
+
+// StreamOutput sends the session's backlog and then its live output
+func (s *Server) StreamOutput(req *StreamOutputRequest, stream grpc.ServerStreamingServer[OutputChunk]) error {
+	observer, err := s.handler.ObserveOutput(req.SessionId, req.SinceSeq)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer observer.Close()
+
+	for _, ev := range observer.Backlog {
+		if err := stream.Send(&OutputChunk{Data: ev.Data, Seq: ev.Seq}); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-observer.Events:
+			if !ok {
+				if _, exists := s.manager.Get(req.SessionId); !exists {
+					return status.Error(codes.NotFound, "session deleted")
+				}
+				return status.Error(codes.ResourceExhausted, "client fell behind; resume with since_seq")
+			}
+			if ev.Seq <= observer.Seq {
+				continue // Already in the backlog
+			}
+			if err := stream.Send(&OutputChunk{Data: ev.Data, Seq: ev.Seq}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WatchStatus streams status changes
+func (s *Server) WatchStatus(req *WatchStatusRequest, stream grpc.ServerStreamingServer[StatusEvent]) error {
+	only := make(map[string]bool)
+	for _, id := range req.SessionIds {
+		only[id] = true
+	}
+
+	observer := s.handler.ObserveStatus()
+	defer observer.Close()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg, ok := <-observer.Events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "client fell behind")
+			}
+			if len(only) > 0 && !only[msg.SessionID] {
+				continue
+			}
+			err := stream.Send(&StatusEvent{
+				SessionId: msg.SessionID,
+				Status:    string(msg.Status),
+				CostUsd:   msg.CostUSD,
+				Tool:      msg.Tool,
+				Reason:    msg.Reason,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writable rejects state changes in read-only observer mode
+func (s *Server) writable() error {
+	if s.handler.IsReadOnly() {
+		return status.Error(codes.PermissionDenied, "server is in read-only mode")
+	}
+	return nil
+}
+
+// admin reports whether the call carries the admin token
+func (s *Server) admin(ctx context.Context) bool {
+	return s.manager.IsAdmin(header(ctx, session.AdminHeader))
+}
+
+// actor identifies the caller for the audit log
+func (s *Server) actor(ctx context.Context) audit.Actor {
+	actor := audit.Actor{Source: "grpc", User: header(ctx, ws.UserHeader), Admin: s.admin(ctx)}
+	if p, ok := peer.FromContext(ctx); ok {
+		actor.RemoteAddr = p.Addr.String()
+	}
+	return actor
+}
+
+// header returns a request metadata value (gRPC lowercases the keys)
+func header(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, strings.ToLower(key)); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// size converts a requested terminal size
+func size(rows, cols uint32) (uint16, uint16, error) {
+	if rows > 0xffff || cols > 0xffff {
+		return 0, 0, status.Error(codes.InvalidArgument, "terminal size out of range")
+	}
+	return uint16(rows), uint16(cols), nil
+}
+
+// toStatus maps control errors to gRPC status codes
+func toStatus(err error) error {
+	var quotaErr *session.QuotaExceededError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ws.ErrSessionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ws.ErrBlocked), errors.Is(err, ws.ErrControlHeld), errors.Is(err, ws.ErrSettingUp):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.As(err, &quotaErr), errors.Is(err, ws.ErrRateLimited):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func toSession(sess *session.Session) *Session {
+	owner, _ := sess.MetadataString(session.OwnerKey)
+	return &Session{
+		Id:           sess.ID,
+		Name:         sess.Name,
+		Status:       string(sess.GetStatus()),
+		Directory:    sess.Directory,
+		Branch:       sess.Branch,
+		ParentId:     sess.ParentID,
+		Tags:         sess.GetTags(),
+		Owner:        owner,
+		PtyAlive:     sess.PTYAlive,
+		CreatedAt:    timestamp(sess.CreatedAt),
+		UpdatedAt:    timestamp(sess.UpdatedAt),
+		LastOutputAt: timestamp(sess.LastOutputAt),
+	}
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
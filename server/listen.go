@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unixScheme prefixes a listen address naming a Unix domain socket
+const unixScheme = "unix://"
+
+// socketMode lets the server's user and group (e.g. nginx) connect
+const socketMode = 0660
+
+// socketPath returns the socket of a unix:// listen address, "" for none
+func socketPath(listen string) string {
+	if !strings.HasPrefix(listen, unixScheme) {
+		return ""
+	}
+	return expandPath(strings.TrimPrefix(listen, unixScheme))
+}
+
+// validateListen checks a listen address: only unix:///absolute/path is
+// accepted, in a directory that exists
+func validateListen(listen string) error {
+	path := socketPath(listen)
+	if path == "" || !filepath.IsAbs(path) {
+		return fmt.Errorf("listen: %q must be unix:///absolute/path/claudex.sock", listen)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		return fmt.Errorf("listen: directory %s does not exist", filepath.Dir(path))
+	}
+	return nil
+}
+
+// clientURL returns the URL processes on this host use to reach a listener,
+// and the socket to connect through for a Unix socket
+func clientURL(addr net.Addr) (url, socket string) {
+	switch addr := addr.(type) {
+	case *net.UnixAddr:
+		return "http://localhost", addr.Name
+	case *net.TCPAddr:
+		host := "localhost"
+		if !addr.IP.IsUnspecified() {
+			host = addr.IP.String()
+		}
+		return "http://" + net.JoinHostPort(host, strconv.Itoa(addr.Port)), ""
+	}
+	return "http://" + addr.String(), ""
+}
+
+// listenUnix listens on a Unix domain socket. A socket file left by a server
+// that didn't shut down cleanly is replaced; one still accepting connections
+// means another server is running.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Created with socketMode, so it is never reachable by others, not even
+	// before the chmod
+	restore := restrictUmask(socketMode)
+	lis, err := net.Listen("unix", path) // Removed again when the listener closes
+	restore()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
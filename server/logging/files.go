@@ -0,0 +1,164 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rotation defaults for session files
+const (
+	defaultMaxSizeMB  = 10
+	defaultMaxFiles   = 3
+	defaultMaxAgeDays = 30
+)
+
+// retentionInterval is how often RunRetention prunes the log directory
+const retentionInterval = time.Hour
+
+// active holds the session files installed by the last Setup, if any
+var active atomic.Pointer[sessionFiles]
+
+// sessionFiles appends records to per-session log files, rotating each to
+// <id>.log.1 … <id>.log.N by size. Each write opens and closes the file, so
+// no descriptors pile up for sessions that come and go.
+type sessionFiles struct {
+	dir      string
+	options  *slog.HandlerOptions
+	maxSize  int64
+	maxFiles int
+	maxAge   time.Duration
+	maxTotal int64
+	mu       sync.Mutex
+}
+
+func newSessionFiles(c Config, dir string, options *slog.HandlerOptions) *sessionFiles {
+	f := &sessionFiles{
+		dir:      dir,
+		options:  options,
+		maxSize:  int64(c.MaxSizeMB) << 20,
+		maxFiles: c.MaxFiles,
+		maxAge:   time.Duration(c.MaxAgeDays) * 24 * time.Hour,
+		maxTotal: int64(c.MaxTotalMB) << 20,
+	}
+	if f.maxSize == 0 {
+		f.maxSize = defaultMaxSizeMB << 20
+	}
+	if f.maxFiles == 0 {
+		f.maxFiles = defaultMaxFiles
+	}
+	if f.maxAge == 0 {
+		f.maxAge = defaultMaxAgeDays * 24 * time.Hour
+	}
+	return f
+}
+
+func (f *sessionFiles) write(ctx context.Context, sessionID string, derive []func(slog.Handler) slog.Handler, r slog.Record) {
+	if sessionID != filepath.Base(sessionID) || strings.HasPrefix(sessionID, ".") {
+		return
+	}
+
+	var buf bytes.Buffer
+	var handler slog.Handler = slog.NewTextHandler(&buf, f.options)
+	for _, fn := range derive {
+		handler = fn(handler)
+	}
+	if err := handler.Handle(ctx, r); err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := filepath.Join(f.dir, sessionID+".log")
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 && info.Size()+int64(buf.Len()) > f.maxSize {
+		f.rotate(path)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	buf.WriteTo(file)
+	file.Close()
+}
+
+// rotate shifts path.N-1 -> path.N … path -> path.1 (caller must hold the lock)
+func (f *sessionFiles) rotate(path string) {
+	os.Remove(fmt.Sprintf("%s.%d", path, f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	os.Rename(path, path+".1")
+}
+
+// prune deletes session files older than the maximum age, then the oldest
+// remaining ones until the directory fits the total size limit
+func (f *sessionFiles) prune(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return
+	}
+	type logFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []logFile
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || !strings.Contains(e.Name(), ".log") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(f.dir, e.Name())
+		if now.Sub(info.ModTime()) > f.maxAge {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, logFile{path, info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	if f.maxTotal == 0 || total <= f.maxTotal {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, file := range files {
+		if total <= f.maxTotal {
+			break
+		}
+		if os.Remove(file.path) == nil {
+			total -= file.size
+		}
+	}
+}
+
+// RunRetention prunes session log files now and every hour until stop is
+// closed. It does nothing when session files are disabled.
+func RunRetention(stop <-chan struct{}) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		if files := active.Load(); files != nil {
+			files.prune(time.Now())
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package logging configures the server's structured logs: level, format and
+// optional per-session files that collect every record about one session.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// SessionKey is the attribute that ties a record to a session. Records
+// carrying it are also written to that session's log file.
+const SessionKey = "session"
+
+// Config controls logging
+type Config struct {
+	Level        string `json:"level,omitempty"`         // debug, info (default), warn or error
+	Format       string `json:"format,omitempty"`        // text (default) or json
+	SessionFiles bool   `json:"session_files,omitempty"` // Also write each session's records to <dir>/<session-id>.log
+
+	// Rotation and retention of session files
+	MaxSizeMB  int `json:"max_size_mb,omitempty"`  // Rotate a session's file at this size (default 10)
+	MaxFiles   int `json:"max_files,omitempty"`    // Rotated files kept per session (default 3)
+	MaxAgeDays int `json:"max_age_days,omitempty"` // Delete files not written for this long (default 30)
+	MaxTotalMB int `json:"max_total_mb,omitempty"` // Delete the oldest files beyond this total (0: no limit)
+}
+
+// Validate rejects unknown levels and formats
+func (c Config) Validate() error {
+	if _, err := c.level(); err != nil {
+		return err
+	}
+	switch c.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown log format: %s", c.Format)
+	}
+	if c.MaxSizeMB < 0 || c.MaxFiles < 0 || c.MaxAgeDays < 0 || c.MaxTotalMB < 0 {
+		return fmt.Errorf("log rotation limits cannot be negative")
+	}
+	return nil
+}
+
+func (c Config) level() (slog.Level, error) {
+	var level slog.Level
+	if c.Level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return 0, fmt.Errorf("unknown log level: %s", c.Level)
+	}
+	return level, nil
+}
+
+// Setup installs the configured logger as the slog and log package default.
+// Session files go to dir; RunRetention keeps them within the configured
+// age and total size.
+func Setup(c Config, dir string) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	level, _ := c.level()
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if c.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+
+	if c.SessionFiles {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		files := newSessionFiles(c, dir, options)
+		handler = &sessionHandler{base: handler, files: files}
+		active.Store(files)
+	} else {
+		active.Store(nil)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// sessionHandler passes records to the base handler and copies those
+// about a session to the session's file
+type sessionHandler struct {
+	base    slog.Handler
+	files   *sessionFiles
+	session string                            // Session bound with With, if any
+	derive  []func(slog.Handler) slog.Handler // With/WithGroup calls, replayed on file handlers
+}
+
+func (h *sessionHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.base.Enabled(ctx, level)
+}
+
+func (h *sessionHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.base.Handle(ctx, r)
+
+	sessionID := h.session
+	if sessionID == "" {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == SessionKey {
+				sessionID = a.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if sessionID != "" {
+		h.files.write(ctx, sessionID, h.derive, r)
+	}
+	return err
+}
+
+func (h *sessionHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.base = h.base.WithAttrs(attrs)
+	if len(h.derive) == 0 { // Only top-level attributes name the session
+		for _, a := range attrs {
+			if a.Key == SessionKey {
+				next.session = a.Value.String()
+			}
+		}
+	}
+	next.derive = append(h.derive[:len(h.derive):len(h.derive)], func(fh slog.Handler) slog.Handler {
+		return fh.WithAttrs(attrs)
+	})
+	return &next
+}
+
+func (h *sessionHandler) WithGroup(name string) slog.Handler {
+	next := *h
+	next.base = h.base.WithGroup(name)
+	next.derive = append(h.derive[:len(h.derive):len(h.derive)], func(fh slog.Handler) slog.Handler {
+		return fh.WithGroup(name)
+	})
+	return &next
+}
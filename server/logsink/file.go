@@ -0,0 +1,84 @@
+package logsink
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileSink appends lines to a file, rotating it to path.1 … path.N by size
+type fileSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openFile(c Config) (*fileSink, error) {
+	s := &fileSink{path: c.Path, maxSize: int64(c.MaxSizeMB) << 20, maxFiles: c.MaxFiles}
+	if s.maxSize == 0 {
+		s.maxSize = 100 << 20
+	}
+	if s.maxFiles == 0 {
+		s.maxFiles = 5
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, err
+	}
+	return s, s.open()
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 -> path.N … path -> path.1 and reopens path
+func (s *fileSink) rotate() error {
+	s.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.open()
+}
+
+func (s *fileSink) Write(lines []Line) error {
+	w := bufio.NewWriter(s.file)
+	for _, l := range lines {
+		if s.size >= s.maxSize {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			w = bufio.NewWriter(s.file)
+		}
+		n, err := fmt.Fprintln(w, format(l))
+		if err != nil {
+			return err
+		}
+		s.size += int64(n)
+	}
+	return w.Flush()
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
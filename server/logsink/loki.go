@@ -0,0 +1,74 @@
+package logsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lokiSink pushes batches to Loki's push API, one stream per session
+type lokiSink struct {
+	url    string
+	labels map[string]string
+	client *http.Client
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func newLoki(c Config) *lokiSink {
+	return &lokiSink{
+		url:    strings.TrimSuffix(c.URL, "/") + "/loki/api/v1/push",
+		labels: c.Labels,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *lokiSink) Write(lines []Line) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, l := range lines {
+		st, ok := streams[l.SessionID]
+		if !ok {
+			labels := map[string]string{"job": "claudex", "session_id": l.SessionID, "session": l.Session}
+			for k, v := range s.labels {
+				labels[k] = v
+			}
+			st = &lokiStream{Stream: labels}
+			streams[l.SessionID] = st
+			order = append(order, l.SessionID)
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(l.Time.UnixNano(), 10), l.Text})
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, id := range order {
+		body.Streams = append(body.Streams, streams[id])
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("loki push: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *lokiSink) Close() error {
+	return nil
+}
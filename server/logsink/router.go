@@ -0,0 +1,236 @@
+package logsink
+
+import (
+	"bytes"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 256         // Batches buffered per sink before output is dropped
+	flushInterval = time.Second // How often buffered lines are handed to the sinks
+	maxPartial    = 64 * 1024   // Longest unterminated line kept between chunks
+)
+
+// ansiPattern matches CSI and OSC escape sequences and other two-byte escapes
+var ansiPattern = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// worker feeds one sink from a queue so a slow sink never blocks the PTY
+type worker struct {
+	name    string
+	sink    Sink
+	queue   chan []Line
+	done    chan struct{}
+	dropped bool
+}
+
+func newWorker(name string, sink Sink) *worker {
+	w := &worker{name: name, sink: sink, queue: make(chan []Line, queueSize), done: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+func (w *worker) run() {
+	defer close(w.done)
+	for lines := range w.queue {
+		if err := w.sink.Write(lines); err != nil {
+			slog.Warn("Log sink write failed", "sink", w.name, "err", err)
+		}
+	}
+	w.sink.Close()
+}
+
+func (w *worker) send(lines []Line) {
+	select {
+	case w.queue <- lines:
+		w.dropped = false
+	default:
+		if !w.dropped {
+			slog.Warn("Log sink is falling behind, dropping output", "sink", w.name)
+			w.dropped = true
+		}
+	}
+}
+
+func (w *worker) close() {
+	close(w.queue)
+	<-w.done
+}
+
+// Router splits session output into lines and hands them to the global
+// sinks and to each session's own sinks
+type Router struct {
+	mu         sync.Mutex
+	sessionDir string // Where sessions' own file sinks are written
+	global     []*worker
+	sessions   map[string][]*worker // Session ID -> its own sinks
+	partial    map[string][]byte    // Session ID -> unterminated last line
+	pending    map[string][]Line    // Session ID -> lines waiting for the next flush
+	stop       chan struct{}
+}
+
+// NewRouter opens the global sinks; ones that fail to open are logged and
+// skipped. Sessions' own file sinks are written under sessionDir.
+func NewRouter(global []Config, sessionDir string) *Router {
+	r := &Router{
+		sessionDir: sessionDir,
+		sessions:   make(map[string][]*worker),
+		partial:    make(map[string][]byte),
+		pending:    make(map[string][]Line),
+		stop:       make(chan struct{}),
+	}
+	r.global = openWorkers(global, "global")
+	go r.run()
+	return r
+}
+
+func openWorkers(configs []Config, owner string) []*worker {
+	var workers []*worker
+	for _, c := range configs {
+		sink, err := Open(c)
+		if err != nil {
+			slog.Error("Cannot open log sink", "owner", owner, "type", c.Type, "err", err)
+			continue
+		}
+		workers = append(workers, newWorker(owner+" "+c.Type, sink))
+	}
+	return workers
+}
+
+// SetSessionSinks replaces a session's own sinks (nil closes them)
+func (r *Router) SetSessionSinks(sessionID string, configs []Config) error {
+	resolved := make([]Config, 0, len(configs))
+	for _, c := range configs {
+		if err := c.ValidateSession(); err != nil {
+			return err
+		}
+		if c.Type == TypeFile {
+			c.Path = filepath.Join(r.sessionDir, c.Path)
+		}
+		resolved = append(resolved, c)
+	}
+	workers := openWorkers(resolved, "session "+sessionID)
+
+	r.mu.Lock()
+	r.flushSession(sessionID)
+	old := r.sessions[sessionID]
+	if len(workers) > 0 {
+		r.sessions[sessionID] = workers
+	} else {
+		delete(r.sessions, sessionID)
+	}
+	r.mu.Unlock()
+
+	for _, w := range old {
+		w.close()
+	}
+	return nil
+}
+
+// RemoveSession closes a deleted session's sinks and drops its buffers
+func (r *Router) RemoveSession(sessionID string) {
+	r.SetSessionSinks(sessionID, nil)
+	r.mu.Lock()
+	delete(r.partial, sessionID)
+	r.mu.Unlock()
+}
+
+// Write adds a chunk of a session's terminal output
+func (r *Router) Write(sessionID, name string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.global) == 0 && len(r.sessions[sessionID]) == 0 {
+		return
+	}
+
+	buf := append(r.partial[sessionID], data...)
+	now := time.Now()
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		if text := cleanLine(buf[:i]); text != "" {
+			r.pending[sessionID] = append(r.pending[sessionID], Line{Time: now, SessionID: sessionID, Session: name, Text: text})
+		}
+		buf = buf[i+1:]
+	}
+	if len(buf) > maxPartial {
+		buf = buf[len(buf)-maxPartial:]
+	}
+	r.partial[sessionID] = append([]byte(nil), buf...)
+}
+
+// cleanLine strips escape sequences and keeps what's left after the last
+// carriage return (progress bars and spinners redraw the same line)
+func cleanLine(b []byte) string {
+	text := ansiPattern.ReplaceAllString(string(b), "")
+	text = strings.TrimRight(text, "\r")
+	if i := strings.LastIndexByte(text, '\r'); i >= 0 {
+		text = text[i+1:]
+	}
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.TrimSpace(text)
+}
+
+// run flushes buffered lines to the sinks once per interval
+func (r *Router) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			for sessionID := range r.pending {
+				r.flushSession(sessionID)
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// flushSession hands a session's buffered lines to its sinks (caller must hold the lock)
+func (r *Router) flushSession(sessionID string) {
+	lines := r.pending[sessionID]
+	delete(r.pending, sessionID)
+	if len(lines) == 0 {
+		return
+	}
+	for _, w := range r.global {
+		w.send(lines)
+	}
+	for _, w := range r.sessions[sessionID] {
+		w.send(lines)
+	}
+}
+
+// Close flushes what's buffered and closes every sink
+func (r *Router) Close() {
+	close(r.stop)
+	r.mu.Lock()
+	for sessionID := range r.pending {
+		r.flushSession(sessionID)
+	}
+	workers := r.global
+	for _, ws := range r.sessions {
+		workers = append(workers, ws...)
+	}
+	r.global = nil
+	r.sessions = make(map[string][]*worker)
+	r.mu.Unlock()
+
+	for _, w := range workers {
+		w.close()
+	}
+}
@@ -0,0 +1,116 @@
+// Package logsink copies session terminal output to external log
+// infrastructure (rotating files, syslog, Loki) as plain text lines.
+package logsink
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Sink types
+const (
+	TypeFile   = "file"
+	TypeSyslog = "syslog"
+	TypeLoki   = "loki"
+)
+
+// Config describes one output sink
+type Config struct {
+	Type string `json:"type"` // file, syslog or loki
+
+	// File
+	Path      string `json:"path,omitempty"`        // Relative to the session sink directory for a session's own sinks
+	MaxSizeMB int    `json:"max_size_mb,omitempty"` // Rotate at this size (default 100)
+	MaxFiles  int    `json:"max_files,omitempty"`   // Rotated files kept (default 5)
+
+	// Syslog
+	Network string `json:"network,omitempty"` // "" for the local daemon, or udp/tcp
+	Address string `json:"address,omitempty"`
+	Tag     string `json:"tag,omitempty"` // Default "claudex"
+
+	// Loki
+	URL    string            `json:"url,omitempty"`    // Base URL, e.g. http://loki:3100
+	Labels map[string]string `json:"labels,omitempty"` // Extra stream labels
+}
+
+// Line is one line of terminal output with ANSI sequences removed
+type Line struct {
+	Time      time.Time
+	SessionID string
+	Session   string // Session name
+	Text      string
+}
+
+// Sink receives batches of output lines
+type Sink interface {
+	Write(lines []Line) error
+	Close() error
+}
+
+// Validate checks that the config has what its type needs
+func (c Config) Validate() error {
+	switch c.Type {
+	case TypeFile:
+		if c.Path == "" {
+			return fmt.Errorf("file sink needs a path")
+		}
+	case TypeSyslog:
+		if (c.Network == "") != (c.Address == "") {
+			return fmt.Errorf("syslog sink needs both network and address, or neither")
+		}
+	case TypeLoki:
+		if c.URL == "" {
+			return fmt.Errorf("loki sink needs a url")
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q", c.Type)
+	}
+	if c.MaxSizeMB < 0 || c.MaxFiles < 0 {
+		return fmt.Errorf("rotation settings must not be negative")
+	}
+	return nil
+}
+
+// ValidateSession checks a sink set through a session rather than in
+// config.json, which any API client can do: files must stay in the
+// session sink directory, syslog goes to the local daemon only, and Loki,
+// which can send output to any host, is left to config.json
+func (c Config) ValidateSession() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	switch c.Type {
+	case TypeFile:
+		if !filepath.IsLocal(c.Path) {
+			return fmt.Errorf("session file sinks need a relative path inside the sink directory: %q", c.Path)
+		}
+	case TypeSyslog:
+		if c.Network != "" {
+			return fmt.Errorf("session syslog sinks can only use the local daemon")
+		}
+	case TypeLoki:
+		return fmt.Errorf("loki sinks can only be configured in config.json")
+	}
+	return nil
+}
+
+// Open creates the sink described by the config
+func Open(c Config) (Sink, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case TypeFile:
+		return openFile(c)
+	case TypeSyslog:
+		return openSyslog(c)
+	default:
+		return newLoki(c), nil
+	}
+}
+
+// format renders a line for text sinks
+func format(l Line) string {
+	return fmt.Sprintf("%s session=%s name=%q %s", l.Time.Format(time.RFC3339Nano), l.SessionID, l.Session, l.Text)
+}
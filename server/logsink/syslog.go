@@ -0,0 +1,35 @@
+//go:build !windows
+
+package logsink
+
+import "log/syslog"
+
+// syslogSink sends each line as an info message
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func openSyslog(c Config) (*syslogSink, error) {
+	tag := c.Tag
+	if tag == "" {
+		tag = "claudex"
+	}
+	w, err := syslog.Dial(c.Network, c.Address, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: w}, nil
+}
+
+func (s *syslogSink) Write(lines []Line) error {
+	for _, l := range lines {
+		if err := s.writer.Info("session=" + l.SessionID + " name=" + l.Session + " " + l.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,18 @@
+package logsink
+
+import "errors"
+
+// syslogSink is unavailable: Go's log/syslog doesn't support Windows
+type syslogSink struct{}
+
+func openSyslog(c Config) (*syslogSink, error) {
+	return nil, errors.New("syslog sinks are not supported on Windows")
+}
+
+func (s *syslogSink) Write(lines []Line) error {
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	return nil
+}
@@ -1,76 +1,239 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"claudex/claude"
+	"claudex/grpcapi"
+	"claudex/logging"
+	"claudex/logsink"
+	"claudex/notify"
 	"claudex/session"
+	"claudex/watchdog"
 	"claudex/ws"
 )
 
-type Config struct {
-	Port int `json:"port"`
-}
+func main() {
+	config := loadConfig()
 
-func loadConfig() Config {
-	config := Config{Port: 9090} // defaults
+	readOnly := flag.Bool("readonly", config.ReadOnly, "Observer mode: serve sessions read-only (no input, start/stop or git operations)")
+	demo := flag.Bool("demo", false, "Create the onboarding demo project and session on startup")
+	logLevel := flag.String("log-level", config.Logging.Level, "Log level: debug, info, warn or error")
+	dev := flag.Bool("dev", config.Dev, "Development mode: accept WebSocket and REST requests from any origin")
+	flag.Parse()
+
+	config.Logging.Level = *logLevel
+	if err := logging.Setup(config.Logging, config.storagePath("logs")); err != nil {
+		logging.Setup(logging.Config{}, "")
+		slog.Warn("Ignoring logging config", "err", err)
+	}
 
-	configPath := os.ExpandEnv("$HOME/.claudex/config.json")
-	data, err := os.ReadFile(configPath)
+	// Sockets and notification channel from systemd, taken before any child
+	// process can inherit them
+	activated, err := takeSystemdEnv()
 	if err != nil {
-		return config
+		slog.Error("Cannot use socket activation", "err", err)
+		os.Exit(1)
 	}
 
-	json.Unmarshal(data, &config)
-	return config
-}
+	timeouts, _ := config.Timeouts.parse() // Checked by loadConfig
+	session.SetTimeouts(timeouts.session)
+	session.SetShell(config.Shell)
+	session.SetClaudeBinary(config.ClaudeBinary)
+	session.SetDockerConfig(config.Docker)
+	if err := session.SetDefaultBackend(config.Backend); err != nil {
+		slog.Warn("Ignoring backend", "err", err)
+	}
+	if err := session.SetScrollbackLimit(config.ScrollbackMB); err != nil {
+		slog.Warn("Ignoring scrollback_mb", "err", err)
+	}
+	if err := session.SetScrollbackMax(config.ScrollbackMaxMB); err != nil {
+		slog.Warn("Ignoring scrollback_max_mb", "err", err)
+	}
+	session.SetSandboxInstance(config.StorageDir)
+	session.CleanupSandboxContainers()
 
-func main() {
-	config := loadConfig()
+	// Metadata keys must be known before sessions load so stored values migrate
+	for _, field := range config.MetadataSchema {
+		if err := session.RegisterMetadataField(field); err != nil {
+			slog.Warn("Ignoring metadata schema entry", "err", err)
+		}
+	}
 
 	// Session manager - use global path so sessions are shared across worktrees
-	sessionsDir := os.ExpandEnv("$HOME/.claudex/sessions")
+	sessionsDir := config.storagePath("sessions")
 	manager := session.NewManager(sessionsDir)
+	manager.SetPortPool(config.PortPool)
 
 	// WebSocket handler
 	wsHandler := ws.NewHandler(manager)
+	wsHandler.SetReadOnly(*readOnly)
+
+	// Output sinks - copies of session output for existing log infrastructure
+	sinks := logsink.NewRouter(config.LogSinks, config.storagePath("logs/sinks"))
+	wsHandler.SetLogSinks(sinks)
+
+	// Event outbox - persisted so notifications survive restarts and outages
+	outbox := notify.NewOutbox(config.storagePath("outbox.json"))
+
+	// Notification rules: static ones from config.json plus imported ones
+	rules := notify.NewRuleStore(config.storagePath("rules.json"),
+		notify.Rules{Version: notify.RulesVersion, Webhooks: config.Webhooks, Emails: config.Emails}, outbox)
+	wsHandler.SetRules(rules)
+
+	// Limits, notification targets, detection patterns, origins and the input
+	// audit log (one append-only JSONL file per session) follow config.json
+	live := &liveConfig{
+		manager:  manager,
+		handler:  wsHandler,
+		rules:    rules,
+		dev:      *dev,
+		auditDir: config.storagePath("audit"),
+		started:  config,
+	}
+	live.apply(config)
+
+	stopBackground := make(chan struct{})
+	go outbox.Run(stopBackground)
+	manager.SetIdleStopCallback(wsHandler.IdleStopped)
+	go manager.RunIdleStop(stopBackground)
+	go manager.RunLiveness(stopBackground)
+	go wsHandler.RunBudgetChecks(stopBackground)
+	go logging.RunRetention(stopBackground)
+	go live.watch(stopBackground)
+	wsHandler.SetOutbox(outbox)
 
-	// Routes
-	http.HandleFunc("/ws", wsHandler.HandleConnection)
-	http.HandleFunc("/api/sessions", wsHandler.HandleSessions)
-	http.HandleFunc("/api/sessions/create", wsHandler.HandleCreateSession)
-	http.HandleFunc("/api/sessions/experiment", wsHandler.HandleCreateExperiment)
-	http.HandleFunc("/api/sessions/", wsHandler.HandleSessionUpdate)
-	http.HandleFunc("/api/client-state", wsHandler.HandleClientState)
-	http.HandleFunc("/api/worktree", wsHandler.HandleWorktree)
-	http.HandleFunc("/api/worktree/merge", wsHandler.HandleWorktreeMerge)
-	http.HandleFunc("/api/worktree/discard", wsHandler.HandleWorktreeDiscard)
+	// Watchdog - surfaces the server's own failures via the "system" pseudo-session
+	wd := watchdog.New()
+	wsHandler.SetWatchdog(wd)
+	manager.SetStorageErrorCallback(func(err error) {
+		wd.Report(watchdog.KindStorageWrite, "%v", err)
+	})
+	claude.SetParseErrorHandler(func(path string, err error) {
+		wd.Report(watchdog.KindTranscriptParse, "%s: %v", path, err)
+	})
+
+	if *demo {
+		if sess, err := manager.CreateDemo(session.Claim{}); err != nil {
+			slog.Error("Failed to create demo session", "err", err)
+		} else {
+			slog.Info("Demo session ready", "session", sess.ID, "dir", sess.Directory)
+		}
+	}
+
+	// Routes - the REST API under /api/v1, its old unversioned paths as aliases
+	mux := http.NewServeMux()
+	wsHandler.RegisterRoutes(mux)
+	mux.HandleFunc("/ws", wsHandler.HandleConnection)
+	mux.HandleFunc("/wall", wsHandler.HandleWall)
 
 	// Static files (web frontend)
-	webDir := os.ExpandEnv("$HOME/.claudex/web")
-	http.Handle("/", http.FileServer(http.Dir(webDir)))
+	mux.Handle("/", http.FileServer(http.Dir(config.WebDir)))
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = fmt.Sprintf("%d", config.Port)
 	}
 
-	// Handle shutdown gracefully - save all session states
+	// Listen on the socket systemd opened, a TCP port, or only on a local
+	// socket for a reverse proxy
+	lis := activated.http
+	if lis == nil {
+		if socket := socketPath(config.Listen); socket != "" {
+			lis, err = listenUnix(socket)
+		} else {
+			lis, err = net.Listen("tcp", net.JoinHostPort(config.Bind, port))
+		}
+		if err != nil {
+			slog.Error("Cannot listen", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Lets processes in sessions (e.g. the statusline command) reach the server
+	url, socket := clientURL(lis.Addr())
+	os.Setenv("CLAUDEX_URL", url)
+	if socket != "" {
+		os.Setenv("CLAUDEX_SOCKET", socket)
+	}
+
+	// Requests see their context cancelled at shutdown, which ends streams
+	// (narration, transcript tails) that would otherwise hold it up
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Handler:     wsHandler.CORSMiddleware(wsHandler.ReadOnlyMiddleware(mux)),
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	server.RegisterOnShutdown(cancelRequests)
+	server.RegisterOnShutdown(wsHandler.Shutdown)
+
+	// gRPC API on its own port (or systemd socket) for typed, streaming
+	// clients. A server kept off the network on a socket keeps it on loopback.
+	grpcLis := activated.grpc
+	if grpcLis == nil && config.GRPCPort > 0 {
+		bind := config.Bind
+		if config.Listen != "" {
+			bind = "127.0.0.1"
+		}
+		grpcLis, err = net.Listen("tcp", net.JoinHostPort(bind, fmt.Sprint(config.GRPCPort)))
+		if err != nil {
+			slog.Error("Cannot listen for the gRPC API", "err", err)
+		}
+	}
+	if grpcLis != nil {
+		grpcServer := grpcapi.NewGRPCServer(wsHandler, manager)
+		server.RegisterOnShutdown(grpcServer.Stop) // Streams never finish on their own
+		go grpcServer.Serve(grpcLis)
+		slog.Info("gRPC API listening", "addr", grpcLis.Addr().String())
+	}
+
+	// Handle shutdown gracefully - finish requests, end session processes, save state
+	stopped := make(chan struct{})
 	go func() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
 
-		log.Println("Shutting down, saving session states...")
-		manager.SaveAllSessions()
-		os.Exit(0)
+		sdNotify("STOPPING=1")
+		slog.Info("Shutting down, waiting for in-flight requests")
+		ctx, cancel := context.WithTimeout(context.Background(), timeouts.shutdown)
+		if err := server.Shutdown(ctx); err != nil {
+			slog.Warn("HTTP shutdown", "err", err)
+		}
+		cancel()
+
+		slog.Info("Stopping sessions and saving session states")
+		manager.Shutdown(timeouts.processGrace)
+		session.StopSandboxContainers()
+		sinks.Close()
+		close(stopBackground)
+		close(stopped)
 	}()
 
-	log.Printf("Claudex server starting on http://localhost:%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	if *readOnly {
+		slog.Info("Running in read-only observer mode")
+	}
+	if *dev {
+		slog.Warn("Development mode: accepting requests from any origin")
+	}
+	if socket != "" {
+		slog.Info("Claudex server starting", "socket", socket)
+	} else {
+		slog.Info("Claudex server starting", "url", url)
+	}
+	go runSystemdWatchdog(stopBackground)
+	sdNotify("READY=1\nSTATUS=Serving on " + lis.Addr().String())
+	if err := server.Serve(lis); err != http.ErrServerClosed {
+		slog.Error("Server failed", "err", err)
+		os.Exit(1)
+	}
+	<-stopped
 }
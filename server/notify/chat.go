@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Webhook types: the generic JSON webhook and built-in chat/push integrations
+const (
+	TypeWebhook = "webhook" // Event JSON posted as-is (default)
+	TypeNtfy    = "ntfy"    // ntfy.sh (or self-hosted) topic
+	TypeSlack   = "slack"   // Slack incoming webhook
+	TypeDiscord = "discord" // Discord channel webhook
+)
+
+// DefaultNtfyServer is used for ntfy notifiers configured with only a topic
+const DefaultNtfyServer = "https://ntfy.sh"
+
+// validType reports whether t names a supported webhook type
+func validType(t string) bool {
+	switch t {
+	case "", TypeWebhook, TypeNtfy, TypeSlack, TypeDiscord:
+		return true
+	}
+	return false
+}
+
+// eventTitle is the short headline shown by push and chat integrations
+func eventTitle(e Event) string {
+	if e.SessionName != "" {
+		return "claudex: " + e.SessionName
+	}
+	return "claudex"
+}
+
+// eventText is the human-readable body of an event
+func eventText(e Event) string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return e.Type
+}
+
+// urgent reports whether an event needs the user's attention right away
+func urgent(e Event) bool {
+	switch e.Type {
+	case EventBudgetAlert, EventSystemProblem:
+		return true
+	case EventStatusChanged:
+		return e.Data["status"] == "waiting_input"
+	}
+	return false
+}
+
+// sendSlack posts the event to a Slack incoming webhook
+func sendSlack(url string, e Event) error {
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", eventTitle(e), eventText(e)),
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(url, body, nil)
+}
+
+// sendDiscord posts the event to a Discord channel webhook
+func sendDiscord(url string, e Event) error {
+	body, err := json.Marshal(map[string]string{
+		"content": fmt.Sprintf("**%s**\n%s", eventTitle(e), eventText(e)),
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(url, body, nil)
+}
+
+// sendNtfy publishes the event to an ntfy topic URL
+func sendNtfy(url string, e Event, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(eventText(e)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", eventTitle(e))
+	req.Header.Set("Tags", strings.ReplaceAll(e.Type, ".", "-"))
+	if urgent(e) {
+		req.Header.Set("Priority", "high")
+	}
+	// Headers carry credentials (e.g. Authorization) for protected topics
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
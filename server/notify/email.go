@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig configures an SMTP notifier
+type EmailConfig struct {
+	Name     string   `json:"name"`
+	Host     string   `json:"host"`
+	Port     int      `json:"port,omitempty"` // Default 587 (STARTTLS is used when offered)
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Digest   string   `json:"digest,omitempty"` // Batch events into one email per interval (e.g. "15m"); empty sends each event
+	Filter
+}
+
+// Email sends events through an SMTP server, one per message or batched into
+// digests (it is a Batcher)
+type Email struct {
+	config EmailConfig
+	digest time.Duration
+}
+
+// NewEmail creates an email notifier
+func NewEmail(config EmailConfig) (*Email, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("email %q has no host", config.Name)
+	}
+	if config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("email %q needs from and to addresses", config.Name)
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	config.Name = config.key()
+	e := &Email{config: config}
+	if config.Digest != "" {
+		d, err := time.ParseDuration(config.Digest)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("email %q has invalid digest interval %q", config.Name, config.Digest)
+		}
+		e.digest = d
+	}
+	return e, nil
+}
+
+// key identifies an email config: its name, or its recipients if unnamed
+func (c EmailConfig) key() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return "email:" + strings.Join(c.To, ",")
+}
+
+// Name returns the notifier name
+func (n *Email) Name() string {
+	return n.config.Name
+}
+
+// Accepts reports whether the notifier wants this event
+func (n *Email) Accepts(e Event) bool {
+	return n.config.Match(e)
+}
+
+// Send emails the event
+func (n *Email) Send(e Event) error {
+	return n.mail(eventTitle(e), eventText(e)+"\n")
+}
+
+// BatchInterval returns the digest interval, 0 without digests
+func (n *Email) BatchInterval() time.Duration {
+	return n.digest
+}
+
+// SendBatch sends the events as a single digest email
+func (n *Email) SendBatch(events []Event) error {
+	var body strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&body, "%s  %s: %s\n", e.Time.Format("15:04:05"), eventTitle(e), eventText(e))
+	}
+	return n.mail(fmt.Sprintf("claudex: %d update(s)", len(events)), body.String())
+}
+
+// mail sends one plain-text message
+func (n *Email) mail(subject, body string) error {
+	addr := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	// Session names end up in the subject: no line breaks may start a new
+	// header, and non-ASCII is encoded as RFC 2047 requires
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(addr, auth, n.config.From, n.config.To, []byte(msg.String()))
+}
@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published by the server
+const (
+	EventStatusChanged = "session.status"     // A session changed status (Data["status"])
+	EventBudgetAlert   = "session.budget"     // A session crossed a budget threshold (Data["threshold"], Data["cost_usd"], Data["tokens"])
+	EventSystemProblem = "system.problem"     // The server detected an internal failure (Data["kind"], Data["count"])
+	EventIdleStopped   = "session.idle"       // The idle policy stopped a session
+	EventInterrupted   = "session.interrupt"  // A client interrupted Claude's turn (Data["status"], Data["follow_up"])
+	EventPermission    = "session.permission" // Claude is asking to use a tool (Data["tool"], Data["command"])
+)
+
+// Event is something that happened in claudex that notifiers may deliver
+type Event struct {
+	ID          string         `json:"id"`
+	Type        string         `json:"type"`
+	SessionID   string         `json:"session_id,omitempty"`
+	SessionName string         `json:"session_name,omitempty"`
+	Message     string         `json:"message,omitempty"`
+	Data        map[string]any `json:"data,omitempty"`
+	Time        time.Time      `json:"time"`
+}
+
+// NewEvent creates an event with a fresh ID and timestamp
+func NewEvent(eventType, sessionID, sessionName, message string) Event {
+	return Event{
+		ID:          uuid.New().String(),
+		Type:        eventType,
+		SessionID:   sessionID,
+		SessionName: sessionName,
+		Message:     message,
+		Data:        make(map[string]any),
+		Time:        time.Now(),
+	}
+}
+
+// Notifier delivers events to an external system
+type Notifier interface {
+	// Name uniquely identifies the notifier (used to route outbox entries)
+	Name() string
+	// Accepts reports whether the notifier wants this event
+	Accepts(e Event) bool
+	// Send delivers the event; an error means the delivery should be retried
+	Send(e Event) error
+}
+
+// Batcher is a Notifier that delivers events in batches. The outbox holds
+// its deliveries for the batch interval and hands over all that are due in
+// one SendBatch, so batched events are persisted, retried and dead-lettered
+// like any other.
+type Batcher interface {
+	Notifier
+	// BatchInterval is how long events are collected (0 sends them one by one)
+	BatchInterval() time.Duration
+	// SendBatch delivers the events together; an error retries all of them
+	SendBatch(events []Event) error
+}
+
+// Filter selects events by type and session status
+type Filter struct {
+	Events   []string `json:"events,omitempty"`   // Event types to deliver (all if empty)
+	Statuses []string `json:"statuses,omitempty"` // For status events, only these statuses (all if empty)
+}
+
+// Match reports whether an event passes the filter
+func (f Filter) Match(e Event) bool {
+	if len(f.Events) > 0 && !contains(f.Events, e.Type) {
+		return false
+	}
+	if len(f.Statuses) > 0 && e.Type == EventStatusChanged {
+		status, _ := e.Data["status"].(string)
+		if !contains(f.Statuses, status) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Retry configuration for outbox deliveries
+const (
+	MaxAttempts    = 20               // Deliveries are dead-lettered after this many failures
+	InitialBackoff = 5 * time.Second  // Delay before the first retry
+	MaxBackoff     = 10 * time.Minute // Upper bound for the retry delay
+)
+
+// Delivery is one event queued for one notifier
+type Delivery struct {
+	ID          string    `json:"id"`
+	Sink        string    `json:"sink"`
+	Event       Event     `json:"event"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// outboxFile is the on-disk representation of the outbox
+type outboxFile struct {
+	Pending []*Delivery `json:"pending"`
+	Dead    []*Delivery `json:"dead"`
+}
+
+// Outbox persists events until every notifier has acknowledged them,
+// retrying with exponential backoff and keeping failures in a dead-letter list
+type Outbox struct {
+	path      string
+	mu        sync.Mutex
+	pending   []*Delivery
+	dead      []*Delivery
+	notifiers map[string]Notifier
+	wake      chan struct{}
+}
+
+// NewOutbox creates an outbox persisted at path, loading any queued deliveries
+func NewOutbox(path string) *Outbox {
+	o := &Outbox{
+		path:      path,
+		notifiers: make(map[string]Notifier),
+		wake:      make(chan struct{}, 1),
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		var file outboxFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			slog.Warn("Failed to load outbox", "path", path, "err", err)
+		} else {
+			o.pending = file.Pending
+			o.dead = file.Dead
+		}
+	}
+	return o
+}
+
+// SetNotifiers replaces the registered notifiers. Queued deliveries for
+// notifiers that disappear are dead-lettered on their next attempt.
+func (o *Outbox) SetNotifiers(notifiers []Notifier) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.notifiers = make(map[string]Notifier)
+	for _, n := range notifiers {
+		o.notifiers[n.Name()] = n
+	}
+}
+
+// Publish queues an event for every notifier that accepts it
+func (o *Outbox) Publish(e Event) {
+	o.mu.Lock()
+	queued := 0
+	now := time.Now()
+	for name, n := range o.notifiers {
+		if !n.Accepts(e) {
+			continue
+		}
+		o.pending = append(o.pending, &Delivery{
+			ID:          uuid.New().String(),
+			Sink:        name,
+			Event:       e,
+			NextAttempt: o.firstAttempt(name, n, now),
+			CreatedAt:   now,
+		})
+		queued++
+	}
+	if queued > 0 {
+		o.save()
+	}
+	o.mu.Unlock()
+
+	if queued > 0 {
+		o.notify()
+	}
+}
+
+// firstAttempt returns when a new delivery to a notifier is first tried:
+// right away, or for a Batcher with the batch already collecting (or one
+// interval from now if none is) (caller must hold the lock)
+func (o *Outbox) firstAttempt(name string, n Notifier, now time.Time) time.Time {
+	b, ok := n.(Batcher)
+	if !ok || b.BatchInterval() == 0 {
+		return now
+	}
+	for _, d := range o.pending {
+		if d.Sink == name && d.Attempts == 0 && d.NextAttempt.After(now) {
+			return d.NextAttempt
+		}
+	}
+	return now.Add(b.BatchInterval())
+}
+
+// Run delivers queued events until stop is closed
+func (o *Outbox) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+		o.deliverDue()
+	}
+}
+
+// deliverDue attempts every delivery whose retry time has come
+func (o *Outbox) deliverDue() {
+	now := time.Now()
+
+	o.mu.Lock()
+	var due []*Delivery
+	for _, d := range o.pending {
+		if !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+	o.mu.Unlock()
+
+	batches := make(map[string][]*Delivery)
+	for _, d := range due {
+		o.mu.Lock()
+		n, ok := o.notifiers[d.Sink]
+		o.mu.Unlock()
+
+		if b, isBatcher := n.(Batcher); ok && isBatcher && b.BatchInterval() > 0 {
+			batches[d.Sink] = append(batches[d.Sink], d)
+			continue
+		}
+		var err error
+		if !ok {
+			err = errUnknownSink
+		} else {
+			err = n.Send(d.Event)
+		}
+		o.complete(d, err)
+	}
+
+	for name, batch := range batches {
+		o.mu.Lock()
+		b, _ := o.notifiers[name].(Batcher)
+		o.mu.Unlock()
+		events := make([]Event, len(batch))
+		for i, d := range batch {
+			events[i] = d.Event
+		}
+		var err error
+		if b == nil {
+			err = errUnknownSink
+		} else {
+			err = b.SendBatch(events)
+		}
+		for _, d := range batch {
+			o.complete(d, err)
+		}
+	}
+}
+
+// complete records the outcome of a delivery attempt
+func (o *Outbox) complete(d *Delivery, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err == nil {
+		o.pending = removeDelivery(o.pending, d.ID)
+		o.save()
+		return
+	}
+
+	d.Attempts++
+	d.LastError = err.Error()
+	if d.Attempts >= MaxAttempts || err == errUnknownSink {
+		slog.Warn("Dead-lettering notification",
+			"event", d.Event.Type, "sink", d.Sink, "attempts", d.Attempts, "err", err)
+		o.pending = removeDelivery(o.pending, d.ID)
+		o.dead = append(o.dead, d)
+	} else {
+		d.NextAttempt = time.Now().Add(backoff(d.Attempts))
+		slog.Info("Notification delivery failed, will retry",
+			"sink", d.Sink, "attempt", d.Attempts, "next_attempt", d.NextAttempt.Format(time.RFC3339), "err", err)
+	}
+	o.save()
+}
+
+// Pending returns a snapshot of queued deliveries
+func (o *Outbox) Pending() []Delivery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return copyDeliveries(o.pending)
+}
+
+// Dead returns a snapshot of dead-lettered deliveries
+func (o *Outbox) Dead() []Delivery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return copyDeliveries(o.dead)
+}
+
+// Replay moves dead-lettered deliveries back into the queue. If ids is empty,
+// every dead letter is replayed. It returns the number of deliveries requeued.
+func (o *Outbox) Replay(ids []string) int {
+	o.mu.Lock()
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var remaining []*Delivery
+	replayed := 0
+	now := time.Now()
+	for _, d := range o.dead {
+		if len(ids) > 0 && !wanted[d.ID] {
+			remaining = append(remaining, d)
+			continue
+		}
+		d.Attempts = 0
+		d.NextAttempt = now
+		o.pending = append(o.pending, d)
+		replayed++
+	}
+	o.dead = remaining
+	if replayed > 0 {
+		o.save()
+	}
+	o.mu.Unlock()
+
+	if replayed > 0 {
+		o.notify()
+	}
+	return replayed
+}
+
+// Purge drops dead letters. If ids is empty, all are removed.
+func (o *Outbox) Purge(ids []string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	before := len(o.dead)
+	if len(ids) == 0 {
+		o.dead = nil
+	} else {
+		for _, id := range ids {
+			o.dead = removeDelivery(o.dead, id)
+		}
+	}
+	o.save()
+	return before - len(o.dead)
+}
+
+// notify wakes the delivery loop without blocking
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the outbox to disk (caller must hold the lock)
+func (o *Outbox) save() {
+	data, err := json.MarshalIndent(outboxFile{Pending: o.pending, Dead: o.dead}, "", "  ")
+	if err != nil {
+		return
+	}
+	// Write atomically so a crash never leaves a truncated outbox
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		slog.Error("Failed to save outbox", "err", err)
+		return
+	}
+	os.Rename(tmp, o.path)
+}
+
+// backoff returns the retry delay after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	delay := InitialBackoff
+	for i := 1; i < attempts && delay < MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > MaxBackoff {
+		delay = MaxBackoff
+	}
+	return delay
+}
+
+func removeDelivery(list []*Delivery, id string) []*Delivery {
+	for i, d := range list {
+		if d.ID == id {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+func copyDeliveries(list []*Delivery) []Delivery {
+	result := make([]Delivery, 0, len(list))
+	for _, d := range list {
+		result = append(result, *d)
+	}
+	return result
+}
+
+// errUnknownSink marks deliveries for notifiers that are no longer configured
+var errUnknownSink = errors.New("notifier is not configured")
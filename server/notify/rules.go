@@ -0,0 +1,254 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// RulesVersion is the current version of the rules document format
+const RulesVersion = 1
+
+// ErrInvalidRules wraps the reason Import rejected a rules document
+var ErrInvalidRules = errors.New("invalid rules")
+
+// Rules is the portable document describing all notification and automation rules
+type Rules struct {
+	Version    int             `json:"version"`
+	ExportedAt string          `json:"exported_at,omitempty"`
+	Webhooks   []WebhookConfig `json:"webhooks"`
+	Emails     []EmailConfig   `json:"emails,omitempty"`
+}
+
+// Validate checks the document version and that every rule can be built
+func (r *Rules) Validate() error {
+	if r.Version > RulesVersion {
+		return fmt.Errorf("unsupported rules version %d (max %d)", r.Version, RulesVersion)
+	}
+	seen := make(map[string]bool)
+	for _, hook := range r.Webhooks {
+		webhook, err := NewWebhook(hook)
+		if err != nil {
+			return err
+		}
+		if seen[webhook.Name()] {
+			return fmt.Errorf("duplicate webhook name %q", webhook.Name())
+		}
+		seen[webhook.Name()] = true
+	}
+	for _, config := range r.Emails {
+		email, err := NewEmail(config)
+		if err != nil {
+			return err
+		}
+		if seen[email.Name()] {
+			return fmt.Errorf("duplicate notifier name %q", email.Name())
+		}
+		seen[email.Name()] = true
+	}
+	return nil
+}
+
+// migrate upgrades older documents to the current version
+func (r *Rules) migrate() {
+	if r.Version == 0 {
+		// Unversioned documents predate versioning and share the v1 layout
+		r.Version = 1
+	}
+}
+
+// RuleStore holds the rules from config.json (static) and the imported rules
+// persisted on disk, and keeps the outbox notifiers in sync with them
+type RuleStore struct {
+	path   string
+	mu     sync.Mutex
+	static Rules
+	rules  Rules
+	outbox *Outbox
+}
+
+// NewRuleStore loads persisted rules from path and registers notifiers for all rules
+func NewRuleStore(path string, static Rules, outbox *Outbox) *RuleStore {
+	s := &RuleStore{
+		path:   path,
+		static: static,
+		rules:  Rules{Version: RulesVersion},
+		outbox: outbox,
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		var rules Rules
+		if err := json.Unmarshal(data, &rules); err != nil {
+			slog.Warn("Failed to load notification rules", "path", path, "err", err)
+		} else {
+			rules.migrate()
+			if err := rules.Validate(); err != nil {
+				slog.Warn("Ignoring invalid notification rules", "path", path, "err", err)
+			} else {
+				s.rules = rules
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.apply()
+	s.mu.Unlock()
+	return s
+}
+
+// SetStatic replaces the rules from config.json and re-registers notifiers
+func (s *RuleStore) SetStatic(static Rules) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.static = static
+	s.apply()
+}
+
+// RedactedPassword stands in for SMTP passwords in exported rules. Importing
+// it keeps the password of the email notifier with the same name.
+const RedactedPassword = "********"
+
+// Export returns every effective rule as a single versioned document, with
+// SMTP passwords redacted
+func (s *RuleStore) Export() Rules {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	merged := s.merged()
+	emails := make([]EmailConfig, 0, len(merged.Emails))
+	for _, config := range merged.Emails {
+		if config.Password != "" {
+			config.Password = RedactedPassword
+		}
+		emails = append(emails, config)
+	}
+	return Rules{
+		Version:    RulesVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+		Webhooks:   merged.Webhooks,
+		Emails:     emails,
+	}
+}
+
+// Import validates a rules document and stores it. With replace, previously
+// imported rules are dropped; otherwise rules are merged by name. A document
+// that doesn't validate is rejected with ErrInvalidRules.
+func (s *RuleStore) Import(doc Rules, replace bool) error {
+	doc.migrate()
+	if err := doc.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRules, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := Rules{Version: RulesVersion}
+	if !replace {
+		next.Webhooks = append(next.Webhooks, s.rules.Webhooks...)
+		next.Emails = append(next.Emails, s.rules.Emails...)
+	}
+	for _, hook := range doc.Webhooks {
+		next.Webhooks = upsertWebhook(next.Webhooks, hook)
+	}
+	current := s.merged()
+	for _, email := range doc.Emails {
+		if email.Password == RedactedPassword {
+			email.Password = ""
+			for _, existing := range current.Emails {
+				if existing.key() == email.key() {
+					email.Password = existing.Password
+				}
+			}
+		}
+		next.Emails = upsertEmail(next.Emails, email)
+	}
+
+	if err := s.save(next); err != nil {
+		return err
+	}
+	s.rules = next
+	s.apply()
+	return nil
+}
+
+// merged combines static and imported rules; imported rules win on name clashes
+func (s *RuleStore) merged() Rules {
+	merged := Rules{Version: RulesVersion}
+	merged.Webhooks = append(merged.Webhooks, s.static.Webhooks...)
+	for _, hook := range s.rules.Webhooks {
+		merged.Webhooks = upsertWebhook(merged.Webhooks, hook)
+	}
+	merged.Emails = append(merged.Emails, s.static.Emails...)
+	for _, email := range s.rules.Emails {
+		merged.Emails = upsertEmail(merged.Emails, email)
+	}
+	return merged
+}
+
+// apply rebuilds the outbox notifiers from the current rules (caller must hold the lock)
+func (s *RuleStore) apply() {
+	var notifiers []Notifier
+	merged := s.merged()
+	for _, hook := range merged.Webhooks {
+		webhook, err := NewWebhook(hook)
+		if err != nil {
+			slog.Warn("Skipping webhook", "err", err)
+			continue
+		}
+		notifiers = append(notifiers, webhook)
+	}
+	for _, config := range merged.Emails {
+		email, err := NewEmail(config)
+		if err != nil {
+			slog.Warn("Skipping email notifier", "err", err)
+			continue
+		}
+		notifiers = append(notifiers, email)
+	}
+	s.outbox.SetNotifiers(notifiers)
+}
+
+// save writes the imported rules to disk
+func (s *RuleStore) save(rules Rules) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// key identifies a webhook config: its name, or its URL/topic if unnamed
+func (c WebhookConfig) key() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.URL != "":
+		return c.URL
+	}
+	return c.Topic
+}
+
+// upsertWebhook replaces the webhook with the same name or appends it
+func upsertWebhook(list []WebhookConfig, hook WebhookConfig) []WebhookConfig {
+	for i, existing := range list {
+		if existing.key() == hook.key() {
+			list[i] = hook
+			return list
+		}
+	}
+	return append(list, hook)
+}
+
+// upsertEmail replaces the email notifier with the same name or appends it
+func upsertEmail(list []EmailConfig, config EmailConfig) []EmailConfig {
+	for i, existing := range list {
+		if existing.key() == config.key() {
+			list[i] = config
+			return list
+		}
+	}
+	return append(list, config)
+}
@@ -0,0 +1,102 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpClient is shared by all HTTP-based notifiers
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookConfig configures a generic JSON webhook or a built-in integration
+type WebhookConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type,omitempty"` // webhook (default), ntfy, slack or discord
+	URL     string            `json:"url"`
+	Topic   string            `json:"topic,omitempty"` // ntfy topic (URL is then the server, default ntfy.sh)
+	Headers map[string]string `json:"headers,omitempty"`
+	Filter
+}
+
+// Webhook posts events to a URL in the format of its type
+type Webhook struct {
+	config WebhookConfig
+}
+
+// NewWebhook creates a webhook notifier
+func NewWebhook(config WebhookConfig) (*Webhook, error) {
+	if !validType(config.Type) {
+		return nil, fmt.Errorf("webhook %q has unknown type %q", config.Name, config.Type)
+	}
+	if config.Type == TypeNtfy && config.Topic != "" {
+		server := config.URL
+		if server == "" {
+			server = DefaultNtfyServer
+		}
+		config.URL = strings.TrimRight(server, "/") + "/" + config.Topic
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook %q has no url", config.Name)
+	}
+	if config.Name == "" {
+		config.Name = config.URL
+	}
+	return &Webhook{config: config}, nil
+}
+
+// Name returns the webhook name
+func (w *Webhook) Name() string {
+	return w.config.Name
+}
+
+// Accepts reports whether the webhook wants this event
+func (w *Webhook) Accepts(e Event) bool {
+	return w.config.Match(e)
+}
+
+// Send posts the event to the webhook URL
+func (w *Webhook) Send(e Event) error {
+	switch w.config.Type {
+	case TypeNtfy:
+		return sendNtfy(w.config.URL, e, w.config.Headers)
+	case TypeSlack:
+		return sendSlack(w.config.URL, e)
+	case TypeDiscord:
+		return sendDiscord(w.config.URL, e)
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return postJSON(w.config.URL, body, w.config.Headers)
+}
+
+// postJSON sends a JSON body and treats any non-2xx response as a failure
+func postJSON(url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
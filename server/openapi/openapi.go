@@ -0,0 +1,122 @@
+// Package openapi builds an OpenAPI 3.1 document from a table of
+// operations whose request and response bodies are described by Go values.
+// WebSocket messages, which OpenAPI can't model, are listed under the
+// x-websocket extension with their schemas.
+package openapi
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Operation is one method on one REST path. Request and Response are zero
+// values of the body types (nil for none or an unspecified JSON object).
+type Operation struct {
+	Method      string
+	Path        string // With {param} placeholders
+	Summary     string
+	Query       []string // Query parameter names
+	Request     any
+	Response    any
+	ContentType string // Response media type when it isn't application/json
+}
+
+// Message is one WebSocket message type and the schema of its payload
+type Message struct {
+	Type    string
+	Summary string
+	Body    any
+}
+
+// Spec is everything the document is built from
+type Spec struct {
+	Title          string
+	Version        string
+	Operations     []Operation
+	WebSocketPath  string
+	ClientMessages []Message
+	ServerMessages []Message
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Build renders the spec as an OpenAPI 3.1 document ready to marshal
+func Build(spec Spec) map[string]any {
+	s := newSchemas()
+
+	paths := map[string]map[string]any{}
+	for _, op := range spec.Operations {
+		item := paths[op.Path]
+		if item == nil {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = s.operation(op)
+	}
+
+	document := map[string]any{
+		"openapi": "3.1.0",
+		"info":    map[string]any{"title": spec.Title, "version": spec.Version},
+		"paths":   paths,
+	}
+	if spec.WebSocketPath != "" {
+		document["x-websocket"] = map[string]any{
+			"path":            spec.WebSocketPath,
+			"client_messages": s.messages(spec.ClientMessages),
+			"server_messages": s.messages(spec.ServerMessages),
+		}
+	}
+	document["components"] = map[string]any{"schemas": s.defs}
+	return document
+}
+
+func (s *schemas) operation(op Operation) map[string]any {
+	var parameters []map[string]any
+	for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		parameters = append(parameters, map[string]any{
+			"name": m[1], "in": "path", "required": true, "schema": Schema{"type": "string"},
+		})
+	}
+	for _, name := range op.Query {
+		parameters = append(parameters, map[string]any{
+			"name": name, "in": "query", "schema": Schema{"type": "string"},
+		})
+	}
+
+	result := map[string]any{"summary": op.Summary}
+	if len(parameters) > 0 {
+		result["parameters"] = parameters
+	}
+	if op.Request != nil {
+		result["requestBody"] = map[string]any{
+			"content": map[string]any{"application/json": map[string]any{"schema": s.of(op.Request)}},
+		}
+	}
+
+	contentType, schema := "application/json", Schema{"type": "object"}
+	if op.Response != nil {
+		schema = s.of(op.Response)
+	}
+	if op.ContentType != "" {
+		contentType, schema = op.ContentType, Schema{"type": "string", "format": "binary"}
+	}
+	result["responses"] = map[string]any{
+		"200": map[string]any{
+			"description": "OK",
+			"content":     map[string]any{contentType: map[string]any{"schema": schema}},
+		},
+	}
+	return result
+}
+
+func (s *schemas) messages(list []Message) []map[string]any {
+	var result []map[string]any
+	for _, m := range list {
+		entry := map[string]any{"type": m.Type, "summary": m.Summary}
+		if m.Body != nil {
+			entry["schema"] = s.of(m.Body)
+		}
+		result = append(result, entry)
+	}
+	return result
+}
@@ -0,0 +1,247 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// validPaneID matches the pane IDs sessions accept, which name track files
+var validPaneID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Manifest links the per-pane recordings of one session
+type Manifest struct {
+	ID        string      `json:"id"`
+	SessionID string      `json:"session_id"`
+	StartedAt time.Time   `json:"started_at"`
+	EndedAt   *time.Time  `json:"ended_at,omitempty"`
+	Panes     []PaneTrack `json:"panes"`
+}
+
+// PaneTrack describes the recording of a single pane
+type PaneTrack struct {
+	PaneID string  `json:"pane_id"`
+	Role   string  `json:"role,omitempty"`
+	File   string  `json:"file"`   // asciicast v2 file, relative to the recording dir
+	Offset float64 `json:"offset"` // Seconds from recording start to the pane's first frame
+	Width  uint16  `json:"width"`
+	Height uint16  `json:"height"`
+}
+
+// header is the asciicast v2 header line
+type header struct {
+	Version   int   `json:"version"`
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// track is an open pane recording
+type track struct {
+	file    *os.File
+	writer  *bufio.Writer
+	started time.Time
+}
+
+// Recorder writes one asciicast file per pane plus a manifest linking them.
+// All panes share the recording start time so their timelines line up.
+type Recorder struct {
+	dir      string
+	mu       sync.Mutex
+	manifest Manifest
+	tracks   map[string]*track
+	closed   bool
+}
+
+// NewRecorder starts a recording for a session under baseDir
+func NewRecorder(baseDir, sessionID string) (*Recorder, error) {
+	now := time.Now()
+	id := fmt.Sprintf("%s-%s", sessionID, now.Format("20060102-150405"))
+	dir := filepath.Join(baseDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		dir: dir,
+		manifest: Manifest{
+			ID:        id,
+			SessionID: sessionID,
+			StartedAt: now,
+			Panes:     []PaneTrack{},
+		},
+		tracks: make(map[string]*track),
+	}
+	return r, r.saveManifest()
+}
+
+// ID returns the recording ID
+func (r *Recorder) ID() string {
+	return r.manifest.ID
+}
+
+// AddPane opens a recording track for a pane (no-op if already tracked)
+func (r *Recorder) AddPane(paneID, role string, width, height uint16) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	if _, ok := r.tracks[paneID]; ok {
+		return nil
+	}
+	if !validPaneID.MatchString(paneID) {
+		return fmt.Errorf("invalid pane id: %s", paneID)
+	}
+
+	name := "pane-" + paneID + ".cast"
+	file, err := os.Create(filepath.Join(r.dir, name))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	t := &track{file: file, writer: bufio.NewWriter(file), started: now}
+	hdr, _ := json.Marshal(header{Version: 2, Width: int(width), Height: int(height), Timestamp: now.Unix()})
+	t.writer.Write(hdr)
+	t.writer.WriteByte('\n')
+	r.tracks[paneID] = t
+
+	r.manifest.Panes = append(r.manifest.Panes, PaneTrack{
+		PaneID: paneID,
+		Role:   role,
+		File:   name,
+		Offset: now.Sub(r.manifest.StartedAt).Seconds(),
+		Width:  width,
+		Height: height,
+	})
+	return r.saveManifest()
+}
+
+// WriteOutput records output from a pane
+func (r *Recorder) WriteOutput(paneID string, data []byte) {
+	r.writeEvent(paneID, "o", string(data))
+}
+
+// WriteResize records a terminal resize of a pane
+func (r *Recorder) WriteResize(paneID string, width, height uint16) {
+	r.writeEvent(paneID, "r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// writeEvent appends an asciicast event line to a pane track
+func (r *Recorder) writeEvent(paneID, kind, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tracks[paneID]
+	if !ok || r.closed {
+		return
+	}
+	line, _ := json.Marshal([]any{time.Since(t.started).Seconds(), kind, data})
+	t.writer.Write(line)
+	t.writer.WriteByte('\n')
+	t.writer.Flush()
+}
+
+// Close finishes all pane tracks and the manifest
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	for _, t := range r.tracks {
+		t.writer.Flush()
+		t.file.Close()
+	}
+	now := time.Now()
+	r.manifest.EndedAt = &now
+	return r.saveManifest()
+}
+
+// saveManifest writes the manifest (caller must hold the lock or own the recorder)
+func (r *Recorder) saveManifest() error {
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.dir, "manifest.json"), data, 0644)
+}
+
+// List returns the manifests of all recordings under baseDir, newest first
+func List(baseDir string) ([]Manifest, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Manifest{}, nil
+		}
+		return nil, err
+	}
+
+	manifests := []Manifest{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if m, err := Load(baseDir, entry.Name()); err == nil {
+			manifests = append(manifests, *m)
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].StartedAt.After(manifests[j].StartedAt)
+	})
+	return manifests, nil
+}
+
+// Load reads the manifest of a recording
+func Load(baseDir, id string) (*Manifest, error) {
+	if id != filepath.Base(id) {
+		return nil, fmt.Errorf("invalid recording id: %s", id)
+	}
+	data, err := os.ReadFile(filepath.Join(baseDir, id, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Latest returns the manifest of the newest recording of a session
+func Latest(baseDir, sessionID string) (*Manifest, error) {
+	manifests, err := List(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range manifests {
+		if m.SessionID == sessionID {
+			return &m, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// TrackPath returns the asciicast file of a pane in a recording. An empty
+// paneID selects the first pane recorded, which is the session's main pane.
+func TrackPath(baseDir string, m *Manifest, paneID string) (string, error) {
+	for _, pane := range m.Panes {
+		if paneID == "" || pane.PaneID == paneID {
+			if m.ID != filepath.Base(m.ID) || pane.File != filepath.Base(pane.File) {
+				return "", fmt.Errorf("invalid track file: %s", pane.File)
+			}
+			return filepath.Join(baseDir, m.ID, pane.File), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
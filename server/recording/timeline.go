@@ -0,0 +1,76 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Frame is one event in a merged multi-pane timeline
+type Frame struct {
+	Time   float64 `json:"time"` // Seconds since the recording started
+	PaneID string  `json:"pane_id"`
+	Kind   string  `json:"kind"` // "o" (output) or "r" (resize)
+	Data   string  `json:"data"`
+}
+
+// Timeline merges all pane tracks of a recording into one time-ordered list
+func Timeline(baseDir string, m *Manifest) ([]Frame, error) {
+	var frames []Frame
+	for _, pane := range m.Panes {
+		paneFrames, err := readTrack(filepath.Join(baseDir, m.ID, pane.File), pane.PaneID, pane.Offset)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, paneFrames...)
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		return frames[i].Time < frames[j].Time
+	})
+	return frames, nil
+}
+
+// PaneFrames returns the frames of one pane track, timed from the pane's
+// first frame. An empty paneID selects the first pane recorded.
+func PaneFrames(baseDir string, m *Manifest, paneID string) (*PaneTrack, []Frame, error) {
+	for i, pane := range m.Panes {
+		if paneID == "" || pane.PaneID == paneID {
+			frames, err := readTrack(filepath.Join(baseDir, m.ID, pane.File), pane.PaneID, 0)
+			return &m.Panes[i], frames, err
+		}
+	}
+	return nil, nil, os.ErrNotExist
+}
+
+// readTrack parses an asciicast v2 file, shifting times by the pane offset
+func readTrack(path, paneID string, offset float64) ([]Frame, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var frames []Frame
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	first := true
+	for scanner.Scan() {
+		if first {
+			// Skip the header line
+			first = false
+			continue
+		}
+		var event []any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			continue
+		}
+		t, _ := event[0].(float64)
+		kind, _ := event[1].(string)
+		data, _ := event[2].(string)
+		frames = append(frames, Frame{Time: offset + t, PaneID: paneID, Kind: kind, Data: data})
+	}
+	return frames, scanner.Err()
+}
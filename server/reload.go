@@ -0,0 +1,156 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"claudex/audit"
+	"claudex/claude"
+	"claudex/notify"
+	"claudex/session"
+	"claudex/ws"
+)
+
+// configPollInterval is how often config.json is checked for changes
+const configPollInterval = 2 * time.Second
+
+// liveConfig applies the settings that can change without a restart and
+// reloads them from config.json on SIGHUP or when the file changes
+type liveConfig struct {
+	manager  *session.Manager
+	handler  *ws.Handler
+	rules    *notify.RuleStore
+	dev      bool   // -dev given at startup
+	auditDir string // Where the audit log goes when enabled
+	started  Config // Settings the server started with, for those that need a restart
+}
+
+// apply pushes the reloadable settings into the server: notification
+// targets, limits, detection patterns, origins, the merge branch, test
+// commands, forges and the audit switch
+func (l *liveConfig) apply(c Config) {
+	claude.SetPricing(c.Pricing)
+	session.SetDetectionPatterns(c.Detection)
+	if err := session.SetDetector(c.Detection.Detector); err != nil {
+		slog.Warn("Ignoring detection.detector", "err", err)
+	}
+
+	l.manager.SetQuotas(c.Quotas)
+	l.manager.SetColdAfter(time.Duration(c.ColdAfterDays) * 24 * time.Hour)
+	if err := l.manager.SetIdlePolicy(c.IdleStop); err != nil {
+		slog.Warn("Ignoring idle_stop", "err", err)
+	}
+
+	l.handler.SetBudget(c.Budget)
+	if err := l.handler.SetBackpressure(c.Backpressure); err != nil {
+		slog.Warn("Ignoring backpressure", "err", err)
+	}
+	if err := l.handler.SetRateLimits(c.RateLimits); err != nil {
+		slog.Warn("Ignoring rate_limits", "err", err)
+	}
+	if err := l.handler.SetMergeBranch(c.MergeBranch); err != nil {
+		slog.Warn("Ignoring merge_branch", "err", err)
+	}
+	if err := l.handler.SetTestCommands(c.TestCommands); err != nil {
+		slog.Warn("Ignoring test_commands", "err", err)
+	}
+	if err := l.handler.SetForges(c.forges()); err != nil {
+		slog.Warn("Ignoring forges", "err", err)
+	}
+	if err := l.handler.SetOriginPolicy(ws.OriginPolicy{Allowed: c.AllowedOrigins, AllowAny: l.dev}); err != nil {
+		slog.Warn("Ignoring allowed_origins", "err", err)
+	}
+	if c.Audit.Disabled {
+		l.handler.SetAuditLog(nil)
+	} else {
+		l.handler.SetAuditLog(audit.New(l.auditDir))
+	}
+
+	l.rules.SetStatic(notify.Rules{Version: notify.RulesVersion, Webhooks: c.Webhooks, Emails: c.Emails})
+}
+
+// reload re-reads config.json and applies it. A file that doesn't parse
+// leaves the running settings alone; settings that differ from startup but
+// need a restart are logged.
+func (l *liveConfig) reload() {
+	c, err := readConfig()
+	if err != nil {
+		slog.Warn("Config reload failed, keeping the current settings", "err", err)
+		return
+	}
+
+	started := l.started
+	restartOnly := []struct {
+		name          string
+		before, after any
+	}{
+		{"port", started.Port, c.Port},
+		{"bind", started.Bind, c.Bind},
+		{"listen", started.Listen, c.Listen},
+		{"storage_dir", started.StorageDir, c.StorageDir},
+		{"web_dir", started.WebDir, c.WebDir},
+		{"shell", started.Shell, c.Shell},
+		{"claude_binary", started.ClaudeBinary, c.ClaudeBinary},
+		{"timeouts", started.Timeouts, c.Timeouts},
+		{"scrollback_max_mb", started.ScrollbackMaxMB, c.ScrollbackMaxMB},
+		{"readonly", started.ReadOnly, c.ReadOnly},
+		{"port_pool", started.PortPool, c.PortPool},
+		{"metadata_schema", started.MetadataSchema, c.MetadataSchema},
+		{"docker", started.Docker, c.Docker},
+		{"log_sinks", started.LogSinks, c.LogSinks},
+		{"backend", started.Backend, c.Backend},
+		{"scrollback_mb", started.ScrollbackMB, c.ScrollbackMB},
+		{"logging", started.Logging, c.Logging},
+		{"grpc_port", started.GRPCPort, c.GRPCPort},
+		{"dev", started.Dev, c.Dev},
+	}
+	for _, setting := range restartOnly {
+		if !reflect.DeepEqual(setting.before, setting.after) {
+			slog.Warn("Config change needs a restart", "setting", setting.name)
+		}
+	}
+
+	l.apply(c)
+	slog.Info("Config reloaded")
+}
+
+// watch reloads the config on SIGHUP and when config.json changes, until
+// stop is closed
+func (l *liveConfig) watch(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	modified := configModTime()
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			slog.Info("SIGHUP received, reloading config")
+			modified = configModTime()
+			l.reload()
+		case <-ticker.C:
+			if t := configModTime(); !t.Equal(modified) {
+				modified = t
+				l.reload()
+			}
+		}
+	}
+}
+
+// configModTime returns when config.json last changed (zero if missing)
+func configModTime() time.Time {
+	info, err := os.Stat(configPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
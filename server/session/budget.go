@@ -0,0 +1,112 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultBudgetThresholds are the fractions of a budget that raise an alert
+var DefaultBudgetThresholds = []float64{0.5, 0.8, 1.0}
+
+// Budget limits the spend of a session's Claude run. Zero limits are unset.
+type Budget struct {
+	CostUSD    float64   `json:"cost_usd,omitempty"`   // Dollar limit
+	Tokens     int       `json:"tokens,omitempty"`     // Token limit (input + output + cache)
+	Thresholds []float64 `json:"thresholds,omitempty"` // Fractions of the limit that alert (default 0.5, 0.8, 1.0)
+}
+
+// Enabled reports whether any limit is set
+func (b Budget) Enabled() bool {
+	return b.CostUSD > 0 || b.Tokens > 0
+}
+
+// Validate checks the budget limits and thresholds
+func (b Budget) Validate() error {
+	if b.CostUSD < 0 || b.Tokens < 0 {
+		return fmt.Errorf("budget limits must not be negative")
+	}
+	for _, t := range b.Thresholds {
+		if t <= 0 {
+			return fmt.Errorf("budget thresholds must be positive fractions (e.g. 0.8)")
+		}
+	}
+	return nil
+}
+
+// Used returns the fraction of the budget consumed (the larger of cost and tokens)
+func (b Budget) Used(costUSD float64, tokens int) float64 {
+	var used float64
+	if b.CostUSD > 0 {
+		used = costUSD / b.CostUSD
+	}
+	if b.Tokens > 0 {
+		if t := float64(tokens) / float64(b.Tokens); t > used {
+			used = t
+		}
+	}
+	return used
+}
+
+// Crossed returns the highest threshold reached at the given usage fraction (0 if none)
+func (b Budget) Crossed(used float64) float64 {
+	thresholds := b.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = DefaultBudgetThresholds
+	}
+	thresholds = append([]float64(nil), thresholds...)
+	sort.Float64s(thresholds)
+
+	var crossed float64
+	for _, t := range thresholds {
+		if used >= t {
+			crossed = t
+		}
+	}
+	return crossed
+}
+
+// SetBudget sets the session's own budget (nil falls back to the global one)
+func (s *Session) SetBudget(budget *Budget) error {
+	if budget != nil {
+		if err := budget.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Budget = budget
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// BudgetAlert is the highest budget threshold alerted for a Claude run
+type BudgetAlert struct {
+	ClaudeSessionID string  `json:"claude_session_id"`
+	Threshold       float64 `json:"threshold"`
+}
+
+// AlertBudget records that a Claude run of the session crossed a budget
+// threshold. It reports false if that threshold (or a higher one) was
+// already alerted for the run; a new run starts fresh.
+func (s *Session) AlertBudget(claudeSessionID string, threshold float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.BudgetAlerted; a != nil && a.ClaudeSessionID == claudeSessionID && a.Threshold >= threshold {
+		return false
+	}
+	s.BudgetAlerted = &BudgetAlert{ClaudeSessionID: claudeSessionID, Threshold: threshold}
+	return true
+}
+
+// GetBudget returns the session's own budget (nil if it uses the global one)
+func (s *Session) GetBudget() *Budget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Budget == nil {
+		return nil
+	}
+	b := *s.Budget
+	return &b
+}
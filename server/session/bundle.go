@@ -0,0 +1,296 @@
+package session
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"claudex/claude"
+
+	"github.com/google/uuid"
+)
+
+// Files inside a session export bundle
+const (
+	BundleSessionFile    = "session.json"
+	BundleScrollbackFile = "scrollback"
+	BundleTranscriptFile = "transcript.jsonl"
+)
+
+// maxBundleTranscript caps the inflated transcript of an imported bundle
+const maxBundleTranscript = 1 << 30
+
+// ExportBundle writes a tar.gz archive with the session JSON, its scrollback
+// and the Claude transcript it last ran (when one can be found)
+func (s *Session) ExportBundle(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	s.mu.RLock()
+	info := sessionInfo(s)
+	s.mu.RUnlock()
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, BundleSessionFile, data, now); err != nil {
+		return err
+	}
+
+	if scrollback := s.GetScrollback(); len(scrollback) > 0 {
+		if err := writeTarFile(tw, BundleScrollbackFile, scrollback, now); err != nil {
+			return err
+		}
+	}
+
+	// The transcript is optional: the session may never have run Claude
+	if path, err := claude.FindTranscript(s.Directory, s.GetLastClaudeSessionID()); err == nil {
+		if err := writeTarFileFromDisk(tw, BundleTranscriptFile, path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ImportOptions controls how an export bundle is turned back into a session
+type ImportOptions struct {
+	Directory string   // Working directory for the session (default: the exported one)
+	Relink    bool     // Install the bundled transcript so Claude can resume it
+	Keep      []string // ImportFields to take from the bundle instead of dropping
+	Claim     Claim    // Quota claim; the session gets its owner
+}
+
+// ImportFields are the settings an import drops unless asked to keep them:
+// they run commands, change what input is let through, send output
+// elsewhere or change where and how the session's processes run. A bundle
+// from someone else shouldn't get any of that by being imported.
+var ImportFields = []string{
+	"startup_command", "macros", "input_policy", "log_sinks", "claude_options",
+	"sandbox", "limits", "worktree", "backend",
+}
+
+// dropImportFields clears the ImportFields not in keep
+func dropImportFields(info *SessionInfo, keep []string) error {
+	for _, field := range keep {
+		if !slices.Contains(ImportFields, field) {
+			return fmt.Errorf("unknown import field %q", field)
+		}
+	}
+	kept := func(field string) bool { return slices.Contains(keep, field) }
+	if !kept("startup_command") {
+		info.StartupCommand = ""
+	}
+	if !kept("macros") {
+		info.Macros = nil
+	}
+	if !kept("input_policy") {
+		info.InputPolicy = nil
+	}
+	if !kept("log_sinks") {
+		info.LogSinks = nil
+	}
+	for _, c := range info.LogSinks {
+		if err := c.ValidateSession(); err != nil {
+			return fmt.Errorf("invalid log sink: %w", err)
+		}
+	}
+	if !kept("claude_options") {
+		info.ClaudeOptions = nil
+	}
+	if !kept("sandbox") {
+		info.Sandbox = ""
+	}
+	if !kept("limits") {
+		info.Limits = nil
+	}
+	if !kept("worktree") {
+		info.WorktreePath = ""
+		info.Branch = ""
+	}
+	if !kept("backend") {
+		info.Backend = ""
+	}
+	return nil
+}
+
+// ImportBundle recreates a session from an export bundle under a new ID,
+// failing with a *QuotaExceededError if the claim would break a session limit
+func (m *Manager) ImportBundle(r io.Reader, opts ImportOptions) (*Session, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	var info *SessionInfo
+	var scrollback []byte
+	var transcript *os.File
+	defer func() {
+		if transcript != nil {
+			transcript.Close()
+			os.Remove(transcript.Name())
+		}
+	}()
+
+	// Entries are read up to a limit: the request size caps the compressed
+	// bytes, not what they inflate to
+	seen := make(map[string]bool)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: %w", err)
+		}
+		if seen[hdr.Name] {
+			return nil, fmt.Errorf("invalid bundle: %s appears twice", hdr.Name)
+		}
+		seen[hdr.Name] = true
+
+		switch hdr.Name {
+		case BundleSessionFile:
+			info = &SessionInfo{}
+			if err := json.NewDecoder(tr).Decode(info); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", BundleSessionFile, err)
+			}
+		case BundleScrollbackFile:
+			maxScrollback := scrollbackMaxMB.Load() << 20
+			if scrollback, err = io.ReadAll(io.LimitReader(tr, maxScrollback+1)); err != nil {
+				return nil, err
+			}
+			if int64(len(scrollback)) > maxScrollback {
+				return nil, fmt.Errorf("%s is larger than the scrollback maximum of %d MB", BundleScrollbackFile, maxScrollback>>20)
+			}
+		case BundleTranscriptFile:
+			// Transcripts can be large, so spool to disk instead of memory
+			if transcript, err = os.CreateTemp("", "claudex-transcript-*.jsonl"); err != nil {
+				return nil, err
+			}
+			n, err := io.Copy(transcript, io.LimitReader(tr, maxBundleTranscript+1))
+			if err != nil {
+				return nil, err
+			}
+			if n > maxBundleTranscript {
+				return nil, fmt.Errorf("%s is larger than %d MB", BundleTranscriptFile, maxBundleTranscript>>20)
+			}
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("bundle has no %s", BundleSessionFile)
+	}
+
+	// Links to other sessions, host ports and grid placement don't carry over
+	info.ID = uuid.New().String()[:8]
+	info.ParentID = ""
+	info.SplitParentID = ""
+	info.Ports = nil
+	info.HexQ = nil
+	info.HexR = nil
+	info.DependsOn = nil
+	delete(info.Metadata, OwnerKey)
+	if opts.Claim.Owner != "" {
+		if info.Metadata == nil {
+			info.Metadata = map[string]any{}
+		}
+		info.Metadata[OwnerKey] = opts.Claim.Owner
+	}
+	if err := dropImportFields(info, opts.Keep); err != nil {
+		return nil, err
+	}
+	if opts.Directory != "" {
+		info.Directory = opts.Directory
+	}
+
+	// Checked with the session added in one step, before anything is installed
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	if err := m.CheckQuota(opts.Claim); err != nil {
+		return nil, err
+	}
+
+	sess := sessionFromInfo(*info)
+	sess.SetSavedScrollback(scrollback)
+
+	claudeID := info.LastClaudeSessionID
+	if transcript != nil && opts.Relink {
+		if _, err := transcript.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if claudeID, err = claude.InstallTranscript(info.Directory, claudeID, transcript); err != nil {
+			return nil, fmt.Errorf("relink transcript: %w", err)
+		}
+	}
+	// Only keep the Claude session if it can actually be resumed here
+	if claudeID != "" {
+		if _, err := claude.FindTranscript(info.Directory, claudeID); err != nil {
+			claudeID = ""
+		}
+	}
+	sess.LastClaudeSessionID = claudeID
+
+	m.mu.Lock()
+	m.sessions[sess.ID] = sess
+	m.trackHistory(sess)
+	err = m.saveSession(sess)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(scrollback) > 0 {
+		m.SaveScrollback(sess)
+	}
+	return sess, nil
+}
+
+// writeTarFile adds an in-memory file to the archive
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeTarFileFromDisk streams a file on disk into the archive
+func writeTarFileFromDisk(tw *tar.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// Copy exactly the size announced in the header (Claude may still be appending)
+	_, err = io.CopyN(tw, file, stat.Size())
+	return err
+}
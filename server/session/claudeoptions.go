@@ -0,0 +1,132 @@
+package session
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Permission modes Claude can start in (claude --permission-mode)
+var permissionModes = []string{"default", "acceptEdits", "plan", "bypassPermissions"}
+
+// ClaudeOptions are the flags Claude is launched with, on resume and in a
+// startup command that runs claude
+type ClaudeOptions struct {
+	PermissionMode  string   `json:"permission_mode,omitempty"`  // default, acceptEdits, plan or bypassPermissions
+	AllowedTools    []string `json:"allowed_tools,omitempty"`    // Tools allowed without asking, e.g. "Bash(git log:*)"
+	DisallowedTools []string `json:"disallowed_tools,omitempty"` // Tools Claude may not use
+	SkipPermissions bool     `json:"skip_permissions,omitempty"` // --dangerously-skip-permissions
+	ExtraArgs       []string `json:"extra_args,omitempty"`       // Passed as they are, after the others
+}
+
+// Validate checks the permission mode and that no argument is empty or has
+// control characters (a newline would submit a typed startup command early)
+func (o *ClaudeOptions) Validate() error {
+	if o.PermissionMode != "" && !slices.Contains(permissionModes, o.PermissionMode) {
+		return fmt.Errorf("unknown permission mode %q (%s)", o.PermissionMode, strings.Join(permissionModes, ", "))
+	}
+	for _, list := range [][]string{o.AllowedTools, o.DisallowedTools, o.ExtraArgs} {
+		for _, arg := range list {
+			if arg == "" || strings.ContainsFunc(arg, unicode.IsControl) {
+				return fmt.Errorf("invalid argument %q", arg)
+			}
+		}
+	}
+	return nil
+}
+
+// args returns the command line flags for the options. The tool lists take
+// every argument up to the next flag, so they come last.
+func (o *ClaudeOptions) args() []string {
+	if o == nil {
+		return nil
+	}
+	var args []string
+	if o.PermissionMode != "" {
+		args = append(args, "--permission-mode", o.PermissionMode)
+	}
+	if o.SkipPermissions {
+		args = append(args, "--dangerously-skip-permissions")
+	}
+	args = append(args, o.ExtraArgs...)
+	if len(o.AllowedTools) > 0 {
+		args = append(args, "--allowedTools")
+		args = append(args, o.AllowedTools...)
+	}
+	if len(o.DisallowedTools) > 0 {
+		args = append(args, "--disallowedTools")
+		args = append(args, o.DisallowedTools...)
+	}
+	return args
+}
+
+// SetClaudeOptions sets the flags Claude is launched with (nil for none);
+// they apply from the next start
+func (s *Session) SetClaudeOptions(o *ClaudeOptions) error {
+	if o != nil {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ClaudeOptions = o
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetClaudeOptions returns a copy of the flags Claude is launched with
+func (s *Session) GetClaudeOptions() *ClaudeOptions {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.ClaudeOptions == nil {
+		return nil
+	}
+	o := *s.ClaudeOptions
+	o.AllowedTools = slices.Clone(o.AllowedTools)
+	o.DisallowedTools = slices.Clone(o.DisallowedTools)
+	o.ExtraArgs = slices.Clone(o.ExtraArgs)
+	return &o
+}
+
+// claudeArgs returns the flags for the session's model and Claude options
+// (caller must hold the lock)
+func (s *Session) claudeArgs() []string {
+	var args []string
+	if s.ClaudeModel != "" {
+		args = append(args, "--model", s.ClaudeModel)
+	}
+	return append(args, s.ClaudeOptions.args()...)
+}
+
+// withClaudeArgs adds flags to a startup command that runs Claude; other
+// commands are left alone
+func withClaudeArgs(command string, args []string) string {
+	if len(args) == 0 {
+		return command
+	}
+	program, rest, _ := strings.Cut(command, " ")
+	if program != ClaudeBinary() && filepath.Base(program) != "claude" {
+		return command
+	}
+	for _, arg := range args {
+		program += " " + shellQuote(arg)
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return program
+	}
+	// The tool lists would take a prompt after them as one more tool
+	if !strings.HasPrefix(rest, "-") {
+		program += " --"
+	}
+	return program + " " + rest
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,91 @@
+//go:build openbsd || netbsd
+
+package session
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cwdSearchTimeout bounds the filesystem search for a directory by inode
+const cwdSearchTimeout = 2 * time.Second
+
+var (
+	cwdCacheMu sync.Mutex
+	cwdCache   = make(map[string]string) // "mount:inode" -> directory path
+)
+
+// bsdProcessCwd finds the cwd with fstat. fstat only reports the mount
+// point and inode of the working directory ("wd"), so the path is found by
+// searching that filesystem for the inode; results are cached because the
+// shell rarely leaves a handful of directories.
+//
+//	USER CMD  PID FD MOUNT INUM  MODE       R/W SZ|DV
+//	me   ksh  123 wd /home 81234 drwxr-xr-x   r   512
+func bsdProcessCwd(pid int) (string, error) {
+	output, err := exec.Command("fstat", "-p", itoa(pid)).Output()
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[3] != "wd" {
+			continue
+		}
+		mount := fields[4]
+		inode, err := strconv.ParseUint(fields[5], 10, 64)
+		if err != nil {
+			return "", err
+		}
+		return findDirByInode(mount, inode)
+	}
+	return "", os.ErrNotExist
+}
+
+// findDirByInode returns the directory with the given inode on the filesystem mounted at mount
+func findDirByInode(mount string, inode uint64) (string, error) {
+	key := mount + ":" + strconv.FormatUint(inode, 10)
+
+	cwdCacheMu.Lock()
+	cached, ok := cwdCache[key]
+	cwdCacheMu.Unlock()
+	if ok && sameInode(cached, inode) {
+		return cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cwdSearchTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "find", mount, "-xdev", "-type", "d",
+		"-inum", strconv.FormatUint(inode, 10)).Output()
+	path, _, _ := strings.Cut(string(output), "\n")
+	if path == "" {
+		if err != nil {
+			return "", err
+		}
+		return "", os.ErrNotExist
+	}
+
+	cwdCacheMu.Lock()
+	cwdCache[key] = path
+	cwdCacheMu.Unlock()
+	return path, nil
+}
+
+// sameInode reports whether path still refers to the given inode
+func sameInode(path string, inode uint64) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && uint64(stat.Ino) == inode
+}
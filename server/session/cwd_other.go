@@ -0,0 +1,10 @@
+//go:build !freebsd && !openbsd && !netbsd
+
+package session
+
+import "os"
+
+// bsdProcessCwd is only implemented on the BSDs
+func bsdProcessCwd(pid int) (string, error) {
+	return "", os.ErrNotExist
+}
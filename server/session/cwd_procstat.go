@@ -0,0 +1,29 @@
+//go:build freebsd
+
+package session
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// bsdProcessCwd reads the cwd from procstat's file descriptor listing:
+//
+//	PID COMM  FD T V FLAGS    REF OFFSET PRO NAME
+//	123 zsh  cwd v d r-------   -      - -   /home/me/project
+func bsdProcessCwd(pid int) (string, error) {
+	output, err := exec.Command("procstat", "-h", "-f", itoa(pid)).Output()
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 10 && fields[2] == "cwd" {
+			return strings.Join(fields[9:], " "), nil
+		}
+	}
+	return "", os.ErrNotExist
+}
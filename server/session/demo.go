@@ -0,0 +1,121 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DemoTag marks sessions created by CreateDemo
+const DemoTag = "demo"
+
+// demoPrompt is the scripted first prompt of the demo session
+const demoPrompt = "This is the claudex demo project. Read README.md, then fix the bug in " +
+	"wordcount.go so that go test passes. Keep the change small and explain what was wrong."
+
+// demoFiles is the sample project: a tiny Go package with a failing test
+var demoFiles = map[string]string{
+	"README.md": `# claudex demo
+
+A tiny project for trying claudex without touching a real repository.
+
+1. The session starts Claude with a prompt to fix the bug in wordcount.go.
+   Watch the robot change status while it thinks, runs tools and waits for you.
+2. Create an experiment from the session (e.g. "add a --top flag that prints
+   the most frequent words") and let it work in its own worktree.
+3. Merge the experiment back, or discard it.
+4. Configure a webhook or ntfy topic to get notified when Claude needs input.
+
+Everything lives in this directory; delete it when you are done.
+`,
+	"go.mod": "module demo\n\ngo 1.21\n",
+	"wordcount.go": `package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CountWords returns how many times each word appears, ignoring case
+func CountWords(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.Split(text, " ") {
+		counts[word]++
+	}
+	return counts
+}
+
+func main() {
+	data, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for word, n := range CountWords(string(data)) {
+		fmt.Printf("%6d %s\n", n, word)
+	}
+}
+`,
+	"wordcount_test.go": `package main
+
+import "testing"
+
+func TestCountWords(t *testing.T) {
+	counts := CountWords("The cat  saw the\ndog")
+	want := map[string]int{"the": 2, "cat": 1, "saw": 1, "dog": 1}
+	if len(counts) != len(want) {
+		t.Fatalf("got %v, want %v", counts, want)
+	}
+	for word, n := range want {
+		if counts[word] != n {
+			t.Errorf("%q: got %d, want %d", word, counts[word], n)
+		}
+	}
+}
+`,
+}
+
+// CreateDemo provisions a throwaway git repository with a small sample
+// project under ~/.claudex/demo and a session that starts Claude on it with
+// a scripted first prompt, so new users can try experiments, merges and
+// notifications without risking a real repository
+func (m *Manager) CreateDemo(claim Claim) (*Session, error) {
+	dir := filepath.Join(filepath.Dir(m.storageDir), "demo", "demo-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for name, content := range demoFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	// Commit as a fixed identity so hosts without a git config work too
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=claudex", "-c", "user.email=demo@claudex.local", "commit", "-q", "-m", "Demo project"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	s, err := m.Create("Demo", dir, claim)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	s.SetStartupCommand(ClaudeCommand(demoPrompt))
+	s.SetTags([]string{DemoTag})
+	m.UpdateSession(s)
+	return s, nil
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// Conditions a dependency waits for
+const (
+	DependOnWaitingInput = "waiting_input" // The other session finished a turn and waits for input
+	DependOnMerged       = "merged"        // The other session's experiment was merged
+)
+
+// Dependency holds a session back until another session reaches a condition.
+// It fires once: the session is started if it isn't running, the prompt (if
+// any) is typed into it, and the dependency is cleared.
+type Dependency struct {
+	SessionID string `json:"session_id"`       // The session waited for
+	On        string `json:"on"`               // waiting_input or merged
+	Prompt    string `json:"prompt,omitempty"` // Typed into this session once Claude waits for input
+}
+
+// Validate checks the condition and that a session is named
+func (d *Dependency) Validate() error {
+	if d.SessionID == "" {
+		return fmt.Errorf("session_id is required")
+	}
+	switch d.On {
+	case DependOnWaitingInput, DependOnMerged:
+		return nil
+	}
+	return fmt.Errorf("unknown condition %q (waiting_input or merged)", d.On)
+}
+
+// SetDependsOn sets the dependency the session waits on (nil clears it)
+func (s *Session) SetDependsOn(d *Dependency) error {
+	if d != nil {
+		if err := d.Validate(); err != nil {
+			return err
+		}
+		if d.SessionID == s.ID {
+			return fmt.Errorf("a session can't depend on itself")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.DependsOn = d
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetDependsOn returns the dependency the session waits on, or nil
+func (s *Session) GetDependsOn() *Dependency {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.DependsOn == nil {
+		return nil
+	}
+	d := *s.DependsOn
+	return &d
+}
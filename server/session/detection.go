@@ -0,0 +1,30 @@
+package session
+
+import "sync/atomic"
+
+// DetectionPatterns extends the built-in output patterns that status
+// detection looks for, e.g. for tools or Claude versions it doesn't know
+type DetectionPatterns struct {
+	Tool     []string `json:"tool,omitempty"`      // Text on lines showing a tool at work, like "── MyTool"
+	ClaudeUI []string `json:"claude_ui,omitempty"` // Text only Claude's interface prints
+	Detector string   `json:"detector,omitempty"`  // Registered Detector deciding statuses (default "hybrid")
+}
+
+// extraPatterns holds the configured patterns (nil: built-ins only)
+var extraPatterns atomic.Pointer[DetectionPatterns]
+
+// SetDetectionPatterns sets the patterns checked besides the built-in ones.
+// Running panes use them from their next output.
+func SetDetectionPatterns(p DetectionPatterns) {
+	extraPatterns.Store(&p)
+}
+
+// matchesAny reports whether line contains one of the patterns
+func matchesAny(line string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern != "" && containsString(line, pattern) {
+			return true
+		}
+	}
+	return false
+}
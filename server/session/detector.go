@@ -0,0 +1,396 @@
+package session
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"claudex/claude"
+)
+
+// Detector decides a pane's status from what the pane observes. The pane
+// keeps the StateTracker up to date (output lines, I/O timing and rate) and
+// asks its detector for a status on each of three signals. A result with ok
+// false keeps the current status and detection. Calls are made with the
+// pane's lock held, one at a time, so a detector may keep state of its own.
+type Detector interface {
+	// Output is called after new output lines were added to the tracker
+	Output(t *StateTracker, current Status) (status Status, d Detection, ok bool)
+	// Transcript is called about once a second with the state read from
+	// Claude's transcript, in agent panes where Claude is active
+	Transcript(t *StateTracker, current Status, state *claude.ClaudeState) (status Status, d Detection, ok bool)
+	// Tick is called once a second to let statuses time out
+	Tick(t *StateTracker, current Status, now time.Time) (status Status, d Detection, ok bool)
+}
+
+// Detection is how sure status detection is of a status and what it went by
+type Detection struct {
+	Confidence float64 `json:"confidence"` // 0 to 1
+	Reason     string  `json:"reason"`     // One of the Reason constants
+}
+
+// Detected reports whether a status comes from status detection, rather than
+// from the pane's process starting, stopping or failing
+func (s Status) Detected() bool {
+	switch s {
+	case StatusIdle, StatusStopped, StatusError, StatusBlocked:
+		return false
+	}
+	return true
+}
+
+// Detection reasons: the signal a status was decided on
+const (
+	ReasonStart       = "start"        // The pane started or resumed Claude
+	ReasonSpinner     = "spinner"      // Claude's spinner is on screen
+	ReasonTool        = "tool"         // A tool at work is on screen
+	ReasonPrompt      = "prompt"       // Claude's interface or input prompt is on screen
+	ReasonShellPrompt = "shell_prompt" // A shell prompt came after any of Claude's interface
+	ReasonOutput      = "output"       // Fast output, or output without a telling pattern
+	ReasonInput       = "input"        // Input was typed into Claude and it hasn't answered yet
+	ReasonSilence     = "silence"      // Claude has been quiet for a while
+	ReasonTranscript  = "transcript"   // Claude's transcript
+	ReasonTimeout     = "timeout"      // The status lasted longer than it can
+)
+
+// DefaultDetector is the detector panes use unless the config names another
+const DefaultDetector = "hybrid"
+
+var (
+	detectorsMu     sync.RWMutex
+	detectors       = map[string]func() Detector{}
+	currentDetector = DefaultDetector
+)
+
+func init() {
+	RegisterDetector("hybrid", func() Detector { return &hybridDetector{} })
+	RegisterDetector("transcript", func() Detector { return &transcriptDetector{} })
+}
+
+// RegisterDetector makes a detector available under name. Each pane gets
+// its own instance from newDetector.
+func RegisterDetector(name string, newDetector func() Detector) {
+	detectorsMu.Lock()
+	defer detectorsMu.Unlock()
+	detectors[name] = newDetector
+}
+
+// Detectors returns the names of the registered detectors, sorted
+func Detectors() []string {
+	detectorsMu.RLock()
+	defer detectorsMu.RUnlock()
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ValidateDetector checks that name ("" for the default) is a registered detector
+func ValidateDetector(name string) error {
+	if name == "" {
+		return nil
+	}
+	detectorsMu.RLock()
+	_, ok := detectors[name]
+	detectorsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown detector %q (one of %v)", name, Detectors())
+	}
+	return nil
+}
+
+// SetDetector selects the detector ("" for the default). Panes pick it up
+// when they next start; running ones keep theirs.
+func SetDetector(name string) error {
+	if err := ValidateDetector(name); err != nil {
+		return err
+	}
+	if name == "" {
+		name = DefaultDetector
+	}
+	detectorsMu.Lock()
+	defer detectorsMu.Unlock()
+	currentDetector = name
+	return nil
+}
+
+// newDetector returns an instance of the selected detector
+func newDetector() Detector {
+	detectorsMu.RLock()
+	defer detectorsMu.RUnlock()
+	if factory, ok := detectors[currentDetector]; ok {
+		return factory()
+	}
+	return &hybridDetector{}
+}
+
+// transcriptStatus maps the status read from Claude's transcript to a pane
+// status (ok false for unknown ones)
+func transcriptStatus(state *claude.ClaudeState) (Status, bool) {
+	switch state.Status {
+	case "thinking":
+		return StatusThinking, true
+	case "executing":
+		return StatusExecuting, true
+	case "waiting_input":
+		return StatusWaitingInput, true
+	case "idle":
+		// Claude session might have ended
+		return StatusWaitingInput, true
+	}
+	return "", false
+}
+
+// hybridDetector combines output patterns, I/O behavior, timeouts and the
+// transcript, trusting each according to how reliable it is
+type hybridDetector struct{}
+
+// Output performs hybrid state analysis, only changing the status when
+// confident enough or for transitions that are hard to get wrong
+func (d *hybridDetector) Output(t *StateTracker, current Status) (Status, Detection, bool) {
+	status, det := d.analyzeState(t, current)
+	if status != current && det.Confidence < 0.6 && !d.isStrongTransition(current, status) {
+		return current, Detection{}, false
+	}
+	return status, det, true
+}
+
+// Transcript takes the transcript's status as the source of truth
+func (d *hybridDetector) Transcript(t *StateTracker, current Status, state *claude.ClaudeState) (Status, Detection, bool) {
+	status, ok := transcriptStatus(state)
+	if !ok || status == current {
+		return current, Detection{}, false
+	}
+	return status, Detection{0.95, ReasonTranscript}, true // High confidence from transcript
+}
+
+// Tick evaluates if current state has timed out
+func (d *hybridDetector) Tick(t *StateTracker, current Status, now time.Time) (Status, Detection, bool) {
+	timeSinceOutput := now.Sub(t.lastOutputTime)
+	timeSinceInput := now.Sub(t.lastInputTime)
+	timeSinceStateChange := now.Sub(t.stateChangedAt)
+
+	switch current {
+	case StatusThinking:
+		if timeSinceOutput > timeouts.Thinking {
+			return StatusWaitingInput, Detection{0.6, ReasonTimeout}, true
+		}
+
+	case StatusExecuting:
+		if timeSinceStateChange > timeouts.Executing {
+			return StatusWaitingInput, Detection{0.5, ReasonTimeout}, true
+		}
+
+	case StatusShell, StatusWaitingInput:
+		if !t.lastInputTime.IsZero() &&
+			timeSinceInput > InputToThinkingDelay &&
+			timeSinceInput < 5*time.Second &&
+			t.lastInputTime.After(t.lastOutputTime) {
+			if t.claudeActive {
+				return StatusThinking, Detection{0.7, ReasonInput}, true
+			}
+		}
+	}
+	return current, Detection{}, false
+}
+
+// analyzeState combines the line patterns, their context and I/O behavior
+func (d *hybridDetector) analyzeState(t *StateTracker, current Status) (Status, Detection) {
+	recentLines := t.recentLines(5)
+
+	// Spinner = definitely thinking
+	for _, line := range recentLines {
+		if line.HasSpinner {
+			t.claudeActive = true
+			return StatusThinking, Detection{0.95, ReasonSpinner}
+		}
+	}
+
+	// Tool patterns = executing
+	for _, line := range recentLines {
+		if line.HasToolPattern {
+			t.claudeActive = true
+			return StatusExecuting, Detection{0.90, ReasonTool}
+		}
+	}
+
+	// Context analysis
+	contextStatus, context := d.analyzeContext(t)
+	if context.Confidence >= 0.8 {
+		return contextStatus, context
+	}
+
+	// I/O behavior analysis
+	ioStatus, io := d.analyzeIOBehavior(t, current)
+	if io.Confidence >= 0.7 {
+		return ioStatus, io
+	}
+
+	// Combine signals
+	if context.Confidence >= 0.5 && io.Confidence >= 0.5 {
+		if contextStatus == ioStatus {
+			return contextStatus, Detection{(context.Confidence + io.Confidence) / 2, context.Reason}
+		}
+	}
+
+	if context.Confidence >= 0.5 {
+		return contextStatus, context
+	}
+
+	return current, Detection{0.4, ReasonOutput}
+}
+
+// analyzeContext looks at the full line buffer for patterns
+func (d *hybridDetector) analyzeContext(t *StateTracker) (Status, Detection) {
+	if len(t.lines) == 0 {
+		if t.claudeActive {
+			return StatusWaitingInput, Detection{0.5, ReasonSilence}
+		}
+		return StatusShell, Detection{0.3, ReasonOutput}
+	}
+
+	var spinnerCount, toolCount, claudeUICount, shellPromptCount int
+	var lastClaudeUI, lastShellPrompt int = -1, -1
+
+	for i, line := range t.lines {
+		if line.HasSpinner {
+			spinnerCount++
+		}
+		if line.HasToolPattern {
+			toolCount++
+		}
+		if line.HasClaudeUI {
+			claudeUICount++
+			lastClaudeUI = i
+		}
+		if line.HasShellPrompt {
+			shellPromptCount++
+			lastShellPrompt = i
+		}
+	}
+
+	if spinnerCount > 0 {
+		t.claudeActive = true
+		return StatusThinking, Detection{0.85, ReasonSpinner}
+	}
+
+	if toolCount > 0 {
+		t.claudeActive = true
+		return StatusExecuting, Detection{0.80, ReasonTool}
+	}
+
+	// CRITICAL: If Claude is active, NEVER go back to shell state
+	// Shell prompts inside Claude output (from Bash tool execution) are false positives
+	if t.claudeActive {
+		if claudeUICount > 0 {
+			lastLine := t.lines[len(t.lines)-1]
+			if looksLikeClaudePrompt(lastLine.Content) {
+				return StatusWaitingInput, Detection{0.85, ReasonPrompt}
+			}
+		}
+		// Stay in waiting_input while Claude is active
+		return StatusWaitingInput, Detection{0.70, ReasonPrompt}
+	}
+
+	// Only reach here if claudeActive is false
+	if claudeUICount > 0 && lastClaudeUI > lastShellPrompt {
+		t.claudeActive = true
+		lastLine := t.lines[len(t.lines)-1]
+		if looksLikeClaudePrompt(lastLine.Content) {
+			return StatusWaitingInput, Detection{0.85, ReasonPrompt}
+		}
+		return StatusWaitingInput, Detection{0.70, ReasonPrompt}
+	}
+
+	if shellPromptCount > 0 && lastShellPrompt > lastClaudeUI {
+		return StatusShell, Detection{0.80, ReasonShellPrompt}
+	}
+
+	return StatusShell, Detection{0.50, ReasonOutput}
+}
+
+// analyzeIOBehavior uses I/O patterns to infer state
+func (d *hybridDetector) analyzeIOBehavior(t *StateTracker, current Status) (Status, Detection) {
+	now := time.Now()
+	timeSinceInput := now.Sub(t.lastInputTime)
+	timeSinceOutput := now.Sub(t.lastOutputTime)
+
+	if t.outputRate > 1000 {
+		return StatusExecuting, Detection{0.75, ReasonOutput}
+	}
+
+	if !t.lastInputTime.IsZero() &&
+		timeSinceInput < 10*time.Second &&
+		t.lastInputTime.After(t.lastOutputTime) {
+		if t.claudeActive {
+			return StatusThinking, Detection{0.65, ReasonInput}
+		}
+	}
+
+	if timeSinceOutput > 5*time.Second && t.claudeActive {
+		return StatusWaitingInput, Detection{0.60, ReasonSilence}
+	}
+
+	return current, Detection{0.3, ReasonOutput}
+}
+
+// isStrongTransition checks if state transition should override confidence threshold
+func (d *hybridDetector) isStrongTransition(from, to Status) bool {
+	if from == StatusShell && (to == StatusThinking || to == StatusExecuting || to == StatusWaitingInput) {
+		return true
+	}
+	if (from == StatusThinking || from == StatusExecuting) && to == StatusWaitingInput {
+		return true
+	}
+	return false
+}
+
+// transcriptDetector leaves Claude's statuses to its transcript alone: the
+// output only tells whether Claude's interface or a shell prompt was seen
+// last, and nothing is guessed from silence. Statuses change later than with
+// the hybrid detector but are never inferred from look-alike output.
+type transcriptDetector struct{}
+
+// Output notices Claude starting and the shell coming back
+func (d *transcriptDetector) Output(t *StateTracker, current Status) (Status, Detection, bool) {
+	lines := t.recentLines(5)
+	if len(lines) == 0 {
+		return current, Detection{}, false
+	}
+	last := lines[len(lines)-1]
+	switch {
+	case last.HasClaudeUI || last.HasSpinner:
+		t.claudeActive = true
+		if current == StatusShell {
+			return StatusWaitingInput, Detection{0.7, ReasonPrompt}, true
+		}
+	case last.HasShellPrompt && !t.claudeActive:
+		return StatusShell, Detection{0.8, ReasonShellPrompt}, true
+	}
+	return current, Detection{}, false
+}
+
+// Transcript takes the transcript's status as it is
+func (d *transcriptDetector) Transcript(t *StateTracker, current Status, state *claude.ClaudeState) (Status, Detection, bool) {
+	status, ok := transcriptStatus(state)
+	if !ok {
+		return current, Detection{}, false
+	}
+	return status, Detection{0.95, ReasonTranscript}, true
+}
+
+// Tick never changes the status: the transcript says when a turn ends
+func (d *transcriptDetector) Tick(t *StateTracker, current Status, now time.Time) (Status, Detection, bool) {
+	return current, Detection{}, false
+}
+
+// recentLines returns the N most recent lines
+func (t *StateTracker) recentLines(n int) []LineEntry {
+	if len(t.lines) <= n {
+		return t.lines
+	}
+	return t.lines[len(t.lines)-n:]
+}
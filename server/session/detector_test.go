@@ -0,0 +1,138 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"claudex/claude"
+)
+
+// Output as Claude Code and a shell print it, CRLF line endings included
+const (
+	shellPrompt  = "user@host:~/app$ "
+	claudeBanner = "╭───────────────────────────────────╮\r\n" +
+		"│ ✻ Welcome to Claude Code!         │\r\n" +
+		"╰───────────────────────────────────╯\r\n\r\n"
+	claudeInput   = "╭───────────────────────────────────╮\r\n│ > \x1b[7m \x1b[0m                               │\r\n╰───────────────────────────────────╯"
+	claudeSpinner = "\r\n\x1b[38;5;174m⠋\x1b[0m Thinking… (esc to interrupt)"
+)
+
+// testPane returns a pane that was started in a shell, with the detector,
+// ready to be fed output without a process behind it
+func testPane(t *testing.T, detector Detector) *Pane {
+	p := NewPane("main", t.TempDir())
+	p.detector = detector
+	p.screen = newScreenLines(24, 80)
+	p.status = StatusShell
+	return p
+}
+
+func TestHybridDetectorOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output []string // Written one after the other
+		status Status
+		reason string
+	}{
+		{"shell prompt", []string{shellPrompt}, StatusShell, ReasonShellPrompt},
+		{"plain shell output", []string{"total 0\r\n"}, StatusShell, ReasonOutput},
+		{"claude starts", []string{shellPrompt + "claude\r\n", claudeBanner, claudeInput}, StatusWaitingInput, ReasonPrompt},
+		{"spinner", []string{shellPrompt + "claude\r\n", claudeBanner, claudeInput, claudeSpinner}, StatusThinking, ReasonSpinner},
+		{"spinner redrawn in place", []string{claudeBanner, claudeSpinner, "\r\x1b[K⠙ Thinking…", "\r\x1b[K⠹ Thinking…"}, StatusThinking, ReasonSpinner},
+		{"tool at work", []string{claudeBanner, claudeInput, "\r\n⏺ Reading server/main.go"}, StatusExecuting, ReasonTool},
+		{"custom tool box", []string{claudeBanner, "\r\n── Bash(go test ./...) ──"}, StatusExecuting, ReasonTool},
+		{"shell prompt in Claude's output", []string{claudeBanner, claudeInput, "\r\n\r\n\r\n\r\n\r\nroot@box:~# make\r\n"}, StatusWaitingInput, ReasonPrompt},
+		{"shell prompt after Claude exits", []string{shellPrompt + "ls\r\n", "README.md\r\n", shellPrompt}, StatusShell, ReasonShellPrompt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPane(t, &hybridDetector{})
+			for _, out := range tt.output {
+				p.detectStatus([]byte(out))
+			}
+			if got, d := p.GetStatus(), p.GetDetection(); got != tt.status || d.Reason != tt.reason {
+				t.Errorf("status = %s (%s), want %s (%s)", got, d.Reason, tt.status, tt.reason)
+			}
+		})
+	}
+}
+
+func TestHybridDetectorTick(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		current Status
+		tracker StateTracker
+		status  Status
+		reason  string
+		changed bool
+	}{
+		{"thinking, output recently", StatusThinking,
+			StateTracker{lastOutputTime: now.Add(-time.Second), stateChangedAt: now.Add(-time.Minute)},
+			StatusThinking, "", false},
+		{"thinking, quiet too long", StatusThinking,
+			StateTracker{lastOutputTime: now.Add(-timeouts.Thinking - time.Second)},
+			StatusWaitingInput, ReasonTimeout, true},
+		{"executing too long", StatusExecuting,
+			StateTracker{lastOutputTime: now, stateChangedAt: now.Add(-timeouts.Executing - time.Second)},
+			StatusWaitingInput, ReasonTimeout, true},
+		{"input typed into Claude", StatusWaitingInput,
+			StateTracker{lastInputTime: now.Add(-time.Second), lastOutputTime: now.Add(-2 * time.Second), claudeActive: true},
+			StatusThinking, ReasonInput, true},
+		{"input typed into the shell", StatusShell,
+			StateTracker{lastInputTime: now.Add(-time.Second), lastOutputTime: now.Add(-2 * time.Second)},
+			StatusShell, "", false},
+		{"input answered", StatusWaitingInput,
+			StateTracker{lastInputTime: now.Add(-time.Second), lastOutputTime: now, claudeActive: true},
+			StatusWaitingInput, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, d, ok := (&hybridDetector{}).Tick(&tt.tracker, tt.current, now)
+			if ok != tt.changed || (ok && (status != tt.status || d.Reason != tt.reason)) {
+				t.Errorf("got %s (%s), %v; want %s (%s), %v", status, d.Reason, ok, tt.status, tt.reason, tt.changed)
+			}
+		})
+	}
+}
+
+func TestTranscriptDetector(t *testing.T) {
+	tests := []struct {
+		name   string
+		output []string
+		state  *claude.ClaudeState // Read from the transcript after the output
+		status Status
+		reason string
+	}{
+		{"shell prompt", []string{shellPrompt}, nil, StatusShell, ReasonShellPrompt},
+		{"claude starts", []string{shellPrompt + "claude\r\n", claudeBanner, claudeInput}, nil, StatusWaitingInput, ReasonPrompt},
+		{"spinner alone", []string{claudeBanner, claudeInput, claudeSpinner}, nil, StatusWaitingInput, ReasonPrompt},
+		{"transcript thinking", []string{claudeBanner, claudeInput, claudeSpinner}, &claude.ClaudeState{Status: "thinking"}, StatusThinking, ReasonTranscript},
+		{"transcript executing", []string{claudeBanner, claudeInput}, &claude.ClaudeState{Status: "executing"}, StatusExecuting, ReasonTranscript},
+		{"transcript idle", []string{claudeBanner, claudeInput}, &claude.ClaudeState{Status: "idle"}, StatusWaitingInput, ReasonTranscript},
+		{"unknown transcript status", []string{claudeBanner, claudeInput}, &claude.ClaudeState{Status: "compacting"}, StatusWaitingInput, ReasonPrompt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPane(t, &transcriptDetector{})
+			for _, out := range tt.output {
+				p.detectStatus([]byte(out))
+			}
+			if tt.state != nil {
+				if status, d, ok := p.detector.Transcript(p.tracker, p.status, tt.state); ok {
+					p.status, p.tracker.detection = status, d
+				}
+			}
+			if got, d := p.GetStatus(), p.GetDetection(); got != tt.status || d.Reason != tt.reason {
+				t.Errorf("status = %s (%s), want %s (%s)", got, d.Reason, tt.status, tt.reason)
+			}
+		})
+	}
+
+	t.Run("no timeouts", func(t *testing.T) {
+		tracker := StateTracker{lastOutputTime: time.Now().Add(-time.Hour), claudeActive: true}
+		if status, _, ok := (&transcriptDetector{}).Tick(&tracker, StatusThinking, time.Now()); ok {
+			t.Errorf("Tick changed the status to %s", status)
+		}
+	})
+}
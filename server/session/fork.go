@@ -0,0 +1,63 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"claudex/claude"
+)
+
+// ForkClaudeContext copies the parent's Claude conversation into the
+// experiment's worktree so the experiment's first start resumes it with
+// --fork-session. The linkage is kept in ForkedFrom.
+func (m *Manager) ForkClaudeContext(experiment, parent *Session) error {
+	claudeID := parent.GetLastClaudeSessionID()
+	if claudeID == "" {
+		return fmt.Errorf("parent session has no Claude conversation")
+	}
+	path, err := claude.FindTranscript(parent.Directory, claudeID)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Claude looks up --resume transcripts in the project dir of the cwd
+	if _, err := claude.InstallTranscript(experiment.Directory, claudeID, f); err != nil {
+		return fmt.Errorf("copy transcript: %w", err)
+	}
+
+	experiment.mu.Lock()
+	experiment.ForkedFrom = claudeID
+	experiment.UpdatedAt = time.Now()
+	experiment.mu.Unlock()
+	return m.saveSession(experiment)
+}
+
+// PendingFork returns the Claude session to fork on the next start, or ""
+// once the experiment has a conversation of its own
+func (s *Session) PendingFork() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.LastClaudeSessionID != "" {
+		return ""
+	}
+	return s.ForkedFrom
+}
+
+// ResumeFork starts Claude on a copy of the forked conversation. The new
+// Claude session ID is picked up by session detection.
+func (s *Session) ResumeFork(claudeSessionID string, rows, cols uint16, onOutput func([]byte)) error {
+	return s.resume(claudeSessionID, true, rows, cols, onOutput)
+}
+
+// GetForkedFrom returns the Claude session the experiment was forked from
+func (s *Session) GetForkedFrom() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ForkedFrom
+}
@@ -0,0 +1,162 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// historyMaxSize is the size at which a history file is rotated to .1,
+// replacing the previous rotation
+const historyMaxSize = 1 << 20
+
+// StatusTransition records one status change of a session
+type StatusTransition struct {
+	From       Status    `json:"from"`
+	To         Status    `json:"to"`
+	Confidence float64   `json:"confidence"`
+	Reason     string    `json:"reason,omitempty"` // What detection went by (detected statuses only)
+	At         time.Time `json:"at"`
+	DurationMs int64     `json:"duration_ms"` // Time spent in To (until the next transition or now)
+}
+
+// historyPath returns the file holding a session's status history
+func (m *Manager) historyPath(id string) string {
+	return filepath.Join(m.storageDir, id+".history")
+}
+
+// trackHistory makes the session append its status transitions to disk
+func (m *Manager) trackHistory(s *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historyFile = m.historyPath(s.ID)
+}
+
+// recordTransition queues a status change for the history file (caller
+// must hold the lock). The file is written outside the lock.
+func (s *Session) recordTransition(from, to Status, at time.Time) {
+	if s.historyFile == "" {
+		return
+	}
+	transition := StatusTransition{From: from, To: to, Confidence: 1.0, At: at}
+	if pane := s.mainPaneLocked(); pane != nil && to.Detected() {
+		d := pane.GetDetection()
+		transition.Confidence, transition.Reason = d.Confidence, d.Reason
+	}
+	data, err := json.Marshal(transition)
+	if err != nil {
+		return
+	}
+	if len(s.historyPending) == 0 {
+		go s.flushHistory()
+	}
+	s.historyPending = append(s.historyPending, append(data, '\n'))
+}
+
+// flushHistory appends the queued transitions to the history file, rotating
+// it when it grows past historyMaxSize
+func (s *Session) flushHistory() {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	s.mu.Lock()
+	path, pending := s.historyFile, s.historyPending
+	s.historyPending = nil
+	s.mu.Unlock()
+	if path == "" || len(pending) == 0 {
+		return
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Size() >= historyMaxSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			slog.Warn("Failed to rotate status history", "session", s.ID, "err", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("Failed to record status history", "session", s.ID, "err", err)
+		return
+	}
+	defer f.Close()
+	for _, line := range pending {
+		if _, err := f.Write(line); err != nil {
+			slog.Warn("Failed to record status history", "session", s.ID, "err", err)
+			return
+		}
+	}
+}
+
+// GetStatusHistory returns the status transitions since the given time
+// (zero for all), oldest first, with the time spent in each status. Only
+// the current and the last rotated history file are kept.
+func (s *Session) GetStatusHistory(since time.Time) ([]StatusTransition, error) {
+	s.mu.RLock()
+	path := s.historyFile
+	loc := s.locationLocked()
+	s.mu.RUnlock()
+
+	history := []StatusTransition{}
+	if path == "" {
+		return history, nil
+	}
+	var err error
+	for _, p := range []string{path + ".1", path} {
+		if history, err = readHistory(p, history); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fill in durations before filtering so the first returned entry is accurate
+	now := time.Now()
+	for i := range history {
+		end := now
+		if i+1 < len(history) {
+			end = history[i+1].At
+		}
+		history[i].DurationMs = end.Sub(history[i].At).Milliseconds()
+	}
+
+	result := history[:0]
+	for _, t := range history {
+		if !since.IsZero() && t.At.Before(since) {
+			continue
+		}
+		t.At = inLocation(t.At, loc)
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// readHistory appends the transitions in a history file to history
+func readHistory(path string, history []StatusTransition) ([]StatusTransition, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var t StatusTransition
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			continue
+		}
+		history = append(history, t)
+	}
+	return history, scanner.Err()
+}
+
+// StatusDurations sums the time spent in each status across a history
+func StatusDurations(history []StatusTransition) map[Status]int64 {
+	totals := make(map[Status]int64)
+	for _, t := range history {
+		totals[t.To] += t.DurationMs
+	}
+	return totals
+}
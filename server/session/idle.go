@@ -0,0 +1,116 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// IdlePolicy stops sessions that sat without input for too long so idle
+// shells don't pile up. A zero Timeout disables it.
+type IdlePolicy struct {
+	Timeout  string   `json:"timeout"`            // e.g. "4h"
+	Statuses []Status `json:"statuses,omitempty"` // Statuses considered idle (default: waiting_input, shell)
+}
+
+// idleCheckInterval is how often sessions are checked against the idle policy
+const idleCheckInterval = time.Minute
+
+// defaultIdleStatuses are the statuses in which a session counts as idle
+var defaultIdleStatuses = []Status{StatusWaitingInput, StatusShell}
+
+// idlePolicy is the parsed IdlePolicy
+type idlePolicy struct {
+	timeout  time.Duration
+	statuses []Status
+}
+
+// SetIdlePolicy configures automatic stopping of idle sessions
+func (m *Manager) SetIdlePolicy(p IdlePolicy) error {
+	var parsed idlePolicy
+	if p.Timeout != "" {
+		d, err := time.ParseDuration(p.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid idle timeout %q", p.Timeout)
+		}
+		parsed.timeout = d
+	}
+	parsed.statuses = p.Statuses
+	if len(parsed.statuses) == 0 {
+		parsed.statuses = defaultIdleStatuses
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.idle = parsed
+	return nil
+}
+
+// SetIdleStopCallback sets a callback invoked after a session is stopped for being idle
+func (m *Manager) SetIdleStopCallback(cb func(*Session)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onIdleStop = cb
+}
+
+// RunIdleStop checks sessions against the idle policy until stop is closed
+func (m *Manager) RunIdleStop(stop <-chan struct{}) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.stopIdleSessions()
+		}
+	}
+}
+
+// stopIdleSessions stops every running session idle for longer than the timeout,
+// saving its scrollback first
+func (m *Manager) stopIdleSessions() {
+	m.mu.RLock()
+	policy := m.idle
+	cb := m.onIdleStop
+	var idle []*Session
+	if policy.timeout > 0 {
+		for _, s := range m.sessions {
+			if s.idleFor(policy.statuses) > policy.timeout && s.RunningPanes() > 0 {
+				idle = append(idle, s)
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, s := range idle {
+		slog.Info("Stopping idle session", "session", s.ID, "name", s.Name, "timeout", policy.timeout)
+		if err := m.SaveScrollback(s); err != nil {
+			slog.Warn("Failed to save scrollback for idle session", "session", s.ID, "err", err)
+		}
+		s.Stop()
+		m.saveSession(s)
+		if cb != nil {
+			cb(s)
+		}
+	}
+}
+
+// idleFor returns how long the session has been in one of the idle statuses
+// without input (0 if it is in another status)
+func (s *Session) idleFor(statuses []Status) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, status := range statuses {
+		if s.Status != status {
+			continue
+		}
+		since := s.statusChangedAt
+		if s.LastInputAt.After(since) {
+			since = s.LastInputAt
+		}
+		return time.Since(since)
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceLimits caps what a session's processes may use. Limits are applied
+// on Linux by starting the pane in a systemd user scope, so they cover the
+// whole process tree (builds, test runners) rather than just the shell.
+// Zero fields are unlimited.
+type ResourceLimits struct {
+	MemoryMB     int `json:"memory_mb,omitempty"`
+	CPUPercent   int `json:"cpu_percent,omitempty"` // 100 = one full core
+	MaxProcesses int `json:"max_processes,omitempty"`
+}
+
+// Enabled reports whether any limit is set
+func (l *ResourceLimits) Enabled() bool {
+	return l != nil && (l.MemoryMB > 0 || l.CPUPercent > 0 || l.MaxProcesses > 0)
+}
+
+// Validate rejects negative limits
+func (l ResourceLimits) Validate() error {
+	if l.MemoryMB < 0 || l.CPUPercent < 0 || l.MaxProcesses < 0 {
+		return fmt.Errorf("resource limits must not be negative")
+	}
+	return nil
+}
+
+// command builds the exec.Cmd for a pane process, wrapped in a limited
+// systemd scope when limits are set
+func (l *ResourceLimits) command(unit, name string, args ...string) (*exec.Cmd, error) {
+	if !l.Enabled() {
+		return exec.Command(name, args...), nil
+	}
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("resource limits are only supported on Linux")
+	}
+	systemdRun, err := exec.LookPath("systemd-run")
+	if err != nil {
+		return nil, fmt.Errorf("resource limits need systemd-run: %w", err)
+	}
+
+	wrapped := []string{"--user", "--scope", "--quiet", "--collect", "--unit", unit}
+	if l.MemoryMB > 0 {
+		wrapped = append(wrapped, "-p", fmt.Sprintf("MemoryMax=%dM", l.MemoryMB), "-p", "MemorySwapMax=0")
+	}
+	if l.CPUPercent > 0 {
+		wrapped = append(wrapped, "-p", fmt.Sprintf("CPUQuota=%d%%", l.CPUPercent))
+	}
+	if l.MaxProcesses > 0 {
+		wrapped = append(wrapped, "-p", fmt.Sprintf("TasksMax=%d", l.MaxProcesses))
+	}
+	wrapped = append(wrapped, "--", name)
+	wrapped = append(wrapped, args...)
+	return exec.Command(systemdRun, wrapped...), nil
+}
+
+// scopeUnit names the systemd scope of a pane (unique per start)
+func scopeUnit(paneID string) string {
+	return fmt.Sprintf("claudex-%s-%d.scope", paneID, time.Now().UnixNano())
+}
+
+// limitBreach checks the cgroup of a limited process for OOM kills and
+// refused forks. It returns a reason if a limit was hit since the last check.
+func (l *ResourceLimits) limitBreach(pid int, seen map[string]int) string {
+	dir := cgroupDir(pid)
+	if dir == "" {
+		return ""
+	}
+	if l.MemoryMB > 0 {
+		if n := cgroupEvent(filepath.Join(dir, "memory.events"), "oom_kill"); n > seen["oom_kill"] {
+			killed := n - seen["oom_kill"]
+			seen["oom_kill"] = n
+			return fmt.Sprintf("memory limit of %d MB exceeded (%d process(es) killed)", l.MemoryMB, killed)
+		}
+	}
+	if l.MaxProcesses > 0 {
+		if n := cgroupEvent(filepath.Join(dir, "pids.events"), "max"); n > seen["pids_max"] {
+			seen["pids_max"] = n
+			return fmt.Sprintf("process limit of %d reached", l.MaxProcesses)
+		}
+	}
+	return ""
+}
+
+// cgroupDir returns the cgroup v2 directory of a process ("" if unknown)
+func cgroupDir(pid int) string {
+	data, err := os.ReadFile("/proc/" + itoa(pid) + "/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join("/sys/fs/cgroup", path)
+		}
+	}
+	return ""
+}
+
+// cgroupEvent reads one counter from a cgroup events file
+func cgroupEvent(path, key string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// SetLimits sets the session's resource limits (nil removes them). They
+// apply from the next start.
+func (s *Session) SetLimits(limits *ResourceLimits) error {
+	if limits != nil {
+		if err := limits.Validate(); err != nil {
+			return err
+		}
+		if !limits.Enabled() {
+			limits = nil
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Limits = limits
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetLimits returns a copy of the session's resource limits (nil if unlimited)
+func (s *Session) GetLimits() *ResourceLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Limits == nil {
+		return nil
+	}
+	limits := *s.Limits
+	return &limits
+}
+
+// SetLimits sets the resource limits applied when the pane process starts
+func (p *Pane) SetLimits(limits *ResourceLimits) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limits = limits
+	p.limitEvents = make(map[string]int)
+}
+
+// GetErrorReason returns why the pane is in StatusError, if known
+func (p *Pane) GetErrorReason() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.errorReason
+}
+
+// checkLimits flags the pane as errored when its processes hit a resource
+// limit (caller must hold the lock)
+func (p *Pane) checkLimits() {
+	// Sandboxed panes are capped by the container runtime instead
+	if !p.limits.Enabled() || p.sandbox != "" || p.cmd == nil || p.cmd.Process == nil {
+		return
+	}
+	reason := p.limits.limitBreach(p.cmd.Process.Pid, p.limitEvents)
+	if reason == "" {
+		return
+	}
+	p.log.Warn("Resource limit hit", "reason", reason)
+	p.status = StatusError
+	p.errorReason = reason
+	p.tracker.stateChangedAt = time.Now()
+	if p.onStatus != nil {
+		go p.onStatus(StatusError)
+	}
+}
+
+// GetStatusReason returns why the session is in StatusError, if known
+func (s *Session) GetStatusReason() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.StatusReason
+}
@@ -0,0 +1,74 @@
+package session
+
+import "time"
+
+// livenessInterval is how often the liveness fields of sessions are refreshed
+const livenessInterval = 2 * time.Second
+
+// RunLiveness keeps each session's last output time and PTY state fresh
+// until stop is closed
+func (m *Manager) RunLiveness(stop <-chan struct{}) {
+	ticker := time.NewTicker(livenessInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.mu.RLock()
+			sessions := make([]*Session, 0, len(m.sessions))
+			for _, s := range m.sessions {
+				sessions = append(sessions, s)
+			}
+			m.mu.RUnlock()
+
+			for _, s := range sessions {
+				s.refreshLiveness()
+			}
+		}
+	}
+}
+
+// refreshLiveness derives LastOutputAt and PTYAlive from the session's panes
+func (s *Session) refreshLiveness() {
+	alive := false
+	var lastOutput time.Time
+	for _, pane := range s.GetPanes() {
+		if pane.IsRunning() {
+			alive = true
+		}
+		if t := pane.LastOutputAt(); t.After(lastOutput) {
+			lastOutput = t
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.PTYAlive = alive
+	if lastOutput.After(s.LastOutputAt) {
+		s.LastOutputAt = lastOutput
+	}
+}
+
+// TouchClient records that a client subscribed to the session was heard from
+func (s *Session) TouchClient(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastClientSeenAt = t
+}
+
+// LastOutputAt returns when the PTY last produced output (zero if never)
+func (p *Pane) LastOutputAt() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastOutput
+}
+
+// formatTime renders a persisted timestamp, leaving zero values empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,112 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// localePattern matches POSIX locale names such as "de_DE.UTF-8" or "C.UTF-8"
+var localePattern = regexp.MustCompile(`^([A-Za-z]{2,3}(_[A-Z]{2})?|C|POSIX)(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+
+// SetLocale sets the session's timezone (IANA name, e.g. "Europe/Madrid") and
+// locale (e.g. "es_ES.UTF-8"). Empty values fall back to the server's.
+// They apply to panes started afterwards.
+func (s *Session) SetLocale(timezone, locale string) error {
+	var loc *time.Location
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", timezone)
+		}
+	}
+	if locale != "" && !localePattern.MatchString(locale) {
+		return fmt.Errorf("invalid locale %q", locale)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Timezone = timezone
+	s.Locale = locale
+	s.location = loc
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetLocale returns the session's timezone and locale ("" where the server's
+// apply)
+func (s *Session) GetLocale() (timezone, locale string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Timezone, s.Locale
+}
+
+// Location returns the session's timezone (the server's if unset)
+func (s *Session) Location() *time.Location {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.locationLocked()
+}
+
+// locationLocked resolves the session's timezone (caller must hold the lock)
+func (s *Session) locationLocked() *time.Location {
+	if s.location != nil {
+		return s.location
+	}
+	if s.Timezone != "" {
+		if loc, err := time.LoadLocation(s.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// InLocation converts a timestamp to the session's timezone
+func (s *Session) InLocation(t time.Time) time.Time {
+	return inLocation(t, s.Location())
+}
+
+// inLocation converts a timestamp, leaving zero values alone
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(loc)
+}
+
+// localeEnv returns the timezone and locale environment
+func (s *Session) localeEnv() []string {
+	timezone, locale := s.GetLocale()
+	var env []string
+	if timezone != "" {
+		env = append(env, "TZ="+timezone)
+	}
+	if locale != "" {
+		env = append(env, "LANG="+locale, "LC_ALL="+locale)
+	}
+	return env
+}
+
+// MarshalJSON renders the session's timestamps in its timezone
+func (s *Session) MarshalJSON() ([]byte, error) {
+	type plain Session
+	loc := s.Location()
+	return json.Marshal(struct {
+		*plain
+		CreatedAt   time.Time `json:"created_at"`
+		UpdatedAt   time.Time `json:"updated_at"`
+		LastInputAt time.Time `json:"last_input_at,omitempty"`
+
+		LastOutputAt     time.Time `json:"last_output_at,omitempty"`
+		LastClientSeenAt time.Time `json:"last_client_seen_at,omitempty"`
+	}{
+		plain:       (*plain)(s),
+		CreatedAt:   inLocation(s.CreatedAt, loc),
+		UpdatedAt:   inLocation(s.UpdatedAt, loc),
+		LastInputAt: inLocation(s.LastInputAt, loc),
+
+		LastOutputAt:     inLocation(s.LastOutputAt, loc),
+		LastClientSeenAt: inLocation(s.LastClientSeenAt, loc),
+	})
+}
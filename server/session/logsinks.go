@@ -0,0 +1,29 @@
+package session
+
+import (
+	"time"
+
+	"claudex/logsink"
+)
+
+// SetLogSinks sets the session's own output sinks (in addition to the global
+// ones), which are limited as logsink.Config.ValidateSession describes
+func (s *Session) SetLogSinks(sinks []logsink.Config) error {
+	for _, c := range sinks {
+		if err := c.ValidateSession(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LogSinks = sinks
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetLogSinks returns a copy of the session's own output sinks
+func (s *Session) GetLogSinks() []logsink.Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]logsink.Config(nil), s.LogSinks...)
+}
@@ -0,0 +1,250 @@
+package session
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// MacroMaxDelay caps the pause recorded between two macro steps so an idle
+// recording doesn't turn into a long wait on replay
+const MacroMaxDelay = 30 * time.Second
+
+// MacroStep is a chunk of input and the pause before sending it
+type MacroStep struct {
+	DelayMs int64  `json:"delay_ms"`
+	Data    string `json:"data"`
+}
+
+// Macro is a named sequence of keystrokes that can be replayed into a session
+type Macro struct {
+	Name      string      `json:"name"`
+	Steps     []MacroStep `json:"steps"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Duration returns the total replay time of the macro
+func (m *Macro) Duration() time.Duration {
+	var total time.Duration
+	for _, step := range m.Steps {
+		total += time.Duration(step.DelayMs) * time.Millisecond
+	}
+	return total
+}
+
+// reservedMacroNames can't name a macro, as they name the macro routes
+var reservedMacroNames = map[string]bool{"record": true, "stop": true, "cancel": true}
+
+// checkMacroName returns an error if name can't name a macro
+func checkMacroName(name string) error {
+	if name == "" {
+		return fmt.Errorf("macro name is required")
+	}
+	if reservedMacroNames[name] {
+		return fmt.Errorf("macro name %q is reserved", name)
+	}
+	return nil
+}
+
+// macroRecording is an in-progress macro capture
+type macroRecording struct {
+	macro *Macro
+	last  time.Time
+}
+
+// StartMacroRecording begins capturing input sent to the session under name
+func (s *Session) StartMacroRecording(name string) error {
+	if err := checkMacroName(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.macroRec != nil {
+		return fmt.Errorf("already recording macro %q", s.macroRec.macro.Name)
+	}
+	now := time.Now()
+	s.macroRec = &macroRecording{
+		macro: &Macro{Name: name, Steps: []MacroStep{}, CreatedAt: now},
+		last:  now,
+	}
+	return nil
+}
+
+// RecordMacroInput appends input to the macro being recorded, if any
+func (s *Session) RecordMacroInput(data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.macroRec
+	if rec == nil || data == "" {
+		return
+	}
+	now := time.Now()
+	delay := now.Sub(rec.last)
+	if len(rec.macro.Steps) == 0 {
+		// No pause before the first keystroke
+		delay = 0
+	}
+	if delay > MacroMaxDelay {
+		delay = MacroMaxDelay
+	}
+	rec.last = now
+	rec.macro.Steps = append(rec.macro.Steps, MacroStep{DelayMs: delay.Milliseconds(), Data: data})
+}
+
+// StopMacroRecording finishes the capture and stores the macro
+func (s *Session) StopMacroRecording() (*Macro, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.macroRec
+	if rec == nil {
+		return nil, fmt.Errorf("not recording a macro")
+	}
+	s.macroRec = nil
+	if len(rec.macro.Steps) == 0 {
+		return nil, fmt.Errorf("macro %q recorded no input", rec.macro.Name)
+	}
+	s.setMacroLocked(rec.macro)
+	return rec.macro, nil
+}
+
+// RecordingMacro returns the name of the macro being recorded ("" if none)
+func (s *Session) RecordingMacro() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.macroRec == nil {
+		return ""
+	}
+	return s.macroRec.macro.Name
+}
+
+// SetMacro stores a macro, replacing any macro with the same name
+func (s *Session) SetMacro(macro *Macro) error {
+	if err := checkMacroName(macro.Name); err != nil {
+		return err
+	}
+	if len(macro.Steps) == 0 {
+		return fmt.Errorf("macro %q has no steps", macro.Name)
+	}
+	for _, step := range macro.Steps {
+		if step.DelayMs < 0 {
+			return fmt.Errorf("macro %q has a negative delay", macro.Name)
+		}
+	}
+	if macro.CreatedAt.IsZero() {
+		macro.CreatedAt = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setMacroLocked(macro)
+	return nil
+}
+
+// setMacroLocked stores a macro (caller must hold the lock)
+func (s *Session) setMacroLocked(macro *Macro) {
+	if s.Macros == nil {
+		s.Macros = make(map[string]*Macro)
+	}
+	s.Macros[macro.Name] = macro
+	s.UpdatedAt = time.Now()
+}
+
+// DeleteMacro removes a macro, reporting whether it existed
+func (s *Session) DeleteMacro(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Macros[name]; !ok {
+		return false
+	}
+	delete(s.Macros, name)
+	s.UpdatedAt = time.Now()
+	return true
+}
+
+// GetMacro returns a macro by name
+func (s *Session) GetMacro(name string) (*Macro, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	macro, ok := s.Macros[name]
+	return macro, ok
+}
+
+// GetMacros returns all macros sorted by name
+func (s *Session) GetMacros() []*Macro {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	macros := make([]*Macro, 0, len(s.Macros))
+	for _, macro := range s.Macros {
+		macros = append(macros, macro)
+	}
+	sort.Slice(macros, func(i, j int) bool {
+		return macros[i].Name < macros[j].Name
+	})
+	return macros
+}
+
+// PlayMacro replays a macro in the background through write, which types a
+// step into the main pane, keeping the recorded delays. Only one macro plays
+// at a time; CancelMacro stops it. Playback stops at the first step write
+// fails, e.g. a line the input policy denies or holds. It returns the
+// macro being played.
+func (s *Session) PlayMacro(name string, write func(data string) error) (*Macro, error) {
+	s.mu.Lock()
+	macro, ok := s.Macros[name]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("macro %q not found", name)
+	}
+	if s.macroStop != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("a macro is already playing")
+	}
+	if pane := s.mainPaneLocked(); pane == nil || !pane.IsRunning() {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("session is not running")
+	}
+	stop := make(chan struct{})
+	s.macroStop = stop
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			if s.macroStop == stop {
+				s.macroStop = nil
+			}
+			s.mu.Unlock()
+		}()
+
+		slog.Info("Playing macro", "session", s.ID, "macro", macro.Name, "steps", len(macro.Steps))
+		for _, step := range macro.Steps {
+			if step.DelayMs > 0 {
+				select {
+				case <-stop:
+					slog.Info("Macro cancelled", "session", s.ID, "macro", macro.Name)
+					return
+				case <-time.After(time.Duration(step.DelayMs) * time.Millisecond):
+				}
+			}
+			if err := write(step.Data); err != nil {
+				slog.Info("Macro stopped", "session", s.ID, "macro", macro.Name, "err", err)
+				return
+			}
+		}
+	}()
+	return macro, nil
+}
+
+// CancelMacro stops the macro currently playing, reporting whether one was
+func (s *Session) CancelMacro() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.macroStop == nil {
+		return false
+	}
+	close(s.macroStop)
+	s.macroStop = nil
+	return true
+}
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"claudex/logsink"
+
 	"github.com/google/uuid"
 )
 
@@ -16,6 +20,15 @@ type Manager struct {
 	sessions   map[string]*Session
 	mu         sync.RWMutex
 	storageDir string
+	portPool   PortPool      // Port ranges handed out to sessions (disabled if zero)
+	quota      quotaState    // Session limits and cached disk usage
+	createMu   sync.Mutex    // Serializes quota checks with session creation
+	idle       idlePolicy    // Automatic stop of idle sessions (disabled if zero)
+	coldAfter  time.Duration // Inactivity after which stored transcript summaries are trusted
+	ledgerMu   sync.Mutex    // Serializes access to the project and worktree ledgers
+
+	onStorageError func(error)    // Called when persisting a session fails
+	onIdleStop     func(*Session) // Called after a session is stopped for being idle
 }
 
 // SessionInfo is a serializable session representation
@@ -40,6 +53,75 @@ type SessionInfo struct {
 	HexQ                *int              `json:"hex_q,omitempty"`
 	HexR                *int              `json:"hex_r,omitempty"`
 	LastClaudeSessionID string            `json:"last_claude_session_id,omitempty"`
+	InputPolicy         *InputPolicy      `json:"input_policy,omitempty"`
+	Tags                []string          `json:"tags,omitempty"`
+	PaneRoles           map[string]PaneRole `json:"pane_roles,omitempty"`
+	PaneLayout          *PaneLayout       `json:"pane_layout,omitempty"`
+	Recording           bool              `json:"recording,omitempty"`
+	RequiredServices    []ServiceCheck    `json:"required_services,omitempty"`
+	Ports               map[string]int    `json:"ports,omitempty"`
+	StartupCommand      string            `json:"startup_command,omitempty"`
+	Macros              map[string]*Macro `json:"macros,omitempty"`
+	Budget              *Budget           `json:"budget,omitempty"`
+	BudgetAlerted       *BudgetAlert      `json:"budget_alerted,omitempty"`
+	Timezone            string            `json:"timezone,omitempty"`
+	Locale              string            `json:"locale,omitempty"`
+	ForkedFrom          string            `json:"forked_from,omitempty"`
+	Limits              *ResourceLimits   `json:"limits,omitempty"`
+	Sandbox             string            `json:"sandbox,omitempty"`
+	LogSinks            []logsink.Config  `json:"log_sinks,omitempty"`
+	Backend             string            `json:"backend,omitempty"`
+	ClaudeModel         string            `json:"claude_model,omitempty"`
+	ClaudeOptions       *ClaudeOptions    `json:"claude_options,omitempty"`
+	DependsOn           *Dependency       `json:"depends_on,omitempty"`
+	ScrollbackMB        int               `json:"scrollback_mb,omitempty"`
+	LastOutputAt        string            `json:"last_output_at,omitempty"`
+	LastClientSeenAt    string            `json:"last_client_seen_at,omitempty"`
+	PTYAlive            bool              `json:"pty_alive"` // Always false once loaded: PTYs don't survive a restart
+}
+
+// ListOptions filters, sorts and paginates the sessions returned by List
+type ListOptions struct {
+	Tags     []string // Session must carry all of these tags
+	Statuses []Status // Session must be in one of these statuses (any if empty)
+	Sort     string   // Sort field: "created_at" (default), "updated_at", "last_input_at", "name", "status"
+	Desc     bool     // Sort descending
+	Limit    int      // Max sessions to return (0 = no limit)
+	Offset   int      // Number of sessions to skip
+}
+
+// sortFields maps ListOptions.Sort values to comparison functions
+var sortFields = map[string]func(a, b *Session) int{
+	"created_at": func(a, b *Session) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at": func(a, b *Session) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+	"last_input_at": func(a, b *Session) int { return a.LastInputAt.Compare(b.LastInputAt) },
+	"name": func(a, b *Session) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"status": func(a, b *Session) int { return strings.Compare(string(a.GetStatus()), string(b.GetStatus())) },
+}
+
+// ValidSortField reports whether a sort field is supported
+func ValidSortField(field string) bool {
+	_, ok := sortFields[field]
+	return field == "" || ok
+}
+
+// matches reports whether a session passes the filter
+func (o ListOptions) matches(s *Session) bool {
+	for _, tag := range o.Tags {
+		if !s.HasTag(tag) {
+			return false
+		}
+	}
+	if len(o.Statuses) > 0 {
+		status := s.GetStatus()
+		for _, st := range o.Statuses {
+			if st == status {
+				return true
+			}
+		}
+		return false
+	}
+	return true
 }
 
 // NewManager creates a new session manager
@@ -58,14 +140,25 @@ func NewManager(storageDir string) *Manager {
 	return m
 }
 
-// Create creates a new session
-func (m *Manager) Create(name, directory string) (*Session, error) {
+// Create creates a new session, failing with a *QuotaExceededError if the
+// claim would break a session limit
+func (m *Manager) Create(name, directory string, claim Claim) (*Session, error) {
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	if err := m.CheckQuota(claim); err != nil {
+		return nil, err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	id := uuid.New().String()[:8] // Short ID for convenience
 	session := NewSession(id, name, directory)
+	if claim.Owner != "" {
+		session.Metadata[OwnerKey] = claim.Owner
+	}
 	m.sessions[id] = session
+	m.trackHistory(session)
 
 	// Save to disk
 	m.saveSession(session)
@@ -81,16 +174,51 @@ func (m *Manager) Get(id string) (*Session, bool) {
 	return session, ok
 }
 
-// List returns all sessions
-func (m *Manager) List() []*Session {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// List returns the sessions matching the given options
+func (m *Manager) List(opts ListOptions) []*Session {
+	list, _ := m.ListPage(opts)
+	return list
+}
 
+// ListPage returns one page of matching sessions in a stable order, along
+// with the total number of matches before pagination
+func (m *Manager) ListPage(opts ListOptions) ([]*Session, int) {
+	m.mu.RLock()
 	list := make([]*Session, 0, len(m.sessions))
 	for _, s := range m.sessions {
-		list = append(list, s)
+		if opts.matches(s) {
+			list = append(list, s)
+		}
 	}
-	return list
+	m.mu.RUnlock()
+
+	compare, ok := sortFields[opts.Sort]
+	if !ok {
+		compare = sortFields["created_at"]
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		c := compare(list[i], list[j])
+		if c == 0 {
+			// Tie-break on ID so pages never overlap
+			c = strings.Compare(list[i].ID, list[j].ID)
+		}
+		if opts.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	total := len(list)
+	if opts.Offset > 0 {
+		if opts.Offset >= len(list) {
+			return []*Session{}, total
+		}
+		list = list[opts.Offset:]
+	}
+	if opts.Limit > 0 && opts.Limit < len(list) {
+		list = list[:opts.Limit]
+	}
+	return list, total
 }
 
 // Delete removes a session
@@ -117,12 +245,46 @@ func (m *Manager) Delete(id string) error {
 	scrollbackPath := filepath.Join(m.storageDir, id+".scrollback")
 	os.Remove(scrollbackPath)
 
+	// Remove status history and transcript summary
+	os.Remove(m.historyPath(id))
+	os.Remove(m.historyPath(id) + ".1")
+	os.Remove(m.summaryPath(id))
+
 	return nil
 }
 
 // saveSession persists a session to disk
 func (m *Manager) saveSession(s *Session) error {
-	info := SessionInfo{
+	data, err := json.MarshalIndent(sessionInfo(s), "", "  ")
+	if err != nil {
+		m.reportStorageError(err)
+		return err
+	}
+
+	path := filepath.Join(m.storageDir, s.ID+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		m.reportStorageError(err)
+		return err
+	}
+	return nil
+}
+
+// SetStorageErrorCallback sets a function called when persisting a session
+// fails. It must be set before the manager is used concurrently.
+func (m *Manager) SetStorageErrorCallback(cb func(error)) {
+	m.onStorageError = cb
+}
+
+// reportStorageError passes a storage failure to the callback, if any
+func (m *Manager) reportStorageError(err error) {
+	if m.onStorageError != nil {
+		m.onStorageError(err)
+	}
+}
+
+// sessionInfo builds the persisted form of a session
+func sessionInfo(s *Session) SessionInfo {
+	return SessionInfo{
 		ID:             s.ID,
 		Name:           s.Name,
 		Status:         s.Status,
@@ -143,15 +305,32 @@ func (m *Manager) saveSession(s *Session) error {
 		HexQ:                s.HexQ,
 		HexR:                s.HexR,
 		LastClaudeSessionID: s.LastClaudeSessionID,
+		InputPolicy:         s.InputPolicy,
+		Tags:                s.Tags,
+		PaneRoles:           s.PaneRoles,
+		PaneLayout:          s.PaneLayout,
+		Recording:           s.Recording,
+		RequiredServices:    s.RequiredServices,
+		Ports:               s.Ports,
+		StartupCommand:      s.StartupCommand,
+		Macros:              s.Macros,
+		Budget:              s.Budget,
+		BudgetAlerted:       s.BudgetAlerted,
+		Timezone:            s.Timezone,
+		Locale:              s.Locale,
+		ForkedFrom:          s.ForkedFrom,
+		Limits:              s.Limits,
+		Sandbox:             s.Sandbox,
+		LogSinks:            s.LogSinks,
+		Backend:             s.Backend,
+		ClaudeModel:         s.ClaudeModel,
+		ClaudeOptions:       s.ClaudeOptions,
+		DependsOn:           s.DependsOn,
+		ScrollbackMB:        s.ScrollbackMB,
+		LastOutputAt:        formatTime(s.LastOutputAt),
+		LastClientSeenAt:    formatTime(s.LastClientSeenAt),
+		PTYAlive:            s.PTYAlive,
 	}
-
-	data, err := json.MarshalIndent(info, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	path := filepath.Join(m.storageDir, s.ID+".json")
-	return os.WriteFile(path, data, 0644)
 }
 
 // loadSessions loads sessions from storage
@@ -177,29 +356,7 @@ func (m *Manager) loadSessions() {
 			continue
 		}
 
-		// Parse timestamps
-		createdAt, _ := time.Parse("2006-01-02T15:04:05Z07:00", info.CreatedAt)
-		updatedAt, _ := time.Parse("2006-01-02T15:04:05Z07:00", info.UpdatedAt)
-		lastInputAt, _ := time.Parse("2006-01-02T15:04:05Z07:00", info.LastInputAt)
-
-		session := NewSession(info.ID, info.Name, info.Directory)
-		session.Status = StatusIdle // Reset to idle on load
-		session.Color = info.Color
-		session.Position = info.Position
-		session.Metadata = info.Metadata
-		session.ParentID = info.ParentID
-		session.SplitParentID = info.SplitParentID
-		session.WorktreePath = info.WorktreePath
-		session.Branch = info.Branch
-		session.RobotModel = info.RobotModel
-		session.RobotColor = info.RobotColor
-		session.RobotAccessory = info.RobotAccessory
-		session.HexQ = info.HexQ
-		session.HexR = info.HexR
-		session.LastClaudeSessionID = info.LastClaudeSessionID
-		session.CreatedAt = createdAt
-		session.UpdatedAt = updatedAt
-		session.LastInputAt = lastInputAt
+		session := sessionFromInfo(info)
 
 		// Load scrollback from disk
 		scrollbackPath := filepath.Join(m.storageDir, info.ID+".scrollback")
@@ -208,7 +365,64 @@ func (m *Manager) loadSessions() {
 		}
 
 		m.sessions[session.ID] = session
+		m.trackHistory(session)
+	}
+}
+
+// sessionFromInfo rebuilds a session from its persisted form
+func sessionFromInfo(info SessionInfo) *Session {
+	// Parse timestamps
+	createdAt, _ := time.Parse("2006-01-02T15:04:05Z07:00", info.CreatedAt)
+	updatedAt, _ := time.Parse("2006-01-02T15:04:05Z07:00", info.UpdatedAt)
+	lastInputAt, _ := time.Parse("2006-01-02T15:04:05Z07:00", info.LastInputAt)
+
+	session := NewSession(info.ID, info.Name, info.Directory)
+	session.Status = StatusIdle // Reset to idle on load
+	session.Color = info.Color
+	session.Position = info.Position
+	session.Metadata = migrateMetadata(info.Metadata)
+	session.ParentID = info.ParentID
+	session.SplitParentID = info.SplitParentID
+	session.WorktreePath = info.WorktreePath
+	session.Branch = info.Branch
+	session.RobotModel = info.RobotModel
+	session.RobotColor = info.RobotColor
+	session.RobotAccessory = info.RobotAccessory
+	session.HexQ = info.HexQ
+	session.HexR = info.HexR
+	session.LastClaudeSessionID = info.LastClaudeSessionID
+	session.InputPolicy = info.InputPolicy
+	session.Tags = info.Tags
+	session.PaneRoles = info.PaneRoles
+	session.PaneLayout = info.PaneLayout
+	session.Recording = info.Recording
+	session.RequiredServices = info.RequiredServices
+	session.Ports = info.Ports
+	session.StartupCommand = info.StartupCommand
+	session.Macros = info.Macros
+	session.Budget = info.Budget
+	session.BudgetAlerted = info.BudgetAlerted
+	session.Timezone = info.Timezone
+	session.Locale = info.Locale
+	session.ForkedFrom = info.ForkedFrom
+	session.Limits = info.Limits
+	session.Sandbox = info.Sandbox
+	session.LogSinks = info.LogSinks
+	session.Backend = info.Backend
+	session.ClaudeModel = info.ClaudeModel
+	session.ClaudeOptions = info.ClaudeOptions
+	session.DependsOn = info.DependsOn
+	session.ScrollbackMB = info.ScrollbackMB
+	session.LastOutputAt, _ = time.Parse(time.RFC3339, info.LastOutputAt)
+	session.LastClientSeenAt, _ = time.Parse(time.RFC3339, info.LastClientSeenAt)
+	if info.Timezone != "" {
+		session.location, _ = time.LoadLocation(info.Timezone)
 	}
+	session.CreatedAt = createdAt
+	session.UpdatedAt = updatedAt
+	session.LastInputAt = lastInputAt
+
+	return session
 }
 
 // UpdateSession saves session state to disk
@@ -220,12 +434,36 @@ func (m *Manager) UpdateSession(s *Session) error {
 
 // SaveScrollback saves the scrollback buffer to disk
 func (m *Manager) SaveScrollback(s *Session) error {
-	scrollback := s.GetScrollback()
-	if len(scrollback) == 0 {
-		return nil
+	if err := m.writeScrollback(s); err != nil {
+		m.reportStorageError(err)
+		return err
 	}
+	return nil
+}
+
+// writeScrollback streams the session's scrollback to its file on disk,
+// leaving any previous file alone when there is nothing to save
+func (m *Manager) writeScrollback(s *Session) error {
 	path := filepath.Join(m.storageDir, s.ID+".scrollback")
-	return os.WriteFile(path, scrollback, 0644)
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := s.WriteScrollback(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || n == 0 {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// GetRecordingsDir returns the directory where session recordings are stored
+func (m *Manager) GetRecordingsDir() string {
+	return filepath.Join(filepath.Dir(m.storageDir), "recordings")
 }
 
 // GetStorageDir returns the storage directory path
@@ -233,15 +471,26 @@ func (m *Manager) GetStorageDir() string {
 	return m.storageDir
 }
 
-// CreateExperiment creates a new session with a git worktree
-func (m *Manager) CreateExperiment(parentID, branchName, worktreePath string) (*Session, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// CreateExperiment creates a new session with a git worktree. Experiments
+// belong to the parent's owner unless the claim names one.
+func (m *Manager) CreateExperiment(parentID, branchName, worktreePath string, claim Claim) (*Session, error) {
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
 
-	parent, ok := m.sessions[parentID]
+	parent, ok := m.Get(parentID)
 	if !ok {
 		return nil, fmt.Errorf("parent session not found: %s", parentID)
 	}
+	if claim.Owner == "" {
+		claim.Owner = sessionOwner(parent)
+	}
+	claim.Worktree = true
+	if err := m.CheckQuota(claim); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	// Create the session
 	id := uuid.New().String()[:8]
@@ -249,11 +498,17 @@ func (m *Manager) CreateExperiment(parentID, branchName, worktreePath string) (*
 
 	session := NewSession(id, name, worktreePath)
 	session.Color = parent.Color // Same color as parent
+	session.ClaudeModel = parent.GetClaudeModel()
+	session.ClaudeOptions = parent.GetClaudeOptions()
 	session.ParentID = parentID
 	session.WorktreePath = worktreePath
 	session.Branch = branchName
+	if claim.Owner != "" {
+		session.Metadata[OwnerKey] = claim.Owner
+	}
 
 	m.sessions[id] = session
+	m.trackHistory(session)
 	m.saveSession(session)
 
 	return session, nil
@@ -356,10 +611,6 @@ func (m *Manager) SaveAllSessions() {
 		s.UpdateCwd()
 		// Save session and scrollback
 		m.saveSession(s)
-		scrollback := s.GetScrollback()
-		if len(scrollback) > 0 {
-			path := filepath.Join(m.storageDir, s.ID+".scrollback")
-			os.WriteFile(path, scrollback, 0644)
-		}
+		m.writeScrollback(s)
 	}
 }
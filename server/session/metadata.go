@@ -0,0 +1,305 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetadataType is the value type of a metadata key
+type MetadataType string
+
+const (
+	MetadataString  MetadataType = "string"
+	MetadataNumber  MetadataType = "number"
+	MetadataBool    MetadataType = "bool"
+	MetadataStrings MetadataType = "string_list"
+)
+
+// MetadataExtensionPrefix marks free-form keys that aren't in the schema.
+// Integrations may store anything under it.
+const MetadataExtensionPrefix = "x-"
+
+// MetadataField describes a known metadata key
+type MetadataField struct {
+	Key         string       `json:"key"`
+	Type        MetadataType `json:"type"`
+	Description string       `json:"description,omitempty"`
+	Enum        []string     `json:"enum,omitempty"` // Allowed values for string keys (any if empty)
+}
+
+// PullRequestKey is the metadata key with the URL of the pull request opened
+// from an experiment
+const PullRequestKey = "pull_request_url"
+
+// MergedIntoKey is the metadata key with the branch an experiment kept after
+// its merge went into
+const MergedIntoKey = "merged_into"
+
+// metadataSchema is the registry of known metadata keys
+var (
+	metadataMu     sync.RWMutex
+	metadataSchema = map[string]MetadataField{
+		"description": {Key: "description", Type: MetadataString, Description: "What the session is working on"},
+		"owner":       {Key: "owner", Type: MetadataString, Description: "Who is responsible for the session"},
+		"issue_url":   {Key: "issue_url", Type: MetadataString, Description: "Link to the issue or ticket being worked on"},
+		"priority":    {Key: "priority", Type: MetadataString, Description: "Session priority", Enum: []string{"low", "normal", "high"}},
+		"pinned":      {Key: "pinned", Type: MetadataBool, Description: "Keep the session at the top of lists"},
+
+		PullRequestKey: {Key: PullRequestKey, Type: MetadataString, Description: "Pull request opened from the experiment"},
+		MergedIntoKey:  {Key: MergedIntoKey, Type: MetadataString, Description: "Branch the experiment was merged into"},
+	}
+)
+
+// RegisterMetadataField adds a key to the metadata schema (or replaces it)
+func RegisterMetadataField(field MetadataField) error {
+	if field.Key == "" || strings.HasPrefix(field.Key, MetadataExtensionPrefix) {
+		return fmt.Errorf("invalid metadata key %q", field.Key)
+	}
+	switch field.Type {
+	case MetadataString, MetadataNumber, MetadataBool, MetadataStrings:
+	default:
+		return fmt.Errorf("metadata key %q has unknown type %q", field.Key, field.Type)
+	}
+
+	metadataMu.Lock()
+	defer metadataMu.Unlock()
+	metadataSchema[field.Key] = field
+	return nil
+}
+
+// MetadataFields returns the registered metadata keys sorted by key
+func MetadataFields() []MetadataField {
+	metadataMu.RLock()
+	defer metadataMu.RUnlock()
+	fields := make([]MetadataField, 0, len(metadataSchema))
+	for _, field := range metadataSchema {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	return fields
+}
+
+// lookupMetadataField returns the schema of a key
+func lookupMetadataField(key string) (MetadataField, bool) {
+	metadataMu.RLock()
+	defer metadataMu.RUnlock()
+	field, ok := metadataSchema[key]
+	return field, ok
+}
+
+// ValidateMetadata checks a value against the schema and returns it in its
+// canonical form (JSON numbers as float64, string lists as []string)
+func ValidateMetadata(key string, value any) (any, error) {
+	if strings.HasPrefix(key, MetadataExtensionPrefix) {
+		return value, nil
+	}
+	field, ok := lookupMetadataField(key)
+	if !ok {
+		return nil, fmt.Errorf("unknown metadata key %q (use the %q prefix for custom keys)", key, MetadataExtensionPrefix)
+	}
+
+	switch field.Type {
+	case MetadataString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("metadata %q must be a string", key)
+		}
+		if len(field.Enum) > 0 && !containsValue(field.Enum, s) {
+			return nil, fmt.Errorf("metadata %q must be one of %s", key, strings.Join(field.Enum, ", "))
+		}
+		return s, nil
+
+	case MetadataNumber:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		}
+		return nil, fmt.Errorf("metadata %q must be a number", key)
+
+	case MetadataBool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("metadata %q must be a boolean", key)
+		}
+		return b, nil
+
+	case MetadataStrings:
+		switch list := value.(type) {
+		case []string:
+			return list, nil
+		case []any:
+			result := make([]string, 0, len(list))
+			for _, item := range list {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("metadata %q must be a list of strings", key)
+				}
+				result = append(result, s)
+			}
+			return result, nil
+		}
+		return nil, fmt.Errorf("metadata %q must be a list of strings", key)
+	}
+	return nil, fmt.Errorf("metadata %q has unknown type %q", key, field.Type)
+}
+
+// migrateMetadata brings values stored before the schema existed in line with
+// it: loosely typed values are converted, and anything that still doesn't fit
+// is kept under the extension prefix instead of being dropped
+func migrateMetadata(metadata map[string]any) map[string]any {
+	migrated := make(map[string]any, len(metadata))
+	for key, value := range metadata {
+		if v, err := ValidateMetadata(key, coerceMetadata(key, value)); err == nil {
+			migrated[key] = v
+			continue
+		}
+		migrated[MetadataExtensionPrefix+key] = value
+	}
+	return migrated
+}
+
+// coerceMetadata converts string encodings of numbers and booleans and
+// comma-separated lists to the type the schema expects
+func coerceMetadata(key string, value any) any {
+	field, ok := lookupMetadataField(key)
+	s, isString := value.(string)
+	if !ok || !isString {
+		return value
+	}
+	switch field.Type {
+	case MetadataNumber:
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	case MetadataBool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case MetadataStrings:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	}
+	return value
+}
+
+func containsValue(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMetadata validates and sets a metadata value
+func (s *Session) SetMetadata(key string, value any) error {
+	value, err := ValidateMetadata(key, value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]any)
+	}
+	s.Metadata[key] = value
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// ErrOwnerChange is returned when the owner key, which quotas are counted by,
+// is changed without the admin token
+var ErrOwnerChange = errors.New("only an admin can change the session owner")
+
+// UpdateMetadata validates and applies several changes at once; a nil value
+// deletes the key. Nothing is changed if any value is invalid, or if the owner
+// changes without override (the admin token).
+func (s *Session) UpdateMetadata(changes map[string]any, override bool) error {
+	validated := make(map[string]any, len(changes))
+	for key, value := range changes {
+		if value == nil {
+			validated[key] = nil
+			continue
+		}
+		v, err := ValidateMetadata(key, value)
+		if err != nil {
+			return err
+		}
+		validated[key] = v
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if owner, ok := validated[OwnerKey]; ok && !override && !reflect.DeepEqual(owner, s.Metadata[OwnerKey]) {
+		return ErrOwnerChange
+	}
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]any)
+	}
+	for key, value := range validated {
+		if value == nil {
+			delete(s.Metadata, key)
+		} else {
+			s.Metadata[key] = value
+		}
+	}
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetMetadata returns a copy of the session metadata
+func (s *Session) GetMetadata() map[string]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]any, len(s.Metadata))
+	for k, v := range s.Metadata {
+		result[k] = v
+	}
+	return result
+}
+
+// MetadataString returns a string metadata value
+func (s *Session) MetadataString(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Metadata[key].(string)
+	return v, ok
+}
+
+// MetadataNumber returns a numeric metadata value
+func (s *Session) MetadataNumber(key string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Metadata[key].(float64)
+	return v, ok
+}
+
+// MetadataBool returns a boolean metadata value
+func (s *Session) MetadataBool(key string) (bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Metadata[key].(bool)
+	return v, ok
+}
+
+// MetadataStrings returns a string list metadata value
+func (s *Session) MetadataStrings(key string) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.Metadata[key].([]string)
+	return append([]string(nil), v...), ok
+}
@@ -0,0 +1,39 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// validClaudeModel matches model names and aliases Claude accepts for
+// --model, like "sonnet", "claude-opus-4-1" or "opus[1m]"
+var validClaudeModel = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:\[\]-]{0,99}$`)
+
+// ValidateClaudeModel checks a model for claude --model ("" for Claude's default)
+func ValidateClaudeModel(model string) error {
+	if model != "" && !validClaudeModel.MatchString(model) {
+		return fmt.Errorf("invalid model %q", model)
+	}
+	return nil
+}
+
+// SetClaudeModel sets the model Claude is started with; it applies from the
+// next start
+func (s *Session) SetClaudeModel(model string) error {
+	if err := ValidateClaudeModel(model); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ClaudeModel = model
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetClaudeModel returns the model Claude is started with ("" for Claude's default)
+func (s *Session) GetClaudeModel() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ClaudeModel
+}
@@ -2,7 +2,7 @@ package session
 
 import (
 	"bufio"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"runtime"
@@ -54,6 +54,9 @@ func getProcessCwd(pid int) (string, error) {
 		}
 		return "", os.ErrNotExist
 
+	case "freebsd", "openbsd", "netbsd":
+		return bsdProcessCwd(pid)
+
 	default:
 		return "", os.ErrNotExist
 	}
@@ -92,12 +95,38 @@ type Pane struct {
 	pty        *os.File
 	mu         sync.RWMutex
 	done       chan struct{}
-	scrollback []byte        // Full terminal history buffer
+	scrollback *Ring         // Recent terminal output (see SetScrollbackLimit)
 	tracker    *StateTracker // State tracking for this pane
+	detector   Detector      // Turns what the tracker observed into a status
+	screen     *screenLines  // Emulated screen output goes through before detection
 	directory  string        // Working directory
 	onOutput   func([]byte)  // Callback for output
 	onStatus   func(Status)  // Callback for status changes
 	status     Status        // Current status of this pane
+	role       PaneRole      // What this pane is used for (only agent panes read the transcript)
+	tap        func([]byte)  // Extra output consumer (recording)
+	rows       uint16        // Current terminal size
+	cols       uint16
+	extraEnv   []string      // Session-specific environment (allocated ports, etc.)
+	startedAt  time.Time     // When the pane process was started
+	lastOutput time.Time     // When the PTY last produced output
+	startCmd   string        // Command typed once the shell prompt first appears
+	cmdSent    bool          // Whether the startup command has been sent
+	fork       bool          // Resume into a new Claude session (--fork-session)
+	claudeArgs []string      // Flags Claude is resumed with (model, permission mode...)
+	claudeState *claude.ClaudeState // Last read from the transcript (nil while Claude isn't running)
+
+	// Resource limits (applied through a systemd scope on start)
+	limits      *ResourceLimits // CPU/memory/process caps (nil: unlimited)
+	limitEvents map[string]int  // Cgroup event counters already reported
+	errorReason string          // Why the pane is in StatusError
+
+	// Sandbox the process runs in ("" for the host)
+	sandbox   string
+	container string // Running sandbox container name
+	tmuxName  string // tmux socket and session hosting the process ("" for none)
+
+	log *slog.Logger // Tagged with the pane (and session, once bound)
 }
 
 // NewPane creates a new pane
@@ -107,11 +136,23 @@ func NewPane(id, directory string) *Pane {
 		CreatedAt: time.Now(),
 		done:      make(chan struct{}),
 		tracker:   newStateTracker(),
+		detector:  newDetector(),
 		directory: directory,
 		status:    StatusIdle,
+
+		scrollback: NewRing(defaultScrollbackLimit()),
+		log:        slog.With("pane", id),
 	}
 }
 
+// bindSession tags the pane's log records with its session, which also
+// routes them to the session's log file. Call before starting the pane.
+func (p *Pane) bindSession(sessionID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.log = slog.With("session", sessionID, "pane", p.ID)
+}
+
 // Start launches a shell in this pane
 func (p *Pane) Start(rows, cols uint16, onOutput func([]byte), onStatus func(Status)) error {
 	p.mu.Lock()
@@ -119,49 +160,67 @@ func (p *Pane) Start(rows, cols uint16, onOutput func([]byte), onStatus func(Sta
 
 	p.onOutput = onOutput
 	p.onStatus = onStatus
+	p.rows = rows
+	p.cols = cols
 
-	log.Printf("[Pane %s] Starting shell in directory: %s (size: %dx%d)", p.ID, p.directory, cols, rows)
+	p.log.Info("Starting shell", "dir", p.directory, "cols", cols, "rows", rows)
 
 	// Get user's shell
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/zsh"
+	shell := loginShell()
+	if p.sandbox == SandboxDocker {
+		shell = getDockerConfig().Shell // The host shell may not exist in the image
+	}
+
+	// A tmux session that survived a restart already has its shell (and maybe Claude)
+	reattach := p.reattaching()
+	if reattach {
+		p.log.Info("Reattaching to tmux session", "tmux", p.tmuxName)
 	}
 
 	// Create command with login shell
-	p.cmd = exec.Command(shell, "-l")
+	cmd, err := p.command(shell, "-l")
+	if err != nil {
+		p.log.Error("Cannot create process", "err", err)
+		p.status = StatusError
+		p.errorReason = err.Error()
+		return err
+	}
+	p.cmd = cmd
 	p.cmd.Dir = p.directory
-	p.cmd.Env = append(os.Environ(),
-		"TERM=xterm-256color",
-		"LANG=en_US.UTF-8",
-		"LC_ALL=en_US.UTF-8",
-	)
 
 	// Start with PTY and initial size
 	ptmx, err := pty.StartWithSize(p.cmd, &pty.Winsize{
 		Rows: rows,
 		Cols: cols,
 	})
+	p.containerStarted(err == nil)
 	if err != nil {
-		log.Printf("[Pane %s] Failed to start PTY: %v", p.ID, err)
+		p.log.Error("Failed to start PTY", "err", err)
 		p.status = StatusError
 		return err
 	}
 	p.pty = ptmx
+	p.renewDone()
 	p.status = StatusShell
+	p.errorReason = ""
 
-	// Initialize tracker timestamps
+	// Initialize tracker timestamps, with the detector now configured
 	now := time.Now()
+	p.startedAt = now
+	p.detector = newDetector()
+	p.screen = newScreenLines(rows, cols)
+	p.cmdSent = reattach
 	p.tracker.lastOutputTime = now
 	p.tracker.stateChangedAt = now
+	p.tracker.detection = Detection{Confidence: 1.0, Reason: ReasonStart}
 
-	log.Printf("[Pane %s] PTY started successfully", p.ID)
+	p.log.Debug("PTY started")
 
 	// Read output in goroutine
-	go p.readOutput()
+	go p.readOutput(p.done)
 
 	// Start timeout monitor goroutine
-	go p.monitorTimeouts()
+	go p.monitorTimeouts(p.done)
 
 	return nil
 }
@@ -173,45 +232,66 @@ func (p *Pane) Resume(claudeSessionID string, rows, cols uint16, onOutput func([
 
 	p.onOutput = onOutput
 	p.onStatus = onStatus
+	p.rows = rows
+	p.cols = cols
 
-	log.Printf("[Pane %s] Resuming Claude session: %s", p.ID, claudeSessionID)
+	p.log.Info("Resuming Claude session", "claude_session", claudeSessionID)
 
 	// Create command with resume flag
-	p.cmd = exec.Command("claude", "--resume", claudeSessionID)
+	args := []string{"--resume", claudeSessionID}
+	if p.fork {
+		args = append(args, "--fork-session")
+	}
+	args = append(args, p.claudeArgs...)
+	claude := ClaudeBinary()
+	if p.sandbox == SandboxDocker {
+		claude = "claude" // The host path means nothing inside the image
+	}
+	cmd, err := p.command(claude, args...)
+	if err != nil {
+		p.log.Error("Cannot create process", "err", err)
+		p.status = StatusError
+		p.errorReason = err.Error()
+		return err
+	}
+	p.cmd = cmd
 	p.cmd.Dir = p.directory
-	p.cmd.Env = append(os.Environ(),
-		"TERM=xterm-256color",
-		"LANG=en_US.UTF-8",
-		"LC_ALL=en_US.UTF-8",
-	)
 
 	// Start with PTY and initial size
 	ptmx, err := pty.StartWithSize(p.cmd, &pty.Winsize{
 		Rows: rows,
 		Cols: cols,
 	})
+	p.containerStarted(err == nil)
 	if err != nil {
-		log.Printf("[Pane %s] Failed to resume Claude: %v", p.ID, err)
+		p.log.Error("Failed to resume Claude", "err", err)
 		p.status = StatusError
 		return err
 	}
 	p.pty = ptmx
+	p.renewDone()
 	p.status = StatusWaitingInput
+	p.errorReason = ""
 
-	// Initialize tracker for Claude session
+	// Initialize tracker for Claude session, with the detector now configured
 	now := time.Now()
+	p.startedAt = now
+	p.detector = newDetector()
+	p.screen = newScreenLines(rows, cols)
+	p.cmdSent = true // Already running Claude
 	p.tracker.lastOutputTime = now
 	p.tracker.stateChangedAt = now
 	p.tracker.claudeActive = true
 	p.tracker.claudeStartedAt = now
+	p.tracker.detection = Detection{Confidence: 1.0, Reason: ReasonStart}
 
-	log.Printf("[Pane %s] Claude session resumed successfully", p.ID)
+	p.log.Debug("Claude session resumed")
 
 	// Read output in goroutine
-	go p.readOutput()
+	go p.readOutput(p.done)
 
 	// Start timeout monitor
-	go p.monitorTimeouts()
+	go p.monitorTimeouts(p.done)
 
 	return nil
 }
@@ -231,12 +311,15 @@ func (p *Pane) Write(data []byte) (int, error) {
 
 // Resize changes the terminal size
 func (p *Pane) Resize(rows, cols uint16) error {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	if p.pty == nil {
 		return os.ErrClosed
 	}
+	p.rows = rows
+	p.cols = cols
+	p.screen.resize(rows, cols)
 	return pty.Setsize(p.pty, &pty.Winsize{
 		Rows: rows,
 		Cols: cols,
@@ -254,6 +337,8 @@ func (p *Pane) Stop() error {
 	if p.pty != nil {
 		p.pty.Close()
 	}
+	p.removeContainer()
+	p.killTmux()
 	p.status = StatusStopped
 
 	// Only close if not already closed
@@ -266,6 +351,78 @@ func (p *Pane) Stop() error {
 	return nil
 }
 
+// SetStartupCommand sets a command to type once the shell prompt first appears
+func (p *Pane) SetStartupCommand(command string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.startCmd = command
+}
+
+// SetForkSession makes Resume continue the conversation under a new Claude session ID
+func (p *Pane) SetForkSession(fork bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fork = fork
+}
+
+// SetClaudeArgs sets the flags Resume starts Claude with, after --resume
+func (p *Pane) SetClaudeArgs(args []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claudeArgs = args
+}
+
+// sendStartupCommand writes the startup command to the PTY (caller must hold the lock)
+func (p *Pane) sendStartupCommand(reason string) {
+	p.cmdSent = true
+	command := p.startCmd
+	p.log.Info("Running startup command", "reason", reason)
+	// Write takes the lock, so do it outside the caller's critical section
+	go p.Write([]byte(command + "\r"))
+}
+
+// SetExtraEnv sets environment variables added to the pane process on start
+func (p *Pane) SetExtraEnv(env []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.extraEnv = env
+}
+
+// GetSize returns the current terminal size
+func (p *Pane) GetSize() (rows, cols uint16) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.rows, p.cols
+}
+
+// setTap sets an extra consumer for the pane output
+func (p *Pane) setTap(tap func([]byte)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tap = tap
+}
+
+// SetRole sets the pane role
+func (p *Pane) SetRole(role PaneRole) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.role = role
+}
+
+// GetRole returns the pane role
+func (p *Pane) GetRole() PaneRole {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.role
+}
+
+// IsRunning reports whether the pane has a live process
+func (p *Pane) IsRunning() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pty != nil && p.status != StatusStopped && p.status != StatusError
+}
+
 // GetStatus returns current status thread-safely
 func (p *Pane) GetStatus() Status {
 	p.mu.RLock()
@@ -273,30 +430,52 @@ func (p *Pane) GetStatus() Status {
 	return p.status
 }
 
+// GetDetection returns how confident status detection is in the current
+// status and what it was decided on
+func (p *Pane) GetDetection() Detection {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tracker.detection
+}
+
+// GetClaudeState returns the state the pane last read from Claude's
+// transcript (every second while Claude runs in it), nil if there is none
+func (p *Pane) GetClaudeState() *claude.ClaudeState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.claudeState
+}
+
 // GetScrollback returns the terminal scrollback buffer
 func (p *Pane) GetScrollback() []byte {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	result := make([]byte, len(p.scrollback))
-	copy(result, p.scrollback)
-	return result
+	return p.scrollback.Bytes()
 }
 
 // readOutput continuously reads from PTY and detects state
-func (p *Pane) readOutput() {
-	log.Printf("[Pane %s] readOutput goroutine started", p.ID)
+// renewDone gives a restarted pane a fresh done channel; goroutines of the
+// previous run keep the closed one (caller must hold the lock)
+func (p *Pane) renewDone() {
+	select {
+	case <-p.done:
+		p.done = make(chan struct{})
+	default:
+	}
+}
+
+func (p *Pane) readOutput(done <-chan struct{}) {
 	buf := make([]byte, 4096)
 	var pending []byte // Holds incomplete UTF-8 sequences
 
 	for {
 		select {
-		case <-p.done:
-			log.Printf("[Pane %s] readOutput done signal received", p.ID)
+		case <-done:
 			return
 		default:
 			n, err := p.pty.Read(buf)
 			if err != nil {
-				log.Printf("[Pane %s] PTY read error: %v", p.ID, err)
+				p.log.Debug("PTY closed", "err", err)
 				p.mu.Lock()
 				p.status = StatusStopped
 				p.mu.Unlock()
@@ -319,16 +498,17 @@ func (p *Pane) readOutput() {
 				}
 
 				if len(data) > 0 {
-					log.Printf("[Pane %s] Sending %d bytes", p.ID, len(data))
-
-					// Save to scrollback buffer (keep last 1MB)
+					// Save to scrollback buffer (the ring keeps the most recent output)
 					p.mu.Lock()
-					p.scrollback = append(p.scrollback, data...)
-					if len(p.scrollback) > 1024*1024 {
-						p.scrollback = p.scrollback[len(p.scrollback)-1024*1024:]
-					}
+					p.lastOutput = time.Now()
+					p.scrollback.Write(data)
+					tap := p.tap
 					p.mu.Unlock()
 
+					if tap != nil {
+						tap(data)
+					}
+
 					p.detectStatus(data)
 
 					if p.onOutput != nil {
@@ -341,13 +521,13 @@ func (p *Pane) readOutput() {
 }
 
 // monitorTimeouts watches for state timeouts and polls Claude transcript
-func (p *Pane) monitorTimeouts() {
+func (p *Pane) monitorTimeouts(done <-chan struct{}) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-p.done:
+		case <-done:
 			return
 		case <-ticker.C:
 			p.pollClaudeTranscript()
@@ -361,10 +541,14 @@ func (p *Pane) pollClaudeTranscript() {
 	p.mu.Lock()
 	claudeActive := p.tracker.claudeActive
 	directory := p.directory
-	oldStatus := p.status
+	role := p.role
+	if !claudeActive {
+		p.claudeState = nil
+	}
 	p.mu.Unlock()
 
-	if !claudeActive {
+	// Helper panes share the directory but not Claude's transcript
+	if !claudeActive || role != RoleAgent {
 		return
 	}
 
@@ -374,35 +558,29 @@ func (p *Pane) pollClaudeTranscript() {
 		return
 	}
 
-	var newStatus Status
-	switch state.Status {
-	case "thinking":
-		newStatus = StatusThinking
-	case "executing":
-		newStatus = StatusExecuting
-	case "waiting_input":
-		newStatus = StatusWaitingInput
-	case "idle":
-		// Claude session might have ended
-		newStatus = StatusWaitingInput
-	default:
-		return // Don't change if unknown
+	p.mu.Lock()
+	p.claudeState = state
+	oldStatus := p.status
+	newStatus, detection, ok := p.detector.Transcript(p.tracker, oldStatus, state)
+	if !ok {
+		p.mu.Unlock()
+		return
 	}
-
-	if newStatus != oldStatus {
-		p.mu.Lock()
-		p.status = newStatus
-		p.tracker.stateChangedAt = time.Now()
-		p.tracker.confidence = 0.95 // High confidence from transcript
-		onStatus := p.onStatus
+	p.tracker.detection = detection
+	if newStatus == oldStatus {
 		p.mu.Unlock()
+		return
+	}
+	p.status = newStatus
+	p.tracker.stateChangedAt = time.Now()
+	onStatus := p.onStatus
+	p.mu.Unlock()
 
-		log.Printf("[Pane %s] Transcript state: %s -> %s (tool: %s)",
-			p.ID, oldStatus, newStatus, state.CurrentTool)
+	p.log.Debug("Transcript state changed",
+		"from", oldStatus, "to", newStatus, "tool", state.CurrentTool)
 
-		if onStatus != nil {
-			go onStatus(newStatus)
-		}
+	if onStatus != nil {
+		go onStatus(newStatus)
 	}
 }
 
@@ -415,47 +593,36 @@ func (p *Pane) checkTimeouts() {
 		return
 	}
 
+	p.checkLimits()
+	if p.status == StatusError {
+		return
+	}
+
 	now := time.Now()
 	timeSinceOutput := now.Sub(p.tracker.lastOutputTime)
-	timeSinceInput := now.Sub(p.tracker.lastInputTime)
-	timeSinceStateChange := now.Sub(p.tracker.stateChangedAt)
-
-	oldStatus := p.status
-
-	switch p.status {
-	case StatusThinking:
-		if timeSinceOutput > ThinkingTimeout {
-			log.Printf("[Pane %s] Thinking timeout (%.1fs), transitioning to waiting_input",
-				p.ID, timeSinceOutput.Seconds())
-			p.status = StatusWaitingInput
-			p.tracker.confidence = 0.6
-		}
 
-	case StatusExecuting:
-		if timeSinceStateChange > ExecutingTimeout {
-			log.Printf("[Pane %s] Executing timeout (%.1fs), transitioning to waiting_input",
-				p.ID, timeSinceStateChange.Seconds())
-			p.status = StatusWaitingInput
-			p.tracker.confidence = 0.5
-		}
-
-	case StatusShell, StatusWaitingInput:
-		if !p.tracker.lastInputTime.IsZero() &&
-			timeSinceInput > InputToThinkingDelay &&
-			timeSinceInput < 5*time.Second &&
-			p.tracker.lastInputTime.After(p.tracker.lastOutputTime) {
-			if p.tracker.claudeActive {
-				p.status = StatusThinking
-				p.tracker.confidence = 0.7
-			}
-		}
+	// Fallback for prompts we don't recognize: send once the shell has gone quiet
+	if p.startCmd != "" && !p.cmdSent &&
+		now.Sub(p.startedAt) > timeouts.StartupPrompt && timeSinceOutput > time.Second {
+		p.sendStartupCommand("startup timeout")
 	}
 
-	if p.status != oldStatus {
+	oldStatus := p.status
+	newStatus, detection, ok := p.detector.Tick(p.tracker, oldStatus, now)
+	if !ok {
+		return
+	}
+	p.tracker.detection = detection
+	if newStatus != oldStatus {
+		p.log.Debug("State changed without output",
+			"from", oldStatus, "to", newStatus,
+			"confidence", detection.Confidence, "reason", detection.Reason,
+			"idle", timeSinceOutput.Round(time.Millisecond),
+			"elapsed", now.Sub(p.tracker.stateChangedAt).Round(time.Millisecond))
+		p.status = newStatus
 		p.tracker.stateChangedAt = now
 		if p.onStatus != nil {
-			status := p.status
-			go p.onStatus(status)
+			go p.onStatus(newStatus)
 		}
 	}
 }
@@ -471,29 +638,37 @@ func (p *Pane) detectStatus(data []byte) {
 	// Update I/O rate tracking
 	p.updateIORate(len(data), now)
 
-	// Parse new data into lines and add to context buffer
-	newLines := p.parseLines(string(data))
+	// Parse the screen lines the data changed and add them to the context buffer
+	newLines := p.parseLines(p.screen.write(data))
 	p.addLinesToBuffer(newLines, now)
 
-	// Hybrid detection: combine multiple signals
-	oldStatus := p.status
-	newStatus, confidence := p.analyzeState()
+	// Run the startup command once the shell is ready
+	if p.startCmd != "" && !p.cmdSent {
+		for _, line := range newLines {
+			if line.HasShellPrompt {
+				p.sendStartupCommand("shell prompt detected")
+				break
+			}
+		}
+	}
 
-	// Only change state if confidence is high enough
+	// Let the detector weigh the new output
+	oldStatus := p.status
+	newStatus, detection, ok := p.detector.Output(p.tracker, oldStatus)
+	if !ok {
+		return
+	}
+	p.tracker.detection = detection
 	if newStatus != oldStatus {
-		if confidence >= 0.6 || p.isStrongTransition(oldStatus, newStatus) {
-			p.status = newStatus
-			p.tracker.stateChangedAt = now
-			p.tracker.confidence = confidence
-			log.Printf("[Pane %s] State: %s -> %s (confidence: %.2f)",
-				p.ID, oldStatus, newStatus, confidence)
-
-			if p.onStatus != nil {
-				go p.onStatus(newStatus)
-			}
+		p.status = newStatus
+		p.tracker.stateChangedAt = now
+		p.log.Debug("State changed",
+			"from", oldStatus, "to", newStatus,
+			"confidence", detection.Confidence, "reason", detection.Reason)
+
+		if p.onStatus != nil {
+			go p.onStatus(newStatus)
 		}
-	} else {
-		p.tracker.confidence = confidence
 	}
 }
 
@@ -507,12 +682,11 @@ func (p *Pane) updateIORate(bytes int, now time.Time) {
 	p.tracker.outputBytes += int64(bytes)
 }
 
-// parseLines splits data into individual lines with analysis
-func (p *Pane) parseLines(data string) []LineEntry {
-	rawLines := splitLines(data)
-	entries := make([]LineEntry, 0, len(rawLines))
+// parseLines analyzes the lines of output as they appear on screen
+func (p *Pane) parseLines(lines []string) []LineEntry {
+	entries := make([]LineEntry, 0, len(lines))
 
-	for _, line := range rawLines {
+	for _, line := range lines {
 		if len(trimSpace(line)) == 0 {
 			continue
 		}
@@ -543,181 +717,7 @@ func (p *Pane) addLinesToBuffer(lines []LineEntry, now time.Time) {
 	}
 }
 
-// analyzeState performs hybrid state analysis
-func (p *Pane) analyzeState() (Status, float64) {
-	recentLines := p.getRecentLines(5)
-
-	// Spinner = definitely thinking
-	for _, line := range recentLines {
-		if line.HasSpinner {
-			p.tracker.claudeActive = true
-			return StatusThinking, 0.95
-		}
-	}
-
-	// Tool patterns = executing
-	for _, line := range recentLines {
-		if line.HasToolPattern {
-			p.tracker.claudeActive = true
-			return StatusExecuting, 0.90
-		}
-	}
-
-	// Context analysis
-	contextStatus, contextConf := p.analyzeContext()
-	if contextConf >= 0.8 {
-		return contextStatus, contextConf
-	}
-
-	// I/O behavior analysis
-	ioStatus, ioConf := p.analyzeIOBehavior()
-	if ioConf >= 0.7 {
-		return ioStatus, ioConf
-	}
-
-	// Combine signals
-	if contextConf >= 0.5 && ioConf >= 0.5 {
-		if contextStatus == ioStatus {
-			return contextStatus, (contextConf + ioConf) / 2
-		}
-	}
-
-	if contextConf >= 0.5 {
-		return contextStatus, contextConf
-	}
-
-	return p.status, 0.4
-}
-
-// getRecentLines returns the N most recent lines
-func (p *Pane) getRecentLines(n int) []LineEntry {
-	if len(p.tracker.lines) <= n {
-		return p.tracker.lines
-	}
-	return p.tracker.lines[len(p.tracker.lines)-n:]
-}
-
-// analyzeContext looks at the full line buffer for patterns
-func (p *Pane) analyzeContext() (Status, float64) {
-	if len(p.tracker.lines) == 0 {
-		if p.tracker.claudeActive {
-			return StatusWaitingInput, 0.5
-		}
-		return StatusShell, 0.3
-	}
-
-	var spinnerCount, toolCount, claudeUICount, shellPromptCount int
-	var lastClaudeUI, lastShellPrompt int = -1, -1
-
-	for i, line := range p.tracker.lines {
-		if line.HasSpinner {
-			spinnerCount++
-		}
-		if line.HasToolPattern {
-			toolCount++
-		}
-		if line.HasClaudeUI {
-			claudeUICount++
-			lastClaudeUI = i
-		}
-		if line.HasShellPrompt {
-			shellPromptCount++
-			lastShellPrompt = i
-		}
-	}
-
-	if spinnerCount > 0 {
-		p.tracker.claudeActive = true
-		return StatusThinking, 0.85
-	}
-
-	if toolCount > 0 {
-		p.tracker.claudeActive = true
-		return StatusExecuting, 0.80
-	}
-
-	// CRITICAL: If Claude is active, NEVER go back to shell state
-	// Shell prompts inside Claude output (from Bash tool execution) are false positives
-	if p.tracker.claudeActive {
-		if claudeUICount > 0 {
-			lastLine := p.tracker.lines[len(p.tracker.lines)-1]
-			if looksLikeClaudePrompt(lastLine.Content) {
-				return StatusWaitingInput, 0.85
-			}
-		}
-		// Stay in waiting_input while Claude is active
-		return StatusWaitingInput, 0.70
-	}
-
-	// Only reach here if claudeActive is false
-	if claudeUICount > 0 && lastClaudeUI > lastShellPrompt {
-		p.tracker.claudeActive = true
-		lastLine := p.tracker.lines[len(p.tracker.lines)-1]
-		if looksLikeClaudePrompt(lastLine.Content) {
-			return StatusWaitingInput, 0.85
-		}
-		return StatusWaitingInput, 0.70
-	}
-
-	if shellPromptCount > 0 && lastShellPrompt > lastClaudeUI {
-		return StatusShell, 0.80
-	}
-
-	return StatusShell, 0.50
-}
-
-// analyzeIOBehavior uses I/O patterns to infer state
-func (p *Pane) analyzeIOBehavior() (Status, float64) {
-	now := time.Now()
-	timeSinceInput := now.Sub(p.tracker.lastInputTime)
-	timeSinceOutput := now.Sub(p.tracker.lastOutputTime)
-
-	if p.tracker.outputRate > 1000 {
-		return StatusExecuting, 0.75
-	}
-
-	if !p.tracker.lastInputTime.IsZero() &&
-		timeSinceInput < 10*time.Second &&
-		p.tracker.lastInputTime.After(p.tracker.lastOutputTime) {
-		if p.tracker.claudeActive {
-			return StatusThinking, 0.65
-		}
-	}
-
-	if timeSinceOutput > 5*time.Second && p.tracker.claudeActive {
-		return StatusWaitingInput, 0.60
-	}
-
-	return p.status, 0.3
-}
-
-// isStrongTransition checks if state transition should override confidence threshold
-func (p *Pane) isStrongTransition(from, to Status) bool {
-	if from == StatusShell && (to == StatusThinking || to == StatusExecuting || to == StatusWaitingInput) {
-		return true
-	}
-	if (from == StatusThinking || from == StatusExecuting) && to == StatusWaitingInput {
-		return true
-	}
-	return false
-}
-
 // Helper functions for pattern detection (shared with session.go)
-func splitLines(data string) []string {
-	var lines []string
-	start := 0
-	for i := 0; i < len(data); i++ {
-		if data[i] == '\n' {
-			lines = append(lines, data[start:i])
-			start = i + 1
-		}
-	}
-	if start < len(data) {
-		lines = append(lines, data[start:])
-	}
-	return lines
-}
-
 func trimSpace(s string) string {
 	start := 0
 	end := len(s)
@@ -753,6 +753,9 @@ func detectToolPattern(line string) bool {
 			return true
 		}
 	}
+	if extra := extraPatterns.Load(); extra != nil {
+		return matchesAny(line, extra.Tool)
+	}
 	return false
 }
 
@@ -768,6 +771,9 @@ func detectClaudeUI(line string) bool {
 			return true
 		}
 	}
+	if extra := extraPatterns.Load(); extra != nil {
+		return matchesAny(line, extra.ClaudeUI)
+	}
 	return false
 }
 
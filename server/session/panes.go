@@ -0,0 +1,151 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Directions a pane can be split in
+const (
+	SplitHorizontal = "horizontal" // Side by side
+	SplitVertical   = "vertical"   // One above the other
+)
+
+// validPaneID keeps pane IDs usable in tmux and recording names
+var validPaneID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// firstPaneID returns the first leaf of the layout, the main pane ("" for
+// no layout)
+func (l *PaneLayout) firstPaneID() string {
+	if l == nil {
+		return ""
+	}
+	if l.PaneID != "" {
+		return l.PaneID
+	}
+	for i := range l.Children {
+		if id := l.Children[i].firstPaneID(); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// paneIDs appends the layout's leaves to ids, in order
+func (l *PaneLayout) paneIDs(ids []string) []string {
+	if l == nil {
+		return ids
+	}
+	if l.PaneID != "" {
+		return append(ids, l.PaneID)
+	}
+	for i := range l.Children {
+		ids = l.Children[i].paneIDs(ids)
+	}
+	return ids
+}
+
+// clone returns a deep copy of the layout
+func (l *PaneLayout) clone() *PaneLayout {
+	if l == nil {
+		return nil
+	}
+	c := *l
+	c.Children = nil
+	for i := range l.Children {
+		c.Children = append(c.Children, *l.Children[i].clone())
+	}
+	return &c
+}
+
+// MainPaneID returns the ID of the pane the session's shell and Claude run
+// in: the first pane of the layout, "main" by default
+func (s *Session) MainPaneID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if id := s.PaneLayout.firstPaneID(); id != "" {
+		return id
+	}
+	return "main"
+}
+
+// LayoutPaneIDs returns the panes of the layout, the main pane first. They
+// outlive restarts while the panes' processes don't.
+func (s *Session) LayoutPaneIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.PaneLayout.paneIDs(nil)
+}
+
+// GetPaneLayout returns a copy of the pane layout (nil before the first start)
+func (s *Session) GetPaneLayout() *PaneLayout {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.PaneLayout.clone()
+}
+
+// AddPane adds a pane to a running session by splitting splitFrom (the main
+// pane if empty). An empty paneID gets the next free "pane-N". The new pane
+// is not started.
+func (s *Session) AddPane(splitFrom, paneID, direction string) (*Pane, error) {
+	if direction == "" {
+		direction = SplitHorizontal
+	}
+	if direction != SplitHorizontal && direction != SplitVertical {
+		return nil, fmt.Errorf("invalid direction %q (horizontal or vertical)", direction)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leaves := s.PaneLayout.paneIDs(nil)
+	if main := s.mainPaneLocked(); main == nil || !main.IsRunning() {
+		return nil, fmt.Errorf("session is not running")
+	}
+	if splitFrom == "" {
+		splitFrom = leaves[0]
+	}
+	if !slices.Contains(leaves, splitFrom) {
+		return nil, fmt.Errorf("pane %s not found", splitFrom)
+	}
+	if paneID == "" {
+		for n := len(leaves) + 1; paneID == ""; n++ {
+			if id := fmt.Sprintf("pane-%d", n); s.panes[id] == nil && !slices.Contains(leaves, id) {
+				paneID = id
+			}
+		}
+	}
+	if !validPaneID.MatchString(paneID) {
+		return nil, fmt.Errorf("invalid pane ID %q (up to 32 letters, digits, - and _)", paneID)
+	}
+	if s.panes[paneID] != nil || slices.Contains(leaves, paneID) {
+		return nil, fmt.Errorf("pane %s already exists", paneID)
+	}
+	return s.splitPaneLocked(splitFrom, paneID, direction), nil
+}
+
+// ClosePane stops a pane and removes it from the layout. The main pane
+// can't be closed; stop the session instead.
+func (s *Session) ClosePane(paneID string) error {
+	s.mu.RLock()
+	leaves := s.PaneLayout.paneIDs(nil)
+	s.mu.RUnlock()
+
+	if len(leaves) > 0 && leaves[0] == paneID {
+		return fmt.Errorf("the main pane can't be closed")
+	}
+	if s.RemovePane(paneID) {
+		return nil
+	}
+	// Not started since a restart: only the layout knows it
+	if !slices.Contains(leaves, paneID) {
+		return fmt.Errorf("pane %s not found", paneID)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removePaneFromLayout(paneID)
+	s.UpdatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,167 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Answers to a permission prompt
+const (
+	PermissionApprove       = "approve"        // Allow this once
+	PermissionApproveAlways = "approve_always" // Allow and don't ask again (the second "Yes" option)
+	PermissionDeny          = "deny"           // Refuse and tell Claude to do something else
+)
+
+// permissionOption matches an option of Claude's select menu, like
+// "❯ 1. Yes" or "2. No, and tell Claude what to do differently (esc)"
+var permissionOption = regexp.MustCompile(`^(?:[❯>]\s*)?(\d+)\.\s+(.+)$`)
+
+// PermissionPrompt is Claude asking whether it may use a tool
+type PermissionPrompt struct {
+	Tool     string   `json:"tool,omitempty"`    // Tool waiting for approval, from the transcript
+	Title    string   `json:"title,omitempty"`   // Heading of the prompt, like "Bash command"
+	Command  string   `json:"command,omitempty"` // What the tool will run or change
+	Question string   `json:"question"`          // Like "Do you want to proceed?"
+	Options  []string `json:"options"`           // Menu options; option N is Options[N-1]
+}
+
+// Equal reports whether two prompts are the same question
+func (p *PermissionPrompt) Equal(o *PermissionPrompt) bool {
+	if p == nil || o == nil {
+		return p == o
+	}
+	return p.Tool == o.Tool && p.Title == o.Title && p.Command == o.Command &&
+		p.Question == o.Question && slices.Equal(p.Options, o.Options)
+}
+
+// Keys returns the keystrokes that answer the prompt: the number of the
+// option for decision, or of option if it is not zero
+func (p *PermissionPrompt) Keys(decision string, option int) (string, error) {
+	if option != 0 {
+		if option < 1 || option > len(p.Options) {
+			return "", fmt.Errorf("option %d is not one of 1-%d", option, len(p.Options))
+		}
+		return strconv.Itoa(option), nil
+	}
+
+	var yes []int
+	no := 0
+	for i, text := range p.Options {
+		switch {
+		case strings.HasPrefix(text, "Yes"):
+			yes = append(yes, i+1)
+		case strings.HasPrefix(text, "No") && no == 0:
+			no = i + 1
+		}
+	}
+	switch decision {
+	case PermissionApprove:
+		if len(yes) > 0 {
+			return strconv.Itoa(yes[0]), nil
+		}
+		return "1", nil
+	case PermissionApproveAlways:
+		if len(yes) < 2 {
+			return "", fmt.Errorf("the prompt has no option to stop asking")
+		}
+		return strconv.Itoa(yes[1]), nil
+	case PermissionDeny:
+		if no > 0 {
+			return strconv.Itoa(no), nil
+		}
+		return "\x1b", nil // Escape declines too
+	}
+	return "", fmt.Errorf("unknown decision %q (approve, approve_always or deny)", decision)
+}
+
+// ParsePermissionPrompt finds the permission prompt Claude is showing in the
+// text lines of a screen, nil if there is none. The question must be
+// followed by its numbered options with nothing but the prompt's frame or
+// hints after them, so answered prompts still in the scrollback don't count.
+func ParsePermissionPrompt(lines []string) *PermissionPrompt {
+	q := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := promptText(lines[i])
+		if strings.HasPrefix(line, "Do you want to") && strings.HasSuffix(line, "?") {
+			q = i
+			break
+		}
+	}
+	if q < 0 {
+		return nil
+	}
+	prompt := &PermissionPrompt{Question: promptText(lines[q])}
+
+	// Options, numbered from 1
+	i := q + 1
+	for ; i < len(lines); i++ {
+		line := promptText(lines[i])
+		if line == "" && len(prompt.Options) == 0 {
+			continue
+		}
+		m := permissionOption.FindStringSubmatch(line)
+		if m == nil || m[1] != strconv.Itoa(len(prompt.Options)+1) {
+			break
+		}
+		prompt.Options = append(prompt.Options, m[2])
+	}
+	if len(prompt.Options) < 2 {
+		return nil
+	}
+	// Nothing but hints (like "Esc to cancel") may follow, a few lines at most
+	var after int
+	for ; i < len(lines); i++ {
+		if promptText(lines[i]) != "" {
+			after++
+		}
+	}
+	if after > 2 {
+		return nil
+	}
+
+	// Heading and what the tool will do, up to the top of the frame
+	var body []string
+	framed := false
+	for i := q - 1; i >= 0 && q-i <= 12; i-- {
+		if isPromptBorder(lines[i]) {
+			framed = true
+			break
+		}
+		body = append([]string{promptText(lines[i])}, body...)
+	}
+	if !framed {
+		return prompt // Too long to tell, like an edit's diff
+	}
+	var paragraph []string
+	for _, line := range body {
+		switch {
+		case line != "" && prompt.Title == "":
+			prompt.Title = line
+		case line != "" && prompt.Title != "":
+			paragraph = append(paragraph, line)
+		case len(paragraph) > 0:
+			prompt.Command = strings.Join(paragraph, "\n")
+			return prompt
+		}
+	}
+	prompt.Command = strings.Join(paragraph, "\n")
+	return prompt
+}
+
+// promptText returns a screen line without the prompt's side borders
+func promptText(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "│")
+	line = strings.TrimSuffix(line, "│")
+	return strings.TrimSpace(line)
+}
+
+// isPromptBorder reports whether a screen line is a horizontal rule or the
+// top or bottom of a box
+func isPromptBorder(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && strings.Trim(line, "─━═╭╮╰╯┌┐└┘ ") == ""
+}
@@ -0,0 +1,184 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// PolicyDecision is the outcome of checking a submitted command against a policy
+type PolicyDecision string
+
+const (
+	PolicyAllow   PolicyDecision = "allow"   // Command may be submitted
+	PolicyDeny    PolicyDecision = "deny"    // Command is blocked outright
+	PolicyConfirm PolicyDecision = "confirm" // Command needs an explicit override
+)
+
+// InputPolicy restricts which commands can be submitted to a session
+type InputPolicy struct {
+	Deny    []string `json:"deny,omitempty"`    // Regexes that block a command
+	Confirm []string `json:"confirm,omitempty"` // Regexes that require confirmation
+}
+
+// PolicyResult describes why a submitted line was held back
+type PolicyResult struct {
+	Decision PolicyDecision `json:"decision"`
+	Line     string         `json:"line"`
+	Pattern  string         `json:"pattern,omitempty"`
+}
+
+// Validate checks that all policy patterns compile
+func (p *InputPolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, p.Deny...), p.Confirm...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns the decision for a complete command line.
+// Deny patterns take precedence over confirm patterns.
+func (p *InputPolicy) Evaluate(line string) (PolicyDecision, string) {
+	if p == nil || trimSpace(line) == "" {
+		return PolicyAllow, ""
+	}
+	for _, pattern := range p.Deny {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(line) {
+			return PolicyDeny, pattern
+		}
+	}
+	for _, pattern := range p.Confirm {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(line) {
+			return PolicyConfirm, pattern
+		}
+	}
+	return PolicyAllow, ""
+}
+
+// SetInputPolicy replaces the session's input policy
+func (s *Session) SetInputPolicy(policy *InputPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.InputPolicy = policy
+	s.inputLines = nil
+	s.pendingLine = ""
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetInputPolicy returns the session's input policy (nil if unrestricted)
+func (s *Session) GetInputPolicy() *InputPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.InputPolicy
+}
+
+// FilterInput tracks the line being typed into a pane ("" for the main one)
+// and checks it against the policy when it is submitted. It returns the part
+// of the input that may be written to the terminal; if a submission was held
+// back, result describes why and the rest of the input is dropped.
+func (s *Session) FilterInput(paneID, data string) (string, *PolicyResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.InputPolicy == nil {
+		return data, nil
+	}
+	if s.inputLines == nil {
+		s.inputLines = make(map[string][]byte)
+	}
+
+	// Any new input cancels a submission that was waiting for confirmation
+	s.pendingLine = ""
+
+	line := s.inputLines[paneID]
+	defer func() { s.inputLines[paneID] = line }()
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\r' || c == '\n':
+			submitted := string(line)
+			decision, pattern := s.InputPolicy.Evaluate(submitted)
+			if decision != PolicyAllow {
+				if decision == PolicyConfirm {
+					s.pendingLine, s.pendingPane = submitted, paneID
+				} else {
+					line = nil
+				}
+				return data[:i], &PolicyResult{Decision: decision, Line: submitted, Pattern: pattern}
+			}
+			line = nil
+		case c == 0x7f || c == '\b':
+			line = trimLastRune(line)
+		case c == 0x03 || c == 0x15: // Ctrl-C / Ctrl-U discard the line
+			line = nil
+		case c == 0x1b:
+			// Skip escape sequences (arrow keys, etc.)
+			i = skipEscapeSequence(data, i)
+		case c >= 0x20 || c == '\t':
+			line = append(line, c)
+		}
+	}
+	return data, nil
+}
+
+// ConfirmPendingInput releases a submission that was held for confirmation,
+// returning the pane it was typed into ("" for the main one). It returns
+// false if nothing is pending.
+func (s *Session) ConfirmPendingInput() (paneID, line string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pendingLine == "" {
+		return "", "", false
+	}
+	line, paneID = s.pendingLine, s.pendingPane
+	s.pendingLine = ""
+	delete(s.inputLines, paneID)
+	return paneID, line, true
+}
+
+// trimLastRune removes the last UTF-8 character from a line buffer
+func trimLastRune(line []byte) []byte {
+	i := len(line) - 1
+	for i > 0 && line[i]&0xC0 == 0x80 {
+		i--
+	}
+	if i < 0 {
+		return line
+	}
+	return line[:i]
+}
+
+// skipEscapeSequence returns the index of the last byte of the escape sequence starting at i
+func skipEscapeSequence(data string, i int) int {
+	if i+1 >= len(data) {
+		return i
+	}
+	switch data[i+1] {
+	case '[':
+		j := i + 2
+		for j < len(data) && (data[j] < 0x40 || data[j] > 0x7e) {
+			j++
+		}
+		if j >= len(data) {
+			return len(data) - 1
+		}
+		return j
+	case 'O':
+		if i+2 < len(data) {
+			return i + 2
+		}
+		return len(data) - 1
+	default:
+		return i + 1
+	}
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// PortPool configures the port ranges handed out to sessions so parallel
+// experiments running the same app don't fight over the same ports
+type PortPool struct {
+	Start     int      `json:"start"`      // First port of the pool
+	End       int      `json:"end"`        // Last port of the pool (inclusive)
+	BlockSize int      `json:"block_size"` // Ports reserved per session
+	Env       []string `json:"env"`        // Env vars to set, in order: base, base+1, ... (default: PORT)
+}
+
+// Enabled reports whether the pool is configured
+func (p PortPool) Enabled() bool {
+	return p.Start > 0 && p.End >= p.Start
+}
+
+// normalized fills in defaults
+func (p PortPool) normalized() PortPool {
+	if p.BlockSize <= 0 {
+		p.BlockSize = 10
+	}
+	if len(p.Env) == 0 {
+		p.Env = []string{"PORT"}
+	}
+	if len(p.Env) > p.BlockSize {
+		p.BlockSize = len(p.Env)
+	}
+	return p
+}
+
+// PortBaseEnv is always set to the first port of the session's block
+const PortBaseEnv = "CLAUDEX_PORT_BASE"
+
+// PortMapping records which ports a session was given
+type PortMapping struct {
+	SessionID string         `json:"session_id"`
+	Name      string         `json:"name"`
+	Ports     map[string]int `json:"ports"`
+}
+
+// SetPortPool configures the port pool (a zero pool disables allocation)
+func (m *Manager) SetPortPool(pool PortPool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.portPool = pool.normalized()
+}
+
+// AllocatePorts assigns a free block of ports to the session if the pool is
+// configured and it has none yet. Allocations are sticky across restarts.
+func (m *Manager) AllocatePorts(s *Session) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pool := m.portPool
+	if !pool.Enabled() {
+		return nil, nil
+	}
+	if ports := s.GetPorts(); len(ports) > 0 {
+		return ports, nil
+	}
+
+	// Collect bases already handed out to other sessions
+	used := make(map[int]bool)
+	for _, other := range m.sessions {
+		if other.ID == s.ID {
+			continue
+		}
+		if base, ok := other.GetPorts()[PortBaseEnv]; ok {
+			used[base] = true
+		}
+	}
+
+	for base := pool.Start; base+pool.BlockSize-1 <= pool.End; base += pool.BlockSize {
+		if used[base] || !portFree(base) {
+			continue
+		}
+		ports := map[string]int{PortBaseEnv: base}
+		for i, name := range pool.Env {
+			ports[name] = base + i
+		}
+		s.setPorts(ports)
+		m.saveSession(s)
+		return ports, nil
+	}
+	return nil, fmt.Errorf("no free port block in %d-%d", pool.Start, pool.End)
+}
+
+// PortMappings returns the port allocations of all sessions
+func (m *Manager) PortMappings() []PortMapping {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mappings := []PortMapping{}
+	for _, s := range m.sessions {
+		if ports := s.GetPorts(); len(ports) > 0 {
+			mappings = append(mappings, PortMapping{SessionID: s.ID, Name: s.Name, Ports: ports})
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Ports[PortBaseEnv] < mappings[j].Ports[PortBaseEnv]
+	})
+	return mappings
+}
+
+// GetPorts returns a copy of the session's port allocation (env var -> port)
+func (s *Session) GetPorts() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.Ports) == 0 {
+		return nil
+	}
+	result := make(map[string]int, len(s.Ports))
+	for k, v := range s.Ports {
+		result[k] = v
+	}
+	return result
+}
+
+// setPorts stores the session's port allocation
+func (s *Session) setPorts(ports map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Ports = ports
+	s.UpdatedAt = time.Now()
+}
+
+// portEnv returns the allocated ports as environment entries (caller must hold the lock)
+func (s *Session) portEnv() []string {
+	env := make([]string, 0, len(s.Ports))
+	for name, port := range s.Ports {
+		env = append(env, name+"="+strconv.Itoa(port))
+	}
+	sort.Strings(env)
+	return env
+}
+
+// portFree reports whether nothing on this host is listening on the port
+func portFree(port int) bool {
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
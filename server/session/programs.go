@@ -0,0 +1,81 @@
+package session
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Programs sessions run on the host (docker sessions use the image's own)
+var (
+	shellPath  string // Login shell ("": $SHELL, then /bin/zsh)
+	claudePath = "claude"
+)
+
+// SetShell sets the login shell started in panes ("" for $SHELL). Call it
+// before any session starts.
+func SetShell(path string) {
+	shellPath = path
+}
+
+// SetClaudeBinary sets the Claude CLI used to resume conversations and in
+// the demo session ("" for "claude" on the PATH). Call it before any session
+// starts.
+func SetClaudeBinary(path string) {
+	if path == "" {
+		path = "claude"
+	}
+	claudePath = path
+}
+
+// ClaudeBinary returns the Claude CLI sessions run
+func ClaudeBinary() string {
+	return claudePath
+}
+
+// ClaudeCommand returns the shell command line that starts Claude on a
+// first prompt, for use as a startup command
+func ClaudeCommand(prompt string) string {
+	return ClaudeBinary() + " '" + strings.ReplaceAll(prompt, "'", `'\''`) + "'"
+}
+
+// loginShell returns the shell started in host panes
+func loginShell() string {
+	if shellPath != "" {
+		return shellPath
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/zsh"
+}
+
+// Timeouts overrides the status detection timeouts. Zero fields keep the
+// defaults (ThinkingTimeout, ExecutingTimeout, StartupPromptTimeout).
+type Timeouts struct {
+	Thinking      time.Duration
+	Executing     time.Duration
+	StartupPrompt time.Duration
+}
+
+// timeouts are the status detection timeouts in effect
+var timeouts = Timeouts{
+	Thinking:      ThinkingTimeout,
+	Executing:     ExecutingTimeout,
+	StartupPrompt: StartupPromptTimeout,
+}
+
+// SetTimeouts sets the status detection timeouts. Call it before any
+// session starts.
+func SetTimeouts(t Timeouts) {
+	if t.Thinking == 0 {
+		t.Thinking = ThinkingTimeout
+	}
+	if t.Executing == 0 {
+		t.Executing = ExecutingTimeout
+	}
+	if t.StartupPrompt == 0 {
+		t.StartupPrompt = StartupPromptTimeout
+	}
+	timeouts = t
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Project ledger events: what happened to a session that its stats outlive
+const (
+	ProjectEventMerged    = "merged"    // The experiment's worktree was merged
+	ProjectEventDiscarded = "discarded" // The experiment's worktree was discarded
+	ProjectEventDeleted   = "deleted"   // The session was deleted, with its agent time
+)
+
+// ProjectRecord is one line of the project ledger, which keeps what the
+// per-project statistics need from sessions that are gone
+type ProjectRecord struct {
+	SessionID   string    `json:"session_id"`
+	Project     string    `json:"project"` // Working directory the session counted towards
+	Event       string    `json:"event"`
+	Experiment  bool      `json:"experiment,omitempty"`
+	AgentTimeMs int64     `json:"agent_time_ms,omitempty"` // Deleted: time Claude spent thinking or executing
+	MergedInto  string    `json:"merged_into,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// ledgerPath returns the file holding the project ledger (not .json, so it
+// isn't read as a session)
+func (m *Manager) ledgerPath() string {
+	return filepath.Join(m.storageDir, "projects.jsonl")
+}
+
+// AgentTime returns how long Claude has been thinking or executing in the
+// session, from its status history
+func (s *Session) AgentTime() time.Duration {
+	history, err := s.GetStatusHistory(time.Time{})
+	if err != nil {
+		return 0
+	}
+	totals := StatusDurations(history)
+	return time.Duration(totals[StatusThinking]+totals[StatusExecuting]) * time.Millisecond
+}
+
+// RecordProjectEvent appends an event of the session to the project ledger.
+// Deletions are recorded before the session's history is removed, so they
+// carry its agent time.
+func (m *Manager) RecordProjectEvent(s *Session, project, event, mergedInto string) {
+	record := ProjectRecord{
+		SessionID:  s.ID,
+		Project:    project,
+		Event:      event,
+		Experiment: s.ParentID != "",
+		MergedInto: mergedInto,
+		At:         time.Now(),
+	}
+	if event == ProjectEventDeleted {
+		record.AgentTimeMs = s.AgentTime().Milliseconds()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	m.ledgerMu.Lock()
+	defer m.ledgerMu.Unlock()
+	f, err := os.OpenFile(m.ledgerPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("Failed to record project event", "session", s.ID, "event", event, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		slog.Warn("Failed to record project event", "session", s.ID, "event", event, "err", err)
+	}
+}
+
+// ProjectLedger returns every recorded project event, oldest first
+func (m *Manager) ProjectLedger() ([]ProjectRecord, error) {
+	m.ledgerMu.Lock()
+	defer m.ledgerMu.Unlock()
+
+	records := []ProjectRecord{}
+	f, err := os.Open(m.ledgerPath())
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r ProjectRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,345 @@
+package session
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Quota caps the resources sessions may use. Zero fields are unlimited.
+type Quota struct {
+	MaxSessions  int   `json:"max_sessions,omitempty"`
+	MaxRunning   int   `json:"max_running,omitempty"`   // Panes with a live PTY
+	MaxWorktrees int   `json:"max_worktrees,omitempty"` // Experiment sessions with a git worktree
+	MaxDiskMB    int64 `json:"max_disk_mb,omitempty"`   // Session storage plus worktrees
+}
+
+// Quotas configures the global limits and the limits for each user (the
+// session's "owner" metadata)
+type Quotas struct {
+	Global  Quota            `json:"global"`
+	PerUser Quota            `json:"per_user"`        // Default for every owner
+	Users   map[string]Quota `json:"users,omitempty"` // Per-owner overrides of PerUser
+
+	// Requests carrying this token in the AdminHeader bypass the limits
+	AdminToken string `json:"admin_token,omitempty"`
+
+	// Users by the token they send in the UserTokenHeader. Only a token
+	// makes a request count as a user's; without one only global limits
+	// apply.
+	UserTokens map[string]string `json:"user_tokens,omitempty"`
+}
+
+// AdminHeader carries the admin token that overrides quotas
+const AdminHeader = "X-Claudex-Admin"
+
+// UserTokenHeader carries the token that identifies a request's user
+const UserTokenHeader = "X-Claudex-Token"
+
+// OwnerKey is the metadata key quotas are counted per
+const OwnerKey = "owner"
+
+// diskUsageTTL is how long a disk usage measurement is reused
+const diskUsageTTL = time.Minute
+
+// QuotaUsage is the current consumption counted against a Quota
+type QuotaUsage struct {
+	Sessions  int   `json:"sessions"`
+	Running   int   `json:"running"`
+	Worktrees int   `json:"worktrees"`
+	DiskMB    int64 `json:"disk_mb"`
+}
+
+// QuotaExceededError reports which limit a request would break
+type QuotaExceededError struct {
+	Scope    string `json:"scope"` // "global" or "user:<owner>"
+	Resource string `json:"resource"`
+	Limit    int64  `json:"limit"`
+	Current  int64  `json:"current"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s %s limit is %d (currently %d)", e.Scope, e.Resource, e.Limit, e.Current)
+}
+
+// Claim describes what a new session would consume
+type Claim struct {
+	Owner    string // Counted against this user's quota (empty: global only)
+	Worktree bool   // The session gets its own git worktree
+	Override bool   // Admin override: skip the checks
+}
+
+// quotaState holds the configured quotas and cached disk usage
+type quotaState struct {
+	mu       sync.Mutex
+	quotas   Quotas
+	disk     map[string]int64 // Directory -> bytes
+	measured time.Time
+}
+
+// SetQuotas configures the session limits
+func (m *Manager) SetQuotas(q Quotas) {
+	m.quota.mu.Lock()
+	defer m.quota.mu.Unlock()
+	m.quota.quotas = q
+}
+
+// GetQuotas returns the configured limits
+func (m *Manager) GetQuotas() Quotas {
+	m.quota.mu.Lock()
+	defer m.quota.mu.Unlock()
+	return m.quota.quotas
+}
+
+// IsAdmin reports whether the token grants a quota override
+func (m *Manager) IsAdmin(token string) bool {
+	q := m.GetQuotas()
+	return q.AdminToken != "" && token == q.AdminToken
+}
+
+// TokenUser returns the user a token identifies, "" for none
+func (m *Manager) TokenUser(token string) string {
+	if token == "" {
+		return ""
+	}
+	return m.GetQuotas().UserTokens[token]
+}
+
+// ClaimFor builds the claim of a creation request from the admin and user
+// tokens it carries. The owner is the user token's; admins may name another
+// instead, the first of requested that isn't empty.
+func (m *Manager) ClaimFor(adminToken, userToken string, requested ...string) Claim {
+	c := Claim{Owner: m.TokenUser(userToken), Override: m.IsAdmin(adminToken)}
+	if c.Override {
+		for _, owner := range requested {
+			if owner != "" {
+				c.Owner = owner
+				break
+			}
+		}
+	}
+	return c
+}
+
+// userQuota returns the limits that apply to an owner
+func (q Quotas) userQuota(owner string) Quota {
+	if quota, ok := q.Users[owner]; ok {
+		return quota
+	}
+	return q.PerUser
+}
+
+// QuotaUsage returns the consumption of all sessions, or of one owner's
+func (m *Manager) QuotaUsage(owner string) QuotaUsage {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		if owner == "" || sessionOwner(s) == owner {
+			sessions = append(sessions, s)
+		}
+	}
+	m.mu.RUnlock()
+	return m.usageOf(sessions, owner == "")
+}
+
+// usageOf counts what the given sessions consume. Global usage includes the
+// session store itself.
+func (m *Manager) usageOf(sessions []*Session, global bool) QuotaUsage {
+	var usage QuotaUsage
+	dirs := []string{}
+	if global {
+		dirs = append(dirs, m.storageDir)
+	}
+	for _, s := range sessions {
+		usage.Sessions++
+		usage.Running += s.RunningPanes()
+		s.mu.RLock()
+		worktree := s.WorktreePath
+		s.mu.RUnlock()
+		if worktree != "" {
+			usage.Worktrees++
+			dirs = append(dirs, worktree)
+		}
+	}
+	usage.DiskMB = m.diskUsage(dirs) / (1024 * 1024)
+	return usage
+}
+
+// CheckQuota returns a *QuotaExceededError if creating a session for the
+// claim would break a global or per-user limit
+func (m *Manager) CheckQuota(c Claim) error {
+	if c.Override {
+		return nil
+	}
+	q := m.GetQuotas()
+	if err := checkQuota("global", q.Global, m.QuotaUsage(""), c); err != nil {
+		return err
+	}
+	if c.Owner == "" {
+		return nil
+	}
+	return checkQuota("user:"+c.Owner, q.userQuota(c.Owner), m.QuotaUsage(c.Owner), c)
+}
+
+// checkQuota compares usage plus one new session against a quota
+func checkQuota(scope string, q Quota, u QuotaUsage, c Claim) error {
+	exceeded := func(resource string, limit, current int64) error {
+		return &QuotaExceededError{Scope: scope, Resource: resource, Limit: limit, Current: current}
+	}
+	if q.MaxSessions > 0 && u.Sessions >= q.MaxSessions {
+		return exceeded("sessions", int64(q.MaxSessions), int64(u.Sessions))
+	}
+	// The new session will start a PTY as soon as it is opened
+	if q.MaxRunning > 0 && u.Running >= q.MaxRunning {
+		return exceeded("running", int64(q.MaxRunning), int64(u.Running))
+	}
+	if c.Worktree && q.MaxWorktrees > 0 && u.Worktrees >= q.MaxWorktrees {
+		return exceeded("worktrees", int64(q.MaxWorktrees), int64(u.Worktrees))
+	}
+	if q.MaxDiskMB > 0 && u.DiskMB >= q.MaxDiskMB {
+		return exceeded("disk_mb", q.MaxDiskMB, u.DiskMB)
+	}
+	return nil
+}
+
+// CheckRunQuota returns a *QuotaExceededError if starting the session would
+// break a running limit. A session that is already running counts already.
+func (m *Manager) CheckRunQuota(s *Session, override bool) error {
+	if override || s.RunningPanes() > 0 {
+		return nil
+	}
+	return m.checkRunning(s)
+}
+
+// CheckPaneQuota returns a *QuotaExceededError if starting a PTY for
+// another pane of the session would break a running limit
+func (m *Manager) CheckPaneQuota(s *Session, override bool) error {
+	if override {
+		return nil
+	}
+	return m.checkRunning(s)
+}
+
+// checkRunning returns a *QuotaExceededError if one more PTY for the session
+// would break a global or per-user running limit
+func (m *Manager) checkRunning(s *Session) error {
+	q := m.GetQuotas()
+	if u := m.QuotaUsage(""); q.Global.MaxRunning > 0 && u.Running >= q.Global.MaxRunning {
+		return &QuotaExceededError{Scope: "global", Resource: "running",
+			Limit: int64(q.Global.MaxRunning), Current: int64(u.Running)}
+	}
+	owner := sessionOwner(s)
+	if owner == "" {
+		return nil
+	}
+	limit := q.userQuota(owner).MaxRunning
+	if u := m.QuotaUsage(owner); limit > 0 && u.Running >= limit {
+		return &QuotaExceededError{Scope: "user:" + owner, Resource: "running",
+			Limit: int64(limit), Current: int64(u.Running)}
+	}
+	return nil
+}
+
+// diskUsage sums the bytes under the directories, re-measuring each at
+// most once per diskUsageTTL
+func (m *Manager) diskUsage(dirs []string) int64 {
+	m.quota.mu.Lock()
+	defer m.quota.mu.Unlock()
+
+	// Skip the walk entirely when no disk limit is configured
+	q := m.quota.quotas
+	if q.Global.MaxDiskMB == 0 && q.PerUser.MaxDiskMB == 0 && !anyDiskLimit(q.Users) {
+		return 0
+	}
+
+	if m.quota.disk == nil || time.Since(m.quota.measured) > diskUsageTTL {
+		m.quota.disk = make(map[string]int64)
+		m.quota.measured = time.Now()
+	}
+	var total int64
+	for _, dir := range dirs {
+		size, ok := m.quota.disk[dir]
+		if !ok {
+			size = dirSize(dir)
+			m.quota.disk[dir] = size
+		}
+		total += size
+	}
+	return total
+}
+
+// anyDiskLimit reports whether any per-owner quota limits disk
+func anyDiskLimit(users map[string]Quota) bool {
+	for _, q := range users {
+		if q.MaxDiskMB > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dirSize returns the total size of the regular files under dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// sessionOwner returns the session's owner metadata
+func sessionOwner(s *Session) string {
+	owner, _ := s.MetadataString(OwnerKey)
+	return owner
+}
+
+// RunningPanes returns how many of the session's panes have a live PTY
+func (s *Session) RunningPanes() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, pane := range s.panes {
+		if pane.IsRunning() {
+			n++
+		}
+	}
+	return n
+}
+
+// OwnerQuota is one user's limits and consumption
+type OwnerQuota struct {
+	Owner string     `json:"owner"`
+	Quota Quota      `json:"quota"`
+	Usage QuotaUsage `json:"usage"`
+}
+
+// OwnerQuotas reports the limits and consumption of every owner with sessions
+func (m *Manager) OwnerQuotas() []OwnerQuota {
+	m.mu.RLock()
+	owners := make(map[string]bool)
+	for _, s := range m.sessions {
+		if owner := sessionOwner(s); owner != "" {
+			owners[owner] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	q := m.GetQuotas()
+	result := make([]OwnerQuota, 0, len(owners))
+	for owner := range owners {
+		result = append(result, OwnerQuota{Owner: owner, Quota: q.userQuota(owner), Usage: m.QuotaUsage(owner)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Owner < result[j].Owner })
+	return result
+}
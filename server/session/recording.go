@@ -0,0 +1,122 @@
+package session
+
+import (
+	"log/slog"
+	"time"
+
+	"claudex/recording"
+)
+
+// StartRecording begins recording every pane of the session into baseDir.
+// It returns the recording ID (the current one if already recording).
+func (s *Session) StartRecording(baseDir string) (string, error) {
+	s.mu.Lock()
+	if s.recorder != nil {
+		id := s.recorder.ID()
+		s.mu.Unlock()
+		return id, nil
+	}
+
+	rec, err := recording.NewRecorder(baseDir, s.ID)
+	if err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	s.recorder = rec
+	s.Recording = true
+	s.UpdatedAt = time.Now()
+
+	panes := make(map[string]*Pane, len(s.panes))
+	for id, pane := range s.panes {
+		panes[id] = pane
+	}
+	s.mu.Unlock()
+
+	// Track panes that are already running
+	for _, pane := range panes {
+		if pane.IsRunning() {
+			s.trackPane(pane)
+		}
+	}
+
+	slog.Info("Recording started", "session", s.ID, "recording", rec.ID())
+	return rec.ID(), nil
+}
+
+// StopRecording finishes the current recording. If disable is true the
+// session will no longer start recording automatically.
+func (s *Session) StopRecording(disable bool) {
+	s.mu.Lock()
+	rec := s.recorder
+	s.recorder = nil
+	if disable {
+		s.Recording = false
+		s.UpdatedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	if rec != nil {
+		rec.Close()
+		slog.Info("Recording stopped", "session", s.ID, "recording", rec.ID())
+	}
+}
+
+// IsRecording reports whether the session is being recorded right now
+func (s *Session) IsRecording() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.recorder != nil
+}
+
+// RecordingEnabled reports whether the session should be recorded when started
+func (s *Session) RecordingEnabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Recording
+}
+
+// EnableRecording marks the session to be recorded from its next start
+func (s *Session) EnableRecording() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Recording = true
+	s.UpdatedAt = time.Now()
+}
+
+// trackPane adds a pane to the active recording, if any
+func (s *Session) trackPane(pane *Pane) {
+	s.mu.RLock()
+	rec := s.recorder
+	role := s.paneRole(pane.ID)
+	s.mu.RUnlock()
+
+	if rec == nil {
+		return
+	}
+	rows, cols := pane.GetSize()
+	if err := rec.AddPane(pane.ID, string(role), cols, rows); err != nil {
+		slog.Warn("Failed to record pane", "session", s.ID, "pane", pane.ID, "err", err)
+	}
+}
+
+// recordOutput is the pane output tap feeding the active recording
+func (s *Session) recordOutput(paneID string, data []byte) {
+	s.mu.RLock()
+	rec := s.recorder
+	s.mu.RUnlock()
+
+	if rec != nil {
+		rec.WriteOutput(paneID, data)
+	}
+}
+
+// recordResize notes a pane resize in the active recording
+func (s *Session) recordResize(paneID string, rows, cols uint16) {
+	s.mu.RLock()
+	rec := s.recorder
+	s.mu.RUnlock()
+
+	if rec != nil {
+		rec.WriteResize(paneID, cols, rows)
+	}
+}
@@ -0,0 +1,85 @@
+package session
+
+import "unicode/utf8"
+
+// Ring is a fixed-capacity byte buffer that keeps the most recent output.
+// Writes past the limit overwrite the oldest bytes in place, so a full
+// buffer takes no further allocations or copies beyond the written data.
+// It is not safe for concurrent use; the owner's lock guards it.
+type Ring struct {
+	buf     []byte // Grows up to limit, then wraps
+	start   int    // Index of the oldest byte once the buffer has wrapped
+	limit   int
+	trimmed bool // Old output was dropped: the oldest byte may be mid-character
+}
+
+// NewRing creates a ring keeping the last limit bytes
+func NewRing(limit int) *Ring {
+	return &Ring{limit: limit}
+}
+
+// Write appends data, dropping the oldest bytes beyond the limit
+func (r *Ring) Write(data []byte) (int, error) {
+	n := len(data)
+	if len(data) >= r.limit {
+		r.trimmed = r.trimmed || len(r.buf) > 0 || len(data) > r.limit
+		r.buf = append(r.buf[:0], data[len(data)-r.limit:]...)
+		r.start = 0
+		return n, nil
+	}
+
+	if room := r.limit - len(r.buf); room > 0 {
+		take := min(room, len(data))
+		r.buf = append(r.buf, data[:take]...)
+		data = data[take:]
+	}
+	for len(data) > 0 {
+		copied := copy(r.buf[r.start:], data)
+		data = data[copied:]
+		r.start = (r.start + copied) % r.limit
+		r.trimmed = true
+	}
+	return n, nil
+}
+
+// Len returns the number of bytes held
+func (r *Ring) Len() int {
+	return len(r.buf)
+}
+
+// SetLimit changes the capacity, keeping as much recent output as fits
+func (r *Ring) SetLimit(limit int) {
+	if limit == r.limit {
+		return
+	}
+	data := r.Bytes() // Already starts on a character boundary
+	*r = Ring{limit: limit}
+	r.Write(data)
+}
+
+// segments returns the held output oldest first, as up to two slices of the
+// buffer, starting on a character boundary
+func (r *Ring) segments() ([]byte, []byte) {
+	head, tail := r.buf[r.start:], r.buf[:r.start]
+	if !r.trimmed {
+		return head, tail
+	}
+	for skip := 0; skip < utf8.UTFMax-1; skip++ {
+		if len(head) == 0 {
+			head, tail = tail, nil
+		}
+		if len(head) == 0 || utf8.RuneStart(head[0]) {
+			break
+		}
+		head = head[1:]
+	}
+	return head, tail
+}
+
+// Bytes returns a copy of the held output, oldest first
+func (r *Ring) Bytes() []byte {
+	head, tail := r.segments()
+	result := make([]byte, 0, len(head)+len(tail))
+	result = append(result, head...)
+	return append(result, tail...)
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// PaneRole describes what a pane is used for
+type PaneRole string
+
+const (
+	RoleAgent   PaneRole = "agent"   // Runs Claude Code; the only pane whose transcript drives status
+	RoleTests   PaneRole = "tests"   // Test runs
+	RoleServer  PaneRole = "server"  // Dev servers and watch tasks
+	RoleScratch PaneRole = "scratch" // Ad-hoc commands
+)
+
+// ValidPaneRole reports whether role is a known pane role
+func ValidPaneRole(role PaneRole) bool {
+	switch role {
+	case RoleAgent, RoleTests, RoleServer, RoleScratch:
+		return true
+	}
+	return false
+}
+
+// SetPaneRole assigns a role to a pane. Only one pane may hold each role, so
+// any other pane with the same role is cleared.
+func (s *Session) SetPaneRole(paneID string, role PaneRole) error {
+	if !ValidPaneRole(role) {
+		return fmt.Errorf("invalid pane role: %s", role)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.PaneRoles == nil {
+		s.PaneRoles = make(map[string]PaneRole)
+	}
+	for id, r := range s.PaneRoles {
+		if r == role && id != paneID {
+			delete(s.PaneRoles, id)
+		}
+	}
+	s.PaneRoles[paneID] = role
+
+	// Roles can move between panes (including the implicit agent role of "main")
+	for id, pane := range s.panes {
+		pane.SetRole(s.paneRole(id))
+	}
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetPaneRoles returns a copy of the pane ID -> role assignments
+func (s *Session) GetPaneRoles() map[string]PaneRole {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]PaneRole, len(s.PaneRoles))
+	for id, role := range s.PaneRoles {
+		result[id] = role
+	}
+	return result
+}
+
+// paneRole returns the role for a pane (caller must hold the lock)
+func (s *Session) paneRole(paneID string) PaneRole {
+	if role, ok := s.PaneRoles[paneID]; ok {
+		return role
+	}
+	// Without an explicit agent pane, the main pane runs Claude
+	if paneID == "main" && s.paneIDForRole(RoleAgent) == "" {
+		return RoleAgent
+	}
+	return ""
+}
+
+// paneIDForRole returns the pane explicitly assigned a role (caller must hold the lock)
+func (s *Session) paneIDForRole(role PaneRole) string {
+	for id, r := range s.PaneRoles {
+		if r == role {
+			return id
+		}
+	}
+	return ""
+}
+
+// PaneIDForRole returns the ID of the pane holding a role ("" if none)
+func (s *Session) PaneIDForRole(role PaneRole) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if id := s.paneIDForRole(role); id != "" {
+		return id
+	}
+	if role == RoleAgent {
+		return "main"
+	}
+	return ""
+}
+
+// RolePaneID returns the ID of the pane designated for role, assigning the
+// role to a helper pane named after it if no pane holds it yet. The pane may
+// still have to be started.
+func (s *Session) RolePaneID(role PaneRole) (string, error) {
+	if !ValidPaneRole(role) {
+		return "", fmt.Errorf("invalid pane role: %s", role)
+	}
+
+	paneID := s.PaneIDForRole(role)
+	if paneID == "" {
+		paneID = string(role)
+		if err := s.SetPaneRole(paneID, role); err != nil {
+			return "", err
+		}
+	}
+	return paneID, nil
+}
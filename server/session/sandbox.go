@@ -0,0 +1,299 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SandboxDocker runs the session's shell and Claude inside a container with
+// the working directory bind-mounted, instead of directly on the host
+const SandboxDocker = "docker"
+
+// containerLabel marks containers started by claudex so orphans can be
+// found; instanceLabel tells apart the servers sharing a docker daemon
+const (
+	containerLabel = "claudex.managed"
+	instanceLabel  = "claudex.instance"
+)
+
+// DockerConfig configures the docker sandbox
+type DockerConfig struct {
+	Image   string   `json:"image"`
+	Shell   string   `json:"shell,omitempty"`   // Shell inside the image (default /bin/bash)
+	Network string   `json:"network,omitempty"` // docker --network (default bridge)
+	Mounts  []string `json:"mounts,omitempty"`  // Extra -v host:container[:ro] mounts
+	Args    []string `json:"args,omitempty"`    // Extra docker run arguments
+}
+
+var (
+	dockerMu     sync.RWMutex
+	dockerConfig DockerConfig
+	instanceID   string // Value of instanceLabel on this server's containers
+)
+
+// SetSandboxInstance names this server's containers after its storage
+// directory, so a server only cleans up the containers it started
+func SetSandboxInstance(storageDir string) {
+	if abs, err := filepath.Abs(storageDir); err == nil {
+		storageDir = abs
+	}
+	sum := sha256.Sum256([]byte(storageDir))
+	dockerMu.Lock()
+	defer dockerMu.Unlock()
+	instanceID = hex.EncodeToString(sum[:6])
+}
+
+// sandboxInstance returns the value of instanceLabel for this server
+func sandboxInstance() string {
+	dockerMu.RLock()
+	defer dockerMu.RUnlock()
+	return instanceID
+}
+
+// SetDockerConfig configures the image and options of docker sandboxes
+func SetDockerConfig(config DockerConfig) {
+	dockerMu.Lock()
+	defer dockerMu.Unlock()
+	dockerConfig = config
+}
+
+// getDockerConfig returns the docker sandbox config with defaults filled in
+func getDockerConfig() DockerConfig {
+	dockerMu.RLock()
+	defer dockerMu.RUnlock()
+	config := dockerConfig
+	if config.Shell == "" {
+		config.Shell = "/bin/bash"
+	}
+	return config
+}
+
+// ValidateSandbox checks a session sandbox mode ("" runs on the host)
+func ValidateSandbox(sandbox string) error {
+	switch sandbox {
+	case "":
+		return nil
+	case SandboxDocker:
+		if getDockerConfig().Image == "" {
+			return fmt.Errorf("docker sandbox needs an image in the server config")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown sandbox %q", sandbox)
+}
+
+// Containers tracks the sandbox containers started for panes so they are
+// removed when the pane stops and don't outlive the server
+type Containers struct {
+	mu      sync.Mutex
+	running map[string]string // Container name -> pane ID
+}
+
+// containers is the process-wide container tracker
+var containers = &Containers{running: make(map[string]string)}
+
+// add records a started container
+func (c *Containers) add(name, paneID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running[name] = paneID
+}
+
+// Remove force-removes a container (the docker client being killed leaves it running)
+func (c *Containers) Remove(name string) {
+	c.mu.Lock()
+	delete(c.running, name)
+	c.mu.Unlock()
+
+	if out, err := exec.Command("docker", "rm", "-f", name).CombinedOutput(); err != nil {
+		slog.Warn("Failed to remove sandbox container", "container", name, "err", err, "output", strings.TrimSpace(string(out)))
+	}
+}
+
+// RemoveAll removes every tracked container (on shutdown)
+func (c *Containers) RemoveAll() {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.running))
+	for name := range c.running {
+		names = append(names, name)
+	}
+	c.mu.Unlock()
+
+	for _, name := range names {
+		c.Remove(name)
+	}
+}
+
+// CleanupSandboxContainers removes containers left behind by a previous run
+// of this server (no PTY survives a restart, so they are all orphans)
+func CleanupSandboxContainers() {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return
+	}
+	out, err := exec.Command("docker", "ps", "-aq",
+		"--filter", "label="+containerLabel+"=true",
+		"--filter", "label="+instanceLabel+"="+sandboxInstance()).Output()
+	if err != nil {
+		return
+	}
+	for _, id := range strings.Fields(string(out)) {
+		slog.Info("Removing orphaned sandbox container", "container", id)
+		containers.Remove(id)
+	}
+}
+
+// StopSandboxContainers removes the containers of all running sandboxed panes
+func StopSandboxContainers() {
+	containers.RemoveAll()
+}
+
+// SetSandbox sets where the session's processes run; it applies on the next start
+func (s *Session) SetSandbox(sandbox string) error {
+	if err := ValidateSandbox(sandbox); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Sandbox = sandbox
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetSandbox returns where the session's processes run ("" for the host)
+func (s *Session) GetSandbox() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Sandbox
+}
+
+// SetSandbox sets where the pane process runs ("" for the host)
+func (p *Pane) SetSandbox(sandbox string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sandbox = sandbox
+}
+
+// command builds the pane process: on the host (through tmux with the tmux
+// backend, inside a limited scope if limits are set) or inside a sandbox
+// container (caller must hold the lock)
+func (p *Pane) command(name string, args ...string) (*exec.Cmd, error) {
+	env := append([]string{
+		"TERM=xterm-256color",
+		"LANG=en_US.UTF-8",
+		"LC_ALL=en_US.UTF-8",
+	}, p.extraEnv...)
+
+	if p.sandbox == SandboxDocker {
+		return p.dockerCommand(env, name, args)
+	}
+
+	if p.tmuxName != "" {
+		args = p.tmuxArgs(name, args)
+		name = "tmux"
+	}
+	cmd, err := p.limits.command(scopeUnit(p.ID), name, args...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Env = append(os.Environ(), env...)
+	return cmd, nil
+}
+
+// dockerCommand runs name inside a fresh container. The working directory
+// and ~/.claude are mounted at their host paths and the process runs as the
+// host user, so files keep their owner and Claude transcripts stay visible
+// to claudex. Resource limits map to docker's own flags.
+func (p *Pane) dockerCommand(env []string, name string, args []string) (*exec.Cmd, error) {
+	config := getDockerConfig()
+	if config.Image == "" {
+		return nil, fmt.Errorf("docker sandbox needs an image in the server config")
+	}
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, fmt.Errorf("docker sandbox: %w", err)
+	}
+	home, _ := os.UserHomeDir()
+
+	container := "claudex-" + uuid.New().String()[:8]
+	run := []string{"run", "--rm", "-it",
+		"--name", container,
+		"--label", containerLabel + "=true",
+		"--label", instanceLabel + "=" + sandboxInstance(),
+		"--label", "claudex.pane=" + p.ID,
+		"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()),
+		"-v", p.directory + ":" + p.directory,
+		"-w", p.directory,
+		"-e", "HOME=" + home,
+	}
+	if home != "" {
+		claudeDir := filepath.Join(home, ".claude")
+		run = append(run, "-v", claudeDir+":"+claudeDir)
+	}
+	for _, mount := range config.Mounts {
+		run = append(run, "-v", mount)
+	}
+	if config.Network != "" {
+		run = append(run, "--network", config.Network)
+	}
+	if l := p.limits; l.Enabled() {
+		if l.MemoryMB > 0 {
+			run = append(run, "--memory", strconv.Itoa(l.MemoryMB)+"m")
+		}
+		if l.CPUPercent > 0 {
+			run = append(run, "--cpus", strconv.FormatFloat(float64(l.CPUPercent)/100, 'f', 2, 64))
+		}
+		if l.MaxProcesses > 0 {
+			run = append(run, "--pids-limit", strconv.Itoa(l.MaxProcesses))
+		}
+	}
+	for _, e := range env {
+		run = append(run, "-e", e)
+	}
+	run = append(run, config.Args...)
+	run = append(run, config.Image, name)
+	run = append(run, args...)
+
+	cmd := exec.Command(docker, run...)
+	cmd.Env = os.Environ()
+	p.container = container
+	p.log.Info("Starting in docker container", "container", container, "image", config.Image)
+	return cmd, nil
+}
+
+// containerStarted tracks the pane's container once its process is running,
+// or forgets it if the process didn't start (caller must hold the lock)
+func (p *Pane) containerStarted(started bool) {
+	if p.container == "" {
+		return
+	}
+	if !started {
+		p.container = ""
+		return
+	}
+	containers.add(p.container, p.ID)
+}
+
+// removeContainer removes the pane's container after its process stopped (caller must hold the lock)
+func (p *Pane) removeContainer() {
+	if p.container == "" {
+		return
+	}
+	name := p.container
+	p.container = ""
+	// docker rm blocks for a while; don't hold the pane lock for it
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		containers.Remove(name)
+	}()
+}
@@ -0,0 +1,72 @@
+package session
+
+import "claudex/vt"
+
+// screenScrollLines is how many lines scrolled off the top in one write are
+// kept: as many as the StateTracker holds
+const screenScrollLines = 50
+
+// screenLines runs a pane's output through a terminal emulator before status
+// detection sees it, so escape sequences are gone, lines redrawn in place by
+// cursor movement (spinners, Claude's input box) come out as they look, and
+// each write yields only the lines it changed
+type screenLines struct {
+	term *vt.Terminal
+	prev []string // Screen text after the previous write
+}
+
+// newScreenLines creates an emulated screen of the pane's size
+func newScreenLines(rows, cols uint16) *screenLines {
+	term := vt.New(int(rows), int(cols))
+	term.KeepScrolled(screenScrollLines)
+	return &screenLines{term: term, prev: term.Text()}
+}
+
+// resize follows a resize of the pane. The program redraws afterwards, so
+// the resize itself yields no lines.
+func (s *screenLines) resize(rows, cols uint16) {
+	s.term.Resize(int(rows), int(cols))
+	s.term.TakeScrolled()
+	s.prev = s.term.Text()
+}
+
+// write feeds output to the screen and returns the lines it changed, top to
+// bottom: first those that scrolled off the top, then those still on
+// screen. The cursor's line, where prompts wait for input, comes last.
+func (s *screenLines) write(data []byte) []string {
+	s.term.Write(data)
+	off, scrolled := s.term.TakeScrolled()
+	text := s.term.Text()
+	cursor := s.term.Cursor()
+
+	var lines []string
+	// A line that scrolled off is new unless it is one of the old top rows
+	// moving up (rows past the limit scrolled off before these)
+	skipped := scrolled - len(off)
+	for i, line := range off {
+		if old := skipped + i; old < len(s.prev) && s.prev[old] == line {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	// Rows still on screen are compared with the row they were before scrolling
+	cursorLine, cursorChanged := "", false
+	for row, line := range text {
+		old := row + scrolled
+		changed := old >= len(s.prev) || s.prev[old] != line
+		if row == cursor.Row {
+			cursorLine, cursorChanged = line, changed
+			continue
+		}
+		if changed {
+			lines = append(lines, line)
+		}
+	}
+	if cursorChanged || len(lines) > 0 {
+		lines = append(lines, cursorLine)
+	}
+
+	s.prev = text
+	return lines
+}
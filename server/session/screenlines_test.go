@@ -0,0 +1,47 @@
+package session
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScreenLinesWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   uint16
+		writes []string
+		lines  [][]string // Returned by each write
+	}{
+		{"new lines", 4, []string{"a\r\nb"}, [][]string{{"a", "b"}}},
+		{"escape sequences", 4, []string{"\x1b[1;32mok\x1b[0m \x1b]0;title\x07done"}, [][]string{{"ok done"}}},
+		{"unchanged redraw", 4, []string{"a", "\ra"}, [][]string{{"a"}, nil}},
+		{"spinner redrawn in place", 4, []string{"⠋ Thinking", "\r⠙ Thinking"}, [][]string{{"⠋ Thinking"}, {"⠙ Thinking"}}},
+		{"cursor line last", 4, []string{"a\r\nb", "\x1b[1;1Hc"}, [][]string{{"a", "b"}, {"c"}}},
+		{"redraw above the cursor", 4, []string{"box\r\n> ", "\x1b[1A\r\x1b[Kbox 2\r\n\x1b[2C"}, [][]string{{"box", ">"}, {"box 2", ">"}}},
+		{"scrolled lines seen before", 2, []string{"1\r\n2", "\r\n3\r\n4"}, [][]string{{"1", "2"}, {"3", "4"}}},
+		{"scrolled off within one write", 2, []string{"1\r\n2\r\n3"}, [][]string{{"1", "2", "3"}}},
+		{"alternate screen", 4, []string{"a", "\x1b[?1049h\x1b[Hfull", "\x1b[?1049l"}, [][]string{{"a"}, {"full"}, {"a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScreenLines(tt.rows, 20)
+			for i, data := range tt.writes {
+				if got := s.write([]byte(data)); !slices.Equal(got, tt.lines[i]) {
+					t.Errorf("write %d (%q) = %q, want %q", i, data, got, tt.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScreenLinesResize(t *testing.T) {
+	s := newScreenLines(4, 20)
+	s.write([]byte("a\r\nb"))
+	s.resize(6, 30)
+	if got := s.write(nil); got != nil {
+		t.Errorf("write after resize = %q, want nothing", got)
+	}
+	if got := s.write([]byte("c")); !slices.Equal(got, []string{"bc"}) {
+		t.Errorf("write = %q, want %q", got, []string{"bc"})
+	}
+}
@@ -0,0 +1,131 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultScrollbackMB is the scrollback kept per pane unless configured otherwise
+const DefaultScrollbackMB = 1
+
+// DefaultScrollbackMaxMB caps the limit sessions may set for themselves
+// unless configured otherwise
+const DefaultScrollbackMaxMB = 64
+
+var (
+	// scrollbackMB is the server-wide scrollback limit (see SetScrollbackLimit)
+	scrollbackMB atomic.Int64
+	// scrollbackMaxMB caps the limit sessions may set for themselves
+	scrollbackMaxMB atomic.Int64
+)
+
+func init() {
+	scrollbackMB.Store(DefaultScrollbackMB)
+	scrollbackMaxMB.Store(DefaultScrollbackMaxMB)
+}
+
+// SetScrollbackLimit sets the scrollback kept for sessions without their own
+// limit, in MB (0 restores the default). It applies to the in-memory buffer
+// and to the copy saved on disk.
+func SetScrollbackLimit(mb int) error {
+	if mb < 0 {
+		return fmt.Errorf("scrollback limit must not be negative")
+	}
+	if mb == 0 {
+		mb = DefaultScrollbackMB
+	}
+	scrollbackMB.Store(int64(mb))
+	return nil
+}
+
+// SetScrollbackMax caps the scrollback a session may ask for, in MB (0
+// restores the default). Sessions already above it keep their limit.
+func SetScrollbackMax(mb int) error {
+	if mb < 0 {
+		return fmt.Errorf("scrollback maximum must not be negative")
+	}
+	if mb == 0 {
+		mb = DefaultScrollbackMaxMB
+	}
+	scrollbackMaxMB.Store(int64(mb))
+	return nil
+}
+
+// ValidateScrollbackMB rejects a session scrollback limit that is negative
+// or above the server's maximum
+func ValidateScrollbackMB(mb int) error {
+	if mb < 0 {
+		return fmt.Errorf("scrollback limit must not be negative")
+	}
+	if maxMB := int(scrollbackMaxMB.Load()); mb > maxMB {
+		return fmt.Errorf("scrollback limit of %d MB is above the server maximum of %d MB", mb, maxMB)
+	}
+	return nil
+}
+
+// SetScrollbackLimit overrides the server-wide scrollback limit for this
+// session, in MB (0 removes the override). Running panes trim immediately.
+func (s *Session) SetScrollbackLimit(mb int) error {
+	if err := ValidateScrollbackMB(mb); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.ScrollbackMB = mb
+	s.UpdatedAt = time.Now()
+	limit := s.scrollbackLimitLocked()
+	if s.savedScrollback != nil {
+		s.savedScrollback.SetLimit(limit)
+	}
+	panes := make([]*Pane, 0, len(s.panes))
+	for _, pane := range s.panes {
+		panes = append(panes, pane)
+	}
+	s.mu.Unlock()
+
+	for _, pane := range panes {
+		pane.SetScrollbackLimit(limit)
+	}
+	return nil
+}
+
+// GetScrollbackLimit returns the scrollback limit in effect, in bytes
+func (s *Session) GetScrollbackLimit() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.scrollbackLimitLocked()
+}
+
+// scrollbackLimitLocked returns the limit in bytes (caller must hold the lock)
+func (s *Session) scrollbackLimitLocked() int {
+	if s.ScrollbackMB > 0 {
+		return s.ScrollbackMB * 1024 * 1024
+	}
+	return defaultScrollbackLimit()
+}
+
+// defaultScrollbackLimit returns the server-wide limit in bytes
+func defaultScrollbackLimit() int {
+	return int(scrollbackMB.Load()) * 1024 * 1024
+}
+
+// SetScrollbackLimit sets how many bytes of output the pane keeps, trimming
+// what it already holds
+func (p *Pane) SetScrollbackLimit(limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.scrollback.SetLimit(limit)
+}
+
+// WriteScrollback writes the session's scrollback (see GetScrollback) to w
+// and returns the number of bytes written. It is copied first, so a slow
+// writer doesn't hold up the pane's output.
+func (s *Session) WriteScrollback(w io.Writer) (int64, error) {
+	data := s.GetScrollback()
+	if len(data) == 0 {
+		return 0, nil
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
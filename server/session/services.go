@@ -0,0 +1,175 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ServiceCheckTimeout bounds how long a single service check may take
+const ServiceCheckTimeout = 2 * time.Second
+
+// serviceCacheTTL is how long check results are reused for prompt submissions
+const serviceCacheTTL = 10 * time.Second
+
+// ServiceCheck declares an external service a session depends on.
+// Exactly one of TCP, Unix or HTTP should be set.
+type ServiceCheck struct {
+	Name string `json:"name"`
+	TCP  string `json:"tcp,omitempty"`  // host:port that must accept connections (e.g. "localhost:5432")
+	Unix string `json:"unix,omitempty"` // Unix socket that must accept connections (e.g. "/var/run/docker.sock")
+	HTTP string `json:"http,omitempty"` // URL that must answer with a 2xx/3xx status
+}
+
+// ServiceResult is the outcome of checking one service
+type ServiceResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Validate checks that the service declaration is usable
+func (c ServiceCheck) Validate() error {
+	set := 0
+	for _, v := range []string{c.TCP, c.Unix, c.HTTP} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("service %q must set exactly one of tcp, unix or http", c.Name)
+	}
+	return nil
+}
+
+// Check probes the service
+func (c ServiceCheck) Check() ServiceResult {
+	result := ServiceResult{Name: c.Name}
+	var err error
+
+	switch {
+	case c.TCP != "":
+		err = dialCheck("tcp", c.TCP)
+	case c.Unix != "":
+		err = dialCheck("unix", c.Unix)
+	case c.HTTP != "":
+		client := http.Client{Timeout: ServiceCheckTimeout}
+		var resp *http.Response
+		resp, err = client.Get(c.HTTP)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				err = fmt.Errorf("HTTP %d", resp.StatusCode)
+			}
+		}
+	default:
+		err = fmt.Errorf("no check configured")
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+	}
+	return result
+}
+
+func dialCheck(network, address string) error {
+	conn, err := net.DialTimeout(network, address, ServiceCheckTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// CheckServices probes all services in parallel
+func CheckServices(checks []ServiceCheck) []ServiceResult {
+	results := make([]ServiceResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check ServiceCheck) {
+			defer wg.Done()
+			results[i] = check.Check()
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// SetRequiredServices replaces the services the session depends on
+func (s *Session) SetRequiredServices(checks []ServiceCheck) error {
+	for _, check := range checks {
+		if err := check.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.RequiredServices = checks
+	s.serviceResults = nil
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetRequiredServices returns the services the session depends on
+func (s *Session) GetRequiredServices() []ServiceCheck {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]ServiceCheck(nil), s.RequiredServices...)
+}
+
+// CheckRequiredServices probes the required services and returns the failing
+// ones. Results younger than serviceCacheTTL are reused unless fresh is set.
+// A failure puts the session into StatusBlocked; recovery clears it.
+func (s *Session) CheckRequiredServices(fresh bool) []ServiceResult {
+	s.mu.RLock()
+	checks := s.RequiredServices
+	cached := s.serviceResults
+	checkedAt := s.servicesCheckedAt
+	s.mu.RUnlock()
+
+	if len(checks) == 0 {
+		return nil
+	}
+
+	results := cached
+	if fresh || results == nil || time.Since(checkedAt) > serviceCacheTTL {
+		results = CheckServices(checks)
+	}
+
+	var failed []ServiceResult
+	for _, result := range results {
+		if !result.OK {
+			failed = append(failed, result)
+		}
+	}
+
+	s.mu.Lock()
+	s.serviceResults = results
+	s.servicesCheckedAt = time.Now()
+	s.BlockedBy = failed
+	if len(failed) > 0 {
+		s.setStatus(StatusBlocked)
+	} else if s.Status == StatusBlocked {
+		// Back to whatever the main pane reports (idle if not running)
+		status := StatusIdle
+		if pane := s.mainPaneLocked(); pane != nil {
+			status = pane.GetStatus()
+		}
+		s.setStatus(status)
+	}
+	s.mu.Unlock()
+
+	return failed
+}
+
+// GetBlockedBy returns the services that blocked the session on the last check
+func (s *Session) GetBlockedBy() []ServiceResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]ServiceResult(nil), s.BlockedBy...)
+}
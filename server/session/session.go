@@ -3,6 +3,10 @@ package session
 import (
 	"sync"
 	"time"
+
+	"claudex/claude"
+	"claudex/logsink"
+	"claudex/recording"
 )
 
 // Status represents the current state of a Claude Code session
@@ -16,6 +20,7 @@ const (
 	StatusWaitingInput Status = "waiting_input" // Waiting for user input
 	StatusError        Status = "error"         // Error state
 	StatusStopped      Status = "stopped"       // Session terminated
+	StatusBlocked      Status = "blocked"       // A required external service is unavailable
 )
 
 // StateTracker provides temporal and contextual state detection
@@ -23,7 +28,7 @@ type StateTracker struct {
 	lastInputTime     time.Time   // When user last sent input
 	lastOutputTime    time.Time   // When we last received output
 	stateChangedAt    time.Time   // When state last changed
-	confidence        float64     // Confidence in current state (0.0 - 1.0)
+	detection         Detection   // Confidence in current state and what it was decided on
 	outputBytes       int64       // Bytes received in current window
 	outputWindowStart time.Time   // Start of measurement window
 	outputRate        float64     // Bytes per second
@@ -49,6 +54,7 @@ const (
 	ExecutingTimeout     = 5 * time.Minute          // Max time executing a tool
 	NoOutputTimeout      = 30 * time.Second         // No output = probably waiting for input
 	InputToThinkingDelay = 500 * time.Millisecond   // After input, wait before assuming thinking
+	StartupPromptTimeout = 5 * time.Second          // Send the startup command anyway if no prompt is detected
 	IOWindowDuration     = 2 * time.Second          // Window for I/O rate calculation
 )
 
@@ -85,6 +91,12 @@ type Session struct {
 	WorktreePath  string            `json:"worktree_path,omitempty"`
 	Branch        string            `json:"branch,omitempty"`
 
+	// Liveness, refreshed by the manager's monitor so clients can tell a
+	// silent process from a stale status without extra calls
+	LastOutputAt     time.Time `json:"last_output_at,omitempty"`
+	LastClientSeenAt time.Time `json:"last_client_seen_at,omitempty"` // Last message or pong from a subscribed client
+	PTYAlive         bool      `json:"pty_alive"`
+
 	// Robot customization
 	RobotModel     string `json:"robot_model,omitempty"`
 	RobotColor     string `json:"robot_color,omitempty"`
@@ -100,11 +112,89 @@ type Session struct {
 	// Multi-pane support
 	PaneLayout *PaneLayout `json:"pane_layout,omitempty"`
 
+	// Pane ID -> role (agent, tests, server, scratch)
+	PaneRoles map[string]PaneRole `json:"pane_roles,omitempty"`
+
+	// External services that must be reachable before starting or submitting prompts
+	RequiredServices []ServiceCheck  `json:"required_services,omitempty"`
+	BlockedBy        []ServiceResult `json:"blocked_by,omitempty"` // Failing services from the last check
+
+	// Record pane output (asciicast per pane) whenever the session runs
+	Recording bool `json:"recording,omitempty"`
+
+	// Command typed into the shell once its prompt first appears (e.g. "claude")
+	StartupCommand string `json:"startup_command,omitempty"`
+
+	// Spend limit for the session's Claude run (nil uses the global budget)
+	Budget *Budget `json:"budget,omitempty"`
+	// Highest threshold of it alerted so far, so alerts don't repeat after a restart
+	BudgetAlerted *BudgetAlert `json:"budget_alerted,omitempty"`
+
+	// Timezone (IANA name) and locale for the session's processes and API timestamps
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+
+	// Parent's Claude session this experiment's conversation was forked from
+	ForkedFrom string `json:"forked_from,omitempty"`
+
+	// CPU/memory/process caps for the session's processes (nil: unlimited)
+	Limits *ResourceLimits `json:"limits,omitempty"`
+
+	// Where the session's processes run: "" on the host, "docker" in a container
+	Sandbox string `json:"sandbox,omitempty"`
+
+	// How panes are hosted: "" owns the PTY, "tmux" survives server restarts
+	Backend string `json:"backend,omitempty"`
+
+	// Model Claude is started with (claude --model), "" for Claude's default
+	ClaudeModel string `json:"claude_model,omitempty"`
+
+	// Flags Claude is launched with: permission mode, allowed tools, extra args
+	ClaudeOptions *ClaudeOptions `json:"claude_options,omitempty"`
+
+	// Another session this one waits on before it starts or gets its prompt
+	DependsOn *Dependency `json:"depends_on,omitempty"`
+
+	// Where the session's terminal output is copied, besides the global sinks
+	LogSinks []logsink.Config `json:"log_sinks,omitempty"`
+
+	// Scrollback kept in memory and on disk, in MB (0: server default)
+	ScrollbackMB int `json:"scrollback_mb,omitempty"`
+
+	// Why the session is in StatusError (e.g. a resource limit was hit)
+	StatusReason string `json:"status_reason,omitempty"`
+
+	// Recorded input macros, by name
+	Macros map[string]*Macro `json:"macros,omitempty"`
+
+	// Ports allocated from the port pool (env var -> port)
+	Ports map[string]int `json:"ports,omitempty"`
+
+	// Free-form labels for organizing and filtering sessions
+	Tags []string `json:"tags,omitempty"`
+
+	// Command allow/deny policy enforced on submitted input
+	InputPolicy *InputPolicy `json:"input_policy,omitempty"`
+
 	// Internal fields (not serialized)
 	panes          map[string]*Pane
 	mu             sync.RWMutex
 	onStatusChange func(Status)
-	savedScrollback []byte // Scrollback loaded from disk (before pane exists)
+	savedScrollback *Ring  // Scrollback loaded from disk (before pane exists)
+	inputLines      map[string][]byte // Line currently being typed per pane ("" for the main one), for policy checks
+	pendingLine     string // Submitted line awaiting policy confirmation
+	pendingPane     string // Pane the pending line was typed into
+	statusChangedAt time.Time // When Status last changed
+	recorder        *recording.Recorder // Active recording (nil when not recording)
+	serviceResults    []ServiceResult // Last required-service check results
+	servicesCheckedAt time.Time       // When required services were last checked
+	macroRec          *macroRecording // Macro being recorded (nil when not recording)
+	macroStop         chan struct{}   // Closed to cancel the macro being played
+	statusLine        *StatusLine     // Last report from Claude Code's statusLine hook
+	location          *time.Location  // Loaded Timezone (nil for the server's)
+	historyFile       string          // Status transition log (empty when not tracked)
+	historyPending    [][]byte        // Transitions not yet appended to historyFile
+	historyMu         sync.Mutex      // Serializes appends to historyFile
 }
 
 // NewSession creates a new session with default values
@@ -120,6 +210,8 @@ func NewSession(id, name, directory string) *Session {
 		UpdatedAt: now,
 		Directory: directory,
 		panes:     make(map[string]*Pane),
+
+		statusChangedAt: now,
 	}
 }
 
@@ -130,7 +222,7 @@ func newStateTracker() *StateTracker {
 		lastOutputTime:    now,
 		stateChangedAt:    now,
 		outputWindowStart: now,
-		confidence:        1.0,
+		detection:         Detection{Confidence: 1.0, Reason: ReasonStart},
 		lines:             make([]LineEntry, 0, 50),
 		maxLines:          50,
 	}
@@ -156,6 +248,9 @@ func (s *Session) CreatePane(paneID string) *Pane {
 	defer s.mu.Unlock()
 
 	pane := NewPane(paneID, s.Directory)
+	pane.bindSession(s.ID)
+	pane.SetRole(s.paneRole(paneID))
+	pane.setTap(func(data []byte) { s.recordOutput(paneID, data) })
 	s.panes[paneID] = pane
 
 	// Update layout
@@ -193,8 +288,22 @@ func (s *Session) GetPanes() map[string]*Pane {
 func (s *Session) GetMainPane() *Pane {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if s.PaneLayout != nil && s.PaneLayout.PaneID != "" {
-		return s.panes[s.PaneLayout.PaneID]
+	return s.mainPaneLocked()
+}
+
+// GetClaudeState returns the Claude state the main pane last read from the
+// transcript, nil if Claude isn't running in it
+func (s *Session) GetClaudeState() *claude.ClaudeState {
+	if pane := s.GetMainPane(); pane != nil {
+		return pane.GetClaudeState()
+	}
+	return nil
+}
+
+// mainPaneLocked returns the main pane (caller must hold the lock)
+func (s *Session) mainPaneLocked() *Pane {
+	if id := s.PaneLayout.firstPaneID(); id != "" {
+		return s.panes[id]
 	}
 	// Return any pane if layout doesn't specify
 	for _, pane := range s.panes {
@@ -269,8 +378,15 @@ func (s *Session) removePaneFromLayoutNode(node *PaneLayout, paneID string) *Pan
 func (s *Session) SplitPane(paneID, newPaneID, direction string) *Pane {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.splitPaneLocked(paneID, newPaneID, direction)
+}
 
+// splitPaneLocked splits a pane (caller must hold the lock)
+func (s *Session) splitPaneLocked(paneID, newPaneID, direction string) *Pane {
 	newPane := NewPane(newPaneID, s.Directory)
+	newPane.bindSession(s.ID)
+	newPane.SetRole(s.paneRole(newPaneID))
+	newPane.setTap(func(data []byte) { s.recordOutput(newPaneID, data) })
 	s.panes[newPaneID] = newPane
 	s.splitPaneInLayout(paneID, newPaneID, direction)
 	s.UpdatedAt = time.Now()
@@ -307,17 +423,17 @@ func (s *Session) splitPaneInLayoutNode(node *PaneLayout, paneID, newPaneID, dir
 	return node
 }
 
-// Start launches a shell in the main pane (backward compatibility)
-func (s *Session) Start(rows, cols uint16, onOutput func([]byte)) error {
-	// Create main pane if it doesn't exist
-	pane := s.GetMainPane()
-	if pane == nil {
-		pane = s.CreatePane("main")
-	}
-
-	onStatus := func(status Status) {
+// paneStatusHandler returns the callback that mirrors a pane's status
+// changes onto the session
+func (s *Session) paneStatusHandler(pane *Pane) func(Status) {
+	return func(status Status) {
+		reason := ""
+		if status == StatusError {
+			reason = pane.GetErrorReason()
+		}
 		s.mu.Lock()
-		s.Status = status
+		s.setStatus(status)
+		s.StatusReason = reason
 		s.UpdatedAt = time.Now()
 		cb := s.onStatusChange
 		s.mu.Unlock()
@@ -325,11 +441,38 @@ func (s *Session) Start(rows, cols uint16, onOutput func([]byte)) error {
 			cb(status)
 		}
 	}
+}
 
+// Start launches a shell in the main pane (backward compatibility)
+func (s *Session) Start(rows, cols uint16, onOutput func([]byte)) error {
+	// Create main pane if it doesn't exist
+	pane := s.GetMainPane()
+	if pane == nil {
+		pane = s.CreatePane(s.MainPaneID())
+	}
+
+	onStatus := s.paneStatusHandler(pane)
+
+	pane.SetExtraEnv(s.paneEnv())
+	pane.SetLimits(s.GetLimits())
+	pane.SetSandbox(s.GetSandbox())
+	pane.SetScrollbackLimit(s.GetScrollbackLimit())
+	pane.SetTmux(s.tmuxName(pane.ID))
+	s.mu.RLock()
+	pane.SetStartupCommand(withClaudeArgs(s.StartupCommand, s.claudeArgs()))
+	s.mu.RUnlock()
 	err := pane.Start(rows, cols, onOutput, onStatus)
 	if err == nil {
 		s.mu.Lock()
-		s.Status = StatusShell
+		s.setStatus(StatusShell)
+		s.StatusReason = ""
+		s.UpdatedAt = time.Now()
+		s.mu.Unlock()
+		s.trackPane(pane)
+	} else if reason := pane.GetErrorReason(); reason != "" {
+		s.mu.Lock()
+		s.setStatus(StatusError)
+		s.StatusReason = reason
 		s.UpdatedAt = time.Now()
 		s.mu.Unlock()
 	}
@@ -338,36 +481,65 @@ func (s *Session) Start(rows, cols uint16, onOutput func([]byte)) error {
 
 // Resume resumes a previous Claude Code session (backward compatibility)
 func (s *Session) Resume(claudeSessionID string, rows, cols uint16, onOutput func([]byte)) error {
+	s.mu.Lock()
+	s.LastClaudeSessionID = claudeSessionID
+	s.mu.Unlock()
+	return s.resume(claudeSessionID, false, rows, cols, onOutput)
+}
+
+// resume starts Claude on an existing conversation in the main pane, or on
+// a copy of it under a new session ID when fork is set
+func (s *Session) resume(claudeSessionID string, fork bool, rows, cols uint16, onOutput func([]byte)) error {
 	pane := s.GetMainPane()
 	if pane == nil {
-		pane = s.CreatePane("main")
-	}
-
-	onStatus := func(status Status) {
-		s.mu.Lock()
-		s.Status = status
-		s.UpdatedAt = time.Now()
-		cb := s.onStatusChange
-		s.mu.Unlock()
-		if cb != nil {
-			cb(status)
-		}
+		pane = s.CreatePane(s.MainPaneID())
 	}
 
-	s.mu.Lock()
-	s.LastClaudeSessionID = claudeSessionID
-	s.mu.Unlock()
+	onStatus := s.paneStatusHandler(pane)
 
+	pane.SetExtraEnv(s.paneEnv())
+	pane.SetLimits(s.GetLimits())
+	pane.SetSandbox(s.GetSandbox())
+	pane.SetScrollbackLimit(s.GetScrollbackLimit())
+	pane.SetTmux(s.tmuxName(pane.ID))
+	pane.SetForkSession(fork)
+	s.mu.RLock()
+	pane.SetClaudeArgs(s.claudeArgs())
+	s.mu.RUnlock()
 	err := pane.Resume(claudeSessionID, rows, cols, onOutput, onStatus)
 	if err == nil {
 		s.mu.Lock()
-		s.Status = StatusWaitingInput
+		s.setStatus(StatusWaitingInput)
+		s.StatusReason = ""
+		s.UpdatedAt = time.Now()
+		s.mu.Unlock()
+		s.trackPane(pane)
+	} else if reason := pane.GetErrorReason(); reason != "" {
+		s.mu.Lock()
+		s.setStatus(StatusError)
+		s.StatusReason = reason
 		s.UpdatedAt = time.Now()
 		s.mu.Unlock()
 	}
 	return err
 }
 
+// SetStartupCommand sets the command run when the session's shell starts
+func (s *Session) SetStartupCommand(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.StartupCommand = command
+	s.UpdatedAt = time.Now()
+}
+
+// paneEnv returns the session-specific environment for pane processes
+func (s *Session) paneEnv() []string {
+	s.mu.RLock()
+	env := append(s.portEnv(), SessionIDEnv+"="+s.ID)
+	s.mu.RUnlock()
+	return append(env, s.localeEnv()...)
+}
+
 // Write sends input to the main pane (backward compatibility)
 func (s *Session) Write(data []byte) (int, error) {
 	pane := s.GetMainPane()
@@ -384,11 +556,14 @@ func (s *Session) Resize(rows, cols uint16) error {
 	if pane == nil {
 		return nil
 	}
+	s.recordResize(pane.ID, rows, cols)
 	return pane.Resize(rows, cols)
 }
 
 // Stop terminates all panes in the session
 func (s *Session) Stop() error {
+	s.StopRecording(false)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -396,13 +571,15 @@ func (s *Session) Stop() error {
 		pane.Stop()
 	}
 
-	s.Status = StatusStopped
+	s.setStatus(StatusStopped)
 	s.UpdatedAt = time.Now()
 	return nil
 }
 
 // Reset prepares the session for restart
 func (s *Session) Reset() {
+	s.StopRecording(false)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -410,9 +587,9 @@ func (s *Session) Reset() {
 		pane.Stop()
 	}
 
+	// The layout is kept so the panes come back on the next start
 	s.panes = make(map[string]*Pane)
-	s.PaneLayout = nil
-	s.Status = StatusIdle
+	s.setStatus(StatusIdle)
 	s.UpdatedAt = time.Now()
 }
 
@@ -431,6 +608,22 @@ func (s *Session) GetLastClaudeSessionID() string {
 	return s.LastClaudeSessionID
 }
 
+// setStatus updates the status and remembers when it changed (caller must hold the lock)
+func (s *Session) setStatus(status Status) {
+	if s.Status != status {
+		s.statusChangedAt = time.Now()
+		s.recordTransition(s.Status, status, s.statusChangedAt)
+	}
+	s.Status = status
+}
+
+// GetStatusSince returns when the session entered its current status
+func (s *Session) GetStatusSince() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.statusChangedAt
+}
+
 // GetStatus returns current status thread-safely
 func (s *Session) GetStatus() Status {
 	s.mu.RLock()
@@ -454,14 +647,44 @@ func (s *Session) SetPosition(pos *Position3D) {
 	s.UpdatedAt = time.Now()
 }
 
-// SetMetadata sets a metadata value
-func (s *Session) SetMetadata(key string, value any) {
+// SetTags replaces the session tags, dropping empty and duplicate entries
+func (s *Session) SetTags(tags []string) {
+	seen := make(map[string]bool)
+	cleaned := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = trimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		cleaned = append(cleaned, tag)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.Metadata[key] = value
+	s.Tags = cleaned
 	s.UpdatedAt = time.Now()
 }
 
+// GetTags returns a copy of the session tags
+func (s *Session) GetTags() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.Tags...)
+}
+
+// HasTag reports whether the session carries the given tag
+func (s *Session) HasTag(tag string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 // GetScrollback returns the terminal scrollback buffer from main pane or saved scrollback
 func (s *Session) GetScrollback() []byte {
 	pane := s.GetMainPane()
@@ -474,14 +697,18 @@ func (s *Session) GetScrollback() []byte {
 	// Return saved scrollback if no pane or pane has no scrollback
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.savedScrollback
+	if s.savedScrollback == nil {
+		return nil
+	}
+	return s.savedScrollback.Bytes()
 }
 
 // SetSavedScrollback sets the scrollback loaded from disk
 func (s *Session) SetSavedScrollback(data []byte) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.savedScrollback = data
+	s.savedScrollback = NewRing(s.scrollbackLimitLocked())
+	s.savedScrollback.Write(data)
 }
 
 // GetProcessCwd returns the current working directory of the shell process
@@ -570,7 +797,16 @@ func (s *Session) StartPane(paneID string, rows, cols uint16, onOutput func([]by
 		pane = s.CreatePane(paneID)
 	}
 
-	return pane.Start(rows, cols, onOutput, onStatus)
+	pane.SetExtraEnv(s.paneEnv())
+	pane.SetLimits(s.GetLimits())
+	pane.SetSandbox(s.GetSandbox())
+	pane.SetScrollbackLimit(s.GetScrollbackLimit())
+	pane.SetTmux(s.tmuxName(pane.ID))
+	if err := pane.Start(rows, cols, onOutput, onStatus); err != nil {
+		return err
+	}
+	s.trackPane(pane)
+	return nil
 }
 
 // WriteToPane sends input to a specific pane
@@ -588,6 +824,7 @@ func (s *Session) ResizePane(paneID string, rows, cols uint16) error {
 	if pane == nil {
 		return nil
 	}
+	s.recordResize(paneID, rows, cols)
 	return pane.Resize(rows, cols)
 }
 
@@ -606,7 +843,7 @@ func (s *Session) UpdateSessionStatus() {
 	defer s.mu.Unlock()
 
 	if len(s.panes) == 0 {
-		s.Status = StatusIdle
+		s.setStatus(StatusIdle)
 		return
 	}
 
@@ -629,7 +866,7 @@ func (s *Session) UpdateSessionStatus() {
 		}
 	}
 
-	s.Status = highestPriority
+	s.setStatus(highestPriority)
 	s.UpdatedAt = time.Now()
 }
 
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Shutdown ends every session's processes for a server exit and saves the
+// sessions and their scrollback. Processes get SIGHUP (as when a terminal
+// closes) and SIGTERM, and are killed if still running after grace;
+// tmux-backed panes are only detached so they keep running for the next start.
+func (m *Manager) Shutdown(grace time.Duration) {
+	m.mu.RLock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.RUnlock()
+
+	// The cwd can only be read while the shell is alive
+	for _, s := range sessions {
+		s.UpdateCwd()
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range sessions {
+		s.StopRecording(false)
+		for _, pane := range s.GetPanes() {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pane.terminate(grace)
+			}()
+		}
+	}
+	wg.Wait()
+
+	// Saved last so the scrollback includes whatever the processes printed on the way out
+	m.SaveAllSessions()
+	for _, s := range sessions {
+		s.flushHistory()
+	}
+}
+
+// terminate ends every process in the pane's terminal session, or detaches
+// from its tmux session
+func (p *Pane) terminate(grace time.Duration) {
+	p.mu.Lock()
+	cmd, ptmx, tmux := p.cmd, p.pty, p.tmuxName != ""
+	p.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	// The shell leads its own session (pty.Start uses setsid), so its pid is
+	// the session ID shared by everything started in the terminal
+	sid := cmd.Process.Pid
+	deadline := time.Now().Add(grace)
+	if !tmux {
+		signalSession(sid, syscall.SIGHUP)
+		signalSession(sid, syscall.SIGTERM)
+	}
+	if ptmx != nil {
+		ptmx.Close()
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(grace):
+	}
+	if !tmux {
+		for sessionAlive(sid) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if sessionAlive(sid) {
+			p.log.Warn("Processes still running after grace period, killing", "sid", sid, "grace", grace)
+			signalSession(sid, syscall.SIGKILL)
+		}
+	}
+	cmd.Process.Kill()
+	<-exited
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = StatusStopped
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+}
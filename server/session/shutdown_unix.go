@@ -0,0 +1,22 @@
+//go:build !windows
+
+package session
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// signalSession sends sig to every process in a terminal session. Jobs
+// started by an interactive shell get process groups of their own, so
+// signalling the shell's group alone would miss them.
+func signalSession(sid int, sig syscall.Signal) {
+	syscall.Kill(-sid, sig)
+	exec.Command("pkill", "-"+strconv.Itoa(int(sig)), "-s", strconv.Itoa(sid)).Run()
+}
+
+// sessionAlive reports whether any process of a terminal session is running
+func sessionAlive(sid int) bool {
+	return exec.Command("pgrep", "-s", strconv.Itoa(sid)).Run() == nil
+}
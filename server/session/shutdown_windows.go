@@ -0,0 +1,12 @@
+package session
+
+import "syscall"
+
+// signalSession does nothing: Windows has no terminal sessions to signal,
+// so terminate falls back to killing the shell itself
+func signalSession(sid int, sig syscall.Signal) {}
+
+// sessionAlive reports no processes, as there is no session to look for
+func sessionAlive(sid int) bool {
+	return false
+}
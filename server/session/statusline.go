@@ -0,0 +1,126 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"claudex/claude"
+)
+
+// SessionIDEnv tells processes in a pane which claudex session they belong to
+// (used by the statusline command to report back)
+const SessionIDEnv = "CLAUDEX_SESSION_ID"
+
+// StatusLine is what Claude Code's statusLine hook last reported for a session.
+// Unlike transcript parsing, these numbers come straight from Claude.
+type StatusLine struct {
+	ClaudeSessionID string    `json:"claude_session_id"`
+	Model           string    `json:"model"`
+	ModelName       string    `json:"model_name,omitempty"`
+	Version         string    `json:"version,omitempty"`
+	Cwd             string    `json:"cwd,omitempty"`
+	CostUSD         float64   `json:"cost_usd"`
+	DurationMs      int64     `json:"duration_ms"`
+	LinesAdded      int       `json:"lines_added"`
+	LinesRemoved    int       `json:"lines_removed"`
+	ContextTokens   int       `json:"context_tokens,omitempty"` // Tokens in the context window (when reported)
+	ContextWindow   int       `json:"context_window,omitempty"` // Context window size (when reported)
+	ExceedsContext  bool      `json:"exceeds_200k_tokens,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ParseStatusLine reads the JSON Claude Code passes to statusLine commands
+func ParseStatusLine(data []byte) (*StatusLine, error) {
+	var payload struct {
+		SessionID string `json:"session_id"`
+		Cwd       string `json:"cwd"`
+		Version   string `json:"version"`
+		Model     struct {
+			ID          string `json:"id"`
+			DisplayName string `json:"display_name"`
+		} `json:"model"`
+		Workspace struct {
+			CurrentDir string `json:"current_dir"`
+		} `json:"workspace"`
+		Cost struct {
+			TotalCostUSD      float64 `json:"total_cost_usd"`
+			TotalDurationMs   int64   `json:"total_duration_ms"`
+			TotalLinesAdded   int     `json:"total_lines_added"`
+			TotalLinesRemoved int     `json:"total_lines_removed"`
+		} `json:"cost"`
+		Exceeds200kTokens bool `json:"exceeds_200k_tokens"`
+		ContextWindow     *struct {
+			TotalInputTokens  int `json:"total_input_tokens"`
+			ContextWindowSize int `json:"context_window_size"`
+		} `json:"context_window"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	if payload.SessionID == "" || payload.Model.ID == "" {
+		return nil, fmt.Errorf("not a Claude Code statusline payload")
+	}
+	if !claude.ValidSessionID(payload.SessionID) {
+		return nil, fmt.Errorf("invalid session_id %q", payload.SessionID)
+	}
+
+	sl := &StatusLine{
+		ClaudeSessionID: payload.SessionID,
+		Model:           payload.Model.ID,
+		ModelName:       payload.Model.DisplayName,
+		Version:         payload.Version,
+		Cwd:             payload.Workspace.CurrentDir,
+		CostUSD:         payload.Cost.TotalCostUSD,
+		DurationMs:      payload.Cost.TotalDurationMs,
+		LinesAdded:      payload.Cost.TotalLinesAdded,
+		LinesRemoved:    payload.Cost.TotalLinesRemoved,
+		ExceedsContext:  payload.Exceeds200kTokens,
+		UpdatedAt:       time.Now(),
+	}
+	if sl.Cwd == "" {
+		sl.Cwd = payload.Cwd
+	}
+	if payload.ContextWindow != nil {
+		sl.ContextTokens = payload.ContextWindow.TotalInputTokens
+		sl.ContextWindow = payload.ContextWindow.ContextWindowSize
+	}
+	return sl, nil
+}
+
+// Render formats the line Claude Code shows under its prompt
+func (sl *StatusLine) Render(sessionName string) string {
+	model := sl.ModelName
+	if model == "" {
+		model = sl.Model
+	}
+	parts := []string{"[" + model + "]", fmt.Sprintf("$%.2f", sl.CostUSD)}
+	if sl.ContextWindow > 0 {
+		parts = append(parts, fmt.Sprintf("ctx %d%%", sl.ContextTokens*100/sl.ContextWindow))
+	}
+	parts = append(parts, "claudex:"+sessionName)
+	return strings.Join(parts, " · ")
+}
+
+// SetStatusLine stores a statusline report and links the Claude session it came from
+func (s *Session) SetStatusLine(sl *StatusLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusLine = sl
+	if sl.ClaudeSessionID != "" && sl.ClaudeSessionID != s.LastClaudeSessionID {
+		s.LastClaudeSessionID = sl.ClaudeSessionID
+		s.UpdatedAt = time.Now()
+	}
+}
+
+// GetStatusLine returns the last statusline report (nil if none)
+func (s *Session) GetStatusLine() *StatusLine {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.statusLine == nil {
+		return nil
+	}
+	sl := *s.statusLine
+	return &sl
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"claudex/claude"
+)
+
+// DefaultColdAfter is how long a session must be inactive before its stored
+// transcript summary is trusted without looking at the transcript again
+const DefaultColdAfter = 7 * 24 * time.Hour
+
+// StoredSummary is a transcript summary as served from claudex storage
+type StoredSummary struct {
+	*claude.TranscriptSummary
+	Cold bool `json:"cold"` // Served from storage without checking the transcript
+}
+
+// SetColdAfter sets the inactivity period after which sessions are cold (0 uses the default)
+func (m *Manager) SetColdAfter(d time.Duration) {
+	if d <= 0 {
+		d = DefaultColdAfter
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.coldAfter = d
+}
+
+// summaryPath returns the file holding a session's transcript summary
+func (m *Manager) summaryPath(id string) string {
+	return filepath.Join(m.storageDir, id+".summary.json")
+}
+
+// TranscriptSummary returns the summary of the session's last Claude
+// transcript. Cold sessions are served from storage; others are re-read only
+// when the transcript changed. recompute forces a fresh read.
+func (m *Manager) TranscriptSummary(s *Session, recompute bool) (*StoredSummary, error) {
+	claudeID := s.GetLastClaudeSessionID()
+	if claudeID == "" {
+		return nil, fmt.Errorf("session has no Claude conversation")
+	}
+
+	cached := m.loadSummary(s.ID)
+	if cached != nil && cached.ClaudeSessionID != claudeID {
+		cached = nil
+	}
+	if cached != nil && !recompute && m.isCold(s) {
+		return &StoredSummary{TranscriptSummary: cached, Cold: true}, nil
+	}
+
+	path, err := claude.FindTranscript(s.Directory, claudeID)
+	if err != nil {
+		if cached != nil {
+			// The transcript is gone (pruned or moved); the summary is all that's left
+			return &StoredSummary{TranscriptSummary: cached, Cold: true}, nil
+		}
+		return nil, err
+	}
+	if cached != nil && !recompute && cached.Current(path) {
+		return &StoredSummary{TranscriptSummary: cached}, nil
+	}
+
+	summary, err := claude.ComputeSummary(claudeID, path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.MarshalIndent(summary, "", "  "); err == nil {
+		if err := os.WriteFile(m.summaryPath(s.ID), data, 0644); err != nil {
+			m.reportStorageError(err)
+		}
+	}
+	return &StoredSummary{TranscriptSummary: summary}, nil
+}
+
+// loadSummary reads a stored summary (nil if there is none)
+func (m *Manager) loadSummary(id string) *claude.TranscriptSummary {
+	data, err := os.ReadFile(m.summaryPath(id))
+	if err != nil {
+		return nil
+	}
+	var summary claude.TranscriptSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil
+	}
+	return &summary
+}
+
+// isCold reports whether the session has been inactive for longer than the
+// cold period and is not running
+func (m *Manager) isCold(s *Session) bool {
+	m.mu.RLock()
+	coldAfter := m.coldAfter
+	m.mu.RUnlock()
+	if coldAfter <= 0 {
+		coldAfter = DefaultColdAfter
+	}
+
+	s.mu.RLock()
+	last := s.UpdatedAt
+	if s.LastInputAt.After(last) {
+		last = s.LastInputAt
+	}
+	s.mu.RUnlock()
+	return time.Since(last) > coldAfter && s.RunningPanes() == 0
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackendTmux runs each pane inside its own tmux server instead of owning
+// the process directly, so shells and Claude survive server restarts and
+// can be attached from a regular terminal
+const BackendTmux = "tmux"
+
+var (
+	backendMu      sync.RWMutex
+	defaultBackend string
+)
+
+// SetDefaultBackend sets the backend of sessions that don't choose one ("" or "tmux")
+func SetDefaultBackend(backend string) error {
+	if err := ValidateBackend(backend); err != nil {
+		return err
+	}
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	defaultBackend = backend
+	return nil
+}
+
+// ValidateBackend checks a session backend ("" owns the PTY directly)
+func ValidateBackend(backend string) error {
+	switch backend {
+	case "":
+		return nil
+	case BackendTmux:
+		if _, err := exec.LookPath("tmux"); err != nil {
+			return fmt.Errorf("tmux backend: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q", backend)
+}
+
+// SetBackend sets how the session's panes are hosted; it applies on the next start
+func (s *Session) SetBackend(backend string) error {
+	if err := ValidateBackend(backend); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Backend = backend
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// GetBackend returns the session's backend, falling back to the server default
+func (s *Session) GetBackend() string {
+	s.mu.RLock()
+	backend := s.Backend
+	s.mu.RUnlock()
+	if backend != "" {
+		return backend
+	}
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return defaultBackend
+}
+
+// TmuxName is the tmux socket and session name of a pane; attach from a
+// terminal with: tmux -L <name> attach
+func TmuxName(sessionID, paneID string) string {
+	return "claudex-" + sessionID + "-" + paneID
+}
+
+// tmuxName returns the tmux name of one of the session's panes, or "" if
+// the session doesn't use the tmux backend
+func (s *Session) tmuxName(paneID string) string {
+	if s.GetBackend() != BackendTmux {
+		return ""
+	}
+	return TmuxName(s.ID, paneID)
+}
+
+// tmuxAlive reports whether the pane's tmux session is still running
+func tmuxAlive(name string) bool {
+	return exec.Command("tmux", "-L", name, "has-session", "-t", "="+name).Run() == nil
+}
+
+// Reattachable reports whether the session's main pane is still running in
+// tmux from before a restart, so starting it should attach rather than
+// launch or resume anything
+func (s *Session) Reattachable() bool {
+	if s.GetBackend() != BackendTmux {
+		return false
+	}
+	return tmuxAlive(TmuxName(s.ID, "main"))
+}
+
+// SetTmux hosts the pane in the named tmux session ("" owns the PTY directly)
+func (p *Pane) SetTmux(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tmuxName = name
+}
+
+// tmuxArgs builds the tmux client command line: create the session, or
+// attach if it survived a restart. Each pane gets its own server (-L) so
+// resource limits on the client's scope cover it, and the user's config,
+// prefix key and status bar are left out so the terminal behaves as before.
+func (p *Pane) tmuxArgs(name string, args []string) []string {
+	tmux := []string{"-L", p.tmuxName, "-f", "/dev/null",
+		"new-session", "-A", "-s", p.tmuxName, "-c", p.directory,
+		"-x", fmt.Sprint(p.cols), "-y", fmt.Sprint(p.rows),
+		name}
+	tmux = append(tmux, args...)
+	for _, option := range [][]string{
+		{"prefix", "None"},
+		{"status", "off"},
+		{"escape-time", "0"},
+		{"history-limit", "10000"},
+	} {
+		tmux = append(tmux, ";", "set-option", "-g", option[0], option[1])
+	}
+	return tmux
+}
+
+// reattaching reports whether Start will attach to a surviving tmux session (caller must hold the lock)
+func (p *Pane) reattaching() bool {
+	return p.tmuxName != "" && p.sandbox == "" && tmuxAlive(p.tmuxName)
+}
+
+// killTmux ends the pane's tmux server when the pane is stopped on purpose (caller must hold the lock)
+func (p *Pane) killTmux() {
+	if p.tmuxName == "" {
+		return
+	}
+	if out, err := exec.Command("tmux", "-L", p.tmuxName, "kill-server").CombinedOutput(); err != nil &&
+		!strings.Contains(string(out), "no server running") {
+		p.log.Warn("Failed to kill tmux server", "tmux", p.tmuxName, "err", err)
+	}
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WorktreeRecord is one line of the worktree ledger: a worktree and branch
+// claudex created for an experiment. Pruning only ever removes these.
+type WorktreeRecord struct {
+	Repo   string    `json:"repo"`
+	Path   string    `json:"path"`
+	Branch string    `json:"branch"`
+	At     time.Time `json:"at"`
+}
+
+// worktreeLedgerPath returns the file holding the worktree ledger
+func (m *Manager) worktreeLedgerPath() string {
+	return filepath.Join(m.storageDir, "worktrees.jsonl")
+}
+
+// RecordWorktree appends a worktree created for an experiment to the
+// worktree ledger
+func (m *Manager) RecordWorktree(repo, path, branch string) {
+	data, err := json.Marshal(WorktreeRecord{
+		Repo:   filepath.Clean(repo),
+		Path:   filepath.Clean(path),
+		Branch: branch,
+		At:     time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	m.ledgerMu.Lock()
+	defer m.ledgerMu.Unlock()
+	f, err := os.OpenFile(m.worktreeLedgerPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("Failed to record worktree", "path", path, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		slog.Warn("Failed to record worktree", "path", path, "err", err)
+	}
+}
+
+// CreatedWorktrees returns every worktree in the worktree ledger, oldest
+// first
+func (m *Manager) CreatedWorktrees() ([]WorktreeRecord, error) {
+	m.ledgerMu.Lock()
+	defer m.ledgerMu.Unlock()
+
+	records := []WorktreeRecord{}
+	f, err := os.Open(m.worktreeLedgerPath())
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r WorktreeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,116 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// systemd integration: socket activation (LISTEN_FDS), readiness and stop
+// notifications (NOTIFY_SOCKET) and the service watchdog (WATCHDOG_USEC).
+// Outside systemd none of the variables are set and all of it is a no-op.
+
+// sdListenFDsStart is the first file descriptor systemd passes
+const sdListenFDsStart = 3
+
+// sdGRPCName is the FileDescriptorName= of a socket meant for the gRPC API
+const sdGRPCName = "grpc"
+
+// Taken from the environment at startup so session processes don't inherit them
+var (
+	sdNotifySocket     string        // Where notifications go ("" outside systemd)
+	sdWatchdogInterval time.Duration // How often systemd expects a ping (0: no watchdog)
+)
+
+// activatedSockets are the listeners systemd opened for the server
+type activatedSockets struct {
+	http net.Listener
+	grpc net.Listener
+}
+
+// takeSystemdEnv reads the variables systemd passes and removes them from the
+// environment. Sockets passed to another process (LISTEN_PID) are ignored.
+func takeSystemdEnv() (activatedSockets, error) {
+	var sockets activatedSockets
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	sdNotifySocket = os.Getenv("NOTIFY_SOCKET")
+	watchdogPID, _ := strconv.Atoi(os.Getenv("WATCHDOG_PID"))
+	watchdogUsec, _ := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if watchdogUsec > 0 && (watchdogPID == 0 || watchdogPID == os.Getpid()) {
+		sdWatchdogInterval = time.Duration(watchdogUsec) * time.Microsecond
+	}
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", "NOTIFY_SOCKET", "WATCHDOG_PID", "WATCHDOG_USEC"} {
+		os.Unsetenv(name)
+	}
+	if pid != os.Getpid() {
+		return sockets, nil
+	}
+
+	for i := range count {
+		fd := sdListenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(fd), name)
+		lis, err := net.FileListener(file)
+		file.Close() // FileListener keeps its own copy
+		if err != nil {
+			return sockets, fmt.Errorf("socket %d (%s) from systemd: %w", fd, name, err)
+		}
+		switch {
+		case name == sdGRPCName && sockets.grpc == nil:
+			sockets.grpc = lis
+		case name != sdGRPCName && sockets.http == nil:
+			sockets.http = lis
+		default:
+			slog.Warn("Ignoring extra socket from systemd", "fd", fd, "name", name)
+			lis.Close()
+		}
+	}
+	return sockets, nil
+}
+
+// sdNotify sends a state update such as "READY=1" to systemd
+func sdNotify(state string) {
+	if sdNotifySocket == "" {
+		return
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: sdNotifySocket, Net: "unixgram"})
+	if err != nil {
+		slog.Debug("Cannot notify systemd", "err", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Debug("Cannot notify systemd", "err", err)
+	}
+}
+
+// runSystemdWatchdog pings systemd at half the watchdog interval until stop
+// is closed; a server that hangs stops pinging and gets restarted
+func runSystemdWatchdog(stop <-chan struct{}) {
+	if sdWatchdogInterval == 0 {
+		return
+	}
+	ticker := time.NewTicker(sdWatchdogInterval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			sdNotify("WATCHDOG=1")
+		}
+	}
+}
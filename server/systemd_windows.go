@@ -0,0 +1,20 @@
+package main
+
+import "net"
+
+// systemd doesn't exist on Windows: no sockets are passed and notifications
+// go nowhere
+
+// activatedSockets are the listeners systemd opened for the server
+type activatedSockets struct {
+	http net.Listener
+	grpc net.Listener
+}
+
+func takeSystemdEnv() (activatedSockets, error) {
+	return activatedSockets{}, nil
+}
+
+func sdNotify(state string) {}
+
+func runSystemdWatchdog(stop <-chan struct{}) {}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// restrictUmask makes files created from now on get at most mode (e.g. a
+// socket, which net.Listen creates world-writable) and returns a func
+// restoring the previous umask
+func restrictUmask(mode int) func() {
+	old := syscall.Umask(0777 &^ mode)
+	return func() { syscall.Umask(old) }
+}
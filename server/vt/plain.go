@@ -0,0 +1,37 @@
+package vt
+
+import "strings"
+
+// plainChunk is how much output Plain writes to the terminal at a time
+const plainChunk = 32 << 10
+
+// Plain replays terminal output on a screen of the given size and returns
+// its text as it ended up: the lines that scrolled off the top, then the
+// screen, without trailing blank lines. Lines redrawn in place (spinners,
+// progress bars, input boxes) come out once, as last drawn; what the
+// output erased or drew on the alternate screen is gone, as it is from a
+// terminal's own scrollback.
+func Plain(data []byte, rows, cols int) []string {
+	term := New(rows, cols)
+	// Each byte scrolls at most a screenful, so no line of a chunk is dropped
+	term.KeepScrolled(plainChunk * rows)
+
+	var lines []string
+	for len(data) > 0 {
+		n := min(len(data), plainChunk)
+		term.Write(data[:n])
+		data = data[n:]
+		scrolled, _ := term.TakeScrolled()
+		lines = append(lines, scrolled...)
+	}
+	term.mu.Lock()
+	for _, line := range term.primary {
+		lines = append(lines, lineText(line))
+	}
+	term.mu.Unlock()
+
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
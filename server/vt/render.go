@@ -0,0 +1,202 @@
+package vt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Cursor is the cursor state of a snapshot (zero-based)
+type Cursor struct {
+	Row     int  `json:"row"`
+	Col     int  `json:"col"`
+	Visible bool `json:"visible"`
+}
+
+// Snapshot is a rendered copy of the screen
+type Snapshot struct {
+	Rows      int    `json:"rows"`
+	Cols      int    `json:"cols"`
+	Cursor    Cursor `json:"cursor"`
+	AltScreen bool   `json:"alt_screen"`
+	Data      []byte `json:"-"` // Escape sequences that redraw the screen on a blank terminal
+}
+
+// Snapshot renders the screen as output that reproduces it, cursor and
+// input modes included, on a freshly reset terminal of the same size
+func (t *Terminal) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[0m\x1b[H\x1b[2J")
+	renderScreen(&buf, t.primary)
+	if t.alt {
+		buf.WriteString("\x1b[0m\x1b[?1049h\x1b[H\x1b[2J")
+		renderScreen(&buf, t.alternate)
+	}
+
+	if t.top != 0 || t.bottom != t.rows-1 {
+		fmt.Fprintf(&buf, "\x1b[%d;%dr", t.top+1, t.bottom+1)
+	}
+	for _, mode := range trackedModes {
+		if t.modes[mode] {
+			fmt.Fprintf(&buf, "\x1b[?%dh", mode)
+		}
+	}
+	if t.noWrap {
+		buf.WriteString("\x1b[?7l")
+	}
+	if t.hidden {
+		buf.WriteString("\x1b[?25l")
+	}
+	fmt.Fprintf(&buf, "\x1b[%d;%dH", t.cur.row+1, t.cur.col+1)
+	buf.WriteString(sgr(Attr{}, t.cur.attr))
+
+	return Snapshot{
+		Rows:      t.rows,
+		Cols:      t.cols,
+		Cursor:    Cursor{Row: t.cur.row, Col: t.cur.col, Visible: !t.hidden},
+		AltScreen: t.alt,
+		Data:      buf.Bytes(),
+	}
+}
+
+// Text returns the visible screen as plain text lines without trailing spaces
+func (t *Terminal) Text() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lines := make([]string, 0, t.rows)
+	for _, line := range t.screen() {
+		lines = append(lines, lineText(line))
+	}
+	return lines
+}
+
+// lineText returns a screen line as plain text without trailing spaces
+func lineText(line []Cell) string {
+	var sb strings.Builder
+	for c := range line {
+		if ch, ok := cellRune(line, c); ok {
+			sb.WriteRune(ch)
+		}
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// Cursor returns where the cursor is and whether it is shown
+func (t *Terminal) Cursor() Cursor {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Cursor{Row: t.cur.row, Col: t.cur.col, Visible: !t.hidden}
+}
+
+// KeepScrolled makes the terminal remember the text of up to n lines that
+// scroll off the top of the primary screen, for TakeScrolled (0 stops it)
+func (t *Terminal) KeepScrolled(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keepScrolled = max(n, 0)
+	t.scrolled, t.scrolledOff = 0, nil
+}
+
+// TakeScrolled returns the text of the lines that scrolled off the top of
+// the primary screen since the last call, oldest first, and how many
+// scrolled off in all: more than returned once over the KeepScrolled limit
+func (t *Terminal) TakeScrolled() (lines []string, count int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines, count = t.scrolledOff, t.scrolled
+	t.scrolled, t.scrolledOff = 0, nil
+	return lines, count
+}
+
+// cellRune returns the character to draw for a cell, false for the right
+// half of a wide character. Halves left over after an erase, shift or
+// resize cut a wide character are drawn as spaces.
+func cellRune(line []Cell, c int) (rune, bool) {
+	ch := line[c].Ch
+	wide := c+1 < len(line) && line[c+1].Ch == 0
+	switch {
+	case ch == 0 && c > 0 && runeWidth(line[c-1].Ch) == 2:
+		return 0, false
+	case ch == 0, runeWidth(ch) == 2 && !wide:
+		return ' ', true
+	}
+	return ch, true
+}
+
+// renderScreen writes the non-blank part of each line
+func renderScreen(buf *bytes.Buffer, screen [][]Cell) {
+	pen := Attr{}
+	for r, line := range screen {
+		end := len(line)
+		for end > 0 && line[end-1] == blank {
+			end--
+		}
+		if end == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "\x1b[%d;1H", r+1)
+		for c, cell := range line[:end] {
+			ch, ok := cellRune(line, c)
+			if !ok {
+				continue
+			}
+			if cell.Attr != pen {
+				buf.WriteString(sgr(pen, cell.Attr))
+				pen = cell.Attr
+			}
+			buf.WriteRune(ch)
+		}
+	}
+	if pen != (Attr{}) {
+		buf.WriteString("\x1b[0m")
+	}
+}
+
+// sgr returns the sequence that changes the rendition from one attribute to another
+func sgr(from, to Attr) string {
+	if from == to {
+		return ""
+	}
+	params := []string{"0"}
+	flags := []struct {
+		flag uint8
+		code string
+	}{
+		{AttrBold, "1"}, {AttrDim, "2"}, {AttrItalic, "3"}, {AttrUnderline, "4"},
+		{AttrBlink, "5"}, {AttrReverse, "7"}, {AttrHidden, "8"}, {AttrStrike, "9"},
+	}
+	for _, f := range flags {
+		if to.Flags&f.flag != 0 {
+			params = append(params, f.code)
+		}
+	}
+	if c := colorParam(to.FG, 30); c != "" {
+		params = append(params, c)
+	}
+	if c := colorParam(to.BG, 40); c != "" {
+		params = append(params, c)
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// colorParam renders a color for SGR; base is 30 for foreground, 40 for background
+func colorParam(c Color, base int) string {
+	switch c &^ 0xffffff {
+	case colorIndexed:
+		n := int(c & 0xff)
+		switch {
+		case n < 8:
+			return fmt.Sprint(base + n)
+		case n < 16:
+			return fmt.Sprint(base + 60 + n - 8)
+		}
+		return fmt.Sprintf("%d;5;%d", base+8, n)
+	case colorRGB:
+		return fmt.Sprintf("%d;2;%d;%d;%d", base+8, c>>16&0xff, c>>8&0xff, c&0xff)
+	}
+	return ""
+}
@@ -0,0 +1,764 @@
+// Package vt is a small VT100/xterm emulator that keeps the visible screen
+// of a session so new subscribers can be sent what the terminal shows
+// instead of the raw output that produced it.
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Attribute flags
+const (
+	AttrBold uint8 = 1 << iota
+	AttrDim
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrReverse
+	AttrHidden
+	AttrStrike
+)
+
+// Color is a cell color: the default color, a 256-color palette index or
+// a 24-bit RGB value
+type Color uint32
+
+const (
+	colorDefault Color = 0
+	colorIndexed Color = 1 << 24
+	colorRGB     Color = 2 << 24
+)
+
+// Attr is the graphic rendition of a cell
+type Attr struct {
+	FG    Color
+	BG    Color
+	Flags uint8
+}
+
+// Cell is one character position on the screen. A wide character occupies
+// its cell and a continuation cell (Ch == 0) to its right.
+type Cell struct {
+	Ch   rune
+	Attr Attr
+}
+
+// blank is an empty cell in the default rendition
+var blank = Cell{Ch: ' '}
+
+// Private modes replayed in snapshots because they change how the client
+// terminal encodes input (cursor keys, mouse, bracketed paste, focus)
+var trackedModes = []int{1, 1000, 1002, 1003, 1004, 1006, 2004}
+
+// parser states
+const (
+	stateGround = iota
+	stateEscape
+	stateCSI
+	stateOSC
+	stateString  // DCS, SOS, PM, APC: ignored until the string terminator
+	stateCharset // ESC ( and friends: the next byte selects a charset
+)
+
+// cursor is the cursor position and pen
+type cursor struct {
+	row, col int
+	attr     Attr
+}
+
+// Terminal is an emulated terminal screen. It is safe for concurrent use.
+type Terminal struct {
+	mu sync.Mutex
+
+	rows, cols int
+	primary    [][]Cell
+	alternate  [][]Cell
+	alt        bool // The alternate screen is active
+
+	cur      cursor
+	saved    cursor // ESC 7 / CSI s
+	wrapNext bool   // The last column was written; the next character wraps
+	top      int    // Scroll region (inclusive)
+	bottom   int
+	hidden   bool // Cursor hidden (?25l)
+	noWrap   bool // Autowrap disabled (?7l)
+	modes    map[int]bool
+
+	keepScrolled int      // Lines scrolled off the top to remember (see KeepScrolled)
+	scrolled     int      // Lines scrolled off the top since the last TakeScrolled
+	scrolledOff  []string // Text of the most recent of them
+
+	state     int
+	params    []byte
+	stringEsc bool   // Saw ESC inside an OSC/DCS string
+	partial   []byte // Incomplete UTF-8 sequence
+}
+
+// New creates a terminal of the given size
+func New(rows, cols int) *Terminal {
+	if rows < 1 {
+		rows = 24
+	}
+	if cols < 1 {
+		cols = 80
+	}
+	t := &Terminal{rows: rows, cols: cols, modes: make(map[int]bool)}
+	t.primary = newScreen(rows, cols)
+	t.alternate = newScreen(rows, cols)
+	t.bottom = rows - 1
+	return t
+}
+
+func newScreen(rows, cols int) [][]Cell {
+	screen := make([][]Cell, rows)
+	for i := range screen {
+		screen[i] = newLine(cols, Attr{})
+	}
+	return screen
+}
+
+func newLine(cols int, attr Attr) []Cell {
+	line := make([]Cell, cols)
+	for i := range line {
+		line[i] = Cell{Ch: ' ', Attr: Attr{BG: attr.BG}}
+	}
+	return line
+}
+
+// screen returns the active screen (caller must hold the lock)
+func (t *Terminal) screen() [][]Cell {
+	if t.alt {
+		return t.alternate
+	}
+	return t.primary
+}
+
+// Size returns the terminal size
+func (t *Terminal) Size() (rows, cols int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rows, t.cols
+}
+
+// Resize changes the terminal size, keeping the top-left of the screen and
+// dropping lines from the top if the cursor would fall off the bottom
+func (t *Terminal) Resize(rows, cols int) {
+	if rows < 1 || cols < 1 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rows == t.rows && cols == t.cols {
+		return
+	}
+
+	shift := 0
+	if t.cur.row >= rows {
+		shift = t.cur.row - rows + 1
+	}
+	resize := func(old [][]Cell) [][]Cell {
+		screen := newScreen(rows, cols)
+		for r := 0; r < rows && r+shift < len(old); r++ {
+			copy(screen[r], old[r+shift])
+		}
+		return screen
+	}
+	t.primary = resize(t.primary)
+	t.alternate = resize(t.alternate)
+	t.rows, t.cols = rows, cols
+	t.cur.row -= shift
+	t.cur.col = min(t.cur.col, cols-1)
+	t.saved.row = min(t.saved.row, rows-1)
+	t.saved.col = min(t.saved.col, cols-1)
+	t.top, t.bottom = 0, rows-1
+	t.wrapNext = false
+}
+
+// Write feeds terminal output to the emulator
+func (t *Terminal) Write(data []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buf := data
+	if len(t.partial) > 0 {
+		buf = append(t.partial, data...)
+		t.partial = nil
+	}
+	for len(buf) > 0 {
+		b := buf[0]
+		if b < utf8.RuneSelf || t.state != stateGround {
+			t.feed(b)
+			buf = buf[1:]
+			continue
+		}
+		if !utf8.FullRune(buf) {
+			t.partial = append([]byte(nil), buf...)
+			break
+		}
+		r, size := utf8.DecodeRune(buf)
+		t.put(r)
+		buf = buf[size:]
+	}
+	return len(data), nil
+}
+
+// feed handles one byte outside of a UTF-8 sequence (caller must hold the lock)
+func (t *Terminal) feed(b byte) {
+	switch t.state {
+	case stateGround:
+		if b == 0x1b {
+			t.state = stateEscape
+		} else if b < 0x20 || b == 0x7f {
+			t.control(b)
+		} else {
+			t.put(rune(b))
+		}
+
+	case stateEscape:
+		t.state = stateGround
+		switch b {
+		case '[':
+			t.state = stateCSI
+			t.params = t.params[:0]
+		case ']':
+			t.state = stateOSC
+			t.stringEsc = false
+		case 'P', 'X', '^', '_':
+			t.state = stateString
+			t.stringEsc = false
+		case '(', ')', '*', '+':
+			t.state = stateCharset
+		case '7':
+			t.saved = t.cur
+		case '8':
+			t.cur = t.saved
+			t.wrapNext = false
+		case 'D':
+			t.index()
+		case 'E':
+			t.cur.col = 0
+			t.index()
+		case 'M':
+			t.reverseIndex()
+		case 'c':
+			t.reset()
+		case 0x1b:
+			t.state = stateEscape
+		}
+
+	case stateCSI:
+		switch {
+		case b == 0x1b:
+			t.state = stateEscape
+		case b < 0x20:
+			t.control(b)
+		case b >= 0x40 && b <= 0x7e:
+			t.state = stateGround
+			t.csi(b)
+		default:
+			t.params = append(t.params, b)
+		}
+
+	case stateOSC, stateString:
+		// Terminated by BEL (OSC) or ST (ESC \)
+		switch {
+		case b == 0x07:
+			t.state = stateGround
+		case t.stringEsc:
+			t.stringEsc = false
+			if b == '\\' {
+				t.state = stateGround
+			}
+		case b == 0x1b:
+			t.stringEsc = true
+		}
+
+	case stateCharset:
+		t.state = stateGround
+	}
+}
+
+// control handles a C0 control character (caller must hold the lock)
+func (t *Terminal) control(b byte) {
+	switch b {
+	case '\r':
+		t.cur.col = 0
+		t.wrapNext = false
+	case '\n', '\v', '\f':
+		t.index()
+	case '\b':
+		if t.cur.col > 0 {
+			t.cur.col--
+		}
+		t.wrapNext = false
+	case '\t':
+		t.cur.col = min((t.cur.col/8+1)*8, t.cols-1)
+		t.wrapNext = false
+	}
+}
+
+// put writes a printable character at the cursor (caller must hold the lock)
+func (t *Terminal) put(r rune) {
+	width := runeWidth(r)
+	if width == 0 || width > t.cols {
+		return
+	}
+	if t.wrapNext {
+		t.cur.col = 0
+		t.index()
+		t.wrapNext = false
+	}
+	if width == 2 && t.cur.col == t.cols-1 {
+		if t.noWrap {
+			return
+		}
+		t.screen()[t.cur.row][t.cur.col] = Cell{Ch: ' ', Attr: t.cur.attr}
+		t.cur.col = 0
+		t.index()
+	}
+
+	line := t.screen()[t.cur.row]
+	clearWide(line, t.cur.col)
+	line[t.cur.col] = Cell{Ch: r, Attr: t.cur.attr}
+	if width == 2 {
+		clearWide(line, t.cur.col+1)
+		line[t.cur.col+1] = Cell{Ch: 0, Attr: t.cur.attr}
+	}
+	t.cur.col += width
+	if t.cur.col >= t.cols {
+		t.cur.col = t.cols - 1
+		t.wrapNext = !t.noWrap
+	}
+}
+
+// clearWide blanks the other half of a wide character about to be
+// partly overwritten at col
+func clearWide(line []Cell, col int) {
+	if line[col].Ch == 0 && col > 0 {
+		line[col-1].Ch = ' '
+	}
+	if col+1 < len(line) && line[col+1].Ch == 0 {
+		line[col+1].Ch = ' '
+	}
+}
+
+// index moves the cursor down, scrolling at the bottom of the region (caller must hold the lock)
+func (t *Terminal) index() {
+	switch {
+	case t.cur.row == t.bottom:
+		t.scrollUp(t.top, t.bottom, 1)
+	case t.cur.row < t.rows-1:
+		t.cur.row++
+	}
+}
+
+// reverseIndex moves the cursor up, scrolling at the top of the region (caller must hold the lock)
+func (t *Terminal) reverseIndex() {
+	switch {
+	case t.cur.row == t.top:
+		t.scrollDown(t.top, t.bottom, 1)
+	case t.cur.row > 0:
+		t.cur.row--
+	}
+}
+
+// scrollUp moves lines top..bottom up by n, blanking the bottom (caller must hold the lock)
+func (t *Terminal) scrollUp(top, bottom, n int) {
+	screen := t.screen()
+	n = min(n, bottom-top+1)
+	if t.keepScrolled > 0 && !t.alt && top == 0 && bottom == t.rows-1 {
+		t.scrolled += n
+		for _, line := range screen[:n] {
+			t.scrolledOff = append(t.scrolledOff, lineText(line))
+		}
+		if excess := len(t.scrolledOff) - t.keepScrolled; excess > 0 {
+			t.scrolledOff = t.scrolledOff[excess:]
+		}
+	}
+	copy(screen[top:bottom+1], screen[top+n:bottom+1])
+	for r := bottom - n + 1; r <= bottom; r++ {
+		screen[r] = newLine(t.cols, t.cur.attr)
+	}
+}
+
+// scrollDown moves lines top..bottom down by n, blanking the top (caller must hold the lock)
+func (t *Terminal) scrollDown(top, bottom, n int) {
+	screen := t.screen()
+	n = min(n, bottom-top+1)
+	copy(screen[top+n:bottom+1], screen[top:bottom+1-n])
+	for r := top; r < top+n; r++ {
+		screen[r] = newLine(t.cols, t.cur.attr)
+	}
+}
+
+// reset returns the terminal to its initial state (caller must hold the lock)
+func (t *Terminal) reset() {
+	t.primary = newScreen(t.rows, t.cols)
+	t.alternate = newScreen(t.rows, t.cols)
+	t.alt = false
+	t.cur, t.saved = cursor{}, cursor{}
+	t.wrapNext = false
+	t.top, t.bottom = 0, t.rows-1
+	t.hidden, t.noWrap = false, false
+	t.modes = make(map[int]bool)
+}
+
+// csi executes a control sequence (caller must hold the lock)
+func (t *Terminal) csi(final byte) {
+	raw := string(t.params)
+	private := strings.HasPrefix(raw, "?")
+	if private {
+		raw = raw[1:]
+	} else if raw != "" && (raw[0] == '>' || raw[0] == '=' || raw[0] == '<') {
+		return // Secondary DA and other queries
+	}
+	if i := strings.IndexAny(raw, " !\"#$%&'()*+,-./"); i >= 0 {
+		return // Intermediate bytes (DECSCUSR, DECSTR, ...): nothing on screen changes
+	}
+
+	params := strings.Split(raw, ";")
+	arg := func(i, def int) int {
+		if i >= len(params) {
+			return def
+		}
+		n, err := strconv.Atoi(params[i])
+		if err != nil || n == 0 {
+			return def
+		}
+		return n
+	}
+
+	if final != 'm' {
+		t.wrapNext = false
+	}
+	switch final {
+	case 'A':
+		t.cur.row = max(t.cur.row-arg(0, 1), 0)
+	case 'B', 'e':
+		t.cur.row = min(t.cur.row+arg(0, 1), t.rows-1)
+	case 'C', 'a':
+		t.cur.col = min(t.cur.col+arg(0, 1), t.cols-1)
+	case 'D':
+		t.cur.col = max(t.cur.col-arg(0, 1), 0)
+	case 'E':
+		t.cur.row = min(t.cur.row+arg(0, 1), t.rows-1)
+		t.cur.col = 0
+	case 'F':
+		t.cur.row = max(t.cur.row-arg(0, 1), 0)
+		t.cur.col = 0
+	case 'G', '`':
+		t.cur.col = clamp(arg(0, 1)-1, 0, t.cols-1)
+	case 'd':
+		t.cur.row = clamp(arg(0, 1)-1, 0, t.rows-1)
+	case 'H', 'f':
+		t.cur.row = clamp(arg(0, 1)-1, 0, t.rows-1)
+		t.cur.col = clamp(arg(1, 1)-1, 0, t.cols-1)
+	case 'J':
+		t.eraseDisplay(arg(0, 0))
+	case 'K':
+		t.eraseLine(arg(0, 0))
+	case '@':
+		t.insertChars(arg(0, 1))
+	case 'P':
+		t.deleteChars(arg(0, 1))
+	case 'X':
+		line := t.screen()[t.cur.row]
+		for c := t.cur.col; c < min(t.cur.col+arg(0, 1), t.cols); c++ {
+			line[c] = Cell{Ch: ' ', Attr: Attr{BG: t.cur.attr.BG}}
+		}
+	case 'L':
+		if t.cur.row >= t.top && t.cur.row <= t.bottom {
+			t.scrollDown(t.cur.row, t.bottom, arg(0, 1))
+		}
+	case 'M':
+		if t.cur.row >= t.top && t.cur.row <= t.bottom {
+			t.scrollUp(t.cur.row, t.bottom, arg(0, 1))
+		}
+	case 'S':
+		t.scrollUp(t.top, t.bottom, arg(0, 1))
+	case 'T':
+		t.scrollDown(t.top, t.bottom, arg(0, 1))
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, t.rows)-1
+		if top < bottom && bottom < t.rows {
+			t.top, t.bottom = top, bottom
+			t.cur.row, t.cur.col = 0, 0
+		}
+	case 'm':
+		t.sgr(params)
+	case 'h', 'l':
+		if private {
+			for i := range params {
+				t.setMode(arg(i, 0), final == 'h')
+			}
+		}
+	case 's':
+		if !private {
+			t.saved = t.cur
+		}
+	case 'u':
+		t.cur = t.saved
+	}
+}
+
+func clamp(n, lo, hi int) int {
+	return max(lo, min(n, hi))
+}
+
+// eraseDisplay implements ED (caller must hold the lock)
+func (t *Terminal) eraseDisplay(mode int) {
+	screen := t.screen()
+	switch mode {
+	case 0:
+		t.eraseLine(0)
+		for r := t.cur.row + 1; r < t.rows; r++ {
+			screen[r] = newLine(t.cols, t.cur.attr)
+		}
+	case 1:
+		t.eraseLine(1)
+		for r := 0; r < t.cur.row; r++ {
+			screen[r] = newLine(t.cols, t.cur.attr)
+		}
+	case 2, 3:
+		for r := range screen {
+			screen[r] = newLine(t.cols, t.cur.attr)
+		}
+	}
+}
+
+// eraseLine implements EL (caller must hold the lock)
+func (t *Terminal) eraseLine(mode int) {
+	line := t.screen()[t.cur.row]
+	from, to := t.cur.col, t.cols
+	switch mode {
+	case 1:
+		from, to = 0, t.cur.col+1
+	case 2:
+		from = 0
+	}
+	for c := from; c < to; c++ {
+		line[c] = Cell{Ch: ' ', Attr: Attr{BG: t.cur.attr.BG}}
+	}
+}
+
+// insertChars implements ICH (caller must hold the lock)
+func (t *Terminal) insertChars(n int) {
+	line := t.screen()[t.cur.row]
+	n = min(n, t.cols-t.cur.col)
+	copy(line[t.cur.col+n:], line[t.cur.col:t.cols-n])
+	for c := t.cur.col; c < t.cur.col+n; c++ {
+		line[c] = Cell{Ch: ' ', Attr: Attr{BG: t.cur.attr.BG}}
+	}
+}
+
+// deleteChars implements DCH (caller must hold the lock)
+func (t *Terminal) deleteChars(n int) {
+	line := t.screen()[t.cur.row]
+	n = min(n, t.cols-t.cur.col)
+	copy(line[t.cur.col:], line[t.cur.col+n:])
+	for c := t.cols - n; c < t.cols; c++ {
+		line[c] = Cell{Ch: ' ', Attr: Attr{BG: t.cur.attr.BG}}
+	}
+}
+
+// setMode handles DECSET/DECRST (caller must hold the lock)
+func (t *Terminal) setMode(mode int, on bool) {
+	switch mode {
+	case 7:
+		t.noWrap = !on
+	case 25:
+		t.hidden = !on
+	case 47, 1047:
+		t.switchScreen(on, false)
+	case 1049:
+		t.switchScreen(on, true)
+	default:
+		t.modes[mode] = on
+	}
+}
+
+// switchScreen enters or leaves the alternate screen, which starts blank (caller must hold the lock)
+func (t *Terminal) switchScreen(alt, saveCursor bool) {
+	if alt == t.alt {
+		return
+	}
+	if alt {
+		if saveCursor {
+			t.saved = t.cur
+		}
+		t.alternate = newScreen(t.rows, t.cols)
+	} else if saveCursor {
+		t.cur = t.saved
+	}
+	t.alt = alt
+	t.wrapNext = false
+}
+
+// sgr applies Select Graphic Rendition parameters (caller must hold the lock)
+func (t *Terminal) sgr(params []string) {
+	a := &t.cur.attr
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		// Colon form: 38:2::r:g:b, 38:5:n, 4:3 (underline style)
+		if strings.Contains(p, ":") {
+			sub := strings.Split(p, ":")
+			switch sub[0] {
+			case "38", "48":
+				if c, ok := extendedColor(sub[1:], true); ok {
+					if sub[0] == "38" {
+						a.FG = c
+					} else {
+						a.BG = c
+					}
+				}
+			case "4":
+				if len(sub) > 1 && sub[1] == "0" {
+					a.Flags &^= AttrUnderline
+				} else {
+					a.Flags |= AttrUnderline
+				}
+			}
+			continue
+		}
+
+		n, _ := strconv.Atoi(p)
+		switch {
+		case n == 0:
+			*a = Attr{}
+		case n == 1:
+			a.Flags |= AttrBold
+		case n == 2:
+			a.Flags |= AttrDim
+		case n == 3:
+			a.Flags |= AttrItalic
+		case n == 4 || n == 21:
+			a.Flags |= AttrUnderline
+		case n == 5 || n == 6:
+			a.Flags |= AttrBlink
+		case n == 7:
+			a.Flags |= AttrReverse
+		case n == 8:
+			a.Flags |= AttrHidden
+		case n == 9:
+			a.Flags |= AttrStrike
+		case n == 22:
+			a.Flags &^= AttrBold | AttrDim
+		case n == 23:
+			a.Flags &^= AttrItalic
+		case n == 24:
+			a.Flags &^= AttrUnderline
+		case n == 25:
+			a.Flags &^= AttrBlink
+		case n == 27:
+			a.Flags &^= AttrReverse
+		case n == 28:
+			a.Flags &^= AttrHidden
+		case n == 29:
+			a.Flags &^= AttrStrike
+		case n >= 30 && n <= 37:
+			a.FG = colorIndexed | Color(n-30)
+		case n == 38 || n == 48:
+			c, used, ok := semicolonColor(params[i+1:])
+			i += used
+			if ok {
+				if n == 38 {
+					a.FG = c
+				} else {
+					a.BG = c
+				}
+			}
+		case n == 39:
+			a.FG = colorDefault
+		case n >= 40 && n <= 47:
+			a.BG = colorIndexed | Color(n-40)
+		case n == 49:
+			a.BG = colorDefault
+		case n >= 90 && n <= 97:
+			a.FG = colorIndexed | Color(n-90+8)
+		case n >= 100 && n <= 107:
+			a.BG = colorIndexed | Color(n-100+8)
+		}
+	}
+}
+
+// semicolonColor parses the arguments after 38/48 in the 5;n or 2;r;g;b
+// form, returning how many parameters it consumed
+func semicolonColor(params []string) (Color, int, bool) {
+	if len(params) == 0 {
+		return 0, 0, false
+	}
+	switch params[0] {
+	case "5":
+		if len(params) < 2 {
+			return 0, len(params), false
+		}
+		c, ok := extendedColor(params[:2], false)
+		return c, 2, ok
+	case "2":
+		if len(params) < 4 {
+			return 0, len(params), false
+		}
+		c, ok := extendedColor(params[:4], false)
+		return c, 4, ok
+	}
+	return 0, 1, false
+}
+
+// extendedColor parses 5,n or 2,r,g,b; the colon form may carry an empty
+// color space id before r,g,b
+func extendedColor(sub []string, colon bool) (Color, bool) {
+	if len(sub) == 0 {
+		return 0, false
+	}
+	num := func(s string) uint32 {
+		n, _ := strconv.Atoi(s)
+		return uint32(clamp(n, 0, 255))
+	}
+	switch sub[0] {
+	case "5":
+		if len(sub) >= 2 {
+			return colorIndexed | Color(num(sub[1])), true
+		}
+	case "2":
+		rgb := sub[1:]
+		if colon && len(rgb) == 4 {
+			rgb = rgb[1:]
+		}
+		if len(rgb) >= 3 {
+			return colorRGB | Color(num(rgb[0])<<16|num(rgb[1])<<8|num(rgb[2])), true
+		}
+	}
+	return 0, false
+}
+
+// runeWidth returns how many cells a character occupies: 0 for combining
+// marks and other zero-width characters, 2 for East Asian wide characters
+// and most emoji
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200b || r == 0x200c || r == 0x200d || r == 0xfeff:
+		return 0
+	case r >= 0x0300 && r <= 0x036f, r >= 0xfe00 && r <= 0xfe0f, r >= 0x20d0 && r <= 0x20ff:
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0x303e,
+		r >= 0x3041 && r <= 0x33ff,
+		r >= 0x3400 && r <= 0x4dbf,
+		r >= 0x4e00 && r <= 0x9fff,
+		r >= 0xa000 && r <= 0xa4cf,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x1fa70 && r <= 0x1faff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,168 @@
+package vt
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows, cols int
+		input      string
+		lines      []string
+		row, col   int
+	}{
+		{"plain text", 3, 10, "ab\r\ncd", []string{"ab", "cd", ""}, 1, 2},
+		{"cursor position", 3, 10, "\x1b[2;3Hx", []string{"", "  x", ""}, 1, 3},
+		{"cursor position clamped", 3, 10, "\x1b[10;20Hx", []string{"", "", "         x"}, 2, 9},
+		{"relative moves", 3, 10, "\x1b[2B\x1b[4Cx\x1b[A\x1b[2Dy", []string{"", "   y", "    x"}, 1, 4},
+		{"erase to end of line", 3, 10, "abcdef\x1b[3D\x1b[K", []string{"abc", "", ""}, 0, 3},
+		{"erase start of line", 3, 10, "abcdef\x1b[3D\x1b[1K", []string{"    ef", "", ""}, 0, 3},
+		{"erase display", 3, 10, "ab\r\ncd\x1b[H\x1b[2J", []string{"", "", ""}, 0, 0},
+		{"erase below", 3, 10, "ab\r\ncd\r\nef\x1b[2;2H\x1b[J", []string{"ab", "c", ""}, 1, 1},
+		{"insert chars", 3, 10, "abc\x1b[1G\x1b[2@", []string{"  abc", "", ""}, 0, 0},
+		{"delete chars", 3, 10, "abcdef\x1b[1G\x1b[2P", []string{"cdef", "", ""}, 0, 0},
+		{"erase chars", 3, 10, "abcdef\x1b[2G\x1b[2X", []string{"a  def", "", ""}, 0, 1},
+		{"SGR prints nothing", 3, 10, "\x1b[1;31mred\x1b[0m", []string{"red", "", ""}, 0, 3},
+		{"OSC ignored", 3, 10, "\x1b]0;title\x07ok", []string{"ok", "", ""}, 0, 2},
+		{"autowrap", 3, 3, "abcde", []string{"abc", "de", ""}, 1, 2},
+		{"no autowrap", 3, 3, "\x1b[?7labcde", []string{"abe", "", ""}, 0, 2},
+		{"screen scrolls", 2, 3, "abcdef\r\ngh", []string{"def", "gh"}, 1, 2},
+		{"wide characters", 2, 4, "a日b", []string{"a日b", ""}, 0, 3},
+		{"split UTF-8", 2, 4, "\xe6\x97", []string{"", ""}, 0, 0},
+		{"alternate screen", 2, 5, "main\x1b[?1049h\x1b[Hnew", []string{"new", ""}, 0, 3},
+		{"alternate screen left", 2, 5, "main\x1b[?1049h\x1b[Hnew\x1b[?1049l", []string{"main", ""}, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			term := New(tt.rows, tt.cols)
+			term.Write([]byte(tt.input))
+			if got := term.Text(); !slices.Equal(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+			if c := term.Cursor(); c.Row != tt.row || c.Col != tt.col {
+				t.Errorf("cursor = %d,%d, want %d,%d", c.Row, c.Col, tt.row, tt.col)
+			}
+		})
+	}
+}
+
+func TestScrollRegion(t *testing.T) {
+	const screen = "1\r\n2\r\n3\r\n4"
+	tests := []struct {
+		name  string
+		input string
+		lines []string
+	}{
+		{"line feed at region bottom", "\x1b[2;3r\x1b[3;1H\n", []string{"1", "3", "", "4"}},
+		{"line feed below region", "\x1b[2;3r\x1b[4;1H\n", []string{"1", "2", "3", "4"}},
+		{"reverse index at region top", "\x1b[2;3r\x1b[2;1H\x1bM", []string{"1", "", "2", "4"}},
+		{"scroll up", "\x1b[2;3r\x1b[S", []string{"1", "3", "", "4"}},
+		{"scroll down", "\x1b[2;3r\x1b[T", []string{"1", "", "2", "4"}},
+		{"insert lines", "\x1b[2;3r\x1b[2;1H\x1b[L", []string{"1", "", "2", "4"}},
+		{"delete lines", "\x1b[2;3r\x1b[2;1H\x1b[M", []string{"1", "3", "", "4"}},
+		{"insert lines outside region", "\x1b[2;3r\x1b[4;1H\x1b[L", []string{"1", "2", "3", "4"}},
+		{"invalid region ignored", "\x1b[3;2r\x1b[4;1H\n", []string{"2", "3", "4", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			term := New(4, 10)
+			term.Write([]byte(screen + tt.input))
+			if got := term.Text(); !slices.Equal(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+		})
+	}
+}
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		rows, cols int
+		lines      []string
+		row, col   int
+	}{
+		{"grow", "ab", 4, 10, []string{"ab", "", "", ""}, 0, 2},
+		{"shrink keeps the cursor line", "a\r\nb\r\nc", 2, 5, []string{"b", "c"}, 1, 1},
+		{"shrink below the cursor", "a\r\nb", 2, 5, []string{"a", "b"}, 1, 1},
+		{"narrow", "abcde", 3, 3, []string{"abc", "", ""}, 0, 2},
+		{"region reset", "\x1b[1;2r\x1b[3;1Hx", 3, 5, []string{"", "", "x"}, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			term := New(3, 5)
+			term.Write([]byte(tt.input))
+			term.Resize(tt.rows, tt.cols)
+			if got := term.Text(); !slices.Equal(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+			if c := term.Cursor(); c.Row != tt.row || c.Col != tt.col {
+				t.Errorf("cursor = %d,%d, want %d,%d", c.Row, c.Col, tt.row, tt.col)
+			}
+			if rows, cols := term.Size(); rows != tt.rows || cols != tt.cols {
+				t.Errorf("size = %dx%d, want %dx%d", rows, cols, tt.rows, tt.cols)
+			}
+		})
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	inputs := []string{
+		"plain\r\n\x1b[1;32mgreen\x1b[0m and \x1b[7mreverse\x1b[0m",
+		"\x1b[2;3r\x1b[?2004h\x1b[?25lregion",
+		"main\x1b[?1049h\x1b[3;4Halt",
+		"a日b\r\n\x1b[38;2;1;2;3mrgb",
+	}
+	for _, input := range inputs {
+		term := New(4, 12)
+		term.Write([]byte(input))
+		snap := term.Snapshot()
+
+		replay := New(snap.Rows, snap.Cols)
+		replay.Write(snap.Data)
+		if got, want := replay.Text(), term.Text(); !slices.Equal(got, want) {
+			t.Errorf("%q: replayed lines = %q, want %q", input, got, want)
+		}
+		if got, want := replay.Snapshot(), snap; string(got.Data) != string(want.Data) || got.Cursor != want.Cursor || got.AltScreen != want.AltScreen {
+			t.Errorf("%q: replayed snapshot = %+v, want %+v", input, got, want)
+		}
+	}
+}
+
+func TestPlain(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		lines []string
+	}{
+		{"lines", "a\r\nb\r\n", []string{"a", "b"}},
+		{"scrolled off", "1\r\n2\r\n3\r\n4", []string{"1", "2", "3", "4"}},
+		{"redrawn with carriage return", "\r- working\r\\ working\r\x1b[Kdone\r\n", []string{"done"}},
+		{"redrawn above", "box\r\n> a\x1b[1A\r\x1b[Kbox 2\r\n\x1b[K> ab", []string{"box 2", "> ab"}},
+		{"escape sequences", "\x1b[1;31mred\x1b[0m \x1b]0;title\x07text", []string{"red text"}},
+		{"erased", "gone\x1b[2J\x1b[Hkept", []string{"kept"}},
+		{"alternate screen", "a\r\n\x1b[?1049hfull screen\x1b[?1049lb", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Plain([]byte(tt.input), 2, 20); !slices.Equal(got, tt.lines) {
+				t.Errorf("lines = %q, want %q", got, tt.lines)
+			}
+		})
+	}
+
+	t.Run("longer than a chunk", func(t *testing.T) {
+		var input strings.Builder
+		for i := range 10000 {
+			fmt.Fprintf(&input, "line %d\r\n", i)
+		}
+		lines := Plain([]byte(input.String()), 2, 20)
+		if len(lines) != 10000 || lines[0] != "line 0" || lines[9999] != "line 9999" {
+			t.Errorf("got %d lines, %q to %q", len(lines), lines[0], lines[len(lines)-1])
+		}
+	})
+}
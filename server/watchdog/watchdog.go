@@ -0,0 +1,116 @@
+package watchdog
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kind identifies a class of internal failure
+type Kind string
+
+const (
+	KindBroadcastStall  Kind = "broadcast_stall"  // Fanning output out to clients took too long
+	KindStorageWrite    Kind = "storage_write"    // Persisting session state failed
+	KindTranscriptParse Kind = "transcript_parse" // A Claude transcript could not be parsed
+)
+
+// ProblemTTL is how long a problem stays active after it last occurred
+const ProblemTTL = 10 * time.Minute
+
+// NotifyInterval limits how often the same kind of problem is reported
+const NotifyInterval = 5 * time.Minute
+
+// Problem is an internal failure observed by the watchdog
+type Problem struct {
+	Kind      Kind      `json:"kind"`
+	Message   string    `json:"message"` // Most recent occurrence
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Status summarizes the health of the server
+type Status struct {
+	Status   string    `json:"status"` // "ok" or "degraded"
+	Problems []Problem `json:"problems"`
+}
+
+// Watchdog collects internal failures so the orchestrator's own problems
+// surface in the UI and notification channels instead of only in the log
+type Watchdog struct {
+	mu           sync.Mutex
+	problems     map[Kind]*Problem
+	lastNotified map[Kind]time.Time
+	onProblem    func(Problem)
+}
+
+// New creates a watchdog
+func New() *Watchdog {
+	return &Watchdog{
+		problems:     make(map[Kind]*Problem),
+		lastNotified: make(map[Kind]time.Time),
+	}
+}
+
+// SetProblemCallback sets the function called when a problem should be reported.
+// It is called at most once per NotifyInterval for each kind.
+func (w *Watchdog) SetProblemCallback(cb func(Problem)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onProblem = cb
+}
+
+// Report records an occurrence of a problem
+func (w *Watchdog) Report(kind Kind, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	now := time.Now()
+
+	w.mu.Lock()
+	p, ok := w.problems[kind]
+	if !ok || now.Sub(p.LastSeen) > ProblemTTL {
+		p = &Problem{Kind: kind, FirstSeen: now}
+		w.problems[kind] = p
+	}
+	p.Message = message
+	p.Count++
+	p.LastSeen = now
+
+	var cb func(Problem)
+	if now.Sub(w.lastNotified[kind]) >= NotifyInterval {
+		w.lastNotified[kind] = now
+		cb = w.onProblem
+	}
+	problem := *p
+	w.mu.Unlock()
+
+	slog.Warn("Watchdog problem", "kind", kind, "message", message)
+	if cb != nil {
+		cb(problem)
+	}
+}
+
+// Status returns the active problems (those seen within ProblemTTL)
+func (w *Watchdog) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	status := Status{Status: "ok", Problems: []Problem{}}
+	for kind, p := range w.problems {
+		if now.Sub(p.LastSeen) > ProblemTTL {
+			delete(w.problems, kind)
+			continue
+		}
+		status.Problems = append(status.Problems, *p)
+	}
+	if len(status.Problems) > 0 {
+		status.Status = "degraded"
+	}
+	sort.Slice(status.Problems, func(i, j int) bool {
+		return status.Problems[i].LastSeen.After(status.Problems[j].LastSeen)
+	})
+	return status
+}
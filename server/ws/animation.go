@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"claudex/claude"
+	"claudex/session"
+)
+
+// Animation events: a condensed, renderer-friendly view of what Claude is
+// doing, derived from the session status and its transcript
+const (
+	AnimStartedThinking  = "started_thinking"
+	AnimToolStarted      = "tool_started"
+	AnimToolSucceeded    = "tool_succeeded"
+	AnimToolFailed       = "tool_failed"
+	AnimAskedQuestion    = "asked_question"
+	AnimCelebrated       = "celebrated_completion"
+	animationPollEvery   = 500 * time.Millisecond // Re-check interval for tool changes while the status is unchanged
+	animationHistorySize = 20                     // Recent events kept for late subscribers
+)
+
+// askQuestionTool is the tool Claude uses to ask the user to pick an option
+const askQuestionTool = "AskUserQuestion"
+
+// AnimationMessage is one animation event for a session
+type AnimationMessage struct {
+	Type      string    `json:"type"`
+	SessionID string    `json:"session_id"`
+	Event     string    `json:"event"`
+	Tool      string    `json:"tool,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// animationState remembers what was already announced for a session
+type animationState struct {
+	mu        sync.Mutex
+	status    session.Status
+	running   map[string]claude.ToolInfo // Tool use ID -> tool announced as started
+	checkedAt time.Time
+	recent    []AnimationMessage
+}
+
+// animationFor returns the session's animation state, creating it if needed
+func (h *Handler) animationFor(sessionID string) *animationState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, ok := h.animations[sessionID]
+	if !ok {
+		a = &animationState{running: make(map[string]claude.ToolInfo)}
+		h.animations[sessionID] = a
+	}
+	return a
+}
+
+// dropAnimation forgets a deleted session's animation state
+func (h *Handler) dropAnimation(sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.animations, sessionID)
+}
+
+// updateAnimation derives animation events from a status update and sends
+// them to the session's subscribers
+func (h *Handler) updateAnimation(sess *session.Session, status session.Status) {
+	a := h.animationFor(sess.ID)
+	a.mu.Lock()
+	now := time.Now()
+	if status == a.status && now.Sub(a.checkedAt) < animationPollEvery {
+		a.mu.Unlock()
+		return
+	}
+	prev := a.status
+	a.status = status
+	a.checkedAt = now
+
+	// Read by the pane's transcript poller; output chunks don't re-read it
+	state := sess.GetClaudeState()
+
+	var events []AnimationMessage
+	emit := func(event string, tool claude.ToolInfo) {
+		events = append(events, AnimationMessage{
+			Type:      "animation",
+			SessionID: sess.ID,
+			Event:     event,
+			Tool:      tool.Name,
+			Target:    tool.Target,
+			At:        now,
+		})
+	}
+
+	if status == session.StatusThinking && prev != session.StatusThinking {
+		emit(AnimStartedThinking, claude.ToolInfo{})
+	}
+	if state != nil {
+		for _, tool := range state.RecentTools {
+			if _, ok := a.running[tool.ID]; !ok {
+				continue
+			}
+			delete(a.running, tool.ID)
+			if tool.Status == "error" {
+				emit(AnimToolFailed, tool)
+			} else {
+				emit(AnimToolSucceeded, tool)
+			}
+		}
+		for _, tool := range state.PendingTools {
+			if _, ok := a.running[tool.ID]; ok {
+				continue
+			}
+			a.running[tool.ID] = tool
+			if tool.Name == askQuestionTool {
+				emit(AnimAskedQuestion, tool)
+			} else {
+				emit(AnimToolStarted, tool)
+			}
+		}
+	}
+	if status == session.StatusWaitingInput &&
+		(prev == session.StatusThinking || prev == session.StatusExecuting) {
+		// Anything still marked running finished without us seeing its result
+		clear(a.running)
+		if state != nil && state.AskedQuestion {
+			emit(AnimAskedQuestion, claude.ToolInfo{})
+		} else {
+			emit(AnimCelebrated, claude.ToolInfo{})
+		}
+	}
+
+	a.recent = append(a.recent, events...)
+	if len(a.recent) > animationHistorySize {
+		a.recent = a.recent[len(a.recent)-animationHistorySize:]
+	}
+	a.mu.Unlock()
+
+	for _, e := range events {
+		h.broadcast(sess.ID, e)
+	}
+}
+
+// handleSessionAnimation returns the session's most recent animation events
+func (h *Handler) handleSessionAnimation(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a := h.animationFor(sess.ID)
+	a.mu.Lock()
+	events := append([]AnimationMessage{}, a.recent...)
+	a.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"claudex/audit"
+	"claudex/session"
+)
+
+// SetAuditLog sets where input is recorded (nil disables the audit log)
+func (h *Handler) SetAuditLog(log *audit.Log) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.audit = log
+}
+
+// recordAudit appends an input event to the audit log, if enabled
+func (h *Handler) recordAudit(e audit.Event) {
+	h.mu.RLock()
+	log := h.audit
+	h.mu.RUnlock()
+	if log == nil {
+		return
+	}
+	if err := log.Record(e); err != nil {
+		slog.Warn("Failed to write audit log", "session", e.SessionID, "err", err)
+	}
+}
+
+// connectionActor identifies a new WebSocket connection. Browsers can't set
+// headers on the upgrade, so the user may also come as ?user=.
+func connectionActor(r *http.Request, admin bool) audit.Actor {
+	user := r.Header.Get(UserHeader)
+	if user == "" {
+		user = r.URL.Query().Get("user")
+	}
+	return audit.Actor{
+		Source:     "websocket",
+		Connection: uuid.New().String()[:8],
+		User:       user,
+		RemoteAddr: r.RemoteAddr,
+		Admin:      admin,
+	}
+}
+
+// connActor returns the identity of a connection
+func (h *Handler) connActor(conn *websocket.Conn) audit.Actor {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if state, ok := h.connections[conn]; ok {
+		return state.actor
+	}
+	return audit.Actor{Source: "websocket"}
+}
+
+// requestActor identifies the client of a REST request
+func (h *Handler) requestActor(r *http.Request) audit.Actor {
+	return audit.Actor{
+		Source:     "rest",
+		User:       r.Header.Get(UserHeader),
+		RemoteAddr: r.RemoteAddr,
+		Admin:      h.manager.IsAdmin(r.Header.Get(session.AdminHeader)),
+	}
+}
+
+// handleSessionAudit serves a session's audit log:
+// GET /sessions/{id}/audit?since=<RFC 3339>&limit=N
+func (h *Handler) handleSessionAudit(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.RLock()
+	log := h.audit
+	h.mu.RUnlock()
+	if log == nil {
+		http.Error(w, "Audit log is disabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var since time.Time
+	if s := query.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	limit := 0
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events, err := log.Read(sess.ID, since, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"claudex/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// BroadcastInputRequest is the body of POST /api/sessions/input and the data
+// of a broadcast_input message
+type BroadcastInputRequest struct {
+	SessionIDs []string `json:"session_ids"`
+	Input      string   `json:"input"` // Typed as is: end with "\r" to submit, "\u0003" is Ctrl-C
+}
+
+// BroadcastInputResult is what happened to the input in one session
+type BroadcastInputResult struct {
+	SessionID string                `json:"session_id"`
+	Sent      bool                  `json:"sent"`
+	Policy    *session.PolicyResult `json:"policy,omitempty"` // Command policy decision, if the input matched one
+	Error     string                `json:"error,omitempty"`
+}
+
+// HandleBroadcastInput types the same input into several sessions, e.g. a
+// prompt or Ctrl-C for every experiment. Each session's command policy and
+// required services apply as to its own input.
+func (h *Handler) HandleBroadcastInput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BroadcastInputRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.SessionIDs) == 0 || req.Input == "" {
+		http.Error(w, "session_ids and input are required", http.StatusBadRequest)
+		return
+	}
+
+	actor := h.requestActor(r)
+	results := []BroadcastInputResult{}
+	for _, sessionID := range uniqueIDs(req.SessionIDs) {
+		result := BroadcastInputResult{SessionID: sessionID}
+		// Input to a session without a process would vanish silently
+		if sess, ok := h.manager.Get(sessionID); ok && sess.RunningPanes() == 0 {
+			result.Error = "session is not running"
+			results = append(results, result)
+			continue
+		}
+		policy, err := h.SendInput(sessionID, req.Input, actor)
+		result.Policy = policy
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Sent = policy == nil || policy.Decision == session.PolicyAllow
+		}
+		results = append(results, result)
+	}
+	slog.Info("Broadcast input", "sessions", len(results), "bytes", len(req.Input))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// handleBroadcastInput types input into each of the message's sessions the
+// connection may type in, as input messages to each would
+func (h *Handler) handleBroadcastInput(conn *websocket.Conn, data json.RawMessage) {
+	var req BroadcastInputRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		slog.Debug("Invalid broadcast_input message", "err", err)
+		return
+	}
+
+	actor := h.connActor(conn)
+	reply := func(v any) { h.sendToConn(conn, v) }
+	var targets []*session.Session
+	for _, sessionID := range uniqueIDs(req.SessionIDs) {
+		sess, ok := h.manager.Get(sessionID)
+		if !ok {
+			slog.Debug("Input for unknown session", "session", sessionID)
+			continue
+		}
+		if !h.allowMessage(conn, sessionID, "input") || !h.checkControl(conn, sessionID) {
+			continue
+		}
+		targets = append(targets, sess)
+	}
+	h.queueInput(conn, func() {
+		for _, sess := range targets {
+			h.writeInput(sess, req.Input, actor, reply)
+		}
+	})
+}
+
+// uniqueIDs returns ids without repeats, in their first order
+func uniqueIDs(ids []string) []string {
+	var unique []string
+	for _, id := range ids {
+		if id != "" && !slices.Contains(unique, id) {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
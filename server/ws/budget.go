@@ -0,0 +1,146 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"claudex/claude"
+	"claudex/notify"
+	"claudex/session"
+)
+
+// budgetCheckInterval is how often running sessions are checked against
+// their budget besides when they print output
+const budgetCheckInterval = time.Minute
+
+// BudgetAlertMessage tells clients that a session crossed a budget threshold
+type BudgetAlertMessage struct {
+	Type      string         `json:"type"`
+	SessionID string         `json:"session_id"`
+	Threshold float64        `json:"threshold"` // Fraction of the budget reached (e.g. 0.8)
+	CostUSD   float64        `json:"cost_usd"`
+	Tokens    int            `json:"tokens"`
+	Budget    session.Budget `json:"budget"`
+}
+
+// SetBudget sets the global budget applied to sessions without their own
+func (h *Handler) SetBudget(budget session.Budget) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.budget = budget
+}
+
+// effectiveBudget returns the session's budget or the global one
+func (h *Handler) effectiveBudget(sess *session.Session) session.Budget {
+	if b := sess.GetBudget(); b != nil {
+		return *b
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.budget
+}
+
+// checkBudget alerts once for every budget threshold the session's usage crosses.
+// Must not be called with h.mu held.
+func (h *Handler) checkBudget(sess *session.Session, report *claude.CostReport) {
+	budget := h.effectiveBudget(sess)
+	if !budget.Enabled() {
+		return
+	}
+	crossed := budget.Crossed(budget.Used(report.CostUSD, report.TotalTokens))
+	if crossed == 0 {
+		return
+	}
+
+	if !sess.AlertBudget(report.SessionID, crossed) {
+		return
+	}
+	h.manager.UpdateSession(sess)
+
+	slog.Info("Session reached budget threshold",
+		"session", sess.ID, "threshold", crossed, "cost_usd", report.CostUSD, "tokens", report.TotalTokens)
+
+	h.broadcast(sess.ID, BudgetAlertMessage{
+		Type:      "budget_alert",
+		SessionID: sess.ID,
+		Threshold: crossed,
+		CostUSD:   report.CostUSD,
+		Tokens:    report.TotalTokens,
+		Budget:    budget,
+	})
+
+	e := notify.NewEvent(notify.EventBudgetAlert, sess.ID, sess.Name,
+		fmt.Sprintf("%s reached %.0f%% of its budget ($%.2f, %d tokens)", sess.Name, crossed*100, report.CostUSD, report.TotalTokens))
+	e.Data["threshold"] = crossed
+	e.Data["cost_usd"] = report.CostUSD
+	e.Data["tokens"] = report.TotalTokens
+	h.publishEvent(e)
+}
+
+// RunBudgetChecks checks running sessions against their budget until stop
+// is closed, so a session spending without printing anything is caught too
+func (h *Handler) RunBudgetChecks(stop <-chan struct{}) {
+	ticker := time.NewTicker(budgetCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, sess := range h.manager.List(session.ListOptions{}) {
+				if sess.RunningPanes() == 0 || !h.effectiveBudget(sess).Enabled() {
+					continue
+				}
+				if report := h.sessionUsage(sess); report != nil {
+					h.checkBudget(sess, report)
+				}
+			}
+		}
+	}
+}
+
+// handleSessionBudget gets or sets a session's budget. PUT with null (or an
+// empty body object) reverts to the global budget.
+func (h *Handler) handleSessionBudget(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	switch r.Method {
+	case http.MethodGet:
+		result := map[string]any{
+			"budget": h.effectiveBudget(sess),
+			"global": sess.GetBudget() == nil,
+		}
+		if summary, err := h.manager.TranscriptSummary(sess, false); err == nil {
+			report := summary.Cost
+			budget := h.effectiveBudget(sess)
+			result["cost_usd"] = report.CostUSD
+			result["tokens"] = report.TotalTokens
+			result["used"] = budget.Used(report.CostUSD, report.TotalTokens)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+
+	case http.MethodPut:
+		var budget *session.Budget
+		if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if budget != nil && !budget.Enabled() {
+			budget = nil
+		}
+		if err := sess.SetBudget(budget); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.manager.UpdateSession(sess)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
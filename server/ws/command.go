@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+// commandOutputTail is how much of a failed command's output is kept for
+// the error
+const commandOutputTail = 4096
+
+// CommandOutputMessage streams the output of a command the server runs for a
+// session (merge tests, worktree setup) to its subscribers
+type CommandOutputMessage struct {
+	Type      string `json:"type"` // "test_output" or "setup_output"
+	SessionID string `json:"session_id"`
+	Command   string `json:"command"`
+	Data      string `json:"data,omitempty"` // A chunk of stdout and stderr
+	Done      bool   `json:"done,omitempty"` // Last message of the run
+	Passed    bool   `json:"passed,omitempty"`
+	ExitCode  int    `json:"exit_code,omitempty"` // Set when Done; -1 if it didn't exit on its own
+}
+
+// runStreamed runs a shell command in dir, broadcasting its output to the
+// session's subscribers as msgType messages and finishing with a Done one.
+// It returns the exit code (-1 if the command didn't exit on its own) and
+// the end of the output.
+func (h *Handler) runStreamed(ctx context.Context, msgType, sessionID, dir, command string) (int, string, error) {
+	out := &commandStream{h: h, msgType: msgType, sessionID: sessionID, command: command}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+
+	done := CommandOutputMessage{Type: msgType, SessionID: sessionID, Command: command, Done: true, Passed: err == nil}
+	if err != nil {
+		done.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			done.ExitCode = exitErr.ExitCode()
+		}
+	}
+	out.send(done)
+	return done.ExitCode, string(out.tail), err
+}
+
+// commandStream broadcasts a command's output as it is written and keeps its
+// tail. exec serializes writes when stdout and stderr share it.
+type commandStream struct {
+	h         *Handler
+	msgType   string
+	sessionID string
+	command   string
+	tail      []byte
+}
+
+func (s *commandStream) Write(p []byte) (int, error) {
+	s.send(CommandOutputMessage{Type: s.msgType, SessionID: s.sessionID, Command: s.command, Data: string(p)})
+	s.tail = append(s.tail, p...)
+	if len(s.tail) > commandOutputTail {
+		s.tail = s.tail[len(s.tail)-commandOutputTail:]
+	}
+	return len(p), nil
+}
+
+// send broadcasts a message of the run, keeping setup output for
+// subscribers that join later
+func (s *commandStream) send(msg CommandOutputMessage) {
+	if msg.Type == "setup_output" {
+		s.h.keepSetupOutput(msg)
+	}
+	s.h.broadcast(s.sessionID, msg)
+}
@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"claudex/audit"
+	"claudex/session"
+)
+
+// Control API for clients that don't speak the WebSocket protocol (the gRPC
+// server). Each call does what the matching WebSocket message or REST
+// endpoint does, but reports the outcome as an error.
+
+var (
+	// ErrSessionNotFound is returned for an unknown session ID
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrBlocked is returned when required services keep a session from
+	// starting or a prompt from being submitted
+	ErrBlocked = errors.New("required services are unavailable")
+	// ErrRateLimited is returned when input exceeds the session's rate limit
+	ErrRateLimited = errors.New("session input rate limit exceeded")
+	// ErrControlHeld is returned for input while a WebSocket client holds
+	// the session's input control
+	ErrControlHeld = errors.New("another client holds input control of the session")
+	// ErrSettingUp is returned when an experiment is started while its
+	// worktree's setup commands are running
+	ErrSettingUp = errors.New("the experiment's setup commands are still running")
+)
+
+// getSession looks up a session for the control API
+func (h *Handler) getSession(sessionID string) (*session.Session, error) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return sess, nil
+}
+
+// DeleteSession saves the session's scrollback and deletes it
+func (h *Handler) DeleteSession(sessionID string) error {
+	sess, err := h.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+	h.deleteSession(sess)
+	return nil
+}
+
+// deleteSession saves the scrollback, deletes the session and drops its
+// sinks and subscribers
+func (h *Handler) deleteSession(sess *session.Session) {
+	h.manager.RecordProjectEvent(sess, h.projectDir(sess), session.ProjectEventDeleted, "")
+	h.manager.SaveScrollback(sess)
+	h.manager.Delete(sess.ID)
+	h.forgetUsage(sess)
+	h.dropAnimation(sess.ID)
+	h.closeSessionSinks(sess.ID)
+	h.dropHub(sess.ID)
+	h.dropDependencies(sess.ID)
+	h.broadcastSessionList()
+}
+
+// retireExperiment deals with a session whose worktree was merged (into a
+// branch) or discarded: it is deleted, or with keep stopped and, if merged,
+// marked with the branch. Sessions waiting for the merge are fired. It
+// reports whether the session was deleted.
+func (h *Handler) retireExperiment(sess *session.Session, mergedInto string, keep bool) bool {
+	if mergedInto != "" {
+		h.manager.RecordProjectEvent(sess, h.projectDir(sess), session.ProjectEventMerged, mergedInto)
+		h.dependencyMet(sess.ID, session.DependOnMerged)
+	} else {
+		h.manager.RecordProjectEvent(sess, h.projectDir(sess), session.ProjectEventDiscarded, "")
+	}
+	if !keep {
+		h.deleteSession(sess)
+		return true
+	}
+	h.stopSession(sess)
+	if mergedInto != "" {
+		if err := sess.UpdateMetadata(map[string]any{session.MergedIntoKey: mergedInto}, false); err != nil {
+			slog.Warn("Failed to mark experiment merged", "session", sess.ID, "err", err)
+		}
+	}
+	h.manager.UpdateSession(sess)
+	h.broadcastSessionList()
+	return false
+}
+
+// worktreeSessions returns the sessions working inside a worktree
+func (h *Handler) worktreeSessions(worktreePath string) []*session.Session {
+	var found []*session.Session
+	for _, s := range h.manager.List(session.ListOptions{}) {
+		if inDir(s.Directory, worktreePath) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// inDir reports whether path is dir or inside it
+func inDir(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// StartSession starts a session with the given terminal size (0 for 24x80).
+// Admin callers are exempt from run quotas.
+func (h *Handler) StartSession(sessionID string, rows, cols uint16, admin bool) error {
+	sess, err := h.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if rows == 0 || cols == 0 {
+		rows, cols = 24, 80
+	}
+	h.resizeScreen(sessionID, rows, cols)
+	return h.startSession(sess, rows, cols, admin)
+}
+
+// StopSession saves the session's state and stops its processes
+func (h *Handler) StopSession(sessionID string) error {
+	sess, err := h.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+	h.stopSession(sess)
+	return nil
+}
+
+// SendInput types input into the session on behalf of actor. It returns the
+// command policy decision the input matched, if any.
+func (h *Handler) SendInput(sessionID, input string, actor audit.Actor) (*session.PolicyResult, error) {
+	sess, err := h.getSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	var result *session.PolicyResult
+	err = h.writeInput(sess, input, actor, func(v any) {
+		if msg, ok := v.(PolicyMessage); ok {
+			result = msg.Result
+		}
+	})
+	return result, err
+}
+
+// ResizeSession changes the terminal size of the session
+func (h *Handler) ResizeSession(sessionID string, rows, cols uint16) error {
+	sess, err := h.getSession(sessionID)
+	if err != nil {
+		return err
+	}
+	err = sess.Resize(rows, cols)
+	h.resizeScreen(sessionID, rows, cols)
+	return err
+}
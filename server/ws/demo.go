@@ -0,0 +1,30 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// HandleDemo provisions the onboarding demo project and its session.
+// Starting the session (like any other) types the scripted first prompt.
+func (h *Handler) HandleDemo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sess, err := h.manager.CreateDemo(h.claim(r, ""))
+	if err != nil {
+		if writeQuotaError(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Created demo session", "session", sess.ID, "dir", sess.Directory)
+	h.broadcastSessionList()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"claudex/audit"
+	"claudex/session"
+)
+
+// dependencyReadyTimeout is how long a session started by its dependency
+// gets to reach waiting_input before its prompt is given up on
+const dependencyReadyTimeout = 2 * time.Minute
+
+// dependencyActor is who dependency prompts are recorded as typed by
+var dependencyActor = audit.Actor{Source: "dependency"}
+
+// handleSessionDependsOn gets, sets (PUT) or removes (DELETE) the session
+// another one must reach a condition before this one starts or gets its
+// prompt, for simple multi-step pipelines
+func (h *Handler) handleSessionDependsOn(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var dep session.Dependency
+		if err := json.NewDecoder(r.Body).Decode(&dep); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.checkDependency(sess, &dep); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := sess.SetDependsOn(&dep); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.manager.UpdateSession(sess)
+	case http.MethodDelete:
+		sess.SetDependsOn(nil)
+		h.manager.UpdateSession(sess)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"depends_on": sess.GetDependsOn()})
+}
+
+// checkDependency checks that the session waited for exists, can meet the
+// condition, and doesn't itself wait on sess down the chain
+func (h *Handler) checkDependency(sess *session.Session, dep *session.Dependency) error {
+	if err := dep.Validate(); err != nil {
+		return err
+	}
+	other, ok := h.manager.Get(dep.SessionID)
+	if !ok {
+		return fmt.Errorf("session %s not found", dep.SessionID)
+	}
+	if dep.On == session.DependOnMerged && other.ParentID == "" {
+		return fmt.Errorf("session %s is not an experiment, so it is never merged", dep.SessionID)
+	}
+	seen := map[string]bool{}
+	for next := other; next != nil && !seen[next.ID]; {
+		if next.ID == sess.ID {
+			return fmt.Errorf("depending on %s would make a cycle", dep.SessionID)
+		}
+		seen[next.ID] = true
+		d := next.GetDependsOn()
+		if d == nil {
+			break
+		}
+		next, _ = h.manager.Get(d.SessionID)
+	}
+	return nil
+}
+
+// dependencyMet fires the dependencies waiting for sessionID to reach the
+// condition: each dependent session is started if needed and given its
+// prompt, and its dependency is cleared
+func (h *Handler) dependencyMet(sessionID, condition string) {
+	for _, s := range h.manager.List(session.ListOptions{}) {
+		dep := s.GetDependsOn()
+		if dep == nil || dep.SessionID != sessionID || dep.On != condition {
+			continue
+		}
+		s.SetDependsOn(nil)
+		h.manager.UpdateSession(s)
+		slog.Info("Dependency met", "session", s.ID, "waited_for", sessionID, "on", condition)
+		go h.runDependent(s, dep)
+	}
+}
+
+// runDependent starts a session whose dependency was met and types its prompt
+// once Claude waits for input
+func (h *Handler) runDependent(sess *session.Session, dep *session.Dependency) {
+	if sess.RunningPanes() == 0 {
+		h.resizeScreen(sess.ID, 24, 80)
+		if err := h.startSession(sess, 24, 80, false); err != nil {
+			slog.Warn("Failed to start dependent session", "session", sess.ID, "err", err)
+			return
+		}
+	}
+	if dep.Prompt == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dependencyReadyTimeout)
+	defer cancel()
+	ready := h.waitForStatus(ctx, sess, func(status session.Status) bool { return status == session.StatusWaitingInput })
+	if !ready {
+		slog.Warn("Dependent session never waited for input, prompt not sent", "session", sess.ID, "status", sess.GetStatus())
+		return
+	}
+	event := audit.Event{Kind: audit.KindInput, Actor: dependencyActor}
+	if err := h.typePrompt(sess, dep.Prompt, event); err != nil {
+		slog.Warn("Failed to send dependent prompt", "session", sess.ID, "err", err)
+	}
+}
+
+// dropDependencies clears the dependencies on a deleted session, which can
+// never be met now
+func (h *Handler) dropDependencies(sessionID string) {
+	for _, s := range h.manager.List(session.ListOptions{}) {
+		if dep := s.GetDependsOn(); dep != nil && dep.SessionID == sessionID {
+			s.SetDependsOn(nil)
+			h.manager.UpdateSession(s)
+			slog.Info("Dropped dependency on deleted session", "session", s.ID, "waited_for", sessionID)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"claudex/session"
+)
+
+// BatchExperimentResult is one experiment created by a batch
+type BatchExperimentResult struct {
+	Session *session.Session `json:"session"`
+	Started bool             `json:"started"`
+	SetUp   bool             `json:"setup,omitempty"` // Starts once the project's setup commands pass
+	Error   string           `json:"error,omitempty"` // Why the session did not start
+}
+
+// HandleExperimentBatch creates an experiment per branch from one parent
+// session, each in its own worktree, and starts Claude in every one on its
+// own prompt. Creating is all or nothing: when an experiment can't be
+// created the ones before it are discarded. Starting is not: a session kept
+// from starting (run quota, required services) is returned with the reason
+// and can be started later.
+func (h *Handler) HandleExperimentBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BatchExperimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	parent, ok := h.manager.Get(req.ParentID)
+	if !ok {
+		http.Error(w, "Parent session not found", http.StatusNotFound)
+		return
+	}
+	gitRoot := findGitRoot(parent.Directory)
+	if gitRoot == "" {
+		http.Error(w, "Parent directory is not a git repository", http.StatusBadRequest)
+		return
+	}
+	project, err := readProjectConfig(gitRoot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claim := h.claim(r, req.Owner)
+	if claim.Owner == "" {
+		claim.Owner, _ = parent.MetadataString(session.OwnerKey)
+	}
+	claim.Worktree = true
+	if err := h.manager.CheckQuota(claim); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
+	// Check every branch before touching git so a bad one leaves nothing behind
+	for _, exp := range req.Experiments {
+		if exec.Command("git", "check-ref-format", "--branch", exp.BranchName).Run() != nil {
+			http.Error(w, fmt.Sprintf("Invalid branch name %q", exp.BranchName), http.StatusBadRequest)
+			return
+		}
+		if err := checkNewBranch(gitRoot, exp.BranchName); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	created := make([]*session.Session, 0, len(req.Experiments))
+	for _, exp := range req.Experiments {
+		sess, err := h.createPromptedExperiment(gitRoot, req, exp, project, claim)
+		if err != nil {
+			for _, s := range created {
+				h.discardExperimentWorktree(s)
+				h.deleteSession(s)
+			}
+			if writeQuotaError(w, err) {
+				return
+			}
+			http.Error(w, fmt.Sprintf("%s: %v", exp.BranchName, err), http.StatusInternalServerError)
+			return
+		}
+		created = append(created, sess)
+	}
+	h.broadcastSessionList()
+
+	results := make([]BatchExperimentResult, 0, len(created))
+	for _, sess := range created {
+		result := BatchExperimentResult{Session: sess}
+		h.resizeScreen(sess.ID, 24, 80)
+		if len(project.Setup) > 0 {
+			h.beginSetup(sess.ID, sess.Directory, project.Setup, func() {
+				if err := h.startSession(sess, 24, 80, claim.Override); err != nil {
+					slog.Warn("Failed to start experiment after setup", "session", sess.ID, "err", err)
+				}
+			})
+			result.SetUp = true
+		} else if err := h.startSession(sess, 24, 80, claim.Override); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Started = true
+		}
+		results = append(results, result)
+	}
+	slog.Info("Created experiment batch", "parent", req.ParentID, "experiments", len(created))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// createPromptedExperiment creates an experiment in a new worktree whose
+// shell starts Claude on the experiment's prompt
+func (h *Handler) createPromptedExperiment(gitRoot string, req BatchExperimentRequest, exp ExperimentStart, project *ProjectConfig, claim session.Claim) (*session.Session, error) {
+	worktreePath, err := h.addWorktree(gitRoot, exp.BranchName, project, req.CopyFiles, req.LinkFiles)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := h.manager.CreateExperiment(req.ParentID, exp.BranchName, worktreePath, claim)
+	if err != nil {
+		removeWorktree(gitRoot, worktreePath, exp.BranchName)
+		return nil, err
+	}
+	sess.SetStartupCommand(session.ClaudeCommand(exp.Prompt))
+	h.manager.UpdateSession(sess)
+	return sess, nil
+}
+
+// checkNewBranch reports an error if the experiment branch or its worktree
+// directory already exists
+func checkNewBranch(gitRoot, branch string) error {
+	if branchExists(gitRoot, branch) {
+		return fmt.Errorf("branch %q already exists", branch)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(gitRoot), branch)); err == nil {
+		return fmt.Errorf("worktree directory for %q already exists", branch)
+	}
+	return nil
+}
+
+// removeWorktree removes a worktree and its branch (best effort)
+func removeWorktree(gitRoot, worktreePath, branch string) {
+	cmd := exec.Command("git", "worktree", "remove", "--force", worktreePath)
+	cmd.Dir = gitRoot
+	cmd.Run()
+	cmd = exec.Command("git", "branch", "-D", branch)
+	cmd.Dir = gitRoot
+	cmd.Run()
+}
@@ -1,30 +1,44 @@
 package ws
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"claudex/audit"
 	"claudex/claude"
+	"claudex/forge"
+	"claudex/logsink"
+	"claudex/notify"
 	"claudex/session"
+	"claudex/watchdog"
 
 	"github.com/gorilla/websocket"
 )
 
+// Keepalive timing for WebSocket connections
+const (
+	writeWait  = 10 * time.Second    // Max time to write a message to a client
+	pongWait   = 60 * time.Second    // Max time between pongs before a client is considered dead
+	pingPeriod = (pongWait * 9) / 10 // How often pings are sent (must be less than pongWait)
+)
+
+// upgrader is copied per connection with CheckOrigin bound to the origin policy
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
+	Subprotocols:    []string{StatusProtocol},
 }
 
 // Message represents a WebSocket message
@@ -38,14 +52,52 @@ type Message struct {
 type OutputMessage struct {
 	Type      string `json:"type"`
 	SessionID string `json:"session_id"`
-	Data      string `json:"data"` // Base64 encoded for binary safety
+	PaneID    string `json:"pane_id,omitempty"` // Set for panes other than the main one
+	Data      string `json:"data"`              // Base64 encoded for binary safety
+	Seq       uint64 `json:"seq,omitempty"`     // Sequence number of the last chunk included (main pane only)
+}
+
+// SubscribeData holds optional subscribe parameters
+type SubscribeData struct {
+	SinceSeq   uint64 `json:"since_seq,omitempty"`  // Replay only output after this sequence number
+	Scrollback bool   `json:"scrollback,omitempty"` // Send the raw scrollback instead of the rendered screen
 }
 
 // StatusMessage represents a status change
 type StatusMessage struct {
 	Type      string         `json:"type"`
 	SessionID string         `json:"session_id"`
+	PaneID    string         `json:"pane_id,omitempty"` // Set for panes other than the main one
 	Status    session.Status `json:"status"`
+	Tool      string         `json:"tool,omitempty"`     // Tool being executed (executing status only)
+	Model     string         `json:"model,omitempty"`    // Model of the transcript's latest reply
+	CostUSD   float64        `json:"cost_usd,omitempty"` // Running cost of the session's Claude transcript
+	Reason    string         `json:"reason,omitempty"`   // Why the session errored (e.g. a resource limit was hit)
+
+	// Running token counts of the transcript, as in the usage endpoint
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+	TotalTokens  int `json:"total_tokens,omitempty"` // Including cache reads and writes
+
+	Context *claude.ContextUsage `json:"context,omitempty"` // Context window use, to tell when /compact is due
+
+	// How sure status detection is of a detected status and what it went by
+	Detection *session.Detection `json:"detection,omitempty"`
+}
+
+// PolicyMessage tells a client that submitted input was held back by the session policy
+type PolicyMessage struct {
+	Type      string                `json:"type"`
+	SessionID string                `json:"session_id"`
+	PaneID    string                `json:"pane_id,omitempty"` // Set for panes other than the main one
+	Result    *session.PolicyResult `json:"result"`
+}
+
+// BlockedMessage reports required services that keep a session from starting or accepting prompts
+type BlockedMessage struct {
+	Type      string                  `json:"type"`
+	SessionID string                  `json:"session_id"`
+	Services  []session.ServiceResult `json:"services"`
 }
 
 // ResizeData represents terminal resize request
@@ -56,16 +108,70 @@ type ResizeData struct {
 
 // Handler manages WebSocket connections
 type Handler struct {
-	manager     *session.Manager
-	connections map[*websocket.Conn]*connState // conn -> connection state
-	saveTimers  map[string]*time.Timer         // session ID -> save timer
-	mu          sync.RWMutex
+	manager      *session.Manager
+	connections  map[*websocket.Conn]*connState // conn -> connection state
+	saveTimers   map[string]*time.Timer         // session ID -> save timer
+	readOnly     bool                           // Observer mode: reject anything that changes state
+	outbox       *notify.Outbox                 // Event delivery to webhooks/notifiers (nil if not configured)
+	rules        *notify.RuleStore              // Notification and automation rules
+	watchdog     *watchdog.Watchdog             // Internal failure tracking (nil if not configured)
+	budget       session.Budget                 // Global budget for sessions without their own
+	animations   map[string]*animationState     // session ID -> animation events already announced
+	usage        map[string]*usageCache         // session ID -> cost report last read for status updates
+	sentStatus   map[string]StatusMessage       // session ID -> last status update sent
+	sinks        *logsink.Router                // External copies of session output (nil if not configured)
+	backpressure Backpressure                   // Send queue size and overflow policy for new connections
+	origins      OriginPolicy                   // Cross-origin WebSocket and REST clients accepted
+	audit        *audit.Log                     // Record of input per session (nil if disabled)
+	mergeBranch  string                         // Branch merges go into ("": each repository's default branch)
+	testCommands map[string]string              // Command merges with require_tests run, by repository path
+	forges       *forge.Forges                  // Where pull requests are opened, per repository
+	mu           sync.RWMutex
+
+	hubs   map[string]*hub // session ID -> subscribers, replay buffer and screen
+	hubsMu sync.RWMutex
+
+	statusObservers map[*StatusObserver]bool // Status followers outside WebSocket connections
+	observersMu     sync.Mutex
+
+	limiter *rateLimiter // Input and resize limits, with per-session buckets
 }
 
 // connState holds per-connection state with its own mutex for writes
 type connState struct {
-	subscriptions map[string]bool
-	writeMu       sync.Mutex
+	subscriptions  map[string]bool
+	statusOnly     bool                     // Status-only client: session list and status events, no output
+	transcriptSubs map[string]chan struct{} // session ID -> stop channel of the transcript tail
+	playbacks      map[string]chan struct{} // session ID -> stop channel of a recording playback
+	admin          bool                     // Connected with the admin token: quotas don't apply
+	version        int                      // Protocol version negotiated with hello
+	limits         *buckets                 // Input and resize rate limits of this connection
+	actor          audit.Actor              // Who is connected, for the audit log
+	queue          *sendQueue               // Outgoing messages, written by the connection's own goroutine
+	inputs         chan func()              // Input to type, in order, off the read loop (service checks can be slow)
+}
+
+// inputQueueSize is how much input a connection may have waiting to be typed
+const inputQueueSize = 256
+
+// runInputs types a connection's input in order until the channel closes
+func (c *connState) runInputs() {
+	for write := range c.inputs {
+		write()
+	}
+}
+
+// send queues an encoded message; it fails once the connection is gone or
+// was cut off for falling behind
+func (c *connState) send(data []byte) error {
+	return c.queue.push(&outgoing{messageType: websocket.TextMessage, data: data})
+}
+
+// sendOutput queues a chunk of session output. encoded is the OutputMessage
+// for the chunk, shared by all subscribers; the raw chunk lets the queue merge
+// output when the client falls behind.
+func (c *connState) sendOutput(sessionID string, chunk []byte, seq uint64, encoded []byte) error {
+	return c.queue.push(&outgoing{messageType: websocket.TextMessage, data: encoded, sessionID: sessionID, output: chunk, seq: seq})
 }
 
 // NewHandler creates a new WebSocket handler
@@ -74,62 +180,280 @@ func NewHandler(manager *session.Manager) *Handler {
 		manager:     manager,
 		connections: make(map[*websocket.Conn]*connState),
 		saveTimers:  make(map[string]*time.Timer),
+		hubs:        make(map[string]*hub),
+		limiter:     newRateLimiter(),
+
+		statusObservers: make(map[*StatusObserver]bool),
+
+		animations: make(map[string]*animationState),
+		usage:      make(map[string]*usageCache),
+		sentStatus: make(map[string]StatusMessage),
+	}
+}
+
+// SetReadOnly enables or disables observer mode
+func (h *Handler) SetReadOnly(readOnly bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readOnly = readOnly
+}
+
+// SetBackpressure sets how connections that can't keep up are handled
+// (applies to new connections)
+func (h *Handler) SetBackpressure(config Backpressure) error {
+	if err := config.Validate(); err != nil {
+		return err
 	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backpressure = config
+	return nil
+}
+
+// getBackpressure returns the send queue settings for new connections
+func (h *Handler) getBackpressure() Backpressure {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.backpressure
+}
+
+// IsReadOnly reports whether the server is in observer mode
+func (h *Handler) IsReadOnly() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.readOnly
+}
+
+// ReadOnlyMiddleware rejects state-changing REST requests while in observer mode
+func (h *Handler) ReadOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.IsReadOnly() && strings.HasPrefix(r.URL.Path, "/api/") &&
+			r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions &&
+			!isStatusLineReport(r) {
+			http.Error(w, "Server is in read-only mode", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isStatusLineReport reports whether r is a statusline hook report, which
+// Claude sends on its own and observer mode lets through
+func isStatusLineReport(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.Contains(r.URL.Path, "/sessions/") &&
+		strings.HasSuffix(r.URL.Path, "/statusline")
+}
+
+// readOnlyMessages lists WebSocket message types that are allowed in observer mode
+var readOnlyMessages = map[string]bool{
+	"hello":       true,
+	"subscribe":   true,
+	"unsubscribe": true,
+	"list":        true,
+
+	"subscribe_transcript":   true,
+	"unsubscribe_transcript": true,
+
+	"playback":      true,
+	"playback_stop": true,
 }
 
 // HandleConnection handles WebSocket connections
 func (h *Handler) HandleConnection(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	u := upgrader
+	u.CheckOrigin = h.originAllowed
+	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		slog.Warn("WebSocket upgrade failed", "origin", r.Header.Get("Origin"), "err", err)
 		return
 	}
 	defer conn.Close()
 
+	state := &connState{
+		subscriptions:  make(map[string]bool),
+		statusOnly:     conn.Subprotocol() == StatusProtocol || r.URL.Query().Get("mode") == "status",
+		transcriptSubs: make(map[string]chan struct{}),
+		playbacks:      make(map[string]chan struct{}),
+		queue:          newSendQueue(h.getBackpressure()),
+		admin:          h.manager.IsAdmin(r.Header.Get(session.AdminHeader)),
+		version:        ProtocolVersion,
+		limits:         h.limiter.connection(),
+		inputs:         make(chan func(), inputQueueSize),
+	}
+	state.actor = connectionActor(r, state.admin)
 	h.mu.Lock()
-	h.connections[conn] = &connState{subscriptions: make(map[string]bool)}
+	h.connections[conn] = state
 	h.mu.Unlock()
+	go state.queue.run(conn)
+	go state.runInputs()
+
+	h.sendToConn(conn, helloMessage(ProtocolVersion, state.actor.Connection))
+
+	if state.statusOnly {
+		h.sendToConn(conn, h.sessionsMessage())
+	}
 
+	done := make(chan struct{})
 	defer func() {
-		h.mu.Lock()
-		delete(h.connections, conn)
-		h.mu.Unlock()
+		close(done)
+		close(state.inputs)
+		h.reapConnection(conn)
 	}()
 
+	// Clients must answer pings; a missed pong makes ReadMessage fail
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		h.touchSubscribed(state)
+		return nil
+	})
+
+	go h.keepAlive(conn, state, done)
+
 	for {
 		_, messageBytes, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				slog.Warn("WebSocket read failed", "err", err)
 			}
 			break
 		}
 
 		var msg Message
 		if err := json.Unmarshal(messageBytes, &msg); err != nil {
-			log.Printf("Invalid message: %v", err)
+			slog.Debug("Invalid WebSocket message", "err", err)
 			continue
 		}
 
+		h.touchSubscribed(state)
 		h.handleMessage(conn, msg)
 	}
 }
 
+// touchSubscribed records that the sessions a connection is subscribed to
+// still have a live client
+func (h *Handler) touchSubscribed(state *connState) {
+	h.mu.RLock()
+	var ids []string
+	for sessionID, subscribed := range state.subscriptions {
+		if subscribed {
+			ids = append(ids, sessionID)
+		}
+	}
+	h.mu.RUnlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		if sess, ok := h.manager.Get(id); ok {
+			sess.TouchClient(now)
+		}
+	}
+}
+
+// keepAlive pings a connection periodically until it closes
+func (h *Handler) keepAlive(conn *websocket.Conn, state *connState, done chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			// Control frames bypass the send queue so a backlog can't delay them
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				slog.Debug("Ping failed, closing connection", "err", err)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// reapConnection removes a connection from the registry and closes it
+func (h *Handler) reapConnection(conn *websocket.Conn) {
+	var subscribed []string
+	h.mu.Lock()
+	if state, ok := h.connections[conn]; ok {
+		for _, stop := range state.transcriptSubs {
+			close(stop)
+		}
+		for _, stop := range state.playbacks {
+			close(stop)
+		}
+		state.queue.close()
+		for sessionID := range state.subscriptions {
+			subscribed = append(subscribed, sessionID)
+		}
+	}
+	delete(h.connections, conn)
+	h.mu.Unlock()
+
+	for _, sessionID := range subscribed {
+		h.unsubscribe(sessionID, conn)
+	}
+	conn.Close()
+}
+
 // handleMessage processes incoming WebSocket messages
 func (h *Handler) handleMessage(conn *websocket.Conn, msg Message) {
-	log.Printf("[WS] Received message: type=%s session_id=%s", msg.Type, msg.SessionID)
+	slog.Debug("WebSocket message", "type", msg.Type, "session", msg.SessionID)
+	if h.IsReadOnly() && !readOnlyMessages[msg.Type] {
+		slog.Info("Rejected message in read-only mode", "type", msg.Type)
+		return
+	}
+
 	switch msg.Type {
+	case "hello":
+		h.handleHello(conn, msg.Data)
+
 	case "subscribe":
-		h.handleSubscribe(conn, msg.SessionID)
+		// Status-only clients may only follow the system pseudo-session
+		if msg.SessionID != SystemSessionID && h.isStatusOnly(conn) {
+			slog.Debug("Ignoring output subscription from status-only client")
+			return
+		}
+		h.handleSubscribe(conn, msg.SessionID, msg.Data)
+
+	case "list":
+		h.sendToConn(conn, h.sessionsMessage())
+
+	case "subscribe_transcript":
+		h.handleSubscribeTranscript(conn, msg.SessionID, msg.Data)
+
+	case "unsubscribe_transcript":
+		h.handleUnsubscribeTranscript(conn, msg.SessionID)
 
 	case "unsubscribe":
 		h.handleUnsubscribe(conn, msg.SessionID)
 
+	case "playback":
+		if h.isStatusOnly(conn) {
+			slog.Debug("Ignoring playback from status-only client")
+			return
+		}
+		h.handlePlayback(conn, msg.SessionID, msg.Data)
+
+	case "playback_stop":
+		h.handleStopPlayback(conn, msg.SessionID)
+
 	case "input":
-		h.handleInput(msg.SessionID, msg.Data)
+		h.handleInput(conn, msg.SessionID, msg.Data)
+
+	case "broadcast_input":
+		h.handleBroadcastInput(conn, msg.Data)
+
+	case "permission_response":
+		h.handlePermissionResponse(conn, msg.SessionID, msg.Data)
+
+	case "policy_override":
+		h.handlePolicyOverride(conn, msg.SessionID)
+
+	case "control_request", "control_grant", "control_steal", "control_release":
+		h.handleControl(conn, msg)
 
 	case "resize":
-		h.handleResize(msg.SessionID, msg.Data)
+		h.handleResize(conn, msg.SessionID, msg.Data)
 
 	case "start":
 		h.handleStart(conn, msg.SessionID, msg.Data)
@@ -140,23 +464,58 @@ func (h *Handler) handleMessage(conn *websocket.Conn, msg Message) {
 	case "restart":
 		h.handleRestart(conn, msg.SessionID, msg.Data)
 
+	case "pane_create":
+		h.handlePaneCreate(conn, msg.SessionID, msg.Data)
+
+	case "pane_input":
+		h.handlePaneInput(conn, msg.SessionID, msg.Data)
+
+	case "pane_resize":
+		h.handlePaneResize(conn, msg.SessionID, msg.Data)
+
+	case "pane_close":
+		h.handlePaneClose(conn, msg.SessionID, msg.Data)
+
 	default:
-		log.Printf("Unknown message type: %s", msg.Type)
+		slog.Debug("Unknown WebSocket message type", "type", msg.Type)
 	}
 }
 
-// handleSubscribe subscribes a connection to a session's output
-func (h *Handler) handleSubscribe(conn *websocket.Conn, sessionID string) {
+// handleSubscribe subscribes a connection to a session's output.
+// If the client passes since_seq, only output it missed is replayed;
+// otherwise it gets the rendered screen (or the raw scrollback on request).
+// Panes besides the main one get their whole scrollback either way.
+func (h *Handler) handleSubscribe(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	if _, ok := h.manager.Get(sessionID); !ok && sessionID != SystemSessionID {
+		slog.Debug("Subscribe to unknown session", "session", sessionID)
+		return
+	}
+	var subData SubscribeData
+	if len(data) > 0 {
+		json.Unmarshal(data, &subData)
+	}
+
+	// Join the hub under h.mu so a concurrent reap can't miss the subscription
 	h.mu.Lock()
 	state, ok := h.connections[conn]
 	if ok {
 		state.subscriptions[sessionID] = true
+		h.subscribe(sessionID, conn, state)
 	}
 	h.mu.Unlock()
 
 	if !ok {
 		return
 	}
+	state.queue.resume(sessionID)
+
+	if sessionID == SystemSessionID {
+		h.sendSystemStatus(conn)
+		return
+	}
+	h.sendControlState(conn, sessionID)
+	h.sendPermission(conn, sessionID)
+	h.sendSetupOutput(conn, sessionID)
 
 	// Send existing scrollback to new subscriber
 	sess, ok := h.manager.Get(sessionID)
@@ -166,18 +525,62 @@ func (h *Handler) handleSubscribe(conn *websocket.Conn, sessionID string) {
 			h.manager.UpdateSession(sess)
 		}
 
-		scrollback := sess.GetScrollback()
-		if len(scrollback) > 0 {
+		// The other panes first; what follows is the main pane's
+		if err := h.sendPaneScrollback(state, sess); err != nil {
+			slog.Debug("Failed to send pane scrollback", "session", sessionID, "err", err)
+			conn.Close()
+			return
+		}
+
+		ring := h.getOutputRing(sessionID)
+		if subData.SinceSeq > 0 {
+			if chunks, ok := ring.Since(subData.SinceSeq); ok {
+				for _, chunk := range chunks {
+					msg := OutputMessage{
+						Type:      "output",
+						SessionID: sessionID,
+						Data:      base64.StdEncoding.EncodeToString(chunk.data),
+						Seq:       chunk.seq,
+					}
+					msgBytes, _ := json.Marshal(msg)
+					if err := state.sendOutput(sessionID, chunk.data, chunk.seq, msgBytes); err != nil {
+						slog.Debug("Failed to replay output", "session", sessionID, "err", err)
+						conn.Close()
+						return
+					}
+				}
+				return
+			}
+			slog.Debug("Cannot resume subscription, sending full scrollback", "session", sessionID, "since_seq", subData.SinceSeq)
+		}
+
+		if !subData.Scrollback {
+			msgBytes, _ := json.Marshal(h.screenMessage(sessionID))
+			if err := state.send(msgBytes); err != nil {
+				slog.Debug("Failed to send screen", "session", sessionID, "err", err)
+				conn.Close()
+			}
+			return
+		}
+
+		// Encode straight from the scrollback ring instead of copying it first
+		var data strings.Builder
+		enc := base64.NewEncoder(base64.StdEncoding, &data)
+		n, _ := sess.WriteScrollback(enc)
+		enc.Close()
+		if n > 0 {
 			msg := OutputMessage{
 				Type:      "output",
 				SessionID: sessionID,
-				Data:      base64.StdEncoding.EncodeToString(scrollback),
+				Data:      data.String(),
+				Seq:       ring.LastSeq(),
 			}
 			msgBytes, _ := json.Marshal(msg)
 			// Use per-connection mutex for writes
-			state.writeMu.Lock()
-			conn.WriteMessage(websocket.TextMessage, msgBytes)
-			state.writeMu.Unlock()
+			if err := state.send(msgBytes); err != nil {
+				slog.Debug("Failed to send scrollback", "session", sessionID, "err", err)
+				conn.Close()
+			}
 		}
 	}
 }
@@ -185,71 +588,224 @@ func (h *Handler) handleSubscribe(conn *websocket.Conn, sessionID string) {
 // handleUnsubscribe unsubscribes a connection from a session
 func (h *Handler) handleUnsubscribe(conn *websocket.Conn, sessionID string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	if state, ok := h.connections[conn]; ok {
 		delete(state.subscriptions, sessionID)
 	}
+	h.mu.Unlock()
+
+	h.unsubscribe(sessionID, conn)
 }
 
 // handleInput sends input to a session
-func (h *Handler) handleInput(sessionID string, data json.RawMessage) {
+func (h *Handler) handleInput(conn *websocket.Conn, sessionID string, data json.RawMessage) {
 	sess, ok := h.manager.Get(sessionID)
 	if !ok {
-		log.Printf("[WS] handleInput: session not found: %s", sessionID)
+		slog.Debug("Input for unknown session", "session", sessionID)
+		return
+	}
+	if !h.allowMessage(conn, sessionID, "input") || !h.checkControl(conn, sessionID) {
 		return
 	}
 
 	var input string
 	if err := json.Unmarshal(data, &input); err != nil {
-		log.Printf("[WS] handleInput: failed to unmarshal: %v, raw: %s", err, string(data))
+		slog.Debug("Invalid input message", "session", sessionID, "err", err)
 		return
 	}
+	actor := h.connActor(conn)
+	h.queueInput(conn, func() {
+		h.writeInput(sess, input, actor, func(v any) { h.sendToConn(conn, v) })
+	})
+}
+
+// queueInput types input from a connection after what it sent before,
+// without holding up its read loop
+func (h *Handler) queueInput(conn *websocket.Conn, write func()) {
+	h.mu.RLock()
+	state, ok := h.connections[conn]
+	h.mu.RUnlock()
+	if ok {
+		state.inputs <- write
+	}
+}
+
+// writeInput types input into the session once its command policy and
+// required services have had their say, and records it in the audit log as
+// sent by actor. Policy decisions and blocked services are reported to
+// reply; a line held back by unavailable services returns ErrBlocked.
+func (h *Handler) writeInput(sess *session.Session, input string, actor audit.Actor, reply func(v any)) error {
+	return h.writePaneInput(sess, "", input, audit.Event{Kind: audit.KindInput, Actor: actor}, reply)
+}
+
+// writePaneInput types input into one of the session's panes ("" for the
+// main one) through the checks of writeInput, recording event in the audit
+// log. Only the main pane, where Claude runs, waits for required services.
+// A policy override skips the command policy, and keeps the confirmed line
+// as the event's input.
+func (h *Handler) writePaneInput(sess *session.Session, paneID, input string, event audit.Event, reply func(v any)) error {
+	sessionID := sess.ID
+	event.SessionID = sessionID
+	if event.Input == "" {
+		event.Input = input
+	}
+	if paneID != "" && sess.GetPane(paneID) == nil {
+		return fmt.Errorf("pane %s not found", paneID)
+	}
+	if !h.allowInput(sessionID, reply) {
+		return ErrRateLimited
+	}
+	// WebSocket clients were checked against the holder by checkControl
+	if event.Source != "websocket" && h.controlHeld(sessionID) {
+		return ErrControlHeld
+	}
+
+	// Don't submit prompts while a required service is down. The rest of
+	// the line still goes to the policy's line tracker, as it stays typed.
+	var blocked error
+	if i := strings.IndexAny(input, "\r\n"); i >= 0 && paneID == "" {
+		if failed := sess.CheckRequiredServices(false); len(failed) > 0 {
+			slog.Info("Input blocked by unavailable services", "session", sessionID, "services", len(failed))
+			input = input[:i]
+			blocked = ErrBlocked
+			reply(BlockedMessage{Type: "blocked", SessionID: sessionID, Services: failed})
+			h.broadcastStatus(sessionID, session.StatusBlocked)
+		}
+	}
+
+	// Enforce the session's command policy before anything reaches the PTY.
+	// A line confirmed past it is submitted as it is.
+	var result *session.PolicyResult
+	if event.Kind != audit.KindPolicyOverride {
+		input, result = sess.FilterInput(paneID, input)
+	}
+	if result != nil {
+		slog.Info("Input matched command policy",
+			"session", sessionID, "decision", result.Decision, "pattern", result.Pattern)
+		if result.Decision == session.PolicyDeny {
+			// Clear the rejected line from the prompt
+			input += "\x15"
+		}
+		reply(PolicyMessage{
+			Type:      "policy",
+			SessionID: sessionID,
+			PaneID:    paneID,
+			Result:    result,
+		})
+	}
+	if result != nil {
+		event.Decision = string(result.Decision)
+	}
+	event.Blocked = blocked != nil
+	h.recordAudit(event)
+	if input == "" {
+		return blocked
+	}
+
+	if paneID != "" {
+		if _, err := sess.WriteToPane(paneID, []byte(input)); err != nil {
+			slog.Warn("Failed to write pane input", "session", sessionID, "pane", paneID, "err", err)
+			return err
+		}
+		return nil
+	}
 
 	// Track last input time
 	sess.SetLastInputAt(time.Now())
+	if event.Kind == audit.KindInput {
+		sess.RecordMacroInput(input)
+	}
 
-	log.Printf("[WS] handleInput: writing %d bytes to session %s, raw input: %v", len(input), sessionID, []byte(input))
-	n, err := sess.Write([]byte(input))
-	if err != nil {
-		log.Printf("[WS] handleInput: write error: %v", err)
-	} else {
-		log.Printf("[WS] handleInput: wrote %d bytes", n)
+	if _, err := sess.Write([]byte(input)); err != nil {
+		slog.Warn("Failed to write input", "session", sessionID, "err", err)
+		return err
+	}
+	return blocked
+}
+
+// inputErrorStatus returns the HTTP status for an error typing input
+func inputErrorStatus(err error) int {
+	switch err {
+	case ErrRateLimited:
+		return http.StatusTooManyRequests
+	case ErrControlHeld, ErrBlocked:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// handlePolicyOverride submits a line that was held for confirmation
+func (h *Handler) handlePolicyOverride(conn *websocket.Conn, sessionID string) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		slog.Debug("Policy override for unknown session", "session", sessionID)
+		return
+	}
+	if !h.allowMessage(conn, sessionID, "input") || !h.checkControl(conn, sessionID) {
+		return
+	}
+
+	paneID, line, ok := sess.ConfirmPendingInput()
+	if !ok {
+		slog.Debug("Policy override with nothing pending", "session", sessionID)
+		return
+	}
+
+	slog.Info("Submitting input confirmed past command policy", "session", sessionID, "pane", paneID, "bytes", len(line))
+	event := audit.Event{Kind: audit.KindPolicyOverride, Actor: h.connActor(conn), Input: line}
+	if pane := sess.GetPane(paneID); paneID != "" && pane != nil {
+		event.Role = string(pane.GetRole())
+	}
+	reply := func(v any) { h.sendToConn(conn, v) }
+	h.queueInput(conn, func() { h.writePaneInput(sess, paneID, "\r", event, reply) })
+}
+
+// sendToConn writes a single message to one connection
+func (h *Handler) sendToConn(conn *websocket.Conn, v any) {
+	h.mu.RLock()
+	state, ok := h.connections[conn]
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	msgBytes, _ := json.Marshal(v)
+	if err := state.send(msgBytes); err != nil {
+		conn.Close()
 	}
 }
 
 // handleResize resizes a session's terminal
-func (h *Handler) handleResize(sessionID string, data json.RawMessage) {
+func (h *Handler) handleResize(conn *websocket.Conn, sessionID string, data json.RawMessage) {
 	sess, ok := h.manager.Get(sessionID)
 	if !ok {
-		log.Printf("[WS] handleResize: session not found: %s", sessionID)
+		slog.Debug("Resize for unknown session", "session", sessionID)
+		return
+	}
+	if !h.allowMessage(conn, sessionID, "resize") {
 		return
 	}
 
 	var resize ResizeData
 	if err := json.Unmarshal(data, &resize); err != nil {
-		log.Printf("[WS] handleResize: unmarshal error: %v, data: %s", err, string(data))
+		slog.Debug("Invalid resize message", "session", sessionID, "err", err)
 		return
 	}
 
-	log.Printf("[WS] handleResize: session=%s rows=%d cols=%d", sessionID, resize.Rows, resize.Cols)
+	slog.Debug("Resizing session", "session", sessionID, "rows", resize.Rows, "cols", resize.Cols)
 	sess.Resize(resize.Rows, resize.Cols)
+	h.resizeScreen(sessionID, resize.Rows, resize.Cols)
 }
 
 // handleStart starts a session
 func (h *Handler) handleStart(conn *websocket.Conn, sessionID string, data json.RawMessage) {
-	log.Printf("[WS] handleStart called for session: %s", sessionID)
 	sess, ok := h.manager.Get(sessionID)
 	if !ok {
-		log.Printf("[WS] Session not found: %s", sessionID)
+		slog.Debug("Start for unknown session", "session", sessionID)
 		return
 	}
 
 	// Parse initial size from data
-	var startData struct {
-		Rows uint16 `json:"rows"`
-		Cols uint16 `json:"cols"`
-	}
+	var startData StartData
 	rows := uint16(24)
 	cols := uint16(80)
 	if err := json.Unmarshal(data, &startData); err == nil {
@@ -258,16 +814,84 @@ func (h *Handler) handleStart(conn *websocket.Conn, sessionID string, data json.
 			cols = startData.Cols
 		}
 	}
-	log.Printf("[WS] handleStart: initial size rows=%d cols=%d", rows, cols)
+	slog.Info("Starting session", "session", sessionID, "rows", rows, "cols", cols)
+	h.resizeScreen(sessionID, rows, cols)
 
 	// Subscribe this connection to the session
-	h.handleSubscribe(conn, sessionID)
+	h.handleSubscribe(conn, sessionID, nil)
+
+	h.mu.RLock()
+	admin := h.connections[conn] != nil && h.connections[conn].admin
+	h.mu.RUnlock()
+	var quotaErr *session.QuotaExceededError
+	if err := h.startSession(sess, rows, cols, admin); errors.As(err, &quotaErr) {
+		h.sendToConn(conn, QuotaExceededMessage{Type: "quota_exceeded", SessionID: sessionID, Error: quotaErr})
+	}
+}
+
+// startSession checks the session's required services and run quota, then
+// starts its process: reattaching to tmux, forking the parent's
+// conversation or resuming the saved Claude session when it can. The other
+// panes of its layout are started with it.
+func (h *Handler) startSession(sess *session.Session, rows, cols uint16, admin bool) (err error) {
+	sessionID := sess.ID
+	defer func() {
+		if err == nil {
+			h.startLayoutPanes(sess, rows, cols, admin)
+		}
+	}()
+
+	// A new experiment starts once its worktree is set up
+	if h.isSettingUp(sessionID) {
+		slog.Info("Not starting session, its setup is running", "session", sessionID)
+		return ErrSettingUp
+	}
+
+	// Required services must be up before the PTY starts
+	if h.blockOnServices(sessionID, sess) {
+		return ErrBlocked
+	}
+
+	if err := h.manager.CheckRunQuota(sess, admin); err != nil {
+		slog.Info("Not starting session", "session", sessionID, "err", err)
+		return err
+	}
+
+	// Give the session its own port block so parallel experiments don't collide
+	if _, err := h.manager.AllocatePorts(sess); err != nil {
+		slog.Warn("Port allocation failed", "session", sessionID, "err", err)
+	}
 
 	outputCallback := func(data []byte) {
 		h.broadcastOutput(sessionID, data)
-		h.broadcastStatus(sessionID, sess.GetStatus())
+		h.refreshStatus(sessionID, sess)
 		h.scheduleScrollbackSave(sessionID, sess)
 	}
+	h.watchStatus(sessionID, sess)
+	h.startRecordingIfEnabled(sess)
+	h.openSessionSinks(sess)
+
+	// A tmux-hosted session that outlived a server restart is attached as it is
+	if sess.Reattachable() {
+		slog.Info("Reattaching session to its tmux session", "session", sessionID)
+		err := sess.Start(rows, cols, outputCallback)
+		if err == nil {
+			go h.detectClaudeSession(sessionID, sess)
+			return nil
+		}
+		slog.Warn("Failed to reattach tmux session", "session", sessionID, "err", err)
+	}
+
+	// An experiment forked from its parent starts on a copy of the parent's conversation
+	if forkFrom := sess.PendingFork(); forkFrom != "" {
+		slog.Info("Forking Claude session for experiment", "session", sessionID, "claude_session", forkFrom)
+		err := sess.ResumeFork(forkFrom, rows, cols, outputCallback)
+		if err == nil {
+			go h.detectClaudeSession(sessionID, sess)
+			return nil
+		}
+		slog.Warn("Failed to fork Claude session, falling back to shell", "session", sessionID, "err", err)
+	}
 
 	// Check for saved Claude Code session to resume (only resume the specific saved session)
 	savedSessionID := sess.GetLastClaudeSessionID()
@@ -277,26 +901,41 @@ func (h *Handler) handleStart(conn *websocket.Conn, sessionID string, data json.
 		if err == nil && claudeSession != nil && claudeSession.SessionID == savedSessionID {
 			modified, err := time.Parse(time.RFC3339, claudeSession.Modified)
 			if err == nil && time.Since(modified) < 24*time.Hour {
-				log.Printf("[WS] Resuming saved Claude session %s for directory %s",
-					savedSessionID, sess.Directory)
+				slog.Info("Resuming saved Claude session",
+					"session", sessionID, "claude_session", savedSessionID)
 
 				err := sess.Resume(savedSessionID, rows, cols, outputCallback)
 				if err == nil {
-					return
+					return nil
 				}
-				log.Printf("[WS] Failed to resume saved Claude session, falling back to shell: %v", err)
+				slog.Warn("Failed to resume saved Claude session, falling back to shell", "session", sessionID, "err", err)
 			}
 		}
 	}
 
 	// Start normal shell
-	err := sess.Start(rows, cols, outputCallback)
+	err = sess.Start(rows, cols, outputCallback)
 	if err != nil {
-		log.Printf("Failed to start session %s: %v", sessionID, err)
+		slog.Error("Failed to start session", "session", sessionID, "err", err)
 	}
 
 	// Start background task to detect Claude session
 	go h.detectClaudeSession(sessionID, sess)
+	return err
+}
+
+// blockOnServices checks the session's required services and reports failures
+// to subscribers as a structured blocked state. It returns true if blocked.
+func (h *Handler) blockOnServices(sessionID string, sess *session.Session) bool {
+	failed := sess.CheckRequiredServices(true)
+	if len(failed) == 0 {
+		return false
+	}
+
+	slog.Info("Session blocked by unavailable services", "session", sessionID, "services", len(failed))
+	h.broadcast(sessionID, BlockedMessage{Type: "blocked", SessionID: sessionID, Services: failed})
+	h.broadcastStatus(sessionID, session.StatusBlocked)
+	return true
 }
 
 // detectClaudeSession monitors for new Claude sessions and saves the session ID
@@ -322,14 +961,19 @@ func (h *Handler) detectClaudeSession(sessionID string, sess *session.Session) {
 				continue
 			}
 
+			// The copy a fork started from is not the experiment's own conversation
+			if claudeSession.SessionID == sess.GetForkedFrom() {
+				continue
+			}
+
 			// If we found a new session, save it
 			if claudeSession.SessionID != lastSessionID {
 				lastSessionID = claudeSession.SessionID
 
 				// Only save if it's different from what's already saved
 				if sess.GetLastClaudeSessionID() != claudeSession.SessionID {
-					log.Printf("[WS] Detected new Claude session %s for Claudex session %s",
-						claudeSession.SessionID, sessionID)
+					slog.Info("Detected new Claude session",
+						"session", sessionID, "claude_session", claudeSession.SessionID)
 					sess.SetLastClaudeSessionID(claudeSession.SessionID)
 					h.manager.UpdateSession(sess)
 				}
@@ -341,6 +985,27 @@ func (h *Handler) detectClaudeSession(sessionID string, sess *session.Session) {
 	}
 }
 
+// Shutdown closes every WebSocket connection with a going-away frame (so
+// clients reconnect once the server is back) and cancels pending scrollback
+// saves; the manager saves all scrollback on its way down
+func (h *Handler) Shutdown() {
+	h.mu.Lock()
+	for _, timer := range h.saveTimers {
+		timer.Stop()
+	}
+	conns := make([]*websocket.Conn, 0, len(h.connections))
+	for conn := range h.connections {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, conn := range conns {
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
+
 // scheduleScrollbackSave schedules a debounced save of the scrollback
 func (h *Handler) scheduleScrollbackSave(sessionID string, sess *session.Session) {
 	h.mu.Lock()
@@ -363,10 +1028,14 @@ func (h *Handler) scheduleScrollbackSave(sessionID string, sess *session.Session
 
 // handleStop stops a session
 func (h *Handler) handleStop(sessionID string) {
-	sess, ok := h.manager.Get(sessionID)
-	if !ok {
-		return
+	if sess, ok := h.manager.Get(sessionID); ok {
+		h.stopSession(sess)
 	}
+}
+
+// stopSession saves the session's state and stops its processes
+func (h *Handler) stopSession(sess *session.Session) {
+	sessionID := sess.ID
 
 	// Update cwd and save before stopping
 	if sess.UpdateCwd() {
@@ -380,10 +1049,9 @@ func (h *Handler) handleStop(sessionID string) {
 
 // handleRestart restarts a stopped session
 func (h *Handler) handleRestart(conn *websocket.Conn, sessionID string, data json.RawMessage) {
-	log.Printf("[WS] handleRestart called for session: %s", sessionID)
 	sess, ok := h.manager.Get(sessionID)
 	if !ok {
-		log.Printf("[WS] Session not found: %s", sessionID)
+		slog.Debug("Restart for unknown session", "session", sessionID)
 		return
 	}
 
@@ -391,10 +1059,7 @@ func (h *Handler) handleRestart(conn *websocket.Conn, sessionID string, data jso
 	sess.Reset()
 
 	// Parse size from data
-	var restartData struct {
-		Rows uint16 `json:"rows"`
-		Cols uint16 `json:"cols"`
-	}
+	var restartData StartData
 	rows := uint16(24)
 	cols := uint16(80)
 	if err := json.Unmarshal(data, &restartData); err == nil {
@@ -403,84 +1068,178 @@ func (h *Handler) handleRestart(conn *websocket.Conn, sessionID string, data jso
 			cols = restartData.Cols
 		}
 	}
+	h.resizeScreen(sessionID, rows, cols)
 
-	outputCallback := func(data []byte) {
-		h.broadcastOutput(sessionID, data)
-		h.broadcastStatus(sessionID, sess.GetStatus())
-		h.scheduleScrollbackSave(sessionID, sess)
+	// Started the same way as a first start, setup, tmux and fork included
+	var quotaErr *session.QuotaExceededError
+	if err := h.startSession(sess, rows, cols, h.connActor(conn).Admin); errors.As(err, &quotaErr) {
+		h.sendToConn(conn, QuotaExceededMessage{Type: "quota_exceeded", SessionID: sessionID, Error: quotaErr})
 	}
+}
 
-	// Check for saved Claude Code session to resume (only resume the specific saved session)
-	savedSessionID := sess.GetLastClaudeSessionID()
-	if savedSessionID != "" {
-		claudeSession, err := claude.FindActiveSession(sess.Directory)
-		if err == nil && claudeSession != nil && claudeSession.SessionID == savedSessionID {
-			modified, err := time.Parse(time.RFC3339, claudeSession.Modified)
-			if err == nil && time.Since(modified) < 24*time.Hour {
-				log.Printf("[WS] Resuming saved Claude session %s on restart", savedSessionID)
-				err := sess.Resume(savedSessionID, rows, cols, outputCallback)
-				if err == nil {
-					return
-				}
-				log.Printf("[WS] Failed to resume saved Claude session on restart: %v", err)
-			}
-		}
+// broadcastOutput sends output to all subscribed connections
+func (h *Handler) broadcastOutput(sessionID string, data []byte) {
+	if _, ok := h.manager.Get(sessionID); !ok {
+		return // Output after the session was deleted
 	}
+	hb := h.getHub(sessionID)
+	hb.screenMu.Lock()
+	h.writeScreen(sessionID, data)
+	seq := hb.ring.Append(data)
+	hb.screenMu.Unlock()
+	h.schedulePermissionCheck(sessionID)
+	h.writeSinks(sessionID, data)
+	hb.notify(OutputEvent{Data: data, Seq: seq})
 
-	// Start normal shell
-	err := sess.Start(rows, cols, outputCallback)
-	if err != nil {
-		log.Printf("Failed to restart session %s: %v", sessionID, err)
-	}
-
-	// Start background task to detect Claude session
-	go h.detectClaudeSession(sessionID, sess)
-}
-
-// broadcastOutput sends output to all subscribed connections
-func (h *Handler) broadcastOutput(sessionID string, data []byte) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	defer h.checkBroadcast(sessionID, time.Now())
 
 	msg := OutputMessage{
 		Type:      "output",
 		SessionID: sessionID,
 		Data:      base64.StdEncoding.EncodeToString(data), // Base64 encode for safe transmission
+		Seq:       seq,
 	}
 
 	msgBytes, _ := json.Marshal(msg)
 
-	for conn, state := range h.connections {
-		if state.subscriptions[sessionID] {
-			state.writeMu.Lock()
-			conn.WriteMessage(websocket.TextMessage, msgBytes)
-			state.writeMu.Unlock()
+	hb.each(func(conn *websocket.Conn, state *connState) {
+		if err := state.sendOutput(sessionID, data, seq, msgBytes); err != nil {
+			// Closing makes the read loop exit and reap the connection
+			slog.Debug("Write failed, dropping connection", "err", err)
+			conn.Close()
 		}
+	})
+}
+
+// broadcast sends a message to all connections subscribed to a session
+func (h *Handler) broadcast(sessionID string, v any) {
+	defer h.checkBroadcast(sessionID, time.Now())
+
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return // No subscribers, or the session was deleted
 	}
+	msgBytes, _ := json.Marshal(v)
+	hb.each(func(conn *websocket.Conn, state *connState) {
+		if err := state.send(msgBytes); err != nil {
+			slog.Debug("Write failed, dropping connection", "err", err)
+			conn.Close()
+		}
+	})
 }
 
 // broadcastStatus sends status updates to all subscribed connections
 func (h *Handler) broadcastStatus(sessionID string, status session.Status) {
+	h.sendStatus(h.statusMessage(sessionID, status))
+}
+
+// refreshStatus resends the session's status after output, if the usage,
+// context or tool it shows changed since the last update. Changes of the
+// status itself are sent by the status change callback (watchStatus).
+func (h *Handler) refreshStatus(sessionID string, sess *session.Session) {
+	msg := h.statusMessage(sessionID, sess.GetStatus())
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	last, ok := h.sentStatus[sessionID]
+	h.mu.RUnlock()
+	if ok && (last.Status != msg.Status || sameUsage(last, msg)) {
+		return
+	}
+	h.sendStatus(msg)
+}
 
+// sameUsage reports whether two status updates show the same usage and tool
+func sameUsage(a, b StatusMessage) bool {
+	sameContext := (a.Context == nil) == (b.Context == nil) && (a.Context == nil || *a.Context == *b.Context)
+	return a.CostUSD == b.CostUSD && a.TotalTokens == b.TotalTokens && a.Model == b.Model &&
+		a.Tool == b.Tool && sameContext
+}
+
+// statusMessage builds the status update of a session, with its usage
+func (h *Handler) statusMessage(sessionID string, status session.Status) StatusMessage {
 	msg := StatusMessage{
 		Type:      "status",
 		SessionID: sessionID,
 		Status:    status,
 	}
+	if sess, ok := h.manager.Get(sessionID); ok {
+		if report := h.sessionUsage(sess); report != nil {
+			msg.CostUSD = report.CostUSD
+			msg.Model = report.Model
+			msg.InputTokens = report.InputTokens
+			msg.OutputTokens = report.OutputTokens
+			msg.TotalTokens = report.TotalTokens
+			msg.Context = sessionContext(sess, report.Context)
+			h.checkBudget(sess, report)
+		}
+		// Claude's own figures are exact when the statusline hook reports them
+		if sl := sess.GetStatusLine(); sl != nil {
+			if sl.CostUSD > 0 {
+				msg.CostUSD = sl.CostUSD
+			}
+			if sl.ContextTokens > 0 && sl.ContextWindow > 0 {
+				msg.Context = claude.NewContextUsage(sl.ContextTokens, sl.ContextWindow)
+			}
+		}
+		if status == session.StatusExecuting {
+			if state := sess.GetClaudeState(); state != nil {
+				msg.Tool = state.CurrentTool
+			}
+		}
+		if status == session.StatusError {
+			msg.Reason = sess.GetStatusReason()
+		}
+		msg.Detection = paneDetection(sess.GetMainPane(), status)
+		h.updateAnimation(sess, status)
+	}
+	return msg
+}
+
+// sendStatus sends a status update to the session's subscribers, status-only
+// clients and status observers
+func (h *Handler) sendStatus(msg StatusMessage) {
+	sessionID := msg.SessionID
+	h.mu.Lock()
+	if _, ok := h.manager.Get(sessionID); ok {
+		h.sentStatus[sessionID] = msg
+	}
+	h.mu.Unlock()
+
+	h.notifyStatus(msg)
 
 	msgBytes, _ := json.Marshal(msg)
+	send := func(conn *websocket.Conn, state *connState) {
+		if err := state.send(msgBytes); err != nil {
+			// Closing makes the read loop exit and reap the connection
+			slog.Debug("Write failed, dropping connection", "err", err)
+			conn.Close()
+		}
+	}
 
+	if hb := h.lookupHub(sessionID); hb != nil {
+		hb.each(send)
+	}
+
+	// Status-only clients follow every session without subscribing to it;
+	// one that subscribed anyway got it above
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 	for conn, state := range h.connections {
-		if state.subscriptions[sessionID] {
-			state.writeMu.Lock()
-			conn.WriteMessage(websocket.TextMessage, msgBytes)
-			state.writeMu.Unlock()
+		if state.statusOnly && !state.subscriptions[sessionID] {
+			send(conn, state)
 		}
 	}
 }
 
+// sessionContext corrects the context window read from the transcript for a
+// session started with the 1M context beta, which the transcript doesn't show
+func sessionContext(sess *session.Session, usage *claude.ContextUsage) *claude.ContextUsage {
+	if usage != nil && usage.Window < claude.LongContextWindow &&
+		strings.HasSuffix(sess.GetClaudeModel(), "[1m]") {
+		return claude.NewContextUsage(usage.Tokens, claude.LongContextWindow)
+	}
+	return usage
+}
+
 // HandleSessions returns the list of sessions (REST endpoint)
 func (h *Handler) HandleSessions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -488,10 +1247,76 @@ func (h *Handler) HandleSessions(w http.ResponseWriter, r *http.Request) {
 	// Update cwds for all running sessions
 	h.manager.UpdateAllSessionCwds()
 
-	sessions := h.manager.List()
+	// Optional filters: ?tag=backend&tag=api&status=waiting_input
+	// Sorting and pagination: ?sort=updated_at&order=desc&limit=20&offset=40
+	// Claude's state of each session: ?include=claude
+	query := r.URL.Query()
+	opts := session.ListOptions{
+		Tags: query["tag"],
+		Sort: query.Get("sort"),
+		Desc: query.Get("order") == "desc",
+	}
+	for _, status := range query["status"] {
+		opts.Statuses = append(opts.Statuses, session.Status(status))
+	}
+	if !session.ValidSortField(opts.Sort) {
+		http.Error(w, "Invalid sort field: "+opts.Sort, http.StatusBadRequest)
+		return
+	}
+	if order := query.Get("order"); order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "Invalid order: "+order, http.StatusBadRequest)
+		return
+	}
+	var err error
+	if opts.Limit, err = parseNonNegative(query.Get("limit")); err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if opts.Offset, err = parseNonNegative(query.Get("offset")); err != nil {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	includeClaude := false
+	for _, include := range query["include"] {
+		if include != "claude" {
+			http.Error(w, "Invalid include: "+include, http.StatusBadRequest)
+			return
+		}
+		includeClaude = true
+	}
+
+	sessions, total := h.manager.ListPage(opts)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if includeClaude {
+		json.NewEncoder(w).Encode(withClaudeStates(sessions))
+		return
+	}
 	json.NewEncoder(w).Encode(sessions)
 }
 
+// HandleMetadataSchema lists the known session metadata keys
+func (h *Handler) HandleMetadataSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"fields":           session.MetadataFields(),
+		"extension_prefix": session.MetadataExtensionPrefix,
+	})
+}
+
+// HandlePorts returns the port allocations of all sessions
+func (h *Handler) HandlePorts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.manager.PortMappings())
+}
+
 // HandleCreateSession creates a new session (REST endpoint)
 func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -499,19 +1324,34 @@ func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Name          string `json:"name"`
-		Directory     string `json:"directory"`
-		HexQ          *int   `json:"hex_q"`
-		HexR          *int   `json:"hex_r"`
-		SplitParentID string `json:"split_parent_id"`
-	}
+	var req CreateSessionRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := h.CreateSession(req, h.claim(r, req.Owner))
+	if err != nil {
+		if writeQuotaError(w, err) {
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
+// CreateSession creates a session from a validated request and tells
+// clients about it
+func (h *Handler) CreateSession(req CreateSessionRequest, claim session.Claim) (*session.Session, error) {
 	// If this is a split, get the current working directory from the parent session's process
 	if req.SplitParentID != "" {
 		if parentSess, ok := h.manager.Get(req.SplitParentID); ok {
@@ -529,10 +1369,9 @@ func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request) {
 		req.Directory = expandHome(req.Directory)
 	}
 
-	sess, err := h.manager.Create(req.Name, req.Directory)
+	sess, err := h.manager.Create(req.Name, req.Directory, claim)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
 	// Set hex position if provided
@@ -548,8 +1387,53 @@ func (h *Handler) HandleCreateSession(w http.ResponseWriter, r *http.Request) {
 		h.manager.UpdateSession(sess)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sess)
+	if req.StartupCommand != "" {
+		sess.SetStartupCommand(req.StartupCommand)
+		h.manager.UpdateSession(sess)
+	}
+
+	if req.Limits != nil {
+		sess.SetLimits(req.Limits)
+		h.manager.UpdateSession(sess)
+	}
+
+	if req.Sandbox != "" {
+		sess.SetSandbox(req.Sandbox)
+		h.manager.UpdateSession(sess)
+	}
+
+	if len(req.LogSinks) > 0 {
+		sess.SetLogSinks(req.LogSinks)
+		h.manager.UpdateSession(sess)
+	}
+
+	if req.Backend != "" {
+		sess.SetBackend(req.Backend)
+		h.manager.UpdateSession(sess)
+	}
+
+	if req.ClaudeModel != "" {
+		sess.SetClaudeModel(req.ClaudeModel)
+		h.manager.UpdateSession(sess)
+	}
+
+	if req.ClaudeOptions != nil {
+		sess.SetClaudeOptions(req.ClaudeOptions)
+		h.manager.UpdateSession(sess)
+	}
+
+	if req.Recording {
+		sess.EnableRecording()
+		h.manager.UpdateSession(sess)
+	}
+
+	if req.ScrollbackMB > 0 {
+		sess.SetScrollbackLimit(req.ScrollbackMB)
+		h.manager.UpdateSession(sess)
+	}
+
+	h.broadcastSessionList()
+	return sess, nil
 }
 
 // findGitRoot finds the git root directory by searching up the tree
@@ -569,6 +1453,18 @@ func findGitRoot(dir string) string {
 	}
 }
 
+// parseNonNegative parses an optional non-negative integer query parameter
+func parseNonNegative(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value: %s", value)
+	}
+	return n, nil
+}
+
 // expandHome expands ~ to the user's home directory
 func expandHome(path string) string {
 	if len(path) == 0 || path[0] != '~' {
@@ -586,19 +1482,10 @@ func expandHome(path string) string {
 
 // HandleSessionUpdate handles session updates (name, etc.)
 func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
-	// Extract session ID from path: /api/sessions/{id} or /api/sessions/{id}/name
-	path := r.URL.Path
-	parts := strings.Split(strings.TrimPrefix(path, "/api/sessions/"), "/")
-	if len(parts) < 1 || parts[0] == "" {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
-		return
-	}
-
-	sessionID := parts[0]
-	action := ""
-	if len(parts) > 1 {
-		action = parts[1]
-	}
+	// Routed as /sessions/{id} or /sessions/{id}/{rest...}, e.g. /sessions/{id}/name
+	sessionID := r.PathValue("id")
+	parts := append([]string{sessionID}, strings.Split(r.PathValue("rest"), "/")...)
+	action := parts[1]
 
 	sess, ok := h.manager.Get(sessionID)
 	if !ok {
@@ -608,9 +1495,7 @@ func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
 
 	// Handle DELETE for session itself (no action in path)
 	if action == "" && r.Method == http.MethodDelete {
-		// Save scrollback before deleting
-		h.manager.SaveScrollback(sess)
-		h.manager.Delete(sessionID)
+		h.deleteSession(sess)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 		return
@@ -624,13 +1509,355 @@ func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		state.Context = sessionContext(sess, state.Context)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+		return
+
+	case "transcript":
+		if len(parts) < 3 || parts[2] != "search" || r.Method != http.MethodGet {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			http.Error(w, "Missing q", http.StatusBadRequest)
+			return
+		}
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := parseNonNegative(v)
+			if err != nil {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		// Defaults to the Claude session this session last ran
+		claudeSessionID, ok := claudeSessionParam(w, r)
+		if !ok {
+			return
+		}
+		if claudeSessionID == "" {
+			claudeSessionID = sess.GetLastClaudeSessionID()
+		}
+		path, err := claude.FindTranscript(sess.Directory, claudeSessionID)
+		if err != nil {
+			http.Error(w, "Transcript not found", http.StatusNotFound)
+			return
+		}
+
+		matches, err := claude.SearchTranscript(path, query, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"query":   query,
+			"matches": matches,
+		})
+		return
+
+	case "budget":
+		h.handleSessionBudget(w, r, sess)
+
+	case "statusline":
+		h.handleSessionStatusLine(w, r, sess)
+
+	case "history":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Optional lower bound (RFC 3339)
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid since (expected RFC 3339)", http.StatusBadRequest)
+				return
+			}
+			since = t
+		}
+		history, err := sess.GetStatusHistory(since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"session_id":   sess.ID,
+			"transitions":  history,
+			"durations_ms": session.StatusDurations(history),
+		})
+		return
+
+	case "limits":
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sess.GetLimits())
+		case http.MethodPut:
+			// null removes the limits; changes apply from the next start
+			var limits *session.ResourceLimits
+			if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetLimits(limits); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sess.GetLimits())
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+
+	case "sandbox":
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			// "" runs on the host; changes apply from the next start
+			var req SandboxRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetSandbox(req.Sandbox); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"sandbox": sess.GetSandbox()})
+		return
+
+	case "model":
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			// "" is Claude's default; changes apply from the next start
+			var req ClaudeModelRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetClaudeModel(req.ClaudeModel); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"claude_model": sess.GetClaudeModel()})
+		return
+
+	case "claude-options":
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			// null removes the options; changes apply from the next start
+			var options *session.ClaudeOptions
+			if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetClaudeOptions(options); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sess.GetClaudeOptions())
+		return
+
+	case "depends-on":
+		h.handleSessionDependsOn(w, r, sess)
+		return
+
+	case "backend":
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			// "" uses the server default; changes apply from the next start
+			var req BackendRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetBackend(req.Backend); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		result := map[string]any{"backend": sess.GetBackend()}
+		if sess.GetBackend() == session.BackendTmux {
+			result["tmux_alive"] = sess.Reattachable()
+			result["attach"] = "tmux -L " + session.TmuxName(sess.ID, "main") + " attach"
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+
+	case "sinks":
+		h.handleSessionSinks(w, r, sess)
+		return
+
+	case "tree":
+		h.handleSessionTree(w, r, sess)
+		return
+
+	case "animation":
+		h.handleSessionAnimation(w, r, sess)
+		return
+
+	case "locale":
+		switch r.Method {
+		case http.MethodGet:
+			timezone, locale := sess.GetLocale()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"timezone": timezone,
+				"locale":   locale,
+			})
+
+		case http.MethodPut:
+			// Applies to panes started afterwards
+			var req LocaleRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetLocale(req.Timezone, req.Locale); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case "tools":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Every tool execution with its duration (defaults to the last Claude session)
+		claudeSessionID, ok := claudeSessionParam(w, r)
+		if !ok {
+			return
+		}
+		if claudeSessionID == "" {
+			claudeSessionID = sess.GetLastClaudeSessionID()
+		}
+		path, err := claude.FindTranscript(sess.Directory, claudeSessionID)
+		if err != nil {
+			http.Error(w, "Transcript not found", http.StatusNotFound)
+			return
+		}
+		tools, summary, err := claude.ToolTimeline(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"tools":   tools,
+			"summary": summary,
+		})
+		return
+
+	case "summary":
+		// Stored transcript summary; POST .../summary/recompute re-reads the transcript
+		recompute := len(parts) > 2 && parts[2] == "recompute"
+		if (recompute && r.Method != http.MethodPost) || (!recompute && r.Method != http.MethodGet) {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		summary, err := h.manager.TranscriptSummary(sess, recompute)
+		if err != nil {
+			http.Error(w, "Transcript not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(summary)
+		return
+
+	case "usage":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Token usage and cost per model (defaults to the last Claude session,
+		// served from the stored summary)
+		var report *claude.CostReport
+		claudeSessionID, ok := claudeSessionParam(w, r)
+		if !ok {
+			return
+		}
+		if claudeSessionID == "" {
+			summary, err := h.manager.TranscriptSummary(sess, false)
+			if err == nil {
+				report = summary.Cost
+			}
+		} else {
+			report, _ = claude.GetCostReport(sess.Directory, claudeSessionID)
+		}
+		if report == nil {
+			http.Error(w, "Transcript not found", http.StatusNotFound)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(state)
+		json.NewEncoder(w).Encode(report)
+		return
+
+	case "claude-layout":
+		// How Claude Code stores sessions for this directory (and why it's unsupported, if so)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(claude.DetectLayout(sess.Directory))
 		return
 
 	case "claude-session":
 		// Get available Claude Code session for auto-resume
 		claudeSession, err := claude.FindActiveSession(sess.Directory)
+		var unsupported *claude.UnsupportedLayoutError
+		if errors.As(err, &unsupported) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"available": false,
+				"layout":    unsupported.Info.Layout,
+				"error":     unsupported.Info.Reason,
+			})
+			return
+		}
 		if err != nil {
 			// No session found is not an error
 			w.Header().Set("Content-Type", "application/json")
@@ -670,9 +1897,7 @@ func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		var req struct {
-			Name string `json:"name"`
-		}
+		var req RenameRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -684,18 +1909,272 @@ func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
-	case "customize":
+	case "recording":
+		h.handleSessionRecording(w, r, sess)
+
+	case "macros":
+		h.handleSessionMacros(w, r, sess, parts[2:])
+
+	case "mcp":
+		h.handleSessionMCP(w, r, sess, parts[2:])
+
+	case "interrupt":
+		h.handleSessionInterrupt(w, r, sess)
+
+	case "permission":
+		h.handleSessionPermission(w, r, sess)
+
+	case "audit":
+		h.handleSessionAudit(w, r, sess)
+
+	case "narration":
+		h.handleSessionNarration(w, r, sess)
+
+	case "screen":
+		h.handleSessionScreen(w, r, sess)
+
+	case "scrollback":
+		h.handleSessionScrollback(w, r, sess, parts[2:])
+
+	case "metadata":
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sess.GetMetadata())
+
+		case http.MethodPut, http.MethodPatch:
+			// PUT replaces all metadata, PATCH merges (null deletes a key).
+			// Only admins may change the owner; a PUT without it keeps it.
+			var req map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			admin := h.manager.IsAdmin(r.Header.Get(session.AdminHeader))
+			if r.Method == http.MethodPut {
+				for key := range sess.GetMetadata() {
+					if _, ok := req[key]; !ok && (admin || key != session.OwnerKey) {
+						req[key] = nil
+					}
+				}
+			}
+			if err := sess.UpdateMetadata(req, admin); err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, session.ErrOwnerChange) {
+					status = http.StatusForbidden
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			h.manager.UpdateSession(sess)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sess.GetMetadata())
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case "export":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Stream a tar.gz with the session JSON, scrollback and Claude transcript
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"claudex-session-%s.tar.gz\"", sess.ID))
+		if err := sess.ExportBundle(w); err != nil {
+			// Headers are already sent, so all we can do is log
+			slog.Warn("Failed to export session", "session", sessionID, "err", err)
+		}
+
+	case "startup-command":
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req StartupCommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sess.SetStartupCommand(req.StartupCommand)
+		h.manager.UpdateSession(sess)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	case "services":
+		switch r.Method {
+		case http.MethodGet:
+			// Fresh check so the caller sees the current state
+			results := session.CheckServices(sess.GetRequiredServices())
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"required": sess.GetRequiredServices(),
+				"results":  results,
+			})
+
+		case http.MethodPut:
+			var req ServicesRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetRequiredServices(req.Services); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case "pane-roles":
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sess.GetPaneRoles())
+
+		case http.MethodPut:
+			// Body: {"pane_id": "role", ...}
+			var req map[string]session.PaneRole
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for paneID, role := range req {
+				if err := sess.SetPaneRole(paneID, role); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			h.manager.UpdateSession(sess)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sess.GetPaneRoles())
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case "run":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Route a command (test run, watch task, dev server) to its designated pane
+		var req RunRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Command == "" {
+			http.Error(w, "Missing command", http.StatusBadRequest)
+			return
+		}
+		if req.Role == session.RoleAgent {
+			http.Error(w, "Commands cannot be routed to the agent pane", http.StatusBadRequest)
+			return
+		}
+
+		paneID, err := sess.RolePaneID(req.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Start the helper pane with its output going to subscribers like any other pane's
+		if pane := sess.GetPane(paneID); pane == nil || !pane.IsRunning() {
+			admin := h.manager.IsAdmin(r.Header.Get(session.AdminHeader))
+			if err := h.startPane(sess, paneID, 24, 80, admin); err != nil {
+				if !writeQuotaError(w, err) {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+		}
+		h.manager.UpdateSession(sess)
+
+		var policy *session.PolicyResult
+		event := audit.Event{Kind: audit.KindRun, Actor: h.requestActor(r), Role: string(req.Role)}
+		err = h.writePaneInput(sess, paneID, req.Command+"\r", event, func(v any) {
+			if msg, ok := v.(PolicyMessage); ok {
+				policy = msg.Result
+			}
+		})
+		if err != nil {
+			http.Error(w, err.Error(), inputErrorStatus(err))
+			return
+		}
+		if policy != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]any{"status": "held", "pane_id": paneID, "policy": policy})
+			return
+		}
+		slog.Info("Routed command to role pane", "session", sessionID, "role", req.Role, "pane", paneID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "pane_id": paneID})
+
+	case "tags":
 		if r.Method != http.MethodPut {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req struct {
-			Name           string `json:"name,omitempty"`
-			RobotModel     string `json:"robot_model,omitempty"`
-			RobotColor     string `json:"robot_color,omitempty"`
-			RobotAccessory string `json:"robot_accessory,omitempty"`
+		var req TagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sess.SetTags(req.Tags)
+		h.manager.UpdateSession(sess)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "tags": sess.GetTags()})
+
+	case "policy":
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sess.GetInputPolicy())
+
+		case http.MethodPut:
+			var policy *session.InputPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := sess.SetInputPolicy(policy); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.manager.UpdateSession(sess)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+
+	case "customize":
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
+
+		var req CustomizeRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -720,6 +2199,23 @@ func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
+	case "worktree":
+		switch {
+		case len(parts) < 3:
+			http.Error(w, "Not found", http.StatusNotFound)
+		case parts[2] == "status":
+			h.handleWorktreeStatus(w, r, sess)
+		case parts[2] == "stash":
+			h.handleWorktreeStash(w, r, sess)
+		case parts[2] == "unstash":
+			h.handleWorktreeUnstash(w, r, sess)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+
+	case "pull-request":
+		h.handlePullRequest(w, r, sess)
+
 	case "merge":
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -739,17 +2235,36 @@ func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		var req MergeRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Into = h.mergeTarget(parent.Directory, req.Into)
+		if !branchExists(parent.Directory, req.Into) {
+			http.Error(w, fmt.Sprintf("No branch %q to merge into", req.Into), http.StatusBadRequest)
+			return
+		}
+
 		// Merge the experiment worktree into parent
-		if err := h.mergeExperimentWorktree(sess, parent); err != nil {
+		if err := h.mergeExperimentWorktree(r.Context(), sess, parent, req); err != nil {
+			if writeMergeConflict(w, err) || writeTestError(w, err) {
+				return
+			}
 			http.Error(w, "Merge failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// Delete the experiment session
-		h.manager.Delete(sessionID)
+		deleted := h.retireExperiment(sess, req.Into, req.KeepSession)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "into": req.Into, "deleted": deleted})
 
 	case "discard":
 		if r.Method != http.MethodPost {
@@ -763,30 +2278,53 @@ func (h *Handler) HandleSessionUpdate(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		var req DiscardRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		// Discard the experiment worktree
 		if err := h.discardExperimentWorktree(sess); err != nil {
 			http.Error(w, "Discard failed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// Delete the experiment session
-		h.manager.Delete(sessionID)
+		deleted := h.retireExperiment(sess, "", req.KeepSession)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "deleted": deleted})
 
 	default:
 		http.Error(w, "Unknown action", http.StatusBadRequest)
 	}
 }
 
-// mergeExperimentWorktree merges an experiment worktree into its parent
-func (h *Handler) mergeExperimentWorktree(experiment, parent *session.Session) error {
+// mergeExperimentWorktree merges an experiment worktree into the req.Into
+// branch of its parent's repository, after its tests pass if req asks
+func (h *Handler) mergeExperimentWorktree(ctx context.Context, experiment, parent *session.Session, req MergeRequest) error {
 	// Git operations in the experiment directory
 	expDir := experiment.Directory
+	parentDir := parent.Directory
+
+	// Refuse a merge that would stop half-way on conflicts
+	cmd := exec.Command("git", "branch", "--show-current")
+	cmd.Dir = expDir
+	branchOut, _ := cmd.Output()
+	branch := strings.TrimSpace(string(branchOut))
+	if err := checkMerge(parentDir, expDir, branch, req.Into, req.Strategy); err != nil {
+		return err
+	}
+	if req.RequireTests {
+		if err := h.runMergeTests(ctx, experiment.ID, parentDir, expDir); err != nil {
+			return err
+		}
+	}
 
 	// Add and commit any pending changes
-	cmd := exec.Command("git", "add", "-A")
+	cmd = exec.Command("git", "add", "-A")
 	cmd.Dir = expDir
 	cmd.Run() // Ignore error if nothing to add
 
@@ -794,39 +2332,16 @@ func (h *Handler) mergeExperimentWorktree(experiment, parent *session.Session) e
 	cmd.Dir = expDir
 	if cmd.Run() != nil {
 		// There are staged changes, commit them
-		cmd = exec.Command("git", "commit", "-m", "WIP: Auto-commit before merge")
+		cmd = exec.Command("git", "commit", "-m", req.pendingMessage())
 		cmd.Dir = expDir
 		if _, err := cmd.CombinedOutput(); err != nil {
 			// Ignore commit errors (might be nothing to commit)
 		}
 	}
 
-	// Get current branch name
-	cmd = exec.Command("git", "branch", "--show-current")
-	cmd.Dir = expDir
-	branchOut, _ := cmd.Output()
-	branch := strings.TrimSpace(string(branchOut))
-
-	// Go to parent directory and merge
-	parentDir := parent.Directory
-
-	// Checkout master/main in parent
-	cmd = exec.Command("git", "checkout", "master")
-	cmd.Dir = parentDir
-	if out, err := cmd.CombinedOutput(); err != nil {
-		// Try main if master fails
-		cmd = exec.Command("git", "checkout", "main")
-		cmd.Dir = parentDir
-		if out2, err2 := cmd.CombinedOutput(); err2 != nil {
-			return fmt.Errorf("checkout failed: %s / %s", out, out2)
-		}
-	}
-
-	// Merge the experiment branch
-	cmd = exec.Command("git", "merge", branch, "--no-edit")
-	cmd.Dir = parentDir
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("merge failed: %s", out)
+	// Merge the experiment branch without switching the parent's checkout
+	if err := mergeBranch(parentDir, branch, req.Into, req.Strategy, req.Message); err != nil {
+		return err
 	}
 
 	// Remove the worktree
@@ -834,8 +2349,9 @@ func (h *Handler) mergeExperimentWorktree(experiment, parent *session.Session) e
 	cmd.Dir = parentDir
 	cmd.Run() // Best effort
 
-	// Delete the branch
-	cmd = exec.Command("git", "branch", "-d", branch)
+	// Delete the branch (-D: it is merged into the target, which need not
+	// be checked out)
+	cmd = exec.Command("git", "branch", "-D", branch)
 	cmd.Dir = parentDir
 	cmd.Run() // Best effort
 
@@ -906,6 +2422,42 @@ func (h *Handler) HandleClientState(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// maxImportSize bounds the size of an uploaded session bundle
+const maxImportSize = 512 << 20
+
+// HandleImportSession recreates a session from a bundle produced by
+// /api/sessions/{id}/export. Query: directory (override), relink=true to
+// install the bundled transcript for resume, keep (comma-separated
+// session.ImportFields to take from the bundle rather than drop).
+func (h *Handler) HandleImportSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts := session.ImportOptions{
+		Directory: expandHome(r.URL.Query().Get("directory")),
+		Relink:    r.URL.Query().Get("relink") == "true",
+		Claim:     h.claim(r, ""),
+	}
+	if keep := r.URL.Query().Get("keep"); keep != "" {
+		opts.Keep = strings.Split(keep, ",")
+	}
+	sess, err := h.manager.ImportBundle(http.MaxBytesReader(w, r.Body, maxImportSize), opts)
+	if err != nil {
+		if !writeQuotaError(w, err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	slog.Info("Imported session", "session", sess.ID, "name", sess.Name)
+
+	h.broadcastSessionList()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess)
+}
+
 // HandleCreateExperiment creates a new experiment (git worktree) from a session
 func (h *Handler) HandleCreateExperiment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -913,11 +2465,7 @@ func (h *Handler) HandleCreateExperiment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var req struct {
-		ParentID   string   `json:"parent_id"`
-		BranchName string   `json:"branch_name"`
-		CopyFiles  []string `json:"copy_files"`
-	}
+	var req CreateExperimentRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -931,12 +2479,33 @@ func (h *Handler) HandleCreateExperiment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if req.ForkContext && parent.GetLastClaudeSessionID() == "" {
+		http.Error(w, "Parent session has no Claude conversation to fork", http.StatusBadRequest)
+		return
+	}
+
+	// Check limits before touching git so a rejected request leaves no worktree
+	claim := h.claim(r, req.Owner)
+	if claim.Owner == "" {
+		claim.Owner, _ = parent.MetadataString(session.OwnerKey)
+	}
+	claim.Worktree = true
+	if err := h.manager.CheckQuota(claim); err != nil {
+		writeQuotaError(w, err)
+		return
+	}
+
 	// Find git root directory (search up the tree)
 	gitRoot := findGitRoot(parent.Directory)
 	if gitRoot == "" {
 		http.Error(w, "Parent directory is not a git repository", http.StatusBadRequest)
 		return
 	}
+	project, err := readProjectConfig(gitRoot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Get current branch name
 	cmd := exec.Command("git", "branch", "--show-current")
@@ -954,50 +2523,57 @@ func (h *Handler) HandleCreateExperiment(w http.ResponseWriter, r *http.Request)
 		branchName = fmt.Sprintf("exp-%s-%d", currentBranch, time.Now().Unix())
 	}
 
-	// Create worktree path (sibling to git root)
-	worktreePath := filepath.Join(filepath.Dir(gitRoot), branchName)
-
-	// Create the git worktree
-	cmd = exec.Command("git", "worktree", "add", "-b", branchName, worktreePath)
-	cmd.Dir = gitRoot
-	if output, err := cmd.CombinedOutput(); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create worktree: %s", string(output)), http.StatusInternalServerError)
+	worktreePath, err := h.addWorktree(gitRoot, branchName, project, req.CopyFiles, req.LinkFiles)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Detect and copy config files from git root
-	configFiles := []string{".env", "config.json", "config.local.json", ".env.local"}
-	for _, file := range configFiles {
-		srcPath := filepath.Join(gitRoot, file)
-		if _, err := os.Stat(srcPath); err == nil {
-			dstPath := filepath.Join(worktreePath, file)
-			if data, err := os.ReadFile(srcPath); err == nil {
-				os.WriteFile(dstPath, data, 0644)
-			}
-		}
-	}
-
-	// Copy any additional requested files
-	for _, file := range req.CopyFiles {
-		srcPath := filepath.Join(gitRoot, file)
-		if _, err := os.Stat(srcPath); err == nil {
-			dstPath := filepath.Join(worktreePath, file)
-			if data, err := os.ReadFile(srcPath); err == nil {
-				os.MkdirAll(filepath.Dir(dstPath), 0755)
-				os.WriteFile(dstPath, data, 0644)
-			}
-		}
-	}
-
 	// Create the experiment session
-	sess, err := h.manager.CreateExperiment(req.ParentID, branchName, worktreePath)
+	sess, err := h.manager.CreateExperiment(req.ParentID, branchName, worktreePath, claim)
 	if err != nil {
 		// Cleanup worktree on failure
 		exec.Command("git", "worktree", "remove", worktreePath).Run()
+		if writeQuotaError(w, err) {
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if req.ForkContext {
+		if err := h.manager.ForkClaudeContext(sess, parent); err != nil {
+			// Asked for the parent's context, so don't leave a cold experiment behind
+			h.manager.Delete(sess.ID)
+			removeWorktree(gitRoot, worktreePath, branchName)
+			http.Error(w, "Failed to fork the parent's Claude context: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	h.beginSetup(sess.ID, worktreePath, project.Setup, nil)
+
+	h.broadcastSessionList()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(sess)
 }
+
+// addWorktree creates a git worktree on a new branch next to the repository
+// and copies or links the project's files (plus copyFiles and linkFiles)
+// into it. The worktree is recorded so pruning may remove it later. It
+// returns the worktree's path.
+func (h *Handler) addWorktree(gitRoot, branchName string, project *ProjectConfig, copyFiles, linkFiles []string) (string, error) {
+	// Create worktree path (sibling to git root)
+	worktreePath := filepath.Join(filepath.Dir(gitRoot), branchName)
+
+	// Create the git worktree
+	cmd := exec.Command("git", "worktree", "add", "-b", branchName, worktreePath)
+	cmd.Dir = gitRoot
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to create worktree: %s", output)
+	}
+	h.manager.RecordWorktree(gitRoot, worktreePath, branchName)
+
+	project.prepareWorktree(gitRoot, worktreePath, copyFiles, linkFiles)
+	return worktreePath, nil
+}
@@ -0,0 +1,114 @@
+package ws
+
+import (
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"claudex/session"
+	"claudex/vt"
+)
+
+// hub holds what a session's broadcasts need: its subscribers, the replay
+// buffer and the emulated screen. Each session has its own lock, so output
+// from one session never waits on another's subscribers or on the handler.
+// Messages reach subscribers through their connection's send queue.
+type hub struct {
+	mu          sync.RWMutex
+	subscribers map[*websocket.Conn]*connState
+	ring        *outputRing  // Recent output for resumable subscriptions
+	screen      *vt.Terminal // Emulated screen for subscriber snapshots (nil until first needed)
+	screenMu    sync.Mutex   // Held while output goes to the screen and gets its sequence number
+	observers   map[*OutputObserver]bool
+
+	controller      *websocket.Conn   // Subscriber that took control with control_request (nil: anyone may type)
+	controlRequests []*websocket.Conn // Subscribers waiting for control, oldest first
+
+	permission      *session.PermissionPrompt // Permission prompt Claude is showing (nil: none)
+	permissionCheck bool                      // A check of the screen for one is scheduled
+
+	settingUp   bool                   // The experiment's setup commands are running
+	setupOutput []CommandOutputMessage // Setup output replayed to new subscribers
+}
+
+// getHub returns the hub of a session, creating it if needed
+func (h *Handler) getHub(sessionID string) *hub {
+	h.hubsMu.RLock()
+	hb := h.hubs[sessionID]
+	h.hubsMu.RUnlock()
+	if hb != nil {
+		return hb
+	}
+
+	h.hubsMu.Lock()
+	defer h.hubsMu.Unlock()
+	if hb = h.hubs[sessionID]; hb == nil {
+		hb = &hub{
+			subscribers: make(map[*websocket.Conn]*connState),
+			ring:        newOutputRing(),
+			observers:   make(map[*OutputObserver]bool),
+		}
+		h.hubs[sessionID] = hb
+	}
+	return hb
+}
+
+// lookupHub returns the hub of a session, or nil if it has none yet
+func (h *Handler) lookupHub(sessionID string) *hub {
+	h.hubsMu.RLock()
+	defer h.hubsMu.RUnlock()
+	return h.hubs[sessionID]
+}
+
+// dropHub forgets a deleted session's subscribers, replay buffer, screen
+// and rate limits, and ends its observers
+func (h *Handler) dropHub(sessionID string) {
+	h.hubsMu.Lock()
+	hb := h.hubs[sessionID]
+	delete(h.hubs, sessionID)
+	h.hubsMu.Unlock()
+	h.limiter.forget(sessionID)
+
+	if hb != nil {
+		hb.mu.Lock()
+		defer hb.mu.Unlock()
+		for o := range hb.observers {
+			delete(hb.observers, o)
+			close(o.events)
+		}
+	}
+}
+
+// subscribe adds a connection to the session's subscribers
+func (h *Handler) subscribe(sessionID string, conn *websocket.Conn, state *connState) {
+	hb := h.getHub(sessionID)
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.subscribers[conn] = state
+}
+
+// unsubscribe removes a connection from the session's subscribers, passing
+// on control if it held it
+func (h *Handler) unsubscribe(sessionID string, conn *websocket.Conn) {
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return
+	}
+	hb.mu.Lock()
+	event, changed := hb.leaveControl(conn)
+	delete(hb.subscribers, conn)
+	msg := hb.controlMessage(sessionID, event, conn)
+	hb.mu.Unlock()
+	if changed {
+		h.broadcast(sessionID, msg)
+	}
+}
+
+// each calls fn for every subscriber of the hub
+func (hb *hub) each(fn func(conn *websocket.Conn, state *connState)) {
+	hb.mu.RLock()
+	defer hb.mu.RUnlock()
+	for conn, state := range hb.subscribers {
+		fn(conn, state)
+	}
+}
@@ -0,0 +1,190 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// Control events, reported in ControlMessage.Event
+const (
+	ControlState     = "state"     // Current holder, sent to a new subscriber
+	ControlGranted   = "granted"   // Holder changed: taken while free, handed over or passed on after a release
+	ControlRequested = "requested" // A subscriber asked the holder for control
+	ControlStolen    = "stolen"    // A subscriber took control from the holder
+	ControlReleased  = "released"  // Nobody holds control any more
+	ControlDenied    = "denied"    // Input refused because another connection holds control (sent to that client only)
+)
+
+// ControlMessage tells a session's subscribers which connection may type
+// into it. Connections are named by the ID in their hello message.
+type ControlMessage struct {
+	Type       string   `json:"type"`
+	SessionID  string   `json:"session_id"`
+	Event      string   `json:"event"`
+	Holder     string   `json:"holder,omitempty"`      // Connection holding control ("" if free)
+	HolderUser string   `json:"holder_user,omitempty"` // User of that connection, if known
+	By         string   `json:"by,omitempty"`          // Connection that caused the event
+	Requests   []string `json:"requests,omitempty"`    // Connections waiting for control, oldest first
+}
+
+// ControlGrantData is the body of control_grant: who to hand control to
+// (default: the oldest request)
+type ControlGrantData struct {
+	To string `json:"to,omitempty"`
+}
+
+// controlMessage describes the hub's control state (caller must hold hb.mu)
+func (hb *hub) controlMessage(sessionID, event string, by *websocket.Conn) ControlMessage {
+	msg := ControlMessage{Type: "control", SessionID: sessionID, Event: event}
+	if state, ok := hb.subscribers[hb.controller]; ok {
+		msg.Holder = state.actor.Connection
+		msg.HolderUser = state.actor.User
+	}
+	if state, ok := hb.subscribers[by]; ok {
+		msg.By = state.actor.Connection
+	}
+	for _, conn := range hb.controlRequests {
+		if state, ok := hb.subscribers[conn]; ok {
+			msg.Requests = append(msg.Requests, state.actor.Connection)
+		}
+	}
+	return msg
+}
+
+// passControl hands control to the oldest request, or frees it, and names
+// the resulting event (caller must hold hb.mu)
+func (hb *hub) passControl() string {
+	if len(hb.controlRequests) == 0 {
+		hb.controller = nil
+		return ControlReleased
+	}
+	hb.controller = hb.controlRequests[0]
+	hb.controlRequests = hb.controlRequests[1:]
+	return ControlGranted
+}
+
+// leaveControl drops a connection that unsubscribed from the holder and
+// the request queue, reporting whether the holder changed (caller must hold
+// hb.mu)
+func (hb *hub) leaveControl(conn *websocket.Conn) (event string, changed bool) {
+	hb.controlRequests = slices.DeleteFunc(hb.controlRequests, func(c *websocket.Conn) bool { return c == conn })
+	if hb.controller != conn {
+		return "", false
+	}
+	return hb.passControl(), true
+}
+
+// checkControl reports whether a connection may type into a session: the
+// lock is opt-in, so anyone may while no subscriber has taken control with
+// control_request, and only the holder may once one has
+func (h *Handler) checkControl(conn *websocket.Conn, sessionID string) bool {
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return true
+	}
+	hb.mu.RLock()
+	if hb.controller == nil || hb.controller == conn {
+		hb.mu.RUnlock()
+		return true
+	}
+	msg := hb.controlMessage(sessionID, ControlDenied, conn)
+	hb.mu.RUnlock()
+	h.sendToConn(conn, msg)
+	return false
+}
+
+// controlHeld reports whether a subscriber holds control of a session, which
+// keeps input from other sources (REST, gRPC, macros, dependencies) out
+func (h *Handler) controlHeld(sessionID string) bool {
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return false
+	}
+	hb.mu.RLock()
+	defer hb.mu.RUnlock()
+	return hb.controller != nil
+}
+
+// sendControlState tells a new subscriber who holds control, if anyone
+func (h *Handler) sendControlState(conn *websocket.Conn, sessionID string) {
+	hb := h.getHub(sessionID)
+	hb.mu.RLock()
+	held := hb.controller != nil
+	msg := hb.controlMessage(sessionID, ControlState, nil)
+	hb.mu.RUnlock()
+	if held {
+		h.sendToConn(conn, msg)
+	}
+}
+
+// handleControl processes control_request, control_grant, control_steal and
+// control_release from a subscriber of the session
+func (h *Handler) handleControl(conn *websocket.Conn, msg Message) {
+	hb := h.getHub(msg.SessionID)
+	hb.mu.Lock()
+	if _, subscribed := hb.subscribers[conn]; !subscribed {
+		hb.mu.Unlock()
+		slog.Debug("Ignoring control message from non-subscriber", "type", msg.Type, "session", msg.SessionID)
+		return
+	}
+
+	event := ""
+	switch msg.Type {
+	case "control_request":
+		switch {
+		case hb.controller == nil:
+			hb.controller = conn
+			event = ControlGranted
+		case hb.controller != conn && !slices.Contains(hb.controlRequests, conn):
+			hb.controlRequests = append(hb.controlRequests, conn)
+			event = ControlRequested
+		}
+
+	case "control_grant":
+		if hb.controller != conn {
+			break
+		}
+		var grant ControlGrantData
+		if len(msg.Data) > 0 {
+			json.Unmarshal(msg.Data, &grant)
+		}
+		if grant.To == "" {
+			if len(hb.controlRequests) > 0 {
+				event = hb.passControl()
+			}
+			break
+		}
+		for c, state := range hb.subscribers {
+			if state.actor.Connection == grant.To && c != conn {
+				hb.controller = c
+				hb.controlRequests = slices.DeleteFunc(hb.controlRequests, func(r *websocket.Conn) bool { return r == c })
+				event = ControlGranted
+				break
+			}
+		}
+
+	case "control_steal":
+		if hb.controller != conn {
+			hb.controller = conn
+			hb.controlRequests = slices.DeleteFunc(hb.controlRequests, func(c *websocket.Conn) bool { return c == conn })
+			event = ControlStolen
+		}
+
+	case "control_release":
+		if hb.controller == conn {
+			event = hb.passControl()
+		}
+	}
+
+	if event == "" {
+		hb.mu.Unlock()
+		return
+	}
+	out := hb.controlMessage(msg.SessionID, event, conn)
+	hb.mu.Unlock()
+	slog.Info("Input control changed", "session", msg.SessionID, "event", event, "holder", out.Holder)
+	h.broadcast(msg.SessionID, out)
+}
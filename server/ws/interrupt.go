@@ -0,0 +1,96 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"claudex/audit"
+	"claudex/notify"
+	"claudex/session"
+)
+
+const (
+	// interruptSettle is how long Claude gets to stop before the follow-up is typed
+	interruptSettle = 3 * time.Second
+	// submitDelay separates a typed prompt from the Enter that submits it
+	submitDelay = 100 * time.Millisecond
+)
+
+// handleSessionInterrupt sends Escape to the running Claude turn, the same
+// as pressing it in the terminal, and optionally types a follow-up
+// instruction once Claude has stopped. The process keeps running; the
+// response doesn't wait for the follow-up.
+func (h *Handler) handleSessionInterrupt(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req InterruptRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if sess.RunningPanes() == 0 {
+		http.Error(w, "Session is not running", http.StatusConflict)
+		return
+	}
+
+	before := sess.GetStatus()
+	event := audit.Event{Kind: audit.KindInterrupt, Actor: h.requestActor(r)}
+	if err := h.writePaneInput(sess, "", "\x1b", event, func(any) {}); err != nil {
+		http.Error(w, err.Error(), inputErrorStatus(err))
+		return
+	}
+	slog.Info("Interrupted session", "session", sess.ID, "was", before)
+
+	if req.FollowUp != "" {
+		go func() {
+			// Typing while Claude is still winding down would be swallowed
+			ctx, cancel := context.WithTimeout(context.Background(), interruptSettle)
+			h.waitForStatus(ctx, sess, func(status session.Status) bool { return !isBusy(status) })
+			cancel()
+			if err := h.typePrompt(sess, req.FollowUp, event); err != nil {
+				slog.Warn("Failed to send interrupt follow-up", "session", sess.ID, "err", err)
+			}
+		}()
+	}
+
+	e := notify.NewEvent(notify.EventInterrupted, sess.ID, sess.Name,
+		fmt.Sprintf("%s was interrupted while %s", sess.Name, before))
+	e.Data["status"] = string(before)
+	if req.FollowUp != "" {
+		e.Data["follow_up"] = req.FollowUp
+	}
+	h.publishEvent(e)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":         "ok",
+		"interrupted":    before,
+		"follow_up_sent": req.FollowUp != "", // Typed once Claude stops, or after interruptSettle
+	})
+}
+
+// typePrompt types a prompt into the session's main pane and submits it,
+// through the checks of writeInput
+func (h *Handler) typePrompt(sess *session.Session, prompt string, event audit.Event) error {
+	if err := h.writePaneInput(sess, "", prompt, event, func(any) {}); err != nil {
+		return err
+	}
+	// Submit separately so the text isn't taken as a paste that swallows the newline
+	time.Sleep(submitDelay)
+	return h.writePaneInput(sess, "", "\r", event, func(any) {})
+}
+
+// isBusy reports whether Claude is in the middle of a turn
+func isBusy(status session.Status) bool {
+	return status == session.StatusThinking || status == session.StatusExecuting
+}
@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"claudex/logsink"
+	"claudex/session"
+)
+
+// SetLogSinks sets the router that copies session output to external log sinks
+func (h *Handler) SetLogSinks(sinks *logsink.Router) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sinks = sinks
+}
+
+// writeSinks copies a chunk of broadcast output to the log sinks
+func (h *Handler) writeSinks(sessionID string, data []byte) {
+	h.mu.RLock()
+	sinks := h.sinks
+	h.mu.RUnlock()
+	if sinks == nil {
+		return
+	}
+
+	name := sessionID
+	if sess, ok := h.manager.Get(sessionID); ok {
+		name = sess.Name
+	}
+	sinks.Write(sessionID, name, data)
+}
+
+// openSessionSinks opens the session's own sinks before its PTY starts
+func (h *Handler) openSessionSinks(sess *session.Session) {
+	h.mu.RLock()
+	sinks := h.sinks
+	h.mu.RUnlock()
+	if sinks == nil {
+		return
+	}
+	if err := sinks.SetSessionSinks(sess.ID, sess.GetLogSinks()); err != nil {
+		slog.Warn("Cannot configure log sinks", "session", sess.ID, "err", err)
+	}
+}
+
+// closeSessionSinks closes a deleted session's sinks
+func (h *Handler) closeSessionSinks(sessionID string) {
+	h.mu.RLock()
+	sinks := h.sinks
+	h.mu.RUnlock()
+	if sinks != nil {
+		sinks.RemoveSession(sessionID)
+	}
+}
+
+// handleSessionSinks reads or replaces the session's own log sinks
+func (h *Handler) handleSessionSinks(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var sinks []logsink.Config
+		if err := json.NewDecoder(r.Body).Decode(&sinks); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := sess.SetLogSinks(sinks); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.manager.UpdateSession(sess)
+		h.openSessionSinks(sess)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sess.GetLogSinks())
+}
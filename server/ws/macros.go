@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"claudex/audit"
+	"claudex/session"
+)
+
+// handleSessionMacros manages a session's input macros:
+//
+//	GET    /api/sessions/{id}/macros              list macros
+//	POST   /api/sessions/{id}/macros/record       start recording {"name": "..."}
+//	POST   /api/sessions/{id}/macros/stop         stop recording and save
+//	POST   /api/sessions/{id}/macros/cancel       cancel the macro being played
+//	PUT    /api/sessions/{id}/macros/{name}       define a macro {"steps": [...]}
+//	DELETE /api/sessions/{id}/macros/{name}       delete a macro
+//	POST   /api/sessions/{id}/macros/{name}/play  replay a macro
+func (h *Handler) handleSessionMacros(w http.ResponseWriter, r *http.Request, sess *session.Session, parts []string) {
+	name := ""
+	if len(parts) > 0 {
+		name = parts[0]
+	}
+	play := len(parts) > 1 && parts[1] == "play"
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"macros":    sess.GetMacros(),
+			"recording": sess.RecordingMacro(),
+		})
+
+	case name == "record" && r.Method == http.MethodPost:
+		var req MacroRecordRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := sess.StartMacroRecording(req.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		slog.Info("Recording macro", "session", sess.ID, "macro", req.Name)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "recording", "name": req.Name})
+
+	case name == "stop" && r.Method == http.MethodPost:
+		macro, err := sess.StopMacroRecording()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.manager.UpdateSession(sess)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(macro)
+
+	case name == "cancel" && r.Method == http.MethodPost:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"cancelled": sess.CancelMacro()})
+
+	case play && r.Method == http.MethodPost:
+		macro, err := sess.PlayMacro(name, h.macroWriter(sess, h.requestActor(r)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":      "playing",
+			"duration_ms": macro.Duration().Milliseconds(),
+		})
+
+	case name != "" && !play && r.Method == http.MethodPut:
+		var macro session.Macro
+		if err := json.NewDecoder(r.Body).Decode(&macro); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		macro.Name = name
+		if err := sess.SetMacro(&macro); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.manager.UpdateSession(sess)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(macro)
+
+	case name != "" && !play && r.Method == http.MethodDelete:
+		if !sess.DeleteMacro(name) {
+			http.Error(w, "Macro not found", http.StatusNotFound)
+			return
+		}
+		h.manager.UpdateSession(sess)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// macroWriter types macro steps for actor through the checks of writeInput,
+// so replayed input is subject to the same policy as typed input and lands
+// in the audit log. A step the policy holds back stops the macro.
+func (h *Handler) macroWriter(sess *session.Session, actor audit.Actor) func(data string) error {
+	event := audit.Event{Kind: audit.KindMacro, Actor: actor}
+	return func(data string) error {
+		var held *session.PolicyResult
+		err := h.writePaneInput(sess, "", data, event, func(v any) {
+			if msg, ok := v.(PolicyMessage); ok {
+				held = msg.Result
+			}
+		})
+		if err == nil && held != nil {
+			err = fmt.Errorf("command policy: %s", held.Decision)
+		}
+		return err
+	}
+}
@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"claudex/claude"
+	"claudex/session"
+)
+
+// handleSessionMCP manages the MCP servers Claude starts in the session's
+// directory, editing the config file of each server's scope:
+//
+//	GET    /api/sessions/{id}/mcp                 list servers from every scope
+//	PUT    /api/sessions/{id}/mcp/{name}          add or replace a server {"scope": "project", "command": "..."}
+//	DELETE /api/sessions/{id}/mcp/{name}?scope=   remove a server (from every scope without ?scope)
+//
+// Claude reads them when it starts, so changes apply from the next start.
+func (h *Handler) handleSessionMCP(w http.ResponseWriter, r *http.Request, sess *session.Session, parts []string) {
+	name := ""
+	if len(parts) > 0 {
+		name = parts[0]
+	}
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		servers, err := claude.ListMCPServers(sess.Directory)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(servers)
+
+	case name != "" && r.Method == http.MethodPut:
+		var server claude.MCPServer
+		if err := json.NewDecoder(r.Body).Decode(&server); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		server.Name = name
+		if server.Scope == "" {
+			server.Scope = claude.MCPScopeLocal
+		}
+		if err := server.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := claude.AddMCPServer(session.ClaudeBinary(), sess.Directory, server); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Added MCP server", "session", sess.ID, "server", name, "scope", server.Scope)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	case name != "" && r.Method == http.MethodDelete:
+		scope := r.URL.Query().Get("scope")
+		if err := claude.RemoveMCPServer(session.ClaudeBinary(), sess.Directory, name, scope); err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, claude.ErrMCPServerNotFound):
+				status = http.StatusNotFound
+			case scope != "" && !claude.ValidMCPScope(scope):
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		slog.Info("Removed MCP server", "session", sess.ID, "server", name, "scope", scope)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
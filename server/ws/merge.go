@@ -0,0 +1,326 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// MergeStrategy is how a branch's changes land on the target branch
+type MergeStrategy string
+
+const (
+	MergeCommit      MergeStrategy = "merge-commit" // A merge commit, even when a fast-forward would do
+	MergeSquash      MergeStrategy = "squash"       // A single commit with all the branch's changes
+	MergeFastForward MergeStrategy = "ff-only"      // Move the target to the branch; fail if it has diverged
+)
+
+// ErrNotFastForward is returned by ff-only merges when the target branch has
+// commits the merged branch lacks
+var ErrNotFastForward = errors.New("not a fast-forward: the target branch has diverged")
+
+// MergePreview is the outcome of a dry-run merge of a branch into another
+type MergePreview struct {
+	Branch      string   `json:"branch"`
+	Into        string   `json:"into"`
+	Clean       bool     `json:"clean"`
+	Conflicts   []string `json:"conflicts"`    // Files the merge would leave conflicted
+	FastForward bool     `json:"fast_forward"` // Into has nothing the branch lacks, so ff-only works
+}
+
+// MergeConflictError reports the files that keep a branch from merging
+type MergeConflictError struct {
+	Branch string   `json:"branch"`
+	Into   string   `json:"into"`
+	Files  []string `json:"conflicts"`
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("merging %s into %s conflicts in %s", e.Branch, e.Into, strings.Join(e.Files, ", "))
+}
+
+// previewMerge merges the worktree's state, including changes not yet
+// committed (the merge auto-commits them), into the into branch with git
+// merge-tree. Neither checkout nor any ref is touched.
+func previewMerge(repo, worktreePath, branch, into string) (*MergePreview, error) {
+	head, err := snapshotWorktree(worktreePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exit status 1 means conflicts: the tree ID comes first, then the
+	// conflicted files
+	cmd := exec.Command("git", "merge-tree", "--write-tree", "--name-only", "--no-messages", into, head)
+	cmd.Dir = repo
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return nil, fmt.Errorf("git merge-tree (needs git 2.38 or later): %s", strings.TrimSpace(stderr.String()))
+	}
+
+	preview := &MergePreview{Branch: branch, Into: into, Clean: err == nil, Conflicts: []string{}}
+	preview.FastForward = isAncestor(repo, into, head)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	for _, file := range lines[1:] {
+		if file != "" {
+			preview.Conflicts = append(preview.Conflicts, file)
+		}
+	}
+	return preview, nil
+}
+
+// checkMerge returns a *MergeConflictError if merging the worktree into the
+// into branch would conflict, or ErrNotFastForward if an ff-only merge can't
+// fast-forward
+func checkMerge(repo, worktreePath, branch, into string, strategy MergeStrategy) error {
+	preview, err := previewMerge(repo, worktreePath, branch, into)
+	if err != nil {
+		return err
+	}
+	if strategy == MergeFastForward && !preview.FastForward {
+		return ErrNotFastForward
+	}
+	if !preview.Clean {
+		return &MergeConflictError{Branch: branch, Into: into, Files: preview.Conflicts}
+	}
+	return nil
+}
+
+// snapshotWorktree returns a commit of everything in the worktree, tracked
+// or not, as "git add -A" would stage it. A throwaway index keeps the real
+// one as it is; a worktree without changes returns HEAD.
+func snapshotWorktree(dir string) (string, error) {
+	index, err := os.CreateTemp("", "claudex-index-*")
+	if err != nil {
+		return "", err
+	}
+	index.Close()
+	os.Remove(index.Name()) // git refuses an empty index file
+	defer os.Remove(index.Name())
+
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+index.Name())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	if _, err := git("read-tree", "HEAD"); err != nil {
+		return "", err
+	}
+	if _, err := git("add", "-A"); err != nil {
+		return "", err
+	}
+	tree, err := git("write-tree")
+	if err != nil {
+		return "", err
+	}
+	headTree, err := git("rev-parse", "HEAD^{tree}")
+	if err != nil {
+		return "", err
+	}
+	if tree == headTree {
+		return git("rev-parse", "HEAD")
+	}
+	// Commit as a fixed identity so hosts without a git config work too
+	return git("-c", "user.name=claudex", "-c", "user.email=merge-preview@claudex.local",
+		"commit-tree", tree, "-p", "HEAD", "-m", "claudex merge preview")
+}
+
+// SetMergeBranch sets the branch merges go into when the request names none
+// ("" for each repository's default branch)
+func (h *Handler) SetMergeBranch(branch string) error {
+	if branch != "" && exec.Command("git", "check-ref-format", "--branch", branch).Run() != nil {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.mergeBranch = branch
+	return nil
+}
+
+// mergeTarget returns the branch to merge into in repo: the requested one,
+// else the configured one, else the repository's default branch
+func (h *Handler) mergeTarget(repo, requested string) string {
+	if requested != "" {
+		return requested
+	}
+	h.mu.RLock()
+	configured := h.mergeBranch
+	h.mu.RUnlock()
+	if configured != "" {
+		return configured
+	}
+	return defaultBranch(repo)
+}
+
+// defaultBranch guesses the repository's main line: the branch origin/HEAD
+// points at, init.defaultBranch, master, main or trunk, whichever exists
+// first, and as a last resort the branch checked out in repo
+func defaultBranch(repo string) string {
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if remote := git("symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); remote != "" {
+		if branch := strings.TrimPrefix(remote, "origin/"); branchExists(repo, branch) {
+			return branch
+		}
+	}
+	for _, branch := range []string{git("config", "init.defaultBranch"), "master", "main", "trunk"} {
+		if branchExists(repo, branch) {
+			return branch
+		}
+	}
+	return git("branch", "--show-current")
+}
+
+// branchExists reports whether repo has a local branch of that name
+func branchExists(repo, branch string) bool {
+	cmd := exec.Command("git", "show-ref", "--verify", "--quiet", "refs/heads/"+branch)
+	cmd.Dir = repo
+	return branch != "" && cmd.Run() == nil
+}
+
+// checkedOutAt returns the worktree of repo that has branch checked out, or
+// "" if none has
+func checkedOutAt(repo, branch string) (string, error) {
+	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+	cmd.Dir = repo
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git worktree list: %w", err)
+	}
+	path := ""
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "worktree "):
+			path = strings.TrimPrefix(line, "worktree ")
+		case line == "branch refs/heads/"+branch:
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// mergeBranch lands branch on the into branch with the given strategy
+// without switching any checkout. The resulting commit is built with git
+// merge-tree and the branch moved to it; where into is checked out, the
+// checkout is fast-forwarded to it so its files follow.
+func mergeBranch(repo, branch, into string, strategy MergeStrategy, message string) error {
+	if strategy == "" {
+		strategy = MergeCommit
+	}
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	base, err := git("rev-parse", "--verify", "refs/heads/"+into)
+	if err != nil {
+		return err
+	}
+	head, err := git("rev-parse", "--verify", "refs/heads/"+branch)
+	if err != nil {
+		return err
+	}
+	if isAncestor(repo, head, base) {
+		return nil // Already merged
+	}
+
+	target := head
+	if strategy == MergeFastForward {
+		if !isAncestor(repo, base, head) {
+			return ErrNotFastForward
+		}
+	} else {
+		out, err := git("merge-tree", "--write-tree", "--no-messages", base, head)
+		if err != nil {
+			return fmt.Errorf("merge failed: %w", err)
+		}
+		tree := strings.SplitN(out, "\n", 2)[0]
+		parents := []string{"-p", base, "-p", head}
+		if strategy == MergeSquash {
+			parents = parents[:2]
+			if message == "" {
+				log, _ := git("log", "--reverse", "--format=* %s", base+".."+head)
+				message = fmt.Sprintf("Squashed branch '%s' into %s\n\n%s", branch, into, log)
+			}
+		} else if message == "" {
+			message = fmt.Sprintf("Merge branch '%s' into %s", branch, into)
+		}
+		args := append([]string{"commit-tree", tree}, parents...)
+		if target, err = git(append(args, "-m", message)...); err != nil {
+			return err
+		}
+	}
+
+	dir, err := checkedOutAt(repo, into)
+	if err != nil {
+		return err
+	}
+	if dir != "" {
+		// Local changes in the way make this fail without touching anything
+		cmd := exec.Command("git", "merge", "--ff-only", target)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("update %s checked out at %s: %s", into, dir, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	// Moving from base only: a concurrent commit to into fails the merge
+	_, err = git("update-ref", "-m", fmt.Sprintf("merge %s: %s", branch, strategy), "refs/heads/"+into, target, base)
+	return err
+}
+
+// isAncestor reports whether commit a is reachable from commit b
+func isAncestor(repo, a, b string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", a, b)
+	cmd.Dir = repo
+	return cmd.Run() == nil
+}
+
+// writeMergeConflict responds 409 with the conflicting files if err is a
+// merge conflict, or with the error if a fast-forward is impossible. It
+// returns false for any other error.
+func writeMergeConflict(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, ErrNotFastForward) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error()})
+		return true
+	}
+	var conflict *MergeConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":     conflict.Error(),
+		"branch":    conflict.Branch,
+		"into":      conflict.Into,
+		"conflicts": conflict.Files,
+	})
+	return true
+}
@@ -0,0 +1,101 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mergeTestTimeout bounds a test command run before a merge
+const mergeTestTimeout = 15 * time.Minute
+
+// ErrNoTestCommand is returned when a merge requires tests but no test
+// command is configured for the repository
+var ErrNoTestCommand = errors.New("no test command configured for the repository (test_commands in config.json)")
+
+// TestFailedError aborts a merge whose test command failed
+type TestFailedError struct {
+	Command  string
+	ExitCode int
+	Output   string // The end of the output
+}
+
+func (e *TestFailedError) Error() string {
+	return fmt.Sprintf("%q failed with exit code %d", e.Command, e.ExitCode)
+}
+
+// SetTestCommands sets the command merges with require_tests run, keyed by
+// repository path
+func (h *Handler) SetTestCommands(commands map[string]string) error {
+	resolved := make(map[string]string, len(commands))
+	for repo, command := range commands {
+		path := expandHome(repo)
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("%q: repository path must be absolute", repo)
+		}
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("%q: empty command", repo)
+		}
+		resolved[filepath.Clean(path)] = command
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.testCommands = resolved
+	return nil
+}
+
+// testCommand returns the test command of the repository dir belongs to
+func (h *Handler) testCommand(dir string) string {
+	repo := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if repo == "" {
+		repo = dir
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.testCommands[filepath.Clean(repo)]
+}
+
+// runMergeTests runs repo's test command in the worktree about to be merged,
+// streaming its output to streamID's subscribers
+func (h *Handler) runMergeTests(ctx context.Context, streamID, repo, worktree string) error {
+	command := h.testCommand(repo)
+	if command == "" {
+		return ErrNoTestCommand
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mergeTestTimeout)
+	defer cancel()
+	exitCode, output, err := h.runStreamed(ctx, "test_output", streamID, worktree, command)
+	if err != nil {
+		return &TestFailedError{Command: command, ExitCode: exitCode, Output: output}
+	}
+	return nil
+}
+
+// writeTestError responds 400 when no test command is configured, or 409
+// with the end of the output when the tests failed. It returns false for
+// any other error.
+func writeTestError(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, ErrNoTestCommand) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	var failed *TestFailedError
+	if !errors.As(err, &failed) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":     "tests failed: " + failed.Error(),
+		"command":   failed.Command,
+		"exit_code": failed.ExitCode,
+		"output":    failed.Output,
+	})
+	return true
+}
@@ -0,0 +1,100 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"claudex/claude"
+	"claudex/session"
+)
+
+// defaultNarrationBacklog is how many existing transcript lines are narrated on connect
+const defaultNarrationBacklog = 50
+
+// handleSessionNarration streams the session's transcript as labeled text
+// events for screen readers and text-only clients. Plain text lines by
+// default, newline-delimited JSON with ?format=json, or Server-Sent Events
+// when the client accepts text/event-stream.
+func (h *Handler) handleSessionNarration(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	backlog := defaultNarrationBacklog
+	if v := r.URL.Query().Get("backlog"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid backlog", http.StatusBadRequest)
+			return
+		}
+		backlog = n
+	}
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	asJSON := r.URL.Query().Get("format") == "json"
+
+	switch {
+	case sse:
+		w.Header().Set("Content-Type", "text/event-stream")
+	case asJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	stop := make(chan struct{})
+	events := make(chan claude.Narration, 64)
+	resolve := func() (string, error) {
+		return claude.FindTranscript(sess.Directory, sess.GetLastClaudeSessionID())
+	}
+	go claude.TailTranscript(resolve, backlog, stop, func(line claude.TranscriptLine) {
+		for _, n := range claude.Narrate(line) {
+			select {
+			case events <- n:
+			case <-stop:
+				return
+			}
+		}
+	})
+	defer close(stop)
+
+	loc := sess.Location()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case n := <-events:
+			data, _ := json.Marshal(n)
+			switch {
+			case sse:
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", n.Kind, data)
+			case asJSON:
+				fmt.Fprintf(w, "%s\n", data)
+			default:
+				fmt.Fprintf(w, "[%s] %s\n", narrationTime(n.Timestamp, loc), n.Text)
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// narrationTime renders a transcript timestamp as a short local time
+func narrationTime(timestamp string, loc *time.Location) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.In(loc).Format("15:04:05")
+}
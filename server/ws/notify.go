@@ -0,0 +1,243 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"claudex/notify"
+	"claudex/session"
+)
+
+// SetOutbox sets the outbox used to deliver events to webhooks and notifiers
+func (h *Handler) SetOutbox(outbox *notify.Outbox) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.outbox = outbox
+}
+
+// publishEvent queues an event for delivery if notifications are configured
+func (h *Handler) publishEvent(e notify.Event) {
+	h.mu.RLock()
+	outbox := h.outbox
+	h.mu.RUnlock()
+
+	if outbox != nil {
+		outbox.Publish(e)
+	}
+}
+
+// watchStatus publishes an event whenever the session changes status, and
+// fires the sessions waiting for it to wait for input. Clients get the new
+// status and usage right away, not only with the next output: changes read
+// from the transcript come without any.
+func (h *Handler) watchStatus(sessionID string, sess *session.Session) {
+	sess.SetStatusChangeCallback(func(status session.Status) {
+		h.broadcastStatus(sessionID, status)
+		e := notify.NewEvent(notify.EventStatusChanged, sessionID, sess.Name,
+			fmt.Sprintf("%s is now %s", sess.Name, status))
+		e.Data["status"] = string(status)
+		h.publishEvent(e)
+		if status == session.StatusWaitingInput {
+			h.dependencyMet(sessionID, session.DependOnWaitingInput)
+		}
+	})
+}
+
+// IdleStopped tells clients and notifiers that the idle policy stopped a session
+func (h *Handler) IdleStopped(sess *session.Session) {
+	h.broadcastStatus(sess.ID, sess.GetStatus())
+	e := notify.NewEvent(notify.EventIdleStopped, sess.ID, sess.Name,
+		fmt.Sprintf("%s was stopped after being idle", sess.Name))
+	h.publishEvent(e)
+}
+
+// HandleOutbox lists pending and dead-lettered event deliveries
+func (h *Handler) HandleOutbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	outbox := h.outbox
+	h.mu.RUnlock()
+
+	pending := []notify.Delivery{}
+	dead := []notify.Delivery{}
+	if outbox != nil {
+		pending = outbox.Pending()
+		dead = outbox.Dead()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"pending": pending,
+		"dead":    dead,
+	})
+}
+
+// HandleOutboxReplay requeues dead-lettered deliveries (all, or the given IDs).
+// DELETE drops them instead.
+func (h *Handler) HandleOutboxReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	outbox := h.outbox
+	h.mu.RUnlock()
+
+	if outbox == nil {
+		http.Error(w, "Notifications are not configured", http.StatusNotFound)
+		return
+	}
+
+	var req OutboxReplayRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodDelete {
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "purged": outbox.Purge(req.IDs)})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"status": "ok", "replayed": outbox.Replay(req.IDs)})
+}
+
+// SetRules sets the store used to import and export notification rules
+func (h *Handler) SetRules(rules *notify.RuleStore) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rules = rules
+}
+
+// RulesDocument is the rules export: the notification rules plus the
+// sessions' dependencies
+type RulesDocument struct {
+	notify.Rules
+	Dependencies []SessionDependency `json:"dependencies,omitempty"`
+}
+
+// SessionDependency is a session's dependency in a rules document
+type SessionDependency struct {
+	SessionID string             `json:"session_id"` // The session held back
+	DependsOn session.Dependency `json:"depends_on"`
+}
+
+// HandleRulesExport returns all notification and automation rules as one JSON document
+func (h *Handler) HandleRulesExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	rules := h.rules
+	h.mu.RUnlock()
+
+	if rules == nil {
+		http.Error(w, "Rules are not configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="claudex-rules.json"`)
+	doc := RulesDocument{Rules: rules.Export()}
+	for _, s := range h.manager.List(session.ListOptions{}) {
+		if dep := s.GetDependsOn(); dep != nil {
+			doc.Dependencies = append(doc.Dependencies, SessionDependency{SessionID: s.ID, DependsOn: *dep})
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(doc)
+}
+
+// HandleRulesImport imports a rules document (?mode=replace drops previously
+// imported rules and the sessions' dependencies). Dependencies of sessions
+// this server doesn't have, or that can't be set, are skipped and reported.
+func (h *Handler) HandleRulesImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	rules := h.rules
+	h.mu.RUnlock()
+
+	if rules == nil {
+		http.Error(w, "Rules are not configured", http.StatusNotFound)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "merge" && mode != "replace" {
+		http.Error(w, "Invalid mode: "+mode, http.StatusBadRequest)
+		return
+	}
+
+	var doc RulesDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, d := range doc.Dependencies {
+		if err := d.DependsOn.Validate(); err != nil {
+			http.Error(w, fmt.Sprintf("dependency of session %s: %v", d.SessionID, err), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := rules.Import(doc.Rules, mode == "replace"); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, notify.ErrInvalidRules) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if mode == "replace" {
+		for _, s := range h.manager.List(session.ListOptions{}) {
+			if s.GetDependsOn() != nil {
+				s.SetDependsOn(nil)
+				h.manager.UpdateSession(s)
+			}
+		}
+	}
+	imported, skipped := 0, []string{}
+	for _, d := range doc.Dependencies {
+		if err := h.importDependency(d); err != nil {
+			skipped = append(skipped, fmt.Sprintf("session %s: %v", d.SessionID, err))
+			continue
+		}
+		imported++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"status": "ok", "dependencies": imported, "skipped": skipped})
+}
+
+// importDependency sets a dependency from a rules document
+func (h *Handler) importDependency(d SessionDependency) error {
+	sess, ok := h.manager.Get(d.SessionID)
+	if !ok {
+		return fmt.Errorf("session not found")
+	}
+	dep := d.DependsOn
+	if err := h.checkDependency(sess, &dep); err != nil {
+		return err
+	}
+	if err := sess.SetDependsOn(&dep); err != nil {
+		return err
+	}
+	h.manager.UpdateSession(sess)
+	return nil
+}
@@ -0,0 +1,184 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+
+	"claudex/session"
+)
+
+// observerBuffer is how many events an observer may fall behind before it is cut off
+const observerBuffer = 256
+
+// OutputEvent is a chunk of session output
+type OutputEvent struct {
+	Data []byte
+	Seq  uint64 // Sequence number of the last output included
+}
+
+// OutputObserver follows a session's output outside of a WebSocket
+// connection. Backlog is what the observer missed: the output after the
+// requested sequence number, or the whole scrollback. Events then delivers
+// live output; it may repeat output up to Seq, which is already in Backlog.
+// Events is closed when the observer falls too far behind or the session
+// is deleted.
+type OutputObserver struct {
+	Backlog []OutputEvent
+	Seq     uint64
+	Events  <-chan OutputEvent
+
+	events chan OutputEvent
+	hub    *hub
+}
+
+// ObserveOutput starts following a session's output after sinceSeq (0 for
+// the scrollback first). Close the observer when done.
+func (h *Handler) ObserveOutput(sessionID string, sinceSeq uint64) (*OutputObserver, error) {
+	sess, err := h.getSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	hb := h.getHub(sessionID)
+	events := make(chan OutputEvent, observerBuffer)
+	o := &OutputObserver{Events: events, events: events, hub: hb}
+	hb.mu.Lock()
+	hb.observers[o] = true
+	hb.mu.Unlock()
+
+	if sinceSeq > 0 {
+		if chunks, ok := hb.ring.Since(sinceSeq); ok {
+			o.Seq = sinceSeq
+			for _, chunk := range chunks {
+				o.Backlog = append(o.Backlog, OutputEvent{Data: chunk.data, Seq: chunk.seq})
+				o.Seq = chunk.seq
+			}
+			return o, nil
+		}
+	}
+
+	var scrollback bytes.Buffer
+	o.Seq = hb.ring.LastSeq()
+	if n, _ := sess.WriteScrollback(&scrollback); n > 0 {
+		o.Backlog = []OutputEvent{{Data: scrollback.Bytes(), Seq: o.Seq}}
+	}
+	return o, nil
+}
+
+// Close stops the observer
+func (o *OutputObserver) Close() {
+	o.hub.mu.Lock()
+	defer o.hub.mu.Unlock()
+	if o.hub.observers[o] {
+		delete(o.hub.observers, o)
+		close(o.events)
+	}
+}
+
+// notify hands output to the hub's observers, cutting off those that are full
+func (hb *hub) notify(ev OutputEvent) {
+	hb.mu.RLock()
+	n := len(hb.observers)
+	hb.mu.RUnlock()
+	if n == 0 {
+		return
+	}
+
+	ev.Data = append([]byte(nil), ev.Data...)
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	for o := range hb.observers {
+		select {
+		case o.events <- ev:
+		default:
+			delete(hb.observers, o)
+			close(o.events)
+		}
+	}
+}
+
+// StatusObserver follows the status changes of every session. Events is
+// closed when the observer falls too far behind.
+type StatusObserver struct {
+	Events <-chan StatusMessage
+
+	events  chan StatusMessage
+	handler *Handler
+}
+
+// ObserveStatus starts following status changes. Close the observer when done.
+func (h *Handler) ObserveStatus() *StatusObserver {
+	events := make(chan StatusMessage, observerBuffer)
+	o := &StatusObserver{Events: events, events: events, handler: h}
+	h.observersMu.Lock()
+	h.statusObservers[o] = true
+	h.observersMu.Unlock()
+	return o
+}
+
+// Close stops the observer
+func (o *StatusObserver) Close() {
+	o.handler.observersMu.Lock()
+	defer o.handler.observersMu.Unlock()
+	if o.handler.statusObservers[o] {
+		delete(o.handler.statusObservers, o)
+		close(o.events)
+	}
+}
+
+// notifyStatus hands a status change to the status observers, cutting off those that are full
+func (h *Handler) notifyStatus(msg StatusMessage) {
+	h.observersMu.Lock()
+	defer h.observersMu.Unlock()
+	for o := range h.statusObservers {
+		select {
+		case o.events <- msg:
+		default:
+			delete(h.statusObservers, o)
+			close(o.events)
+		}
+	}
+}
+
+// waitForStatus waits until the session's status is one done accepts,
+// reporting false if ctx ends or the session stops or fails first
+func (h *Handler) waitForStatus(ctx context.Context, sess *session.Session, done func(session.Status) bool) bool {
+	for {
+		o := h.ObserveStatus()
+		// Checked after observing, so a change in between isn't missed
+		if status := sess.GetStatus(); done(status) {
+			o.Close()
+			return true
+		}
+		met, cutOff := waitObserved(ctx, o, sess.ID, done)
+		o.Close()
+		if !cutOff {
+			return met
+		}
+	}
+}
+
+// waitObserved reads an observer's events for waitForStatus until the
+// session's status settles it. cutOff reports that the observer fell behind
+// and the wait must start over.
+func waitObserved(ctx context.Context, o *StatusObserver, sessionID string, done func(session.Status) bool) (met, cutOff bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, false
+		case msg, ok := <-o.Events:
+			if !ok {
+				return false, true
+			}
+			if msg.SessionID != sessionID {
+				continue
+			}
+			switch {
+			case done(msg.Status):
+				return true, false
+			case msg.Status == session.StatusStopped || msg.Status == session.StatusError:
+				return false, false
+			}
+		}
+	}
+}
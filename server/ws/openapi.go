@@ -0,0 +1,193 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"claudex/audit"
+	"claudex/claude"
+	"claudex/forge"
+	"claudex/logsink"
+	"claudex/openapi"
+	"claudex/recording"
+	"claudex/session"
+)
+
+// apiDocVersion is the version of the API described by /api/v1/openapi.json
+const apiDocVersion = "1.0.0"
+
+// apiSpec lists every REST endpoint and WebSocket message with its body
+// types. Keep it in step with the handlers and the README API tables.
+var apiSpec = openapi.Spec{
+	Title:   "Claudex",
+	Version: apiDocVersion,
+	Operations: []openapi.Operation{
+		{Method: "GET", Path: "/api/v1/sessions", Summary: "List sessions (total in X-Total-Count)", Query: []string{"tag", "status", "sort", "order", "limit", "offset", "include"}, Response: []*session.Session(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/create", Summary: "Create a session", Request: CreateSessionRequest{}, Response: (*session.Session)(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/experiment", Summary: "Create an experiment in a new worktree", Request: CreateExperimentRequest{}, Response: (*session.Session)(nil)},
+		{Method: "POST", Path: "/api/v1/experiments/batch", Summary: "Create experiments in new worktrees and start Claude in each on its prompt", Request: BatchExperimentRequest{}, Response: []BatchExperimentResult(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/input", Summary: "Type the same input into several sessions", Request: BroadcastInputRequest{}, Response: []BroadcastInputResult(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/import", Summary: "Recreate a session from an export bundle", Query: []string{"relink", "directory"}, Response: (*session.Session)(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/tree", Summary: "All experiment lineages", Query: []string{"diff"}, Response: []*TreeNode(nil)},
+		{Method: "DELETE", Path: "/api/v1/sessions/{id}", Summary: "Delete a session"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/name", Summary: "Rename a session", Request: RenameRequest{}},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/customize", Summary: "Update robot customization", Request: CustomizeRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/claude-state", Summary: "Claude Code state read from the transcript"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/claude-session", Summary: "Check for a resumable Claude session"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/claude-layout", Summary: "Detected ~/.claude project layout", Response: claude.LayoutInfo{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/transcript/search", Summary: "Search the Claude transcript", Query: []string{"q"}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/history", Summary: "Status transitions with time spent in each status", Query: []string{"since"}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/limits", Summary: "Resource limits", Response: (*session.ResourceLimits)(nil)},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/limits", Summary: "Set resource limits (null removes them)", Request: (*session.ResourceLimits)(nil), Response: (*session.ResourceLimits)(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/sandbox", Summary: "Where the session runs"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/sandbox", Summary: "Switch sandbox from the next start", Request: SandboxRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/sinks", Summary: "The session's output log sinks", Response: []logsink.Config(nil)},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/sinks", Summary: "Replace the session's output log sinks", Request: []logsink.Config(nil), Response: []logsink.Config(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/model", Summary: "The model Claude is started with"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/model", Summary: "Switch Claude's model from the next start", Request: ClaudeModelRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/claude-options", Summary: "Flags Claude is launched with", Response: (*session.ClaudeOptions)(nil)},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/claude-options", Summary: "Set Claude's permission mode, allowed tools and extra args from the next start (null removes them)", Request: (*session.ClaudeOptions)(nil), Response: (*session.ClaudeOptions)(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/mcp", Summary: "MCP servers Claude starts in the session's directory, from every scope", Response: []claude.MCPServer(nil)},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/mcp/{name}", Summary: "Add or replace an MCP server in the local, project or user scope", Request: claude.MCPServer{}, Response: claude.MCPServer{}},
+		{Method: "DELETE", Path: "/api/v1/sessions/{id}/mcp/{name}", Summary: "Remove an MCP server", Query: []string{"scope"}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/depends-on", Summary: "The session this one waits for, or null"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/depends-on", Summary: "Start this session, typing its prompt, once another reaches waiting_input or is merged", Request: session.Dependency{}},
+		{Method: "DELETE", Path: "/api/v1/sessions/{id}/depends-on", Summary: "Remove the dependency"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/backend", Summary: "How panes are hosted, with the attach command"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/backend", Summary: "Switch backend from the next start", Request: BackendRequest{}},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/merge", Summary: "Merge an experiment into its repository's target branch and delete it, or stop it and mark it merged_into with keep_session (409 with the conflicting files if it would conflict, or the output if require_tests fails)", Request: MergeRequest{}},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/pull-request", Summary: "Push an experiment's branch and open a pull request for it", Request: PullRequestRequest{}, Response: forge.PullRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/worktree/status", Summary: "Uncommitted changes, commits ahead/behind the base branch and the last commit", Query: []string{"base"}, Response: WorktreeStatus{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/worktree/stash", Summary: "Stashes made on the worktree's branch, newest first", Response: []StashEntry(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/worktree/stash", Summary: "Park the worktree's uncommitted changes, untracked files included", Request: StashRequest{}},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/worktree/unstash", Summary: "Restore and drop one of the worktree's stashes (409 if it doesn't apply)", Request: StashRequest{}},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/discard", Summary: "Remove an experiment's worktree and branch and delete it (or stop it with keep_session)", Request: DiscardRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/tree", Summary: "The experiment lineage the session belongs to", Query: []string{"diff"}, Response: (*TreeNode)(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/animation", Summary: "Most recent animation events", Response: []AnimationMessage(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/locale", Summary: "Timezone and locale"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/locale", Summary: "Set timezone and locale for panes started afterwards", Request: LocaleRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/statusline", Summary: "Last Claude Code statusline report", Response: (*session.StatusLine)(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/statusline", Summary: "Receive a statusline report and answer with the line to display", ContentType: "text/plain"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/tools", Summary: "Tool executions with durations and per-tool totals"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/summary", Summary: "Stored transcript summary", Response: (*session.StoredSummary)(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/summary/recompute", Summary: "Re-read the transcript and refresh the summary", Response: (*session.StoredSummary)(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/usage", Summary: "Token usage and cost by model", Query: []string{"claude_session"}, Response: (*claude.CostReport)(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/budget", Summary: "Usage against the budget"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/budget", Summary: "Set the session budget (null reverts to the global one)", Request: (*session.Budget)(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/services", Summary: "Required services with a live check"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/services", Summary: "Set required services", Request: ServicesRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/recording", Summary: "Recording state, or the latest recording as asciicast with format=cast", Query: []string{"format", "recording_id", "pane"}},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/recording", Summary: "Toggle output recording", Request: RecordingRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/export", Summary: "Download a tar.gz bundle of the session", ContentType: "application/gzip"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/metadata", Summary: "Session metadata", Response: map[string]any(nil)},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/metadata", Summary: "Replace session metadata", Request: map[string]any(nil), Response: map[string]any(nil)},
+		{Method: "PATCH", Path: "/api/v1/sessions/{id}/metadata", Summary: "Merge session metadata (null deletes a key)", Request: map[string]any(nil), Response: map[string]any(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/macros", Summary: "Input macros and the one being recorded"},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/macros/record", Summary: "Start recording a macro", Request: MacroRecordRequest{}},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/macros/stop", Summary: "Stop recording and save the macro", Response: (*session.Macro)(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/macros/cancel", Summary: "Cancel the macro being replayed"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/macros/{name}", Summary: "Define a macro", Request: (*session.Macro)(nil), Response: (*session.Macro)(nil)},
+		{Method: "DELETE", Path: "/api/v1/sessions/{id}/macros/{name}", Summary: "Delete a macro"},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/macros/{name}/play", Summary: "Replay a macro"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/screen", Summary: "Visible screen as text lines with the cursor"},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/scrollback", Summary: "Download the scrollback", Query: []string{"format"}, ContentType: "application/octet-stream"},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/scrollback", Summary: "Set the scrollback limit", Request: ScrollbackLimitRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/scrollback/search", Summary: "Search the plain scrollback line by line", Query: []string{"q", "regex", "ignore_case", "context", "limit"}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/narration", Summary: "Live text narration of the Claude conversation", Query: []string{"backlog", "format"}, ContentType: "text/plain"},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/interrupt", Summary: "Stop Claude's turn and optionally type a follow-up", Request: InterruptRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/permission", Summary: "Permission prompt Claude is showing, null if none"},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/permission", Summary: "Approve or deny the permission prompt", Request: PermissionResponse{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/audit", Summary: "Audit log of input typed into the session, oldest first", Query: []string{"since", "limit"}, Response: []audit.Event(nil)},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/pane-roles", Summary: "Pane roles", Response: map[string]session.PaneRole(nil)},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/pane-roles", Summary: "Assign pane roles", Request: map[string]session.PaneRole(nil), Response: map[string]session.PaneRole(nil)},
+		{Method: "POST", Path: "/api/v1/sessions/{id}/run", Summary: "Run a command in the pane for a role", Request: RunRequest{}},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/startup-command", Summary: "Set the command typed once the shell prompt appears", Request: StartupCommandRequest{}},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/tags", Summary: "Replace session tags", Request: TagsRequest{}},
+		{Method: "GET", Path: "/api/v1/sessions/{id}/policy", Summary: "Command allow/deny policy", Response: (*session.InputPolicy)(nil)},
+		{Method: "PUT", Path: "/api/v1/sessions/{id}/policy", Summary: "Set the command policy", Request: (*session.InputPolicy)(nil)},
+		{Method: "GET", Path: "/api/v1/metadata/schema", Summary: "Known metadata keys and their types"},
+		{Method: "GET", Path: "/api/v1/ports", Summary: "Port blocks allocated to sessions", Response: []session.PortMapping(nil)},
+		{Method: "GET", Path: "/api/v1/quotas", Summary: "Session limits with global and per-user usage"},
+		{Method: "GET", Path: "/api/v1/usage", Summary: "Tokens, cost and tool calls across all sessions by day and project", Query: []string{"since", "until"}, Response: UsageReport{}},
+		{Method: "GET", Path: "/api/v1/projects", Summary: "Sessions, experiments, agent time and merge outcomes per working directory", Response: []ProjectStats(nil)},
+		{Method: "POST", Path: "/api/v1/onboarding/demo", Summary: "Create the demo project and its session", Response: (*session.Session)(nil)},
+		{Method: "GET", Path: "/api/v1/worktree", Summary: "Whether the server runs from a git worktree, and its branch", Response: WorktreeInfo{}},
+		{Method: "POST", Path: "/api/v1/worktree/merge", Summary: "Commit and merge the server's worktree branch and retire the sessions in it (409 with the conflicting files if it would conflict, or the output if require_tests fails)", Request: MergeRequest{}},
+		{Method: "POST", Path: "/api/v1/worktree/prune", Summary: "Remove (or with dry_run, list) experiment worktrees and exp-* branches no session uses", Request: PruneRequest{}, Response: PruneReport{}},
+		{Method: "GET", Path: "/api/v1/worktree/merge/preview", Summary: "Dry-run merge of the server's worktree branch", Query: []string{"into"}, Response: MergePreview{}},
+		{Method: "POST", Path: "/api/v1/worktree/discard", Summary: "Discard the server's worktree and retire the sessions in it", Request: DiscardRequest{}},
+		{Method: "GET", Path: "/api/v1/recordings", Summary: "List recordings", Query: []string{"session_id"}, Response: []recording.Manifest(nil)},
+		{Method: "GET", Path: "/api/v1/recordings/{id}", Summary: "Recording manifest", Response: recording.Manifest{}},
+		{Method: "GET", Path: "/api/v1/recordings/{id}/timeline", Summary: "Merged multi-pane timeline for playback"},
+		{Method: "GET", Path: "/api/v1/rules/export", Summary: "Export notification rules and session dependencies", Response: RulesDocument{}},
+		{Method: "POST", Path: "/api/v1/rules/import", Summary: "Import notification rules and session dependencies", Query: []string{"mode"}, Request: RulesDocument{}},
+		{Method: "GET", Path: "/api/v1/outbox", Summary: "Pending and dead-lettered notification deliveries"},
+		{Method: "POST", Path: "/api/v1/outbox/replay", Summary: "Requeue dead letters", Request: OutboxReplayRequest{}},
+		{Method: "DELETE", Path: "/api/v1/outbox/replay", Summary: "Drop dead letters", Request: OutboxReplayRequest{}},
+		{Method: "GET", Path: "/api/v1/system", Summary: "Server health and active problems"},
+		{Method: "GET", Path: "/api/v1/client-state", Summary: "UI state", Response: (*session.ClientState)(nil)},
+		{Method: "PUT", Path: "/api/v1/client-state", Summary: "Save UI state", Request: (*session.ClientState)(nil)},
+		{Method: "GET", Path: "/api/v1/openapi.json", Summary: "This document"},
+		{Method: "GET", Path: "/wall", Summary: "HTML wallboard of all sessions", ContentType: "text/html"},
+	},
+	WebSocketPath: "/ws",
+	ClientMessages: []openapi.Message{
+		{Type: "hello", Summary: "Negotiate the protocol version", Body: HelloData{}},
+		{Type: "subscribe", Summary: "Subscribe to session output", Body: SubscribeData{}},
+		{Type: "unsubscribe", Summary: "Stop receiving session output"},
+		{Type: "list", Summary: "Request the session list"},
+		{Type: "subscribe_transcript", Summary: "Stream the session's Claude transcript", Body: SubscribeTranscriptData{}},
+		{Type: "unsubscribe_transcript", Summary: "Stop the transcript stream"},
+		{Type: "playback", Summary: "Play a recording back in real time", Body: PlaybackData{}},
+		{Type: "playback_stop", Summary: "Stop playback"},
+		{Type: "start", Summary: "Start the session", Body: StartData{}},
+		{Type: "restart", Summary: "Restart a stopped session", Body: StartData{}},
+		{Type: "stop", Summary: "Stop the session"},
+		{Type: "input", Summary: "Terminal input", Body: ""},
+		{Type: "resize", Summary: "Update terminal dimensions", Body: ResizeData{}},
+		{Type: "policy_override", Summary: "Submit a command held for confirmation"},
+		{Type: "control_request", Summary: "Ask for input control (granted at once if free)"},
+		{Type: "control_grant", Summary: "Hand input control to a requester", Body: ControlGrantData{}},
+		{Type: "control_steal", Summary: "Take input control from its holder"},
+		{Type: "control_release", Summary: "Give up input control"},
+	},
+	ServerMessages: []openapi.Message{
+		{Type: "hello", Summary: "Protocol version in use, sent on connect and in answer to hello", Body: HelloMessage{}},
+		{Type: "output", Summary: "Terminal output", Body: OutputMessage{}},
+		{Type: "screen", Summary: "Rendered screen sent on subscribe", Body: ScreenMessage{}},
+		{Type: "resync", Summary: "Output was dropped; subscribe again with since_seq", Body: ResyncMessage{}},
+		{Type: "status", Summary: "Session state change", Body: StatusMessage{}},
+		{Type: "sessions", Summary: "Session list for status-only clients", Body: SessionsMessage{}},
+		{Type: "policy", Summary: "Command denied or needs confirmation", Body: PolicyMessage{}},
+		{Type: "blocked", Summary: "Required services are unavailable", Body: BlockedMessage{}},
+		{Type: "quota_exceeded", Summary: "Starting would exceed a quota", Body: QuotaExceededMessage{}},
+		{Type: "control", Summary: "Input control changed, was requested or refused input", Body: ControlMessage{}},
+		{Type: "rate_limited", Summary: "Input or resize dropped for exceeding a rate limit", Body: RateLimitedMessage{}},
+		{Type: "playback", Summary: "A step of a recording being played back", Body: PlaybackMessage{}},
+		{Type: "transcript", Summary: "A parsed transcript message", Body: TranscriptMessage{}},
+		{Type: "animation", Summary: "Renderer-friendly event", Body: AnimationMessage{}},
+		{Type: "statusline", Summary: "Claude Code statusline report", Body: StatusLineMessage{}},
+		{Type: "budget_alert", Summary: "Spend crossed a budget threshold", Body: BudgetAlertMessage{}},
+		{Type: "system", Summary: "Server health", Body: SystemMessage{}},
+	},
+}
+
+var (
+	apiDocOnce sync.Once
+	apiDoc     []byte
+)
+
+// HandleOpenAPI serves the OpenAPI document describing the REST API and
+// WebSocket messages
+func (h *Handler) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	apiDocOnce.Do(func() {
+		apiDoc, _ = json.MarshalIndent(openapi.Build(apiSpec), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(apiDoc)
+}
@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"claudex/session"
+)
+
+// OriginPolicy decides which browser origins may open WebSockets and call
+// the REST API. Same-origin requests and requests without an Origin header
+// (curl, scripts) are always allowed.
+type OriginPolicy struct {
+	Allowed  []string // Origins such as "https://dash.example.com"
+	AllowAny bool     // Development: accept every origin
+}
+
+// Validate rejects entries that aren't a bare http(s) origin
+func (p OriginPolicy) Validate() error {
+	for _, origin := range p.Allowed {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+			return fmt.Errorf("invalid origin %q: want scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// allows reports whether a cross-origin request from origin is accepted
+func (p OriginPolicy) allows(origin string) bool {
+	if p.AllowAny {
+		return true
+	}
+	origin = strings.TrimSuffix(origin, "/")
+	for _, allowed := range p.Allowed {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetOriginPolicy sets the origins accepted besides the server's own
+func (h *Handler) SetOriginPolicy(policy OriginPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.origins = policy
+	return nil
+}
+
+// originAllowed checks a request's Origin header against the policy
+func (h *Handler) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(r, origin) {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.origins.allows(origin)
+}
+
+// sameOrigin reports whether origin names the host the request was sent to
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// CORSMiddleware rejects REST requests from origins the policy doesn't
+// allow, and adds CORS headers (answering preflights) for those it does
+func (h *Handler) CORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !h.originAllowed(r) {
+			slog.Info("Rejected cross-origin request", "origin", origin, "path", r.URL.Path)
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		header := w.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+		header.Set("Access-Control-Expose-Headers", "X-Total-Count, Deprecation, Link")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			header.Set("Access-Control-Allow-Headers", "Content-Type, "+UserHeader+", "+session.UserTokenHeader+", "+session.AdminHeader)
+			header.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,290 @@
+package ws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"sort"
+
+	"claudex/audit"
+	"claudex/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// PaneCreateData is the data of a pane_create message
+type PaneCreateData struct {
+	PaneID    string `json:"pane_id,omitempty"`    // Generated ("pane-N") when empty
+	SplitFrom string `json:"split_from,omitempty"` // Pane to split, default the main pane
+	Direction string `json:"direction,omitempty"`  // "horizontal" (default) or "vertical"
+	Rows      uint16 `json:"rows"`
+	Cols      uint16 `json:"cols"`
+}
+
+// PaneInputData is the data of a pane_input message
+type PaneInputData struct {
+	PaneID string `json:"pane_id"`
+	Input  string `json:"input"`
+}
+
+// PaneResizeData is the data of a pane_resize message
+type PaneResizeData struct {
+	PaneID string `json:"pane_id"`
+	Rows   uint16 `json:"rows"`
+	Cols   uint16 `json:"cols"`
+}
+
+// PaneCloseData is the data of a pane_close message
+type PaneCloseData struct {
+	PaneID string `json:"pane_id"`
+}
+
+// PanesMessage tells subscribers the session's panes changed
+type PanesMessage struct {
+	Type      string                      `json:"type"`
+	SessionID string                      `json:"session_id"`
+	Layout    *session.PaneLayout         `json:"layout"`
+	Roles     map[string]session.PaneRole `json:"roles,omitempty"`
+}
+
+// handlePaneCreate splits a pane of a running session and starts a shell in
+// the new one
+func (h *Handler) handlePaneCreate(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		slog.Debug("Pane create for unknown session", "session", sessionID)
+		return
+	}
+	if !h.checkControl(conn, sessionID) {
+		return
+	}
+
+	req := PaneCreateData{Rows: 24, Cols: 80}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			slog.Debug("Invalid pane_create message", "session", sessionID, "err", err)
+			return
+		}
+	}
+	if req.Rows == 0 || req.Cols == 0 {
+		req.Rows, req.Cols = 24, 80
+	}
+
+	pane, err := sess.AddPane(req.SplitFrom, req.PaneID, req.Direction)
+	if err != nil {
+		slog.Info("Not creating pane", "session", sessionID, "err", err)
+		return
+	}
+	if err := h.startPane(sess, pane.ID, req.Rows, req.Cols, h.connActor(conn).Admin); err != nil {
+		slog.Warn("Failed to start pane", "session", sessionID, "pane", pane.ID, "err", err)
+		sess.ClosePane(pane.ID)
+		var quotaErr *session.QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			h.sendToConn(conn, QuotaExceededMessage{Type: "quota_exceeded", SessionID: sessionID, Error: quotaErr})
+		}
+		return
+	}
+	slog.Info("Created pane", "session", sessionID, "pane", pane.ID, "split_from", req.SplitFrom)
+	h.manager.UpdateSession(sess)
+	h.broadcastPanes(sess)
+}
+
+// handlePaneInput sends input to one pane, through the same checks as input
+// messages
+func (h *Handler) handlePaneInput(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		slog.Debug("Pane input for unknown session", "session", sessionID)
+		return
+	}
+	if !h.allowMessage(conn, sessionID, "input") || !h.checkControl(conn, sessionID) {
+		return
+	}
+
+	var req PaneInputData
+	if err := json.Unmarshal(data, &req); err != nil {
+		slog.Debug("Invalid pane_input message", "session", sessionID, "err", err)
+		return
+	}
+	actor := h.connActor(conn)
+	reply := func(v any) { h.sendToConn(conn, v) }
+	if req.PaneID == "" || req.PaneID == sess.MainPaneID() {
+		h.queueInput(conn, func() { h.writeInput(sess, req.Input, actor, reply) })
+		return
+	}
+
+	pane := sess.GetPane(req.PaneID)
+	if pane == nil {
+		slog.Debug("Input for unknown pane", "session", sessionID, "pane", req.PaneID)
+		return
+	}
+	event := audit.Event{Kind: audit.KindInput, Actor: actor, Role: string(pane.GetRole())}
+	h.queueInput(conn, func() { h.writePaneInput(sess, req.PaneID, req.Input, event, reply) })
+}
+
+// handlePaneResize resizes one pane's terminal
+func (h *Handler) handlePaneResize(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		slog.Debug("Pane resize for unknown session", "session", sessionID)
+		return
+	}
+	if !h.allowMessage(conn, sessionID, "resize") {
+		return
+	}
+
+	var req PaneResizeData
+	if err := json.Unmarshal(data, &req); err != nil || req.Rows == 0 || req.Cols == 0 {
+		slog.Debug("Invalid pane_resize message", "session", sessionID, "err", err)
+		return
+	}
+	if req.PaneID == "" || req.PaneID == sess.MainPaneID() {
+		sess.Resize(req.Rows, req.Cols)
+		h.resizeScreen(sessionID, req.Rows, req.Cols)
+		return
+	}
+	if err := sess.ResizePane(req.PaneID, req.Rows, req.Cols); err != nil {
+		slog.Debug("Failed to resize pane", "session", sessionID, "pane", req.PaneID, "err", err)
+	}
+}
+
+// handlePaneClose stops a pane and removes it from the layout
+func (h *Handler) handlePaneClose(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		slog.Debug("Pane close for unknown session", "session", sessionID)
+		return
+	}
+	if !h.checkControl(conn, sessionID) {
+		return
+	}
+
+	var req PaneCloseData
+	if err := json.Unmarshal(data, &req); err != nil {
+		slog.Debug("Invalid pane_close message", "session", sessionID, "err", err)
+		return
+	}
+	if err := sess.ClosePane(req.PaneID); err != nil {
+		slog.Info("Not closing pane", "session", sessionID, "pane", req.PaneID, "err", err)
+		return
+	}
+	slog.Info("Closed pane", "session", sessionID, "pane", req.PaneID)
+	h.manager.UpdateSession(sess)
+	h.broadcastPanes(sess)
+}
+
+// startPane starts a shell in a pane other than the main one, its output and
+// status going to the session's subscribers tagged with the pane ID. Admin
+// callers are exempt from run quotas.
+func (h *Handler) startPane(sess *session.Session, paneID string, rows, cols uint16, admin bool) error {
+	if err := h.manager.CheckPaneQuota(sess, admin); err != nil {
+		return err
+	}
+	sessionID := sess.ID
+	onOutput := func(data []byte) {
+		h.broadcast(sessionID, OutputMessage{
+			Type:      "output",
+			SessionID: sessionID,
+			PaneID:    paneID,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		})
+	}
+	onStatus := func(status session.Status) {
+		h.broadcast(sessionID, StatusMessage{
+			Type: "status", SessionID: sessionID, PaneID: paneID, Status: status,
+			Detection: paneDetection(sess.GetPane(paneID), status),
+		})
+	}
+	return sess.StartPane(paneID, rows, cols, onOutput, onStatus)
+}
+
+// paneDetection returns what status detection made of a pane's status, or
+// nil if the status wasn't detected
+func paneDetection(pane *session.Pane, status session.Status) *session.Detection {
+	if pane == nil || !status.Detected() {
+		return nil
+	}
+	d := pane.GetDetection()
+	return &d
+}
+
+// startLayoutPanes starts the panes of a session's saved layout besides the
+// main one, which the session was just started in
+func (h *Handler) startLayoutPanes(sess *session.Session, rows, cols uint16, admin bool) {
+	ids := sess.LayoutPaneIDs()
+	if len(ids) < 2 {
+		return
+	}
+	for _, paneID := range ids[1:] {
+		if pane := sess.GetPane(paneID); pane != nil && pane.IsRunning() {
+			continue
+		}
+		if err := h.startPane(sess, paneID, rows, cols, admin); err != nil {
+			slog.Warn("Failed to start pane", "session", sess.ID, "pane", paneID, "err", err)
+		}
+	}
+	h.broadcastPanes(sess)
+}
+
+// broadcastPanes sends the session's pane layout to its subscribers
+func (h *Handler) broadcastPanes(sess *session.Session) {
+	h.broadcast(sess.ID, PanesMessage{
+		Type:      "panes",
+		SessionID: sess.ID,
+		Layout:    sess.GetPaneLayout(),
+		Roles:     sess.GetPaneRoles(),
+	})
+}
+
+// sendPaneScrollback sends a new subscriber the session's pane layout and the
+// scrollback of each pane besides the main one, tagged with its pane ID. The
+// panes have no sequence numbers, so this is sent in full on every subscribe.
+func (h *Handler) sendPaneScrollback(state *connState, sess *session.Session) error {
+	ids := sess.LayoutPaneIDs()
+	panes := sess.GetPanes()
+	// Panes started outside the layout, like role panes
+	var others []string
+	for id := range panes {
+		if !slices.Contains(ids, id) {
+			others = append(others, id)
+		}
+	}
+	sort.Strings(others)
+	ids = append(ids, others...)
+	if len(ids) < 2 {
+		return nil
+	}
+
+	msgBytes, _ := json.Marshal(PanesMessage{
+		Type:      "panes",
+		SessionID: sess.ID,
+		Layout:    sess.GetPaneLayout(),
+		Roles:     sess.GetPaneRoles(),
+	})
+	if err := state.send(msgBytes); err != nil {
+		return err
+	}
+	mainID := sess.MainPaneID()
+	for _, id := range ids {
+		pane := panes[id]
+		if id == mainID || pane == nil {
+			continue
+		}
+		data := pane.GetScrollback()
+		if len(data) == 0 {
+			continue
+		}
+		msgBytes, _ := json.Marshal(OutputMessage{
+			Type:      "output",
+			SessionID: sess.ID,
+			PaneID:    id,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		})
+		if err := state.send(msgBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
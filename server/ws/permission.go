@@ -0,0 +1,223 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"claudex/audit"
+	"claudex/notify"
+	"claudex/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// permissionCheckDelay is how long output has to settle before the screen is
+// checked for a permission prompt
+const permissionCheckDelay = 300 * time.Millisecond
+
+// errNoPermissionPrompt is returned when Claude isn't asking for permission
+var errNoPermissionPrompt = errors.New("no permission prompt is showing")
+
+// PermissionRequestMessage tells subscribers Claude is asking to use a tool.
+// Request is null once the prompt is gone, however it was answered.
+type PermissionRequestMessage struct {
+	Type      string                    `json:"type"`
+	SessionID string                    `json:"session_id"`
+	Request   *session.PermissionPrompt `json:"request"`
+}
+
+// PermissionResponse is the body of POST /api/sessions/{id}/permission and
+// the data of a permission_response message
+type PermissionResponse struct {
+	Decision string `json:"decision,omitempty"` // approve, approve_always or deny
+	Option   int    `json:"option,omitempty"`   // Menu option to pick instead, from 1
+}
+
+// schedulePermissionCheck checks the session's screen for a permission prompt
+// once its output settles
+func (h *Handler) schedulePermissionCheck(sessionID string) {
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return
+	}
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if hb.permissionCheck {
+		return
+	}
+	hb.permissionCheck = true
+	time.AfterFunc(permissionCheckDelay, func() { h.checkPermission(sessionID) })
+}
+
+// checkPermission looks for a permission prompt on the session's screen and
+// tells subscribers when one appears or goes away. It returns the prompt
+// showing, nil if there is none.
+func (h *Handler) checkPermission(sessionID string) *session.PermissionPrompt {
+	hb := h.lookupHub(sessionID)
+	sess, ok := h.manager.Get(sessionID)
+	if hb == nil || !ok {
+		return nil // Deleted meanwhile
+	}
+
+	hb.mu.Lock()
+	hb.permissionCheck = false
+	term := hb.screen
+	hb.mu.Unlock()
+	if term == nil {
+		return nil
+	}
+
+	prompt := session.ParsePermissionPrompt(term.Text())
+	if prompt != nil {
+		// The session's transcript, as its poller last read it, names the
+		// tool; its target stands in for a command the screen didn't show
+		if state := sess.GetClaudeState(); state != nil && len(state.PendingTools) > 0 {
+			tool := state.PendingTools[len(state.PendingTools)-1]
+			prompt.Tool = tool.Name
+			if prompt.Command == "" {
+				prompt.Command = tool.Target
+			}
+		}
+	}
+
+	hb.mu.Lock()
+	changed := !prompt.Equal(hb.permission)
+	hb.permission = prompt
+	hb.mu.Unlock()
+	if !changed {
+		return prompt
+	}
+
+	h.broadcast(sessionID, PermissionRequestMessage{Type: "permission_request", SessionID: sessionID, Request: prompt})
+	if prompt != nil {
+		slog.Info("Permission requested", "session", sessionID, "tool", prompt.Tool, "command", prompt.Command)
+		e := notify.NewEvent(notify.EventPermission, sessionID, sess.Name,
+			fmt.Sprintf("%s is asking to use %s", sess.Name, promptSubject(prompt)))
+		e.Data["tool"] = prompt.Tool
+		e.Data["command"] = prompt.Command
+		h.publishEvent(e)
+	}
+	return prompt
+}
+
+// promptSubject names what a prompt asks for in a notification
+func promptSubject(p *session.PermissionPrompt) string {
+	switch {
+	case p.Tool != "":
+		return p.Tool
+	case p.Title != "":
+		return p.Title
+	}
+	return "a tool"
+}
+
+// currentPermission returns the prompt found by the last screen check, nil
+// if there is none
+func (h *Handler) currentPermission(sessionID string) *session.PermissionPrompt {
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return nil
+	}
+	hb.mu.RLock()
+	defer hb.mu.RUnlock()
+	return hb.permission
+}
+
+// sendPermission tells a new subscriber about a prompt waiting for an answer
+func (h *Handler) sendPermission(conn *websocket.Conn, sessionID string) {
+	if prompt := h.currentPermission(sessionID); prompt != nil {
+		h.sendToConn(conn, PermissionRequestMessage{Type: "permission_request", SessionID: sessionID, Request: prompt})
+	}
+}
+
+// answerPermission types the keystrokes that answer the prompt on the
+// session's screen. The screen is read again first, so an answer to a
+// prompt that is already gone isn't typed into Claude's input.
+func (h *Handler) answerPermission(sess *session.Session, resp PermissionResponse, actor audit.Actor) error {
+	prompt := h.checkPermission(sess.ID)
+	if prompt == nil {
+		return errNoPermissionPrompt
+	}
+	keys, err := prompt.Keys(resp.Decision, resp.Option)
+	if err != nil {
+		return err
+	}
+
+	decision := resp.Decision
+	if resp.Option != 0 {
+		decision = fmt.Sprintf("option %d", resp.Option)
+	}
+	event := audit.Event{Kind: audit.KindPermission, Actor: actor, Decision: decision}
+	if err := h.writePaneInput(sess, "", keys, event, func(any) {}); err != nil {
+		return err
+	}
+	slog.Info("Answered permission prompt", "session", sess.ID, "tool", prompt.Tool, "decision", decision)
+	h.schedulePermissionCheck(sess.ID)
+	return nil
+}
+
+// handleSessionPermission returns the permission prompt Claude is showing
+// (GET) or answers it (POST)
+func (h *Handler) handleSessionPermission(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"request": h.currentPermission(sess.ID)})
+
+	case http.MethodPost:
+		var resp PermissionResponse
+		if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if resp.Decision == "" && resp.Option == 0 {
+			http.Error(w, "decision or option is required", http.StatusBadRequest)
+			return
+		}
+		if err := h.answerPermission(sess, resp, h.requestActor(r)); err != nil {
+			status := http.StatusBadRequest
+			switch err {
+			case errNoPermissionPrompt:
+				status = http.StatusConflict
+			case ErrRateLimited, ErrControlHeld:
+				status = inputErrorStatus(err)
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePermissionResponse answers a permission prompt for a subscriber that
+// may type in the session
+func (h *Handler) handlePermissionResponse(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		slog.Debug("Permission response for unknown session", "session", sessionID)
+		return
+	}
+	if !h.allowMessage(conn, sessionID, "input") || !h.checkControl(conn, sessionID) {
+		return
+	}
+
+	var resp PermissionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		slog.Debug("Invalid permission_response message", "session", sessionID, "err", err)
+		return
+	}
+	actor := h.connActor(conn)
+	h.queueInput(conn, func() {
+		if err := h.answerPermission(sess, resp, actor); err != nil {
+			slog.Debug("Not answering permission prompt", "session", sessionID, "err", err)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package ws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"claudex/recording"
+)
+
+const (
+	maxPlaybackSpeed = 16              // Fastest playback multiplier accepted
+	playbackIdleCap  = 1 * time.Second // Longest pause kept when skipping idle time
+)
+
+// PlaybackData holds the parameters of a playback request
+type PlaybackData struct {
+	RecordingID string  `json:"recording_id,omitempty"` // Defaults to the session's latest recording
+	Pane        string  `json:"pane,omitempty"`         // Defaults to the main pane
+	Speed       float64 `json:"speed,omitempty"`        // Multiplier, 1 if unset
+	SkipIdle    bool    `json:"skip_idle,omitempty"`    // Shorten pauses to at most playbackIdleCap
+}
+
+// PlaybackMessage carries one step of a recording played back to a client.
+// Kind is "start" (with the terminal size), "o" (output), "r" (resize) or "end".
+type PlaybackMessage struct {
+	Type        string  `json:"type"`
+	SessionID   string  `json:"session_id"`
+	RecordingID string  `json:"recording_id"`
+	Kind        string  `json:"kind"`
+	Data        string  `json:"data,omitempty"` // Base64 output, or "COLSxROWS" for resizes
+	Time        float64 `json:"time"`           // Seconds into the recording
+	Rows        uint16  `json:"rows,omitempty"`
+	Cols        uint16  `json:"cols,omitempty"`
+	Duration    float64 `json:"duration,omitempty"`
+}
+
+// handlePlayback streams a recorded session to the connection in real time
+// (scaled by speed), replacing any playback of the same session already running
+func (h *Handler) handlePlayback(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	var req PlaybackData
+	if len(data) > 0 {
+		json.Unmarshal(data, &req)
+	}
+	if req.Speed <= 0 {
+		req.Speed = 1
+	}
+	req.Speed = min(req.Speed, maxPlaybackSpeed)
+
+	baseDir := h.manager.GetRecordingsDir()
+	var manifest *recording.Manifest
+	var err error
+	if req.RecordingID != "" {
+		manifest, err = recording.Load(baseDir, req.RecordingID)
+		if err == nil && manifest.SessionID != sessionID {
+			err = fmt.Errorf("recording %s belongs to another session", req.RecordingID)
+		}
+	} else {
+		manifest, err = recording.Latest(baseDir, sessionID)
+	}
+	if err != nil {
+		slog.Debug("No recording to play back", "session", sessionID, "err", err)
+		h.sendToConn(conn, PlaybackMessage{Type: "playback", SessionID: sessionID, RecordingID: req.RecordingID, Kind: "end"})
+		return
+	}
+	track, frames, err := recording.PaneFrames(baseDir, manifest, req.Pane)
+	if err != nil {
+		slog.Warn("Cannot play back recording", "session", sessionID, "recording", manifest.ID, "err", err)
+		h.sendToConn(conn, PlaybackMessage{Type: "playback", SessionID: sessionID, RecordingID: manifest.ID, Kind: "end"})
+		return
+	}
+
+	stop := make(chan struct{})
+	h.mu.Lock()
+	state, ok := h.connections[conn]
+	if ok {
+		if old, exists := state.playbacks[sessionID]; exists {
+			close(old)
+		}
+		state.playbacks[sessionID] = stop
+	}
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	go h.playback(conn, sessionID, manifest.ID, track, frames, req, stop)
+}
+
+// playback sends frames paced by their timestamps until done or stopped
+func (h *Handler) playback(conn *websocket.Conn, sessionID, recordingID string, track *recording.PaneTrack,
+	frames []recording.Frame, req PlaybackData, stop chan struct{}) {
+	msg := PlaybackMessage{Type: "playback", SessionID: sessionID, RecordingID: recordingID}
+
+	start := msg
+	start.Kind = "start"
+	start.Rows, start.Cols = track.Height, track.Width
+	if len(frames) > 0 {
+		start.Duration = frames[len(frames)-1].Time
+	}
+	h.sendToConn(conn, start)
+
+	began := time.Now()
+	var elapsed, last float64 // Playback clock and recording time of the previous frame, in seconds
+	for _, frame := range frames {
+		gap := frame.Time - last
+		if req.SkipIdle {
+			gap = min(gap, playbackIdleCap.Seconds())
+		}
+		elapsed += max(gap, 0) / req.Speed
+		last = frame.Time
+
+		if wait := time.Until(began.Add(time.Duration(elapsed * float64(time.Second)))); wait > 0 {
+			select {
+			case <-stop:
+				return
+			case <-time.After(wait):
+			}
+		} else {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+
+		out := msg
+		out.Kind = frame.Kind
+		out.Time = frame.Time
+		if frame.Kind == "o" {
+			out.Data = base64.StdEncoding.EncodeToString([]byte(frame.Data))
+		} else {
+			out.Data = frame.Data
+		}
+		h.sendToConn(conn, out)
+	}
+
+	end := msg
+	end.Kind = "end"
+	end.Time = last
+	h.sendToConn(conn, end)
+	h.finishPlayback(conn, sessionID, stop)
+}
+
+// finishPlayback forgets a playback that ran to completion
+func (h *Handler) finishPlayback(conn *websocket.Conn, sessionID string, stop chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if state, ok := h.connections[conn]; ok && state.playbacks[sessionID] == stop {
+		delete(state.playbacks, sessionID)
+	}
+}
+
+// handleStopPlayback stops a playback of a session on this connection
+func (h *Handler) handleStopPlayback(conn *websocket.Conn, sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if state, ok := h.connections[conn]; ok {
+		if stop, exists := state.playbacks[sessionID]; exists {
+			close(stop)
+			delete(state.playbacks, sessionID)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// projectConfigFile is the per-repository config read from the git root
+const projectConfigFile = ".claudex.json"
+
+// setupTimeout bounds each setup command of a new worktree
+const setupTimeout = 30 * time.Minute
+
+// setupReplayLimit is how much setup output is kept to replay to subscribers
+// that join after it was sent
+const setupReplayLimit = 64 << 10
+
+// defaultCopyFiles are copied into new worktrees of repositories without a
+// .claudex.json: untracked config a checkout usually needs to run
+var defaultCopyFiles = []string{".env", "config.json", "config.local.json", ".env.local"}
+
+// ProjectConfig is .claudex.json at a repository's root, saying how new
+// experiment worktrees are prepared. Paths are globs relative to the root.
+type ProjectConfig struct {
+	CopyFiles    []string `json:"copy_files"`    // Copied from the repository root (directories recursively)
+	SymlinkFiles []string `json:"symlink_files"` // Linked to the repository root's copy, e.g. node_modules
+	Setup        []string `json:"setup"`         // Shell commands run in the new worktree, in order, e.g. "npm install"
+}
+
+// readProjectConfig reads .claudex.json from the git root; without one, the
+// default config files are copied
+func readProjectConfig(gitRoot string) (*ProjectConfig, error) {
+	path := filepath.Join(gitRoot, projectConfigFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &ProjectConfig{CopyFiles: defaultCopyFiles}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config ProjectConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, pattern := range append(append([]string{}, config.CopyFiles...), config.SymlinkFiles...) {
+		if err := checkProjectPattern(pattern); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return &config, nil
+}
+
+// checkProjectPattern rejects globs that are malformed or reach outside the
+// repository
+func checkProjectPattern(pattern string) error {
+	if !filepath.IsLocal(pattern) {
+		return fmt.Errorf("%q must be a path inside the repository", pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q", pattern)
+	}
+	return nil
+}
+
+// prepareWorktree copies and links the project's files from the git root into
+// a new worktree, plus the request's copyFiles and linkFiles. Files already
+// checked out are only overwritten by copies. Missing files are skipped.
+func (p *ProjectConfig) prepareWorktree(gitRoot, worktreePath string, copyFiles, linkFiles []string) {
+	each := func(patterns []string, fn func(src, dst string) error) {
+		for _, pattern := range patterns {
+			if checkProjectPattern(pattern) != nil {
+				continue
+			}
+			matches, _ := filepath.Glob(filepath.Join(gitRoot, pattern))
+			for _, src := range matches {
+				rel, err := filepath.Rel(gitRoot, src)
+				if err != nil || rel == ".git" {
+					continue
+				}
+				dst := filepath.Join(worktreePath, rel)
+				os.MkdirAll(filepath.Dir(dst), 0755)
+				if err := fn(src, dst); err != nil {
+					slog.Warn("Failed to prepare worktree file", "worktree", worktreePath, "file", rel, "err", err)
+				}
+			}
+		}
+	}
+
+	each(append(append([]string{}, p.CopyFiles...), copyFiles...), copyPath)
+	each(append(append([]string{}, p.SymlinkFiles...), linkFiles...), func(src, dst string) error {
+		if _, err := os.Lstat(dst); err == nil {
+			return nil // Tracked, or already copied
+		}
+		return os.Symlink(src, dst)
+	})
+}
+
+// copyPath copies a file, or a directory that doesn't exist at dst yet
+func copyPath(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if _, err := os.Lstat(dst); err == nil {
+			return fmt.Errorf("directory already exists")
+		}
+		return os.CopyFS(dst, os.DirFS(src))
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, info.Mode().Perm())
+}
+
+// beginSetup runs the project's setup commands in a new experiment worktree
+// in the background. The session can't be started until they finish; start,
+// if set, is called once they all pass.
+func (h *Handler) beginSetup(sessionID, worktreePath string, commands []string, start func()) {
+	if len(commands) == 0 {
+		return
+	}
+	hb := h.getHub(sessionID)
+	hb.mu.Lock()
+	hb.settingUp = true
+	hb.mu.Unlock()
+
+	go func() {
+		err := h.runSetup(sessionID, worktreePath, commands)
+		hb.mu.Lock()
+		hb.settingUp = false
+		hb.mu.Unlock()
+		if err == nil && start != nil {
+			start()
+		}
+	}()
+}
+
+// isSettingUp reports whether the session's setup commands are running
+func (h *Handler) isSettingUp(sessionID string) bool {
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return false
+	}
+	hb.mu.RLock()
+	defer hb.mu.RUnlock()
+	return hb.settingUp
+}
+
+// runSetup runs setup commands in a worktree, streaming their output to the
+// session's subscribers as "setup_output" messages. It stops at the first
+// failing command.
+func (h *Handler) runSetup(sessionID, worktreePath string, commands []string) error {
+	for _, command := range commands {
+		ctx, cancel := context.WithTimeout(context.Background(), setupTimeout)
+		exitCode, _, err := h.runStreamed(ctx, "setup_output", sessionID, worktreePath, command)
+		cancel()
+		if err != nil {
+			slog.Warn("Worktree setup failed", "session", sessionID, "command", command, "exit_code", exitCode, "err", err)
+			return err
+		}
+	}
+	slog.Info("Worktree setup done", "session", sessionID, "commands", len(commands))
+	return nil
+}
+
+// keepSetupOutput keeps a setup_output message to replay to later
+// subscribers, dropping the oldest beyond setupReplayLimit
+func (h *Handler) keepSetupOutput(msg CommandOutputMessage) {
+	hb := h.lookupHub(msg.SessionID)
+	if hb == nil {
+		return // Deleted meanwhile
+	}
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	hb.setupOutput = append(hb.setupOutput, msg)
+	size := 0
+	for i := len(hb.setupOutput) - 1; i >= 0; i-- {
+		if size += len(hb.setupOutput[i].Data); size > setupReplayLimit {
+			hb.setupOutput = slices.Delete(hb.setupOutput, 0, i+1)
+			break
+		}
+	}
+}
+
+// sendSetupOutput replays the session's setup output to a new subscriber
+func (h *Handler) sendSetupOutput(conn *websocket.Conn, sessionID string) {
+	hb := h.lookupHub(sessionID)
+	if hb == nil {
+		return
+	}
+	hb.mu.RLock()
+	output := slices.Clone(hb.setupOutput)
+	hb.mu.RUnlock()
+	for _, msg := range output {
+		h.sendToConn(conn, msg)
+	}
+}
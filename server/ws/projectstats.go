@@ -0,0 +1,114 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"claudex/session"
+)
+
+// ProjectStats is the agent work done in one working directory, by the
+// sessions claudex has now and the ones deleted since the ledger began
+type ProjectStats struct {
+	Directory   string `json:"directory"`
+	Sessions    int    `json:"sessions"`      // Including deleted ones
+	Active      int    `json:"active"`        // Sessions that still exist
+	Experiments int    `json:"experiments"`   // Including deleted ones
+	AgentTimeMs int64  `json:"agent_time_ms"` // Time Claude spent thinking or executing
+	Merged      int    `json:"merged"`        // Experiments whose worktree was merged
+	Discarded   int    `json:"discarded"`     // Experiments whose worktree was discarded
+}
+
+// projectDir returns the directory a session's work counts towards: its root
+// session's, so experiments count towards the repository they branched from
+// even once their parent is deleted
+func (h *Handler) projectDir(sess *session.Session) string {
+	root := h.rootSession(sess)
+	if root.ParentID == "" {
+		return root.Directory
+	}
+	if repo := mainRepo(root.Directory); repo != "" {
+		return repo
+	}
+	// The worktree is gone too; the ledger remembers the parent's project
+	if ledger, err := h.manager.ProjectLedger(); err == nil {
+		for _, rec := range ledger {
+			if rec.SessionID == root.ParentID {
+				return rec.Project
+			}
+		}
+	}
+	return root.Directory
+}
+
+// HandleProjects returns per-directory statistics, most agent time first
+func (h *Handler) HandleProjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ledger, err := h.manager.ProjectLedger()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	projects := make(map[string]*ProjectStats)
+	project := func(dir string) *ProjectStats {
+		p, ok := projects[dir]
+		if !ok {
+			p = &ProjectStats{Directory: dir}
+			projects[dir] = p
+		}
+		return p
+	}
+
+	for _, sess := range h.manager.List(session.ListOptions{}) {
+		p := project(h.projectDir(sess))
+		p.Sessions++
+		p.Active++
+		if sess.ParentID != "" {
+			p.Experiments++
+		}
+		p.AgentTimeMs += sess.AgentTime().Milliseconds()
+	}
+
+	// A session's outcome is its last merge or discard
+	outcomes := make(map[string]session.ProjectRecord)
+	for _, rec := range ledger {
+		switch rec.Event {
+		case session.ProjectEventDeleted:
+			p := project(rec.Project)
+			p.Sessions++
+			if rec.Experiment {
+				p.Experiments++
+			}
+			p.AgentTimeMs += rec.AgentTimeMs
+		case session.ProjectEventMerged, session.ProjectEventDiscarded:
+			outcomes[rec.SessionID] = rec
+		}
+	}
+	for _, rec := range outcomes {
+		p := project(rec.Project)
+		if rec.Event == session.ProjectEventMerged {
+			p.Merged++
+		} else {
+			p.Discarded++
+		}
+	}
+
+	result := make([]ProjectStats, 0, len(projects))
+	for _, p := range projects {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AgentTimeMs != result[j].AgentTimeMs {
+			return result[i].AgentTimeMs > result[j].AgentTimeMs
+		}
+		return result[i].Directory < result[j].Directory
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,228 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"claudex/session"
+)
+
+// PruneRequest is the optional body of POST /api/worktree/prune
+type PruneRequest struct {
+	DryRun *bool `json:"dry_run"` // Only report the orphans (default true)
+	Force  bool  `json:"force"`   // Also remove dirty worktrees and unmerged branches
+}
+
+// OrphanWorktree is an experiment worktree no session uses
+type OrphanWorktree struct {
+	Repo    string `json:"repo"`
+	Path    string `json:"path"`
+	Branch  string `json:"branch,omitempty"`
+	Missing bool   `json:"missing,omitempty"` // The directory is gone, only git's record is left
+	Dirty   bool   `json:"dirty,omitempty"`   // Has uncommitted changes, kept without force
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// OrphanBranch is an experiment branch no worktree or session uses
+type OrphanBranch struct {
+	Repo    string `json:"repo"`
+	Branch  string `json:"branch"`
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PruneReport is the response of POST /api/worktree/prune
+type PruneReport struct {
+	DryRun    bool             `json:"dry_run"`
+	Repos     []string         `json:"repos"` // Repositories checked: those experiments were created in
+	Worktrees []OrphanWorktree `json:"worktrees"`
+	Branches  []OrphanBranch   `json:"branches"`
+}
+
+// worktreeEntry is a worktree as listed by git worktree list --porcelain
+type worktreeEntry struct {
+	path      string
+	branch    string
+	prunable  bool
+	isPrimary bool
+}
+
+// HandleWorktreePrune finds experiment worktrees and branches left behind
+// by sessions deleted outside the normal flow and removes them
+// (PruneRequest). Only worktrees and branches claudex recorded creating are
+// considered, so ones made by hand are left alone. Without dry_run: false it
+// only reports what it would remove. Branches are deleted with git branch
+// -d, which keeps unmerged ones unless forced.
+func (h *Handler) HandleWorktreePrune(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PruneRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	dryRun := req.DryRun == nil || *req.DryRun
+
+	records, err := h.manager.CreatedWorktrees()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	created := make(map[string]bool)                    // Worktree paths
+	createdBranches := make(map[string]map[string]bool) // Repo to branches
+	for _, rec := range records {
+		created[rec.Path] = true
+		if createdBranches[rec.Repo] == nil {
+			createdBranches[rec.Repo] = make(map[string]bool)
+		}
+		createdBranches[rec.Repo][rec.Branch] = true
+	}
+
+	sessions := h.manager.List(session.ListOptions{})
+	used := func(path string) bool {
+		for _, s := range sessions {
+			if inDir(s.Directory, path) {
+				return true
+			}
+		}
+		return false
+	}
+	sessionBranches := make(map[string]bool)
+	for _, s := range sessions {
+		if s.Branch != "" {
+			sessionBranches[s.Branch] = true
+		}
+	}
+	// The server's own worktree belongs to no session but is in use
+	own := getWorktreeInfo()
+
+	report := PruneReport{DryRun: dryRun, Repos: []string{}, Worktrees: []OrphanWorktree{}, Branches: []OrphanBranch{}}
+	for repo := range createdBranches {
+		if _, err := os.Stat(repo); err == nil {
+			report.Repos = append(report.Repos, repo)
+		}
+	}
+	sort.Strings(report.Repos)
+
+	for _, repo := range report.Repos {
+		checkedOut := make(map[string]bool)
+		for _, wt := range listWorktrees(repo) {
+			orphan := !wt.isPrimary && created[wt.path] && !used(wt.path) &&
+				!(own.IsWorktree && filepath.Clean(own.Path) == wt.path)
+			if !orphan {
+				if wt.branch != "" {
+					checkedOut[wt.branch] = true
+				}
+				continue
+			}
+
+			o := OrphanWorktree{Repo: repo, Path: wt.path, Branch: wt.branch, Missing: wt.prunable}
+			if !o.Missing {
+				o.Dirty = gitOutput(wt.path, "status", "--porcelain") != ""
+			}
+			switch {
+			case o.Dirty && !req.Force:
+				o.Error = "uncommitted changes (force to remove)"
+			case dryRun:
+			default:
+				args := []string{"worktree", "remove", wt.path}
+				if o.Dirty {
+					args = []string{"worktree", "remove", "--force", wt.path}
+				}
+				if o.Missing {
+					args = []string{"worktree", "prune"}
+				}
+				cmd := exec.Command("git", args...)
+				cmd.Dir = repo
+				if out, err := cmd.CombinedOutput(); err != nil {
+					o.Error = strings.TrimSpace(string(out))
+				} else {
+					o.Removed = true
+				}
+			}
+			if o.Error != "" && wt.branch != "" {
+				// Kept, and so is its branch
+				checkedOut[wt.branch] = true
+			}
+			report.Worktrees = append(report.Worktrees, o)
+		}
+
+		// Branches of removed worktrees go too, with ones left behind earlier
+		for _, branch := range strings.Fields(gitOutput(repo, "for-each-ref", "--format=%(refname:short)", "refs/heads/")) {
+			if !createdBranches[repo][branch] || checkedOut[branch] || sessionBranches[branch] {
+				continue
+			}
+			o := OrphanBranch{Repo: repo, Branch: branch}
+			if !dryRun {
+				flag := "-d"
+				if req.Force {
+					flag = "-D"
+				}
+				cmd := exec.Command("git", "branch", flag, branch)
+				cmd.Dir = repo
+				if out, err := cmd.CombinedOutput(); err != nil {
+					o.Error = strings.TrimSpace(string(out))
+				} else {
+					o.Removed = true
+				}
+			}
+			report.Branches = append(report.Branches, o)
+		}
+	}
+	if !dryRun {
+		slog.Info("Pruned orphan worktrees", "worktrees", len(report.Worktrees), "branches", len(report.Branches))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// mainRepo returns the root of the main worktree of the repository dir is
+// in, or "" outside one
+func mainRepo(dir string) string {
+	common := gitOutput(dir, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if common == "" || filepath.Base(common) != ".git" {
+		return ""
+	}
+	return filepath.Dir(common)
+}
+
+// listWorktrees returns the worktrees of a repository, the main one first
+func listWorktrees(repo string) []worktreeEntry {
+	var entries []worktreeEntry
+	for i, block := range strings.Split(gitOutput(repo, "worktree", "list", "--porcelain"), "\n\n") {
+		var e worktreeEntry
+		for _, line := range strings.Split(block, "\n") {
+			key, value, _ := strings.Cut(line, " ")
+			switch key {
+			case "worktree":
+				e.path = filepath.Clean(value)
+			case "branch":
+				e.branch = strings.TrimPrefix(value, "refs/heads/")
+			case "prunable":
+				e.prunable = true
+			}
+		}
+		if e.path == "" {
+			continue
+		}
+		e.isPrimary = i == 0
+		if _, err := os.Stat(e.path); err != nil {
+			e.prunable = true
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"claudex/forge"
+	"claudex/session"
+)
+
+// pushTimeout bounds the git push before a pull request is opened
+const pushTimeout = 2 * time.Minute
+
+// SetForges configures the forges pull requests are opened on
+func (h *Handler) SetForges(configs []forge.Config) error {
+	forges, err := forge.New(configs)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.forges = forges
+	return nil
+}
+
+// handlePullRequest commits an experiment's pending changes, pushes its
+// branch and opens a pull request for it on the forge configured for the
+// remote, so the work goes through review instead of a direct merge
+func (h *Handler) handlePullRequest(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PullRequestRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Only experiments have a branch of their own
+	if sess.ParentID == "" {
+		http.Error(w, "Not an experiment", http.StatusBadRequest)
+		return
+	}
+	parent, ok := h.manager.Get(sess.ParentID)
+	if !ok {
+		http.Error(w, "Parent session not found", http.StatusNotFound)
+		return
+	}
+	dir := sess.Directory
+	branch := gitOutput(dir, "branch", "--show-current")
+	if branch == "" {
+		http.Error(w, "Experiment worktree is not on a branch", http.StatusConflict)
+		return
+	}
+	base := h.mergeTarget(parent.Directory, req.Base)
+	if !branchExists(parent.Directory, base) {
+		http.Error(w, fmt.Sprintf("No branch %q to open the pull request against", base), http.StatusBadRequest)
+		return
+	}
+
+	remoteName := req.Remote
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+	remote, err := forge.ParseRemote(gitOutput(dir, "remote", "get-url", remoteName))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Remote %q: %v", remoteName, err), http.StatusBadRequest)
+		return
+	}
+	h.mu.RLock()
+	forges := h.forges
+	h.mu.RUnlock()
+	provider, err := forges.For(remote)
+	if err != nil {
+		http.Error(w, err.Error()+" (forges in config.json)", http.StatusServiceUnavailable)
+		return
+	}
+
+	message := req.Message
+	if message == "" {
+		message = "WIP: Auto-commit before pull request"
+	}
+	if err := commitPending(dir, message); err != nil {
+		http.Error(w, "Failed to commit changes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	commits := gitOutput(dir, "log", "--reverse", "--format=%s", base+".."+branch)
+	if commits == "" {
+		http.Error(w, fmt.Sprintf("%s has no commits that %s lacks", branch, base), http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), pushTimeout)
+	defer cancel()
+	push := exec.CommandContext(ctx, "git", "push", "--set-upstream", remoteName, branch)
+	push.Dir = dir
+	if out, err := push.CombinedOutput(); err != nil {
+		http.Error(w, "Failed to push: "+strings.TrimSpace(string(out)), http.StatusBadGateway)
+		return
+	}
+
+	// A single commit titles the pull request; several are listed in it
+	subjects := strings.Split(commits, "\n")
+	title, body := req.Title, req.Body
+	if title == "" {
+		title = branch
+		if len(subjects) == 1 {
+			title = subjects[0]
+		}
+	}
+	if body == "" && len(subjects) > 1 {
+		body = "* " + strings.Join(subjects, "\n* ")
+	}
+
+	pr, err := provider.CreatePullRequest(forge.NewPullRequest{
+		Repo:  remote.Repo,
+		Head:  branch,
+		Base:  base,
+		Title: title,
+		Body:  body,
+		Draft: req.Draft,
+	})
+	if err != nil {
+		http.Error(w, "Failed to open pull request: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	slog.Info("Opened pull request", "session", sess.ID, "url", pr.URL, "existing", pr.Existing)
+
+	if err := sess.SetMetadata(session.PullRequestKey, pr.URL); err == nil {
+		h.manager.UpdateSession(sess)
+		h.broadcastSessionList()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !pr.Existing {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(pr)
+}
+
+// commitPending commits everything in the worktree, tracked or not, if
+// anything changed
+func commitPending(dir, message string) error {
+	add := exec.Command("git", "add", "-A")
+	add.Dir = dir
+	if out, err := add.CombinedOutput(); err != nil {
+		return fmt.Errorf("git add: %s", strings.TrimSpace(string(out)))
+	}
+	staged := exec.Command("git", "diff", "--cached", "--quiet")
+	staged.Dir = dir
+	if staged.Run() == nil {
+		return nil // Nothing to commit
+	}
+	commit := exec.Command("git", "commit", "-m", message)
+	commit.Dir = dir
+	if out, err := commit.CombinedOutput(); err != nil {
+		return fmt.Errorf("git commit: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"claudex/session"
+)
+
+// UserHeader names the user a REST request acts for (counted against their quota)
+const UserHeader = "X-Claudex-User"
+
+// QuotaExceededMessage tells a client why a session was not started
+type QuotaExceededMessage struct {
+	Type      string                      `json:"type"`
+	SessionID string                      `json:"session_id"`
+	Error     *session.QuotaExceededError `json:"error"`
+}
+
+// claim builds the quota claim for a creation request, the override from the
+// admin header. The owner is the user of the request's token; only admins
+// may name another (owner from the body, or the user header).
+func (h *Handler) claim(r *http.Request, owner string) session.Claim {
+	return h.manager.ClaimFor(r.Header.Get(session.AdminHeader), r.Header.Get(session.UserTokenHeader),
+		owner, r.Header.Get(UserHeader))
+}
+
+// writeQuotaError responds 429 with the structured error if err is a quota
+// violation. It returns false for any other error.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *session.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": quotaErr.Error(),
+		"quota": quotaErr,
+	})
+	return true
+}
+
+// HandleQuotas reports the configured limits with global and per-user usage
+func (h *Handler) HandleQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := h.manager.GetQuotas()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"global":   map[string]any{"quota": q.Global, "usage": h.manager.QuotaUsage("")},
+		"per_user": q.PerUser,
+		"users":    h.manager.OwnerQuotas(),
+	})
+}
@@ -0,0 +1,226 @@
+package ws
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Default rates: generous for typing, pastes and window drags, far below
+// what a runaway client sends
+var defaultRateLimits = RateLimits{
+	Input:         RateLimit{Rate: 100, Burst: 200},
+	SessionInput:  RateLimit{Rate: 200, Burst: 400},
+	Resize:        RateLimit{Rate: 10, Burst: 20},
+	SessionResize: RateLimit{Rate: 20, Burst: 40},
+}
+
+// rateNoticeInterval spaces out the rate_limited messages sent to a client
+const rateNoticeInterval = time.Second
+
+// RateLimit is a token bucket: Rate messages per second on average, up to
+// Burst at once
+type RateLimit struct {
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// RateLimits caps input and resize messages per connection and per session
+// (across all its connections). Zero fields use the defaults.
+type RateLimits struct {
+	Input         RateLimit `json:"input,omitempty"`          // Per connection (default 100/s, burst 200)
+	SessionInput  RateLimit `json:"session_input,omitempty"`  // Per session (default 200/s, burst 400)
+	Resize        RateLimit `json:"resize,omitempty"`         // Per connection (default 10/s, burst 20)
+	SessionResize RateLimit `json:"session_resize,omitempty"` // Per session (default 20/s, burst 40)
+}
+
+// Validate rejects negative rates and bursts
+func (l RateLimits) Validate() error {
+	for _, limit := range []RateLimit{l.Input, l.SessionInput, l.Resize, l.SessionResize} {
+		if limit.Rate < 0 || limit.Burst < 0 {
+			return fmt.Errorf("rate limits cannot be negative")
+		}
+	}
+	return nil
+}
+
+// withDefaults fills in zero fields
+func (l RateLimits) withDefaults() RateLimits {
+	fill := func(limit *RateLimit, def RateLimit) {
+		if limit.Rate == 0 {
+			limit.Rate = def.Rate
+		}
+		if limit.Burst == 0 {
+			limit.Burst = def.Burst
+		}
+	}
+	fill(&l.Input, defaultRateLimits.Input)
+	fill(&l.SessionInput, defaultRateLimits.SessionInput)
+	fill(&l.Resize, defaultRateLimits.Resize)
+	fill(&l.SessionResize, defaultRateLimits.SessionResize)
+	return l
+}
+
+// RateLimitedMessage tells a client its input or resize was dropped
+type RateLimitedMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+	Kind      string `json:"kind"`  // "input" or "resize"
+	Scope     string `json:"scope"` // "connection" or "session"
+}
+
+// tokenBucket refills at rate tokens per second up to burst
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{rate: limit.Rate, burst: float64(limit.Burst), tokens: float64(limit.Burst)}
+}
+
+// allow takes a token if one is available
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// buckets holds the input and resize buckets of a connection or a session
+type buckets struct {
+	input  *tokenBucket
+	resize *tokenBucket
+
+	mu       sync.Mutex
+	notified time.Time // Last rate_limited message
+}
+
+// rateLimiter keeps the configured limits and the per-session buckets
+type rateLimiter struct {
+	mu       sync.Mutex
+	limits   RateLimits
+	sessions map[string]*buckets
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{limits: defaultRateLimits, sessions: make(map[string]*buckets)}
+}
+
+// SetRateLimits sets the input and resize limits (applies to new connections
+// and to sessions from their next message)
+func (h *Handler) SetRateLimits(limits RateLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	h.limiter.mu.Lock()
+	defer h.limiter.mu.Unlock()
+	h.limiter.limits = limits.withDefaults()
+	clear(h.limiter.sessions)
+	return nil
+}
+
+// connection returns fresh buckets for a new connection
+func (l *rateLimiter) connection() *buckets {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return &buckets{input: newTokenBucket(l.limits.Input), resize: newTokenBucket(l.limits.Resize)}
+}
+
+// session returns a session's buckets, creating them if needed
+func (l *rateLimiter) session(sessionID string) *buckets {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.sessions[sessionID]
+	if b == nil {
+		b = &buckets{input: newTokenBucket(l.limits.SessionInput), resize: newTokenBucket(l.limits.SessionResize)}
+		l.sessions[sessionID] = b
+	}
+	return b
+}
+
+// forget drops a deleted session's buckets
+func (l *rateLimiter) forget(sessionID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.sessions, sessionID)
+}
+
+// allowMessage checks an input or resize message against the connection's
+// limits, and a resize against the session's too (writeInput checks input
+// against them, whatever its source). A dropped message is reported to the
+// client, at most once per rateNoticeInterval.
+func (h *Handler) allowMessage(conn *websocket.Conn, sessionID, kind string) bool {
+	h.mu.RLock()
+	state, ok := h.connections[conn]
+	h.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	connBuckets, sessBuckets := state.limits, h.limiter.session(sessionID)
+	scope := ""
+	switch kind {
+	case "input":
+		if !connBuckets.input.allow(now) {
+			scope = "connection"
+		}
+	case "resize":
+		if !connBuckets.resize.allow(now) {
+			scope = "connection"
+		} else if !sessBuckets.resize.allow(now) {
+			scope = "session"
+		}
+	}
+	if scope == "" {
+		return true
+	}
+
+	connBuckets.mu.Lock()
+	notify := now.Sub(connBuckets.notified) >= rateNoticeInterval
+	if notify {
+		connBuckets.notified = now
+	}
+	connBuckets.mu.Unlock()
+	if notify {
+		slog.Info("Rate limited client", "session", sessionID, "kind", kind, "scope", scope)
+		h.sendToConn(conn, RateLimitedMessage{Type: "rate_limited", SessionID: sessionID, Kind: kind, Scope: scope})
+	}
+	return false
+}
+
+// allowInput takes a token from the session's input bucket for input from
+// any source. Input over the limit is reported to reply, at most once per
+// rateNoticeInterval.
+func (h *Handler) allowInput(sessionID string, reply func(v any)) bool {
+	now := time.Now()
+	b := h.limiter.session(sessionID)
+	if b.input.allow(now) {
+		return true
+	}
+	b.mu.Lock()
+	notify := now.Sub(b.notified) >= rateNoticeInterval
+	if notify {
+		b.notified = now
+	}
+	b.mu.Unlock()
+	if notify {
+		slog.Info("Rate limited session input", "session", sessionID)
+		reply(RateLimitedMessage{Type: "rate_limited", SessionID: sessionID, Kind: "input", Scope: "session"})
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"claudex/recording"
+	"claudex/session"
+)
+
+// startRecordingIfEnabled begins recording a session that has recording turned on
+func (h *Handler) startRecordingIfEnabled(sess *session.Session) {
+	if !sess.RecordingEnabled() {
+		return
+	}
+	if _, err := sess.StartRecording(h.manager.GetRecordingsDir()); err != nil {
+		slog.Warn("Failed to start recording", "session", sess.ID, "err", err)
+	}
+}
+
+// handleSessionRecording enables or disables recording for a session.
+// GET with ?format=cast downloads the asciicast file of the latest recording
+// (?recording_id= picks another one, ?pane= a pane other than the main one).
+func (h *Handler) handleSessionRecording(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("format") == "cast" {
+			h.serveRecordingCast(w, r, sess)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{
+			"enabled":   sess.RecordingEnabled(),
+			"recording": sess.IsRecording(),
+		})
+
+	case http.MethodPut:
+		var req RecordingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := map[string]any{"status": "ok", "enabled": req.Enabled}
+		if req.Enabled {
+			id, err := sess.StartRecording(h.manager.GetRecordingsDir())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result["recording_id"] = id
+		} else {
+			sess.StopRecording(true)
+		}
+		h.manager.UpdateSession(sess)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveRecordingCast sends a session's asciicast v2 file for asciinema play
+func (h *Handler) serveRecordingCast(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	baseDir := h.manager.GetRecordingsDir()
+	query := r.URL.Query()
+
+	var manifest *recording.Manifest
+	var err error
+	if id := query.Get("recording_id"); id != "" {
+		manifest, err = recording.Load(baseDir, id)
+		if err == nil && manifest.SessionID != sess.ID {
+			err = os.ErrNotExist
+		}
+	} else {
+		manifest, err = recording.Latest(baseDir, sess.ID)
+	}
+	if err != nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+
+	path, err := recording.TrackPath(baseDir, manifest, query.Get("pane"))
+	if err != nil {
+		http.Error(w, "Pane not recorded", http.StatusNotFound)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.cast\"", manifest.ID))
+	io.Copy(w, file)
+}
+
+// HandleRecordings lists recordings and serves their manifests and timelines:
+// /recordings, /recordings/{id}, /recordings/{id}/{action} (action: timeline)
+func (h *Handler) HandleRecordings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	baseDir := h.manager.GetRecordingsDir()
+	id := r.PathValue("id")
+
+	if id == "" {
+		manifests, err := recording.List(baseDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sessionID := r.URL.Query().Get("session_id"); sessionID != "" {
+			filtered := []recording.Manifest{}
+			for _, m := range manifests {
+				if m.SessionID == sessionID {
+					filtered = append(filtered, m)
+				}
+			}
+			manifests = filtered
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manifests)
+		return
+	}
+
+	manifest, err := recording.Load(baseDir, id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	switch r.PathValue("action") {
+	case "":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manifest)
+
+	case "timeline":
+		// Merged multi-pane timeline for synchronized playback
+		frames, err := recording.Timeline(baseDir, manifest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if frames == nil {
+			frames = []recording.Frame{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"manifest": manifest,
+			"frames":   frames,
+		})
+
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"sync"
+	"time"
+)
+
+// replayBufferSize is the amount of recent output kept per session for resumable subscriptions
+const replayBufferSize = 256 * 1024
+
+// seqEpochShift is where a ring's epoch sits in its sequence numbers: each
+// ring numbers its output from its creation time in seconds shifted this
+// far, so a sequence number from an earlier server run (or an earlier ring
+// of the session) never matches output of this one. The numbers stay below
+// 2^53 for JavaScript clients.
+const seqEpochShift = 20
+
+// outputChunk is a piece of output tagged with its sequence number
+type outputChunk struct {
+	seq  uint64
+	data []byte
+}
+
+// outputRing keeps the most recent output chunks of a session so reconnecting
+// clients can catch up without receiving the full scrollback again
+type outputRing struct {
+	mu      sync.Mutex
+	chunks  []outputChunk
+	size    int    // Total bytes currently buffered
+	lastSeq uint64 // Sequence number of the most recent chunk
+}
+
+// newOutputRing creates a ring whose sequence numbers start at its epoch
+func newOutputRing() *outputRing {
+	return &outputRing{lastSeq: uint64(time.Now().Unix()) << seqEpochShift}
+}
+
+// Append stores a chunk and returns its sequence number
+func (r *outputRing) Append(data []byte) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastSeq++
+	chunk := outputChunk{seq: r.lastSeq, data: append([]byte(nil), data...)}
+	r.chunks = append(r.chunks, chunk)
+	r.size += len(chunk.data)
+
+	// Drop oldest chunks once over capacity (always keep the newest)
+	for r.size > replayBufferSize && len(r.chunks) > 1 {
+		r.size -= len(r.chunks[0].data)
+		r.chunks = r.chunks[1:]
+	}
+	return r.lastSeq
+}
+
+// LastSeq returns the sequence number of the most recent chunk
+func (r *outputRing) LastSeq() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastSeq
+}
+
+// Since returns the chunks after sinceSeq. ok is false when the requested
+// range is no longer (or was never) in the buffer and a full replay is needed.
+func (r *outputRing) Since(sinceSeq uint64) (chunks []outputChunk, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sinceSeq > r.lastSeq {
+		// Client saw output from a later epoch (the clock went back)
+		return nil, false
+	}
+	if sinceSeq == r.lastSeq {
+		return nil, true
+	}
+	if len(r.chunks) == 0 || r.chunks[0].seq > sinceSeq+1 {
+		// Dropped from the buffer, or from an earlier epoch
+		return nil, false
+	}
+
+	for _, chunk := range r.chunks {
+		if chunk.seq > sinceSeq {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, true
+}
+
+// getOutputRing returns the replay buffer for a session, creating it if needed
+func (h *Handler) getOutputRing(sessionID string) *outputRing {
+	return h.getHub(sessionID).ring
+}
@@ -0,0 +1,241 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"claudex/logsink"
+	"claudex/session"
+)
+
+// Request bodies of the REST API. They are also the schemas published in
+// the OpenAPI document, so every field the handlers read belongs here.
+
+// StartData holds the initial terminal size for start and restart messages
+type StartData struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// CreateSessionRequest is the body of POST /api/sessions/create
+type CreateSessionRequest struct {
+	Name           string                  `json:"name"`
+	Directory      string                  `json:"directory"`
+	HexQ           *int                    `json:"hex_q"` // Tile in the 3D world (placed automatically when absent)
+	HexR           *int                    `json:"hex_r"`
+	SplitParentID  string                  `json:"split_parent_id"`
+	StartupCommand string                  `json:"startup_command"`
+	Owner          string                  `json:"owner"`
+	Limits         *session.ResourceLimits `json:"limits"`
+	Sandbox        string                  `json:"sandbox"`
+	LogSinks       []logsink.Config        `json:"log_sinks"`
+	Backend        string                  `json:"backend"`
+	ClaudeModel    string                  `json:"claude_model"` // claude --model, e.g. "opus" ("" for Claude's default)
+	ClaudeOptions  *session.ClaudeOptions  `json:"claude_options"`
+	Recording      bool                    `json:"recording"`
+	ScrollbackMB   int                     `json:"scrollback_mb"`
+}
+
+// Validate checks the settings of the session to create
+func (req CreateSessionRequest) Validate() error {
+	if req.Limits != nil {
+		if err := req.Limits.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := session.ValidateSandbox(req.Sandbox); err != nil {
+		return err
+	}
+	if err := session.ValidateBackend(req.Backend); err != nil {
+		return err
+	}
+	if err := session.ValidateClaudeModel(req.ClaudeModel); err != nil {
+		return err
+	}
+	if req.ClaudeOptions != nil {
+		if err := req.ClaudeOptions.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, c := range req.LogSinks {
+		if err := c.ValidateSession(); err != nil {
+			return err
+		}
+	}
+	if err := session.ValidateScrollbackMB(req.ScrollbackMB); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateExperimentRequest is the body of POST /api/sessions/experiment
+type CreateExperimentRequest struct {
+	ParentID    string   `json:"parent_id"`
+	BranchName  string   `json:"branch_name"`
+	CopyFiles   []string `json:"copy_files"`
+	LinkFiles   []string `json:"link_files"` // Symlinked to the git root's copy instead of copied, e.g. node_modules
+	Owner       string   `json:"owner"`
+	ForkContext bool     `json:"fork_context"` // Start from a fork of the parent's Claude conversation
+}
+
+// BatchExperimentRequest is the body of POST /api/experiments/batch
+type BatchExperimentRequest struct {
+	ParentID    string            `json:"parent_id"`
+	Experiments []ExperimentStart `json:"experiments"`
+	CopyFiles   []string          `json:"copy_files"`
+	LinkFiles   []string          `json:"link_files"`
+	Owner       string            `json:"owner"`
+}
+
+// ExperimentStart is one experiment of a batch: its branch and the prompt
+// Claude starts on
+type ExperimentStart struct {
+	BranchName string `json:"branch_name"`
+	Prompt     string `json:"prompt"`
+}
+
+// Validate checks that every experiment has a distinct branch and a prompt
+func (req BatchExperimentRequest) Validate() error {
+	if len(req.Experiments) == 0 {
+		return errors.New("experiments is empty")
+	}
+	seen := make(map[string]bool)
+	for i, exp := range req.Experiments {
+		switch {
+		case exp.BranchName == "":
+			return fmt.Errorf("experiments[%d]: branch_name is required", i)
+		case seen[exp.BranchName]:
+			return fmt.Errorf("experiments[%d]: duplicate branch %q", i, exp.BranchName)
+		case strings.TrimSpace(exp.Prompt) == "":
+			return fmt.Errorf("experiments[%d]: prompt is required", i)
+		}
+		seen[exp.BranchName] = true
+	}
+	return nil
+}
+
+// MergeRequest is the optional body of POST /api/sessions/{id}/merge and
+// POST /api/worktree/merge
+type MergeRequest struct {
+	Into     string        `json:"into"`     // Branch to merge into (default: merge_branch, then the repository's default branch)
+	Strategy MergeStrategy `json:"strategy"` // merge-commit (default), squash or ff-only
+	Message  string        `json:"message"`  // Message of the merge or squash commit, or of the commit of pending changes with ff-only
+
+	RequireTests bool `json:"require_tests"` // Run the repository's test command in the worktree first and abort if it fails
+	KeepSession  bool `json:"keep_session"`  // Keep the experiment's session, stopped and marked merged_into, instead of deleting it
+}
+
+// DiscardRequest is the optional body of POST /api/sessions/{id}/discard and
+// POST /api/worktree/discard
+type DiscardRequest struct {
+	KeepSession bool `json:"keep_session"` // Keep the experiment's session, stopped, instead of deleting it
+}
+
+// Validate checks the merge strategy
+func (req MergeRequest) Validate() error {
+	switch req.Strategy {
+	case "", MergeCommit, MergeSquash, MergeFastForward:
+		return nil
+	}
+	return fmt.Errorf("unknown strategy %q (merge-commit, squash or ff-only)", req.Strategy)
+}
+
+// pendingMessage is the message for committing the worktree's pending
+// changes before the merge
+func (req MergeRequest) pendingMessage() string {
+	if req.Strategy == MergeFastForward && req.Message != "" {
+		return req.Message
+	}
+	return "WIP: Auto-commit before merge"
+}
+
+// PullRequestRequest is the optional body of POST /api/sessions/{id}/pull-request
+type PullRequestRequest struct {
+	Base    string `json:"base"`    // Branch to merge into (default: as for merges)
+	Remote  string `json:"remote"`  // Remote to push to (default origin)
+	Title   string `json:"title"`   // Default: the only commit's subject, else the branch name
+	Body    string `json:"body"`    // Default: the commit subjects when there are several
+	Draft   bool   `json:"draft"`   // Open as a draft
+	Message string `json:"message"` // Commit message for pending changes
+}
+
+// RenameRequest is the body of PUT /api/sessions/{id}/name
+type RenameRequest struct {
+	Name string `json:"name"`
+}
+
+// CustomizeRequest is the body of PUT /api/sessions/{id}/customize (empty fields are left as they are)
+type CustomizeRequest struct {
+	Name           string `json:"name,omitempty"`
+	RobotModel     string `json:"robot_model,omitempty"`
+	RobotColor     string `json:"robot_color,omitempty"`
+	RobotAccessory string `json:"robot_accessory,omitempty"`
+}
+
+// SandboxRequest is the body of PUT /api/sessions/{id}/sandbox ("" runs on the host)
+type SandboxRequest struct {
+	Sandbox string `json:"sandbox"`
+}
+
+// BackendRequest is the body of PUT /api/sessions/{id}/backend ("" uses the server default)
+type BackendRequest struct {
+	Backend string `json:"backend"`
+}
+
+// ClaudeModelRequest is the body of PUT /api/sessions/{id}/model ("" for Claude's default)
+type ClaudeModelRequest struct {
+	ClaudeModel string `json:"claude_model"`
+}
+
+// LocaleRequest is the body of PUT /api/sessions/{id}/locale
+type LocaleRequest struct {
+	Timezone string `json:"timezone"`
+	Locale   string `json:"locale"`
+}
+
+// StartupCommandRequest is the body of PUT /api/sessions/{id}/startup-command
+type StartupCommandRequest struct {
+	StartupCommand string `json:"startup_command"`
+}
+
+// ServicesRequest is the body of PUT /api/sessions/{id}/services
+type ServicesRequest struct {
+	Services []session.ServiceCheck `json:"services"`
+}
+
+// RunRequest is the body of POST /api/sessions/{id}/run
+type RunRequest struct {
+	Role    session.PaneRole `json:"role"`
+	Command string           `json:"command"`
+}
+
+// TagsRequest is the body of PUT /api/sessions/{id}/tags
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// InterruptRequest is the optional body of POST /api/sessions/{id}/interrupt
+type InterruptRequest struct {
+	FollowUp string `json:"follow_up"` // Typed after Claude stops
+}
+
+// MacroRecordRequest is the body of POST /api/sessions/{id}/macros/record
+type MacroRecordRequest struct {
+	Name string `json:"name"`
+}
+
+// RecordingRequest is the body of PUT /api/sessions/{id}/recording
+type RecordingRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ScrollbackLimitRequest is the body of PUT /api/sessions/{id}/scrollback
+type ScrollbackLimitRequest struct {
+	ScrollbackMB int `json:"scrollback_mb"` // 0 for the server default
+}
+
+// OutboxReplayRequest is the optional body of /api/outbox/replay (no IDs: every dead letter)
+type OutboxReplayRequest struct {
+	IDs []string `json:"ids"`
+}
@@ -0,0 +1,80 @@
+package ws
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// APIPrefix is where the current REST API is served. The unversioned /api/
+// paths remain as deprecated aliases for one release.
+const APIPrefix = "/api/v1"
+
+// legacyPrefix is the unversioned prefix of the deprecated aliases
+const legacyPrefix = "/api"
+
+// route is a REST endpoint: a path below the API prefix, with {name}
+// wildcards read by the handler through r.PathValue. Handlers check the
+// method themselves: the static file server at / would otherwise answer a
+// wrong method with 404 instead of 405.
+type route struct {
+	path    string
+	handler http.HandlerFunc
+}
+
+// routes lists every REST endpoint
+func (h *Handler) routes() []route {
+	return []route{
+		{"/sessions", h.HandleSessions},
+		{"/sessions/create", h.HandleCreateSession},
+		{"/sessions/experiment", h.HandleCreateExperiment},
+		{"/sessions/import", h.HandleImportSession},
+		{"/sessions/input", h.HandleBroadcastInput},
+		{"/sessions/tree", h.HandleSessionTree},
+		{"/sessions/{id}", h.HandleSessionUpdate},
+		{"/sessions/{id}/{rest...}", h.HandleSessionUpdate},
+		{"/experiments/batch", h.HandleExperimentBatch},
+		{"/client-state", h.HandleClientState},
+		{"/ports", h.HandlePorts},
+		{"/quotas", h.HandleQuotas},
+		{"/usage", h.HandleUsage},
+		{"/projects", h.HandleProjects},
+		{"/metadata/schema", h.HandleMetadataSchema},
+		{"/onboarding/demo", h.HandleDemo},
+		{"/worktree", h.HandleWorktree},
+		{"/worktree/merge", h.HandleWorktreeMerge},
+		{"/worktree/merge/preview", h.HandleWorktreeMergePreview},
+		{"/worktree/discard", h.HandleWorktreeDiscard},
+		{"/worktree/prune", h.HandleWorktreePrune},
+		{"/recordings", h.HandleRecordings},
+		{"/recordings/{id}", h.HandleRecordings},
+		{"/recordings/{id}/{action}", h.HandleRecordings},
+		{"/rules/export", h.HandleRulesExport},
+		{"/rules/import", h.HandleRulesImport},
+		{"/outbox", h.HandleOutbox},
+		{"/outbox/replay", h.HandleOutboxReplay},
+		{"/system", h.HandleSystem},
+		{"/openapi.json", h.HandleOpenAPI},
+	}
+}
+
+// RegisterRoutes adds the REST API to mux under APIPrefix, and the same
+// endpoints under the legacy /api/ paths marked as deprecated
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	for _, rt := range h.routes() {
+		mux.HandleFunc(APIPrefix+rt.path, rt.handler)
+		mux.HandleFunc(legacyPrefix+rt.path, deprecated(rt.handler))
+	}
+}
+
+// deprecated marks responses of a legacy path with the Deprecation header and
+// a link to the versioned path that replaces it
+func deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		successor := APIPrefix + strings.TrimPrefix(r.URL.Path, legacyPrefix)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		slog.Debug("Deprecated API path", "path", r.URL.Path, "successor", successor)
+		next(w, r)
+	}
+}
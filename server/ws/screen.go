@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"claudex/session"
+	"claudex/vt"
+)
+
+// ScreenMessage carries the rendered screen of a session to a new
+// subscriber in place of its raw scrollback. Writing Data to a blank
+// terminal reproduces the screen, cursor and input modes.
+type ScreenMessage struct {
+	Type      string    `json:"type"`
+	SessionID string    `json:"session_id"`
+	Data      string    `json:"data"` // Base64 encoded
+	Seq       uint64    `json:"seq"`  // Output sequence the screen is current to
+	Rows      int       `json:"rows"`
+	Cols      int       `json:"cols"`
+	Cursor    vt.Cursor `json:"cursor"`
+	AltScreen bool      `json:"alt_screen"`
+}
+
+// getScreen returns the session's emulated screen. A screen that doesn't
+// exist yet (first output, or after a server restart) is rebuilt from the
+// stored scrollback, which already holds the output being broadcast.
+func (h *Handler) getScreen(sessionID string) (term *vt.Terminal, created bool) {
+	hb := h.getHub(sessionID)
+	hb.mu.RLock()
+	term = hb.screen
+	hb.mu.RUnlock()
+	if term != nil {
+		return term, false
+	}
+
+	rows, cols := 24, 80
+	sess, ok := h.manager.Get(sessionID)
+	if ok {
+		if pane := sess.GetMainPane(); pane != nil {
+			if r, c := pane.GetSize(); r > 0 && c > 0 {
+				rows, cols = int(r), int(c)
+			}
+		}
+	}
+	term = vt.New(rows, cols)
+	if ok {
+		sess.WriteScrollback(term)
+	}
+
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if hb.screen != nil {
+		return hb.screen, false
+	}
+	hb.screen = term
+	return term, true
+}
+
+// writeScreen feeds broadcast output to the session's screen
+func (h *Handler) writeScreen(sessionID string, data []byte) {
+	if term, created := h.getScreen(sessionID); !created {
+		term.Write(data)
+	}
+}
+
+// resizeScreen keeps the session's screen the size of its terminal
+func (h *Handler) resizeScreen(sessionID string, rows, cols uint16) {
+	term, _ := h.getScreen(sessionID)
+	term.Resize(int(rows), int(cols))
+}
+
+// screenMessage renders the session's screen for a new subscriber, with the
+// sequence number of the last output on it
+func (h *Handler) screenMessage(sessionID string) ScreenMessage {
+	hb := h.getHub(sessionID)
+	hb.screenMu.Lock()
+	term, _ := h.getScreen(sessionID)
+	snap := term.Snapshot()
+	seq := hb.ring.LastSeq()
+	hb.screenMu.Unlock()
+	return ScreenMessage{
+		Type:      "screen",
+		SessionID: sessionID,
+		Data:      base64.StdEncoding.EncodeToString(snap.Data),
+		Seq:       seq,
+		Rows:      snap.Rows,
+		Cols:      snap.Cols,
+		Cursor:    snap.Cursor,
+		AltScreen: snap.AltScreen,
+	}
+}
+
+// handleSessionScreen returns the visible screen as text lines with the cursor
+func (h *Handler) handleSessionScreen(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	term, _ := h.getScreen(sess.ID)
+	snap := term.Snapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"rows":       snap.Rows,
+		"cols":       snap.Cols,
+		"cursor":     snap.Cursor,
+		"alt_screen": snap.AltScreen,
+		"lines":      term.Text(),
+	})
+}
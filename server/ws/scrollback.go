@@ -0,0 +1,185 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"claudex/session"
+	"claudex/vt"
+)
+
+const (
+	defaultSearchContext = 2   // Lines of context around each match
+	maxSearchContext     = 20  // Upper bound for ?context
+	defaultSearchLimit   = 100 // Matches returned
+)
+
+// ScrollbackMatch is one search hit in a session's scrollback
+type ScrollbackMatch struct {
+	Offset int      `json:"offset"` // Byte offset in the plain scrollback
+	Length int      `json:"length"` // Match length in plain bytes
+	Line   int      `json:"line"`   // 1-based line number in the plain scrollback
+	Column int      `json:"column"` // Byte offset of the match in its line
+	Text   string   `json:"text"`   // The matching line
+	Before []string `json:"before"` // Context lines before
+	After  []string `json:"after"`  // Context lines after
+}
+
+// handleSessionScrollback serves the scrollback download, search and limit:
+//
+//	GET /api/sessions/{id}/scrollback?format=plain|raw
+//	PUT /api/sessions/{id}/scrollback {"scrollback_mb": 4}
+//	GET /api/sessions/{id}/scrollback/search?q=...&regex=true&ignore_case=true&context=2&limit=100
+func (h *Handler) handleSessionScrollback(w http.ResponseWriter, r *http.Request, sess *session.Session, parts []string) {
+	action := ""
+	if len(parts) > 0 {
+		action = parts[0]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		handleScrollbackDownload(w, r, sess)
+	case action == "" && r.Method == http.MethodPut:
+		h.handleScrollbackLimit(w, r, sess)
+	case action == "search" && r.Method == http.MethodGet:
+		handleScrollbackSearch(w, r, sess)
+	case action == "" || action == "search":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleScrollbackLimit sets the session's scrollback limit (0 for the server default)
+func (h *Handler) handleScrollbackLimit(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	var req ScrollbackLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sess.SetScrollbackLimit(req.ScrollbackMB); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.manager.UpdateSession(sess)
+	h.manager.SaveScrollback(sess)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":        "ok",
+		"scrollback_mb": req.ScrollbackMB,
+		"limit_bytes":   sess.GetScrollbackLimit(),
+	})
+}
+
+// plainScrollback replays the session's scrollback on a terminal of the
+// session's size and returns the lines of text it left
+func plainScrollback(sess *session.Session) []string {
+	rows, cols := 24, 80
+	if pane := sess.GetMainPane(); pane != nil {
+		if r, c := pane.GetSize(); r > 0 && c > 0 {
+			rows, cols = int(r), int(c)
+		}
+	}
+	return vt.Plain(sess.GetScrollback(), rows, cols)
+}
+
+// handleScrollbackDownload sends the scrollback as a file. The plain format (the
+// default) replays it on a terminal so only the text remains, as it looked;
+// raw keeps the escape sequences for replaying with cat or less -R.
+func handleScrollbackDownload(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	var data []byte
+	ext := "txt"
+	switch r.URL.Query().Get("format") {
+	case "", "plain":
+		data = []byte(strings.Join(plainScrollback(sess), "\n") + "\n")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	case "raw":
+		data = sess.GetScrollback()
+		ext = "log"
+		w.Header().Set("Content-Type", "application/octet-stream")
+	default:
+		http.Error(w, "Invalid format (plain or raw)", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"claudex-session-%s.%s\"", sess.ID, ext))
+	w.Write(data)
+}
+
+// handleScrollbackSearch returns the matches for ?q= with surrounding lines.
+// Matches don't span lines.
+func handleScrollbackSearch(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		http.Error(w, "Missing q", http.StatusBadRequest)
+		return
+	}
+	pattern := q
+	if query.Get("regex") != "true" {
+		pattern = regexp.QuoteMeta(q)
+	}
+	if query.Get("ignore_case") == "true" {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		http.Error(w, "Invalid regex: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	context := defaultSearchContext
+	if v := query.Get("context"); v != "" {
+		if context, err = strconv.Atoi(v); err != nil || context < 0 || context > maxSearchContext {
+			http.Error(w, "Invalid context", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultSearchLimit
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	matches, truncated := searchScrollback(plainScrollback(sess), re, context, limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"matches":   matches,
+		"truncated": truncated,
+	})
+}
+
+// searchScrollback finds re in lines of plain text, returning up to limit
+// matches and whether there are more
+func searchScrollback(lines []string, re *regexp.Regexp, context, limit int) ([]ScrollbackMatch, bool) {
+	matches := []ScrollbackMatch{}
+	offset := 0 // Of the line in the plain text
+	for line, text := range lines {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[1] == loc[0] {
+				continue // Empty matches (e.g. "x*") carry no information
+			}
+			if len(matches) == limit {
+				return matches, true
+			}
+			m := ScrollbackMatch{
+				Offset: offset + loc[0],
+				Length: loc[1] - loc[0],
+				Line:   line + 1,
+				Column: loc[0],
+				Text:   text,
+				Before: lines[max(0, line-context):line],
+				After:  lines[line+1 : min(len(lines), line+1+context)],
+			}
+			matches = append(matches, m)
+		}
+		offset += len(text) + 1
+	}
+	return matches, false
+}
@@ -0,0 +1,279 @@
+package ws
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Backpressure policies for a connection whose send queue is full
+const (
+	PolicyCoalesce   = "coalesce"   // Merge queued output chunks of a session into one message
+	PolicyDrop       = "drop"       // Drop output and ask the client to resync from its last seq
+	PolicyDisconnect = "disconnect" // Close the connection; the client reconnects and resumes
+)
+
+const (
+	defaultQueueSize = 256              // Messages queued per connection
+	maxQueueBytes    = 16 * 1024 * 1024 // Queued bytes after which a connection is closed regardless of policy
+)
+
+// errQueueClosed is returned when writing to a connection that is gone or was cut off
+var errQueueClosed = errors.New("connection send queue closed")
+
+// Backpressure configures how slow clients are handled
+type Backpressure struct {
+	QueueSize int    `json:"queue_size,omitempty"` // Messages queued per connection (default 256)
+	Policy    string `json:"policy,omitempty"`     // "coalesce" (default), "drop" or "disconnect"
+}
+
+// Validate rejects unknown policies and negative sizes
+func (b Backpressure) Validate() error {
+	switch b.Policy {
+	case "", PolicyCoalesce, PolicyDrop, PolicyDisconnect:
+	default:
+		return fmt.Errorf("unknown backpressure policy: %s", b.Policy)
+	}
+	if b.QueueSize < 0 {
+		return fmt.Errorf("queue_size must not be negative")
+	}
+	return nil
+}
+
+// ResyncMessage tells a client that output was dropped and it should
+// subscribe again with its last seq to catch up
+type ResyncMessage struct {
+	Type      string `json:"type"`
+	SessionID string `json:"session_id"`
+}
+
+// outgoing is a queued message. Output keeps its raw chunk so queued
+// chunks of a session can be merged before they are encoded.
+type outgoing struct {
+	messageType int
+	data        []byte // Encoded message (nil for merged output, encoded on write)
+	sessionID   string // Set for output only
+	output      []byte // Shared with other connections until merged into
+	merged      bool   // output is a private copy
+	seq         uint64
+}
+
+func (o *outgoing) size() int {
+	return len(o.data) + len(o.output)
+}
+
+// absorb appends a later output chunk of the same session
+func (o *outgoing) absorb(next *outgoing) {
+	if !o.merged {
+		o.output = append([]byte(nil), o.output...)
+		o.merged = true
+	}
+	o.output = append(o.output, next.output...)
+	o.seq = next.seq
+	o.data = nil
+}
+
+// sendQueue buffers messages for one connection, written by its own
+// goroutine so a slow client never blocks broadcasts to the others
+type sendQueue struct {
+	mu       sync.Mutex
+	items    []*outgoing
+	bytes    int
+	limit    int
+	policy   string
+	desynced map[string]bool // Sessions whose output is being dropped -> resync message sent
+	closed   bool
+	wake     chan struct{}
+}
+
+func newSendQueue(config Backpressure) *sendQueue {
+	q := &sendQueue{
+		limit:    config.QueueSize,
+		policy:   config.Policy,
+		desynced: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+	if q.limit <= 0 {
+		q.limit = defaultQueueSize
+	}
+	if q.policy == "" {
+		q.policy = PolicyCoalesce
+	}
+	return q
+}
+
+// push queues an item, applying the backpressure policy when the queue is full
+func (q *sendQueue) push(item *outgoing) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return errQueueClosed
+	}
+
+	if item.sessionID != "" {
+		if q.policy == PolicyCoalesce && q.merge(item) {
+			if q.bytes > maxQueueBytes {
+				return q.cut()
+			}
+			return q.signal()
+		}
+		if _, ok := q.desynced[item.sessionID]; ok {
+			// Drop output until the client resubscribes, so the replay it
+			// asks for doesn't overlap output sent in the meantime
+			return nil
+		}
+	}
+
+	if len(q.items) >= q.limit {
+		switch {
+		case q.policy == PolicyCoalesce && q.compact():
+		case q.policy == PolicyDrop && item.sessionID != "":
+			q.desynced[item.sessionID] = false
+			return nil
+		default:
+			return q.cut()
+		}
+	}
+
+	q.append(item)
+	if q.bytes > maxQueueBytes {
+		return q.cut()
+	}
+	return q.signal()
+}
+
+// resume delivers a session's output again once the client resubscribes
+func (q *sendQueue) resume(sessionID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.desynced, sessionID)
+}
+
+// merge appends output to the last queued message if it is output of the
+// same session (caller must hold the lock)
+func (q *sendQueue) merge(item *outgoing) bool {
+	if len(q.items) == 0 {
+		return false
+	}
+	last := q.items[len(q.items)-1]
+	if last.sessionID != item.sessionID {
+		return false
+	}
+	q.bytes -= last.size()
+	last.absorb(item)
+	q.bytes += last.size()
+	return true
+}
+
+// compact merges adjacent output messages of the same session, returning
+// whether that made room (caller must hold the lock)
+func (q *sendQueue) compact() bool {
+	items := q.items[:0]
+	for _, item := range q.items {
+		if n := len(items); n > 0 && item.sessionID != "" && items[n-1].sessionID == item.sessionID {
+			items[n-1].absorb(item)
+			continue
+		}
+		items = append(items, item)
+	}
+	clear(q.items[len(items):])
+	q.items = items
+	q.bytes = 0
+	for _, item := range items {
+		q.bytes += item.size()
+	}
+	return len(q.items) < q.limit
+}
+
+// append adds an item (caller must hold the lock)
+func (q *sendQueue) append(item *outgoing) {
+	q.items = append(q.items, item)
+	q.bytes += item.size()
+}
+
+// signal wakes the writer (caller must hold the lock)
+func (q *sendQueue) signal() error {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// cut closes the queue because the client can't keep up (caller must hold the lock)
+func (q *sendQueue) cut() error {
+	slog.Info("Client too slow, disconnecting", "messages", len(q.items), "bytes", q.bytes)
+	q.closeLocked()
+	return errQueueClosed
+}
+
+// close stops the queue and its writer
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closeLocked()
+}
+
+func (q *sendQueue) closeLocked() {
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.items = nil
+	q.bytes = 0
+	close(q.wake)
+}
+
+// take removes all queued items, followed by a resync message for each
+// session whose output was dropped since the last take
+func (q *sendQueue) take() []*outgoing {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := q.items
+	q.items = nil
+	q.bytes = 0
+	for sessionID, sent := range q.desynced {
+		if !sent {
+			items = append(items, encoded(ResyncMessage{Type: "resync", SessionID: sessionID}))
+			q.desynced[sessionID] = true
+		}
+	}
+	return items
+}
+
+// run writes queued messages to the connection until the queue is closed
+// or a write fails, then closes the connection
+func (q *sendQueue) run(conn *websocket.Conn) {
+	defer conn.Close()
+	for range q.wake {
+		for _, item := range q.take() {
+			if item.data == nil {
+				item.data = encoded(OutputMessage{
+					Type:      "output",
+					SessionID: item.sessionID,
+					Data:      base64.StdEncoding.EncodeToString(item.output),
+					Seq:       item.seq,
+				}).data
+			}
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(item.messageType, item.data); err != nil {
+				slog.Debug("Write failed, dropping connection", "err", err)
+				q.close()
+				return
+			}
+		}
+	}
+}
+
+// encoded wraps a JSON message for the queue
+func encoded(v any) *outgoing {
+	data, _ := json.Marshal(v)
+	return &outgoing{messageType: websocket.TextMessage, data: data}
+}
@@ -0,0 +1,56 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"claudex/claude"
+	"claudex/session"
+)
+
+// SessionWithClaude is a session listed with ?include=claude: the session's
+// fields plus "claude", its Claude state as claude-state returns it
+type SessionWithClaude struct {
+	*session.Session
+	Claude *claude.ClaudeState
+}
+
+// MarshalJSON adds the Claude state to the session's own encoding
+func (s SessionWithClaude) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(s.Session)
+	if err != nil {
+		return nil, err
+	}
+	state, err := json.Marshal(s.Claude)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data[:len(data)-1], `,"claude":`...)
+	data = append(data, state...)
+	return append(data, '}'), nil
+}
+
+// withClaudeStates pairs each session with its Claude state: the one its
+// pane's transcript poller last read while Claude runs, otherwise its
+// directory's (read once per directory, and only again once the transcript
+// changes)
+func withClaudeStates(sessions []*session.Session) []SessionWithClaude {
+	states := make(map[string]*claude.ClaudeState)
+	list := make([]SessionWithClaude, 0, len(sessions))
+	for _, sess := range sessions {
+		state := sess.GetClaudeState()
+		if state == nil {
+			var ok bool
+			if state, ok = states[sess.Directory]; !ok {
+				state, _ = claude.GetClaudeState(sess.Directory)
+				states[sess.Directory] = state
+			}
+		}
+		if context := sessionContext(sess, state.Context); context != state.Context {
+			own := *state
+			own.Context = context
+			state = &own
+		}
+		list = append(list, SessionWithClaude{Session: sess, Claude: state})
+	}
+	return list
+}
@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"claudex/session"
+)
+
+// StashEntry is a stash made on a worktree's branch
+type StashEntry struct {
+	Ref     string `json:"ref"` // e.g. "stash@{0}"; shifts as stashes are added and dropped
+	Message string `json:"message"`
+}
+
+// StashRequest is the optional body of POST /api/sessions/{id}/worktree/stash
+// and /worktree/unstash
+type StashRequest struct {
+	Message string `json:"message"` // Stash: what is being parked (default "Parked from claudex")
+	Ref     string `json:"ref"`     // Unstash: which of the branch's stashes (default the newest)
+}
+
+// handleWorktreeStash lists (GET) or parks (POST) the uncommitted changes of
+// the session's worktree, untracked files included. Stashes are shared by
+// all worktrees of a repository, so only those made on the worktree's
+// branch are listed.
+func (h *Handler) handleWorktreeStash(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	dir := sess.Directory
+	branch := gitOutput(dir, "branch", "--show-current")
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(branchStashes(dir, branch))
+
+	case http.MethodPost:
+		var req StashRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if branch == "" {
+			http.Error(w, "Worktree is not on a branch", http.StatusConflict)
+			return
+		}
+		if gitOutput(dir, "status", "--porcelain") == "" {
+			http.Error(w, "No changes to stash", http.StatusConflict)
+			return
+		}
+		message := req.Message
+		if message == "" {
+			message = "Parked from claudex"
+		}
+		cmd := exec.Command("git", "stash", "push", "--include-untracked", "-m", message)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			http.Error(w, "Failed to stash: "+strings.TrimSpace(string(out)), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"status": "stashed", "stash": StashEntry{Ref: "stash@{0}", Message: message}})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWorktreeUnstash restores one of the stashes made on the session's
+// worktree branch and drops it. A stash that doesn't apply cleanly is kept.
+func (h *Handler) handleWorktreeUnstash(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req StashRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	dir := sess.Directory
+	stashes := branchStashes(dir, gitOutput(dir, "branch", "--show-current"))
+	if len(stashes) == 0 {
+		http.Error(w, "No stashes for this worktree", http.StatusNotFound)
+		return
+	}
+	stash := stashes[0]
+	if req.Ref != "" {
+		found := false
+		for _, s := range stashes {
+			if s.Ref == req.Ref {
+				stash, found = s, true
+				break
+			}
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("No stash %s for this worktree", req.Ref), http.StatusNotFound)
+			return
+		}
+	}
+
+	cmd := exec.Command("git", "stash", "pop", stash.Ref)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		// Local changes in the way, or conflicts; the stash stays
+		http.Error(w, "Failed to restore stash: "+strings.TrimSpace(string(out)), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"status": "restored", "stash": stash})
+}
+
+// branchStashes returns the stashes made on branch, newest first
+func branchStashes(dir, branch string) []StashEntry {
+	stashes := []StashEntry{}
+	if branch == "" {
+		return stashes
+	}
+	prefix := "On " + branch + ": "
+	for _, line := range strings.Split(gitOutput(dir, "stash", "list", "--format=%gd%x00%gs"), "\n") {
+		ref, subject, ok := strings.Cut(line, "\x00")
+		if ok && strings.HasPrefix(subject, prefix) {
+			stashes = append(stashes, StashEntry{Ref: ref, Message: strings.TrimPrefix(subject, prefix)})
+		}
+	}
+	return stashes
+}
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"claudex/session"
+)
+
+// StatusLineMessage forwards a statusline report to subscribed clients
+type StatusLineMessage struct {
+	Type       string              `json:"type"`
+	SessionID  string              `json:"session_id"`
+	StatusLine *session.StatusLine `json:"statusline"`
+}
+
+// handleSessionStatusLine receives reports from Claude Code's statusLine hook
+// (POST, body is the JSON Claude passes to the command) and answers with the
+// line to display. GET returns the last report.
+func (h *Handler) handleSessionStatusLine(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	switch r.Method {
+	case http.MethodGet:
+		sl := sess.GetStatusLine()
+		if sl == nil {
+			http.Error(w, "No statusline report yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sl)
+
+	case http.MethodPost:
+		data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sl, err := session.ParseStatusLine(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		linked := sess.GetLastClaudeSessionID() != sl.ClaudeSessionID
+		sess.SetStatusLine(sl)
+		if linked {
+			h.manager.UpdateSession(sess)
+		}
+		h.broadcast(sess.ID, StatusLineMessage{Type: "statusline", SessionID: sess.ID, StatusLine: sl})
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, sl.Render(sess.Name))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
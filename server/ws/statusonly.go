@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"claudex/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// StatusProtocol is the WebSocket subprotocol for status-only clients
+// (widgets, CLI watchers, wallboards). Such connections get the session list
+// and status changes of every session, but never terminal output or scrollback.
+// Clients that can't set a subprotocol can connect to /ws?mode=status instead.
+const StatusProtocol = "claudex.status"
+
+// SessionSummary is the lightweight view of a session sent to status-only clients
+type SessionSummary struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Status      session.Status `json:"status"`
+	StatusSince time.Time      `json:"status_since"`
+	Tags        []string       `json:"tags,omitempty"`
+}
+
+// SessionsMessage carries the session list to status-only clients
+type SessionsMessage struct {
+	Type     string           `json:"type"`
+	Sessions []SessionSummary `json:"sessions"`
+}
+
+// sessionsMessage builds the current session list
+func (h *Handler) sessionsMessage() SessionsMessage {
+	sessions := h.manager.List(session.ListOptions{})
+	summaries := make([]SessionSummary, 0, len(sessions))
+	for _, sess := range sessions {
+		summaries = append(summaries, SessionSummary{
+			ID:          sess.ID,
+			Name:        sess.Name,
+			Status:      sess.GetStatus(),
+			StatusSince: sess.InLocation(sess.GetStatusSince()),
+			Tags:        sess.GetTags(),
+		})
+	}
+	return SessionsMessage{Type: "sessions", Sessions: summaries}
+}
+
+// isStatusOnly reports whether a connection is a status-only client
+func (h *Handler) isStatusOnly(conn *websocket.Conn) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	state, ok := h.connections[conn]
+	return ok && state.statusOnly
+}
+
+// broadcastSessionList sends the session list to all status-only clients
+// (after sessions are created or deleted)
+func (h *Handler) broadcastSessionList() {
+	msgBytes, _ := json.Marshal(h.sessionsMessage())
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for conn, state := range h.connections {
+		if state.statusOnly {
+			if err := state.send(msgBytes); err != nil {
+				slog.Debug("Write failed, dropping connection", "err", err)
+				conn.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"claudex/notify"
+	"claudex/watchdog"
+
+	"github.com/gorilla/websocket"
+)
+
+// SystemSessionID is the pseudo-session clients subscribe to for server health
+const SystemSessionID = "system"
+
+// broadcastStallThreshold is how long fanning out one message may take before
+// it is reported as a stall
+const broadcastStallThreshold = 2 * time.Second
+
+// SystemMessage reports the server's own health to "system" subscribers
+type SystemMessage struct {
+	Type      string            `json:"type"`
+	SessionID string            `json:"session_id"`
+	Health    watchdog.Status   `json:"health"`
+	Problem   *watchdog.Problem `json:"problem,omitempty"` // The problem that triggered this message
+}
+
+// SetWatchdog sets the watchdog and routes its problems to "system"
+// subscribers and the notification channels
+func (h *Handler) SetWatchdog(wd *watchdog.Watchdog) {
+	h.mu.Lock()
+	h.watchdog = wd
+	h.mu.Unlock()
+
+	wd.SetProblemCallback(func(p watchdog.Problem) {
+		h.broadcast(SystemSessionID, SystemMessage{
+			Type:      "system",
+			SessionID: SystemSessionID,
+			Health:    wd.Status(),
+			Problem:   &p,
+		})
+
+		e := notify.NewEvent(notify.EventSystemProblem, SystemSessionID, "claudex",
+			fmt.Sprintf("claudex %s: %s", p.Kind, p.Message))
+		e.Data["kind"] = string(p.Kind)
+		e.Data["count"] = p.Count
+		h.publishEvent(e)
+	})
+}
+
+// reportProblem records an internal failure if a watchdog is configured
+func (h *Handler) reportProblem(kind watchdog.Kind, format string, args ...any) {
+	h.mu.RLock()
+	wd := h.watchdog
+	h.mu.RUnlock()
+
+	if wd != nil {
+		wd.Report(kind, format, args...)
+	}
+}
+
+// checkBroadcast reports a stall if fanning out a message took too long.
+// Deferred before the connection lock is taken so it runs after it is released.
+func (h *Handler) checkBroadcast(sessionID string, start time.Time) {
+	if elapsed := time.Since(start); elapsed > broadcastStallThreshold {
+		h.reportProblem(watchdog.KindBroadcastStall,
+			"broadcast for session %s took %s", sessionID, elapsed.Round(time.Millisecond))
+	}
+}
+
+// sendSystemStatus sends the current server health to a new "system" subscriber
+func (h *Handler) sendSystemStatus(conn *websocket.Conn) {
+	h.mu.RLock()
+	wd := h.watchdog
+	h.mu.RUnlock()
+
+	if wd != nil {
+		h.sendToConn(conn, SystemMessage{Type: "system", SessionID: SystemSessionID, Health: wd.Status()})
+	}
+}
+
+// HandleSystem returns the "system" pseudo-session describing server health
+func (h *Handler) HandleSystem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mu.RLock()
+	wd := h.watchdog
+	h.mu.RUnlock()
+
+	health := watchdog.Status{Status: "ok", Problems: []watchdog.Problem{}}
+	if wd != nil {
+		health = wd.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":       SystemSessionID,
+		"name":     "claudex",
+		"status":   health.Status,
+		"problems": health.Problems,
+	})
+}
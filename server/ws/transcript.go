@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"claudex/claude"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultTranscriptBacklog is how many existing transcript lines are sent on subscribe
+const defaultTranscriptBacklog = 200
+
+// claudeSessionParam returns the claude_session query parameter, answering
+// 400 for one that isn't a Claude session ID
+func claudeSessionParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.URL.Query().Get("claude_session")
+	if id != "" && !claude.ValidSessionID(id) {
+		http.Error(w, "Invalid claude_session", http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
+// SubscribeTranscriptData holds optional subscribe_transcript parameters
+type SubscribeTranscriptData struct {
+	Backlog *int `json:"backlog,omitempty"` // Existing lines to send first (default 200)
+}
+
+// TranscriptBlock is one content block of a transcript message
+type TranscriptBlock struct {
+	Type      string          `json:"type"` // "text", "thinking", "tool_use" or "tool_result"
+	Text      string          `json:"text,omitempty"`
+	Tool      string          `json:"tool,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// TranscriptMessage is a parsed transcript line pushed to transcript subscribers
+type TranscriptMessage struct {
+	Type      string            `json:"type"`
+	SessionID string            `json:"session_id"`
+	UUID      string            `json:"uuid"`
+	Timestamp string            `json:"timestamp"`
+	Role      string            `json:"role"` // "user" or "assistant"
+	Model     string            `json:"model,omitempty"`
+	Blocks    []TranscriptBlock `json:"blocks"`
+}
+
+// newTranscriptMessage converts a transcript line, returning false for lines
+// without conversation content (summaries, metadata)
+func newTranscriptMessage(sessionID string, line claude.TranscriptLine) (TranscriptMessage, bool) {
+	if line.Type != "user" && line.Type != "assistant" {
+		return TranscriptMessage{}, false
+	}
+	msg := TranscriptMessage{
+		Type:      "transcript",
+		SessionID: sessionID,
+		UUID:      line.UUID,
+		Timestamp: line.Timestamp,
+		Role:      line.Type,
+		Model:     line.Message.Model,
+		Blocks:    []TranscriptBlock{},
+	}
+	for _, block := range line.Message.Content {
+		switch block.Type {
+		case "text":
+			msg.Blocks = append(msg.Blocks, TranscriptBlock{Type: "text", Text: block.Text})
+		case "thinking":
+			msg.Blocks = append(msg.Blocks, TranscriptBlock{Type: "thinking", Text: block.Thinking})
+		case "tool_use":
+			msg.Blocks = append(msg.Blocks, TranscriptBlock{Type: "tool_use", Tool: block.Name, ToolUseID: block.ID, Input: block.Input})
+		case "tool_result":
+			msg.Blocks = append(msg.Blocks, TranscriptBlock{Type: "tool_result", ToolUseID: block.ToolUseID, Text: string(block.Content), IsError: block.IsError})
+		}
+	}
+	return msg, len(msg.Blocks) > 0
+}
+
+// handleSubscribeTranscript starts streaming a session's Claude transcript to the connection
+func (h *Handler) handleSubscribeTranscript(conn *websocket.Conn, sessionID string, data json.RawMessage) {
+	sess, ok := h.manager.Get(sessionID)
+	if !ok {
+		slog.Debug("Transcript subscription for unknown session", "session", sessionID)
+		return
+	}
+
+	var subData SubscribeTranscriptData
+	if len(data) > 0 {
+		json.Unmarshal(data, &subData)
+	}
+	backlog := defaultTranscriptBacklog
+	if subData.Backlog != nil {
+		backlog = *subData.Backlog
+	}
+
+	stop := make(chan struct{})
+	h.mu.Lock()
+	state, ok := h.connections[conn]
+	if ok {
+		if old, exists := state.transcriptSubs[sessionID]; exists {
+			close(old)
+		}
+		state.transcriptSubs[sessionID] = stop
+	}
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	// Follow whichever Claude session the claudex session is running
+	resolve := func() (string, error) {
+		return claude.FindTranscript(sess.Directory, sess.GetLastClaudeSessionID())
+	}
+	go claude.TailTranscript(resolve, backlog, stop, func(line claude.TranscriptLine) {
+		if msg, ok := newTranscriptMessage(sessionID, line); ok {
+			h.sendToConn(conn, msg)
+		}
+	})
+}
+
+// handleUnsubscribeTranscript stops streaming a session's transcript
+func (h *Handler) handleUnsubscribeTranscript(conn *websocket.Conn, sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if state, ok := h.connections[conn]; ok {
+		if stop, exists := state.transcriptSubs[sessionID]; exists {
+			close(stop)
+			delete(state.transcriptSubs, sessionID)
+		}
+	}
+}
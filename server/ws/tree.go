@@ -0,0 +1,165 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"claudex/session"
+)
+
+// DiffStat summarizes an experiment's changes against its parent's branch
+type DiffStat struct {
+	Commits      int `json:"commits"` // Commits on the experiment branch since it forked
+	FilesChanged int `json:"files_changed"`
+	Insertions   int `json:"insertions"`
+	Deletions    int `json:"deletions"` // Includes uncommitted changes in the worktree
+}
+
+// TreeNode is a session with the experiments spawned from it
+type TreeNode struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	Status     session.Status `json:"status"`
+	Branch     string         `json:"branch,omitempty"`
+	ForkedFrom string         `json:"forked_from,omitempty"` // Parent's Claude session the conversation was forked from
+	Diff       *DiffStat      `json:"diff,omitempty"`        // Experiments only
+	Children   []*TreeNode    `json:"children"`
+}
+
+// HandleSessionTree returns every experiment lineage as a forest of trees.
+// Query: diff=false skips the git diff stats.
+func (h *Handler) HandleSessionTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.sessionTrees("", r.URL.Query().Get("diff") != "false"))
+}
+
+// handleSessionTree returns the lineage tree the session belongs to, rooted at its oldest ancestor
+func (h *Handler) handleSessionTree(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	root := h.rootSession(sess)
+	trees := h.sessionTrees(root.ID, r.URL.Query().Get("diff") != "false")
+	if len(trees) == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trees[0])
+}
+
+// rootSession returns the session's oldest ancestor, itself if it has none
+func (h *Handler) rootSession(sess *session.Session) *session.Session {
+	root := sess
+	seen := map[string]bool{root.ID: true}
+	for root.ParentID != "" {
+		parent, ok := h.manager.Get(root.ParentID)
+		if !ok || seen[parent.ID] {
+			break
+		}
+		seen[parent.ID] = true
+		root = parent
+	}
+	return root
+}
+
+// sessionTrees builds the lineage trees of all sessions, or only the one
+// rooted at rootID. Sessions whose parent no longer exists are roots.
+func (h *Handler) sessionTrees(rootID string, withDiff bool) []*TreeNode {
+	sessions := h.manager.List(session.ListOptions{})
+	byID := make(map[string]*session.Session, len(sessions))
+	for _, s := range sessions {
+		byID[s.ID] = s
+	}
+	children := make(map[string][]*session.Session)
+	var roots []*session.Session
+	for _, s := range sessions {
+		if _, ok := byID[s.ParentID]; ok && s.ParentID != s.ID {
+			children[s.ParentID] = append(children[s.ParentID], s)
+		} else if rootID == "" || s.ID == rootID {
+			roots = append(roots, s)
+		}
+	}
+	if s, ok := byID[rootID]; ok && len(roots) == 0 {
+		// The root itself has a parent (cycle guard in handleSessionTree hit)
+		roots = append(roots, s)
+	}
+
+	var build func(s *session.Session, parent *session.Session, visited map[string]bool) *TreeNode
+	build = func(s *session.Session, parent *session.Session, visited map[string]bool) *TreeNode {
+		visited[s.ID] = true
+		node := &TreeNode{
+			ID:         s.ID,
+			Name:       s.Name,
+			Status:     s.GetStatus(),
+			Branch:     s.Branch,
+			ForkedFrom: s.GetForkedFrom(),
+			Children:   []*TreeNode{},
+		}
+		if withDiff && parent != nil && s.Branch != "" {
+			node.Diff = experimentDiffStat(s.Directory, parent.Directory)
+		}
+		for _, child := range children[s.ID] {
+			if !visited[child.ID] {
+				node.Children = append(node.Children, build(child, s, visited))
+			}
+		}
+		return node
+	}
+
+	trees := []*TreeNode{}
+	visited := make(map[string]bool)
+	for _, root := range roots {
+		trees = append(trees, build(root, nil, visited))
+	}
+	return trees
+}
+
+// experimentDiffStat compares an experiment worktree (committed and
+// uncommitted changes) with the branch checked out in its parent's directory
+func experimentDiffStat(expDir, parentDir string) *DiffStat {
+	parentHead := gitOutput(parentDir, "rev-parse", "HEAD")
+	if parentHead == "" {
+		return nil
+	}
+	base := gitOutput(expDir, "merge-base", "HEAD", parentHead)
+	if base == "" {
+		return nil
+	}
+
+	stat := &DiffStat{}
+	stat.Commits, _ = strconv.Atoi(gitOutput(expDir, "rev-list", "--count", base+"..HEAD"))
+	for _, line := range strings.Split(gitOutput(expDir, "diff", "--numstat", base), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		stat.FilesChanged++
+		// Binary files report "-" for both counts
+		added, _ := strconv.Atoi(fields[0])
+		deleted, _ := strconv.Atoi(fields[1])
+		stat.Insertions += added
+		stat.Deletions += deleted
+	}
+	return stat
+}
+
+// gitOutput runs a git command in dir and returns its trimmed output ("" on error)
+func gitOutput(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,153 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"claudex/claude"
+	"claudex/session"
+)
+
+// usageEvery is how often status updates re-read a session's cost and usage
+const usageEvery = time.Second
+
+// usageCache is the cost report a session's status updates last read
+type usageCache struct {
+	report *claude.CostReport // nil if the session has no transcript
+	at     time.Time
+}
+
+// sessionUsage returns the cost report of the session's Claude conversation
+// for status updates, nil if there is none. Output comes in many small
+// chunks, each with a status update, so the transcript is read at most once
+// per usageEvery.
+func (h *Handler) sessionUsage(sess *session.Session) *claude.CostReport {
+	h.mu.RLock()
+	cached := h.usage[sess.ID]
+	h.mu.RUnlock()
+	if cached != nil && time.Since(cached.at) < usageEvery {
+		return cached.report
+	}
+
+	report, _ := claude.GetCostReport(sess.Directory, sess.GetLastClaudeSessionID())
+	h.mu.Lock()
+	if _, ok := h.manager.Get(sess.ID); ok {
+		h.usage[sess.ID] = &usageCache{report: report, at: time.Now()}
+	}
+	h.mu.Unlock()
+	return report
+}
+
+// forgetUsage drops what is cached about a deleted session's transcript and
+// the status updates sent for it
+func (h *Handler) forgetUsage(sess *session.Session) {
+	h.mu.Lock()
+	delete(h.usage, sess.ID)
+	delete(h.sentStatus, sess.ID)
+	h.mu.Unlock()
+	if path, err := claude.FindTranscript(sess.Directory, sess.GetLastClaudeSessionID()); err == nil {
+		claude.ForgetTranscript(path)
+	}
+}
+
+// UsageReport is the usage of every session's Claude transcript, totalled
+// and grouped by day and by project
+type UsageReport struct {
+	Total    claude.DayUsage   `json:"total"`
+	Days     []claude.DayUsage `json:"days"`     // Oldest first
+	Projects []ProjectUsage    `json:"projects"` // Most expensive first
+	Sessions int               `json:"sessions"` // Sessions whose transcript was read
+	Missing  int               `json:"missing"`  // Sessions with a conversation whose transcript is gone
+}
+
+// ProjectUsage is the usage of the sessions working on one directory.
+// Experiments count towards the directory of the session they branched from.
+type ProjectUsage struct {
+	Directory string `json:"directory"`
+	Sessions  int    `json:"sessions"`
+	claude.DayUsage
+}
+
+// HandleUsage reports token, cost and tool usage across the transcripts of
+// all saved sessions (their last Claude conversation), optionally limited
+// to the days from ?since= to ?until= (YYYY-MM-DD, UTC)
+func (h *Handler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	since, until := r.URL.Query().Get("since"), r.URL.Query().Get("until")
+	for _, day := range []string{since, until} {
+		if _, err := time.Parse(time.DateOnly, day); day != "" && err != nil {
+			http.Error(w, "Invalid date: "+day, http.StatusBadRequest)
+			return
+		}
+	}
+
+	report := UsageReport{
+		Total: claude.DayUsage{Tools: map[string]int{}}, Days: []claude.DayUsage{}, Projects: []ProjectUsage{},
+	}
+	byDay := make(map[string]*claude.DayUsage)
+	byProject := make(map[string]*ProjectUsage)
+	read := make(map[string]bool) // Transcripts already counted
+
+	for _, sess := range h.manager.List(session.ListOptions{}) {
+		claudeID := sess.GetLastClaudeSessionID()
+		if claudeID == "" {
+			continue
+		}
+		path, err := claude.FindTranscript(sess.Directory, claudeID)
+		if err != nil {
+			report.Missing++
+			continue
+		}
+		if read[path] {
+			continue
+		}
+		read[path] = true
+		days, err := claude.DailyUsage(path)
+		if err != nil {
+			report.Missing++
+			continue
+		}
+		report.Sessions++
+
+		dir := h.projectDir(sess)
+		project, ok := byProject[dir]
+		if !ok {
+			project = &ProjectUsage{Directory: dir, DayUsage: claude.DayUsage{Tools: map[string]int{}}}
+			byProject[dir] = project
+		}
+		project.Sessions++
+
+		for _, day := range days {
+			if (since != "" && day.Day < since) || (until != "" && day.Day > until) {
+				continue
+			}
+			total, ok := byDay[day.Day]
+			if !ok {
+				total = &claude.DayUsage{Day: day.Day}
+				byDay[day.Day] = total
+			}
+			total.Add(day)
+			project.Add(day)
+			report.Total.Add(day)
+		}
+	}
+
+	for _, day := range byDay {
+		report.Days = append(report.Days, *day)
+	}
+	sort.Slice(report.Days, func(i, j int) bool { return report.Days[i].Day < report.Days[j].Day })
+	for _, project := range byProject {
+		report.Projects = append(report.Projects, *project)
+	}
+	sort.Slice(report.Projects, func(i, j int) bool {
+		return report.Projects[i].CostUSD > report.Projects[j].CostUSD
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/gorilla/websocket"
+)
+
+// ProtocolVersion is the WebSocket protocol version the server speaks by
+// default, matching the REST API under APIPrefix
+const ProtocolVersion = 1
+
+// supportedVersions lists the protocol versions a client can negotiate
+var supportedVersions = []int{1}
+
+// HelloData is the body of a client hello: the protocol versions it speaks
+type HelloData struct {
+	Versions []int `json:"versions"`
+}
+
+// HelloMessage is sent on connect with the default version, and in answer to
+// a client hello with the version chosen for the connection
+type HelloMessage struct {
+	Type       string `json:"type"`
+	Version    int    `json:"version"`              // Version in use on this connection (0: none in common)
+	Versions   []int  `json:"versions"`             // Versions the server supports
+	Connection string `json:"connection,omitempty"` // ID naming this connection in control messages
+	Error      string `json:"error,omitempty"`      // Why negotiation failed
+}
+
+// helloMessage describes the version in use on a connection
+func helloMessage(version int, connection string) HelloMessage {
+	return HelloMessage{Type: "hello", Version: version, Versions: supportedVersions, Connection: connection}
+}
+
+// handleHello picks the highest version both sides support. Without one in
+// common the client is told so and the connection closed.
+func (h *Handler) handleHello(conn *websocket.Conn, data json.RawMessage) {
+	var hello HelloData
+	if err := json.Unmarshal(data, &hello); err != nil {
+		slog.Debug("Invalid hello", "err", err)
+		return
+	}
+
+	version := 0
+	for _, v := range hello.Versions {
+		for _, supported := range supportedVersions {
+			if v == supported && v > version {
+				version = v
+			}
+		}
+	}
+
+	if version == 0 {
+		reply := helloMessage(0, h.connActor(conn).Connection)
+		reply.Error = "no supported protocol version"
+		h.sendToConn(conn, reply)
+		slog.Info("Closing connection without a common protocol version", "versions", hello.Versions)
+		// Queued behind the reply so the client gets both; its answer ends the read loop
+		h.mu.RLock()
+		state, ok := h.connections[conn]
+		h.mu.RUnlock()
+		if ok {
+			state.queue.push(&outgoing{
+				messageType: websocket.CloseMessage,
+				data:        websocket.FormatCloseMessage(websocket.CloseProtocolError, reply.Error),
+			})
+		}
+		return
+	}
+
+	h.mu.Lock()
+	connection := ""
+	if state, ok := h.connections[conn]; ok {
+		state.version = version
+		connection = state.actor.Connection
+	}
+	h.mu.Unlock()
+	h.sendToConn(conn, helloMessage(version, connection))
+}
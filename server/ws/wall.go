@@ -0,0 +1,143 @@
+package ws
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"claudex/session"
+)
+
+// wallRefreshSeconds is how often the wallboard page reloads itself
+const wallRefreshSeconds = 5
+
+// wallRow is a single session line on the wallboard
+type wallRow struct {
+	Name       string
+	Color      string
+	Status     session.Status
+	Tool       string
+	Target     string
+	Since      string
+	Directory  string
+	Branch     string
+	NeedsInput bool
+}
+
+var wallTemplate = template.Must(template.New("wall").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Claudex Wall</title>
+<style>
+  body { background: #0f172a; color: #e2e8f0; font-family: -apple-system, BlinkMacSystemFont, sans-serif; margin: 0; padding: 24px; }
+  h1 { font-size: 28px; margin: 0 0 4px; }
+  .meta { color: #94a3b8; margin-bottom: 24px; }
+  .grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(320px, 1fr)); gap: 16px; }
+  .card { background: #1e293b; border-radius: 12px; padding: 16px; border-left: 8px solid #6366f1; }
+  .card.waiting { outline: 3px solid #f59e0b; }
+  .name { font-size: 22px; font-weight: 600; }
+  .status { display: inline-block; margin-top: 8px; padding: 2px 10px; border-radius: 999px; font-size: 16px; background: #334155; }
+  .status.thinking { background: #7c3aed; }
+  .status.executing { background: #2563eb; }
+  .status.waiting_input { background: #d97706; }
+  .status.error { background: #dc2626; }
+  .status.stopped, .status.idle { background: #475569; }
+  .tool, .dir { margin-top: 8px; color: #cbd5e1; font-size: 15px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .dir { color: #64748b; font-size: 13px; }
+</style>
+</head>
+<body>
+<h1>Claudex</h1>
+<div class="meta">{{len .Rows}} sessions &middot; {{.Waiting}} waiting for input &middot; updated {{.Updated}}</div>
+<div class="grid">
+{{range .Rows}}
+  <div class="card{{if .NeedsInput}} waiting{{end}}" style="border-left-color: {{.Color}}">
+    <div class="name">{{.Name}}</div>
+    <span class="status {{.Status}}">{{.Status}} &middot; {{.Since}}</span>
+    {{if .Tool}}<div class="tool">{{.Tool}}{{if .Target}}: {{.Target}}{{end}}</div>{{end}}
+    <div class="dir">{{.Directory}}{{if .Branch}} ({{.Branch}}){{end}}</div>
+  </div>
+{{end}}
+</div>
+</body>
+</html>
+`))
+
+// HandleWall serves a lightweight, auto-refreshing status page for TVs and kiosks
+func (h *Handler) HandleWall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions := h.manager.List(session.ListOptions{})
+	rows := make([]wallRow, 0, len(sessions))
+	waiting := 0
+
+	for _, sess := range sessions {
+		// Split panes are shown through their parent session
+		if sess.SplitParentID != "" {
+			continue
+		}
+
+		status := sess.GetStatus()
+		row := wallRow{
+			Name:       sess.Name,
+			Color:      sess.Color,
+			Status:     status,
+			Since:      formatDuration(time.Since(sess.GetStatusSince())),
+			Directory:  sess.Directory,
+			Branch:     sess.Branch,
+			NeedsInput: status == session.StatusWaitingInput,
+		}
+		if row.Name == "" {
+			row.Name = sess.ID
+		}
+		if status == session.StatusThinking || status == session.StatusExecuting {
+			if state := sess.GetClaudeState(); state != nil {
+				row.Tool = state.CurrentTool
+				row.Target = state.ToolTarget
+			}
+		}
+		if row.NeedsInput {
+			waiting++
+		}
+		rows = append(rows, row)
+	}
+
+	// Sessions waiting for input first, then by name
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].NeedsInput != rows[j].NeedsInput {
+			return rows[i].NeedsInput
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := wallTemplate.Execute(w, map[string]any{
+		"Rows":    rows,
+		"Waiting": waiting,
+		"Refresh": wallRefreshSeconds,
+		"Updated": time.Now().Format("15:04:05"),
+	})
+	if err != nil {
+		slog.Warn("Failed to render wall", "err", err)
+	}
+}
+
+// formatDuration renders a duration compactly (e.g. "45s", "12m", "3h 5m")
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
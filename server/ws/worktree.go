@@ -2,6 +2,7 @@ package ws
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
@@ -29,13 +30,27 @@ func (h *Handler) HandleWorktree(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleWorktreeMerge merges the current worktree branch into master
+// HandleWorktreeMerge merges the current worktree branch into the target
+// branch (MergeRequest), first running the repository's test command if
+// require_tests is set. Sessions in the worktree are retired afterwards.
 func (h *Handler) HandleWorktreeMerge(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	var req MergeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	info := getWorktreeInfo()
 	if !info.IsWorktree {
 		http.Error(w, "Not in a worktree", http.StatusBadRequest)
@@ -44,6 +59,31 @@ func (h *Handler) HandleWorktreeMerge(w http.ResponseWriter, r *http.Request) {
 
 	// Get the worktree path (current working directory of the web files)
 	worktreePath := info.Path
+	mainRepo := info.MainRepo
+	branch := info.Branch
+	into := h.mergeTarget(mainRepo, req.Into)
+	if !branchExists(mainRepo, into) {
+		http.Error(w, fmt.Sprintf("No branch %q to merge into", into), http.StatusBadRequest)
+		return
+	}
+
+	// Refuse a merge that would stop half-way on conflicts
+	if err := checkMerge(mainRepo, worktreePath, branch, into, req.Strategy); err != nil {
+		if writeMergeConflict(w, err) {
+			return
+		}
+		http.Error(w, "Failed to preview merge: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if req.RequireTests {
+		// Output goes to "system" subscribers: the server's worktree is no session
+		if err := h.runMergeTests(r.Context(), SystemSessionID, mainRepo, worktreePath); err != nil {
+			if !writeTestError(w, err) {
+				http.Error(w, "Failed to run tests: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
 
 	// First, commit any pending changes
 	cmd := exec.Command("git", "add", "-A")
@@ -54,7 +94,7 @@ func (h *Handler) HandleWorktreeMerge(w http.ResponseWriter, r *http.Request) {
 	cmd.Dir = worktreePath
 	if cmd.Run() != nil {
 		// There are staged changes, commit them
-		cmd = exec.Command("git", "commit", "-m", "WIP: Auto-commit before merge")
+		cmd = exec.Command("git", "commit", "-m", req.pendingMessage())
 		cmd.Dir = worktreePath
 		if out, err := cmd.CombinedOutput(); err != nil {
 			http.Error(w, "Failed to commit changes: "+string(out), http.StatusInternalServerError)
@@ -62,23 +102,12 @@ func (h *Handler) HandleWorktreeMerge(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Go to main repo and merge
-	mainRepo := info.MainRepo
-	branch := info.Branch
-
-	// Checkout master in main repo
-	cmd = exec.Command("git", "checkout", "master")
-	cmd.Dir = mainRepo
-	if out, err := cmd.CombinedOutput(); err != nil {
-		http.Error(w, "Failed to checkout master: "+string(out), http.StatusInternalServerError)
-		return
-	}
-
-	// Merge the worktree branch
-	cmd = exec.Command("git", "merge", branch, "--no-edit")
-	cmd.Dir = mainRepo
-	if out, err := cmd.CombinedOutput(); err != nil {
-		http.Error(w, "Failed to merge: "+string(out), http.StatusInternalServerError)
+	// Merge the worktree branch without switching the main repo's checkout
+	if err := mergeBranch(mainRepo, branch, into, req.Strategy, req.Message); err != nil {
+		if writeMergeConflict(w, err) {
+			return
+		}
+		http.Error(w, "Failed to merge: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -87,22 +116,64 @@ func (h *Handler) HandleWorktreeMerge(w http.ResponseWriter, r *http.Request) {
 	cmd.Dir = mainRepo
 	cmd.Run() // Best effort
 
-	// Delete the branch
-	cmd = exec.Command("git", "branch", "-d", branch)
+	// Delete the branch (-D: it is merged into the target, which need not
+	// be checked out)
+	cmd = exec.Command("git", "branch", "-D", branch)
 	cmd.Dir = mainRepo
 	cmd.Run() // Best effort
 
+	// Sessions in the worktree would be left pointing at a deleted directory
+	retired := h.retireWorktreeSessions(worktreePath, into, req.KeepSession)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "merged"})
+	json.NewEncoder(w).Encode(map[string]any{"status": "merged", "into": into, "sessions": retired})
 }
 
-// HandleWorktreeDiscard discards changes and removes the worktree
+// HandleWorktreeMergePreview reports whether merging the current worktree
+// branch into the target branch (?into=) would conflict, without touching
+// either checkout
+func (h *Handler) HandleWorktreeMergePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info := getWorktreeInfo()
+	if !info.IsWorktree {
+		http.Error(w, "Not in a worktree", http.StatusBadRequest)
+		return
+	}
+
+	into := h.mergeTarget(info.MainRepo, r.URL.Query().Get("into"))
+	if !branchExists(info.MainRepo, into) {
+		http.Error(w, fmt.Sprintf("No branch %q to merge into", into), http.StatusBadRequest)
+		return
+	}
+	preview, err := previewMerge(info.MainRepo, info.Path, info.Branch, into)
+	if err != nil {
+		http.Error(w, "Failed to preview merge: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
+
+// HandleWorktreeDiscard discards changes and removes the worktree, retiring
+// the sessions in it (DiscardRequest)
 func (h *Handler) HandleWorktreeDiscard(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	var req DiscardRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	info := getWorktreeInfo()
 	if !info.IsWorktree {
 		http.Error(w, "Not in a worktree", http.StatusBadRequest)
@@ -123,8 +194,27 @@ func (h *Handler) HandleWorktreeDiscard(w http.ResponseWriter, r *http.Request)
 	cmd.Dir = mainRepo
 	cmd.Run() // Best effort
 
+	retired := h.retireWorktreeSessions(worktreePath, "", req.KeepSession)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "discarded"})
+	json.NewEncoder(w).Encode(map[string]any{"status": "discarded", "sessions": retired})
+}
+
+// RetiredSession is a session whose worktree was merged or discarded
+type RetiredSession struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"` // Else kept, stopped
+}
+
+// retireWorktreeSessions retires the sessions working in a merged or
+// discarded worktree (see retireExperiment)
+func (h *Handler) retireWorktreeSessions(worktreePath, mergedInto string, keep bool) []RetiredSession {
+	retired := []RetiredSession{}
+	for _, sess := range h.worktreeSessions(worktreePath) {
+		deleted := h.retireExperiment(sess, mergedInto, keep)
+		retired = append(retired, RetiredSession{ID: sess.ID, Deleted: deleted})
+	}
+	return retired
 }
 
 func (h *Handler) getWorktreeInfo(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"claudex/session"
+)
+
+// WorktreeStatus is how far a session's worktree has drifted from its base
+// branch
+type WorktreeStatus struct {
+	Branch       string      `json:"branch,omitempty"` // Empty on a detached HEAD
+	Base         string      `json:"base"`             // Branch ahead/behind are counted against
+	Dirty        bool        `json:"dirty"`            // Uncommitted or untracked changes
+	ChangedFiles int         `json:"changed_files"`
+	Ahead        int         `json:"ahead"`   // Commits on HEAD that base lacks
+	Behind       int         `json:"behind"`  // Commits on base that HEAD lacks
+	Stashes      int         `json:"stashes"` // Changes parked with worktree/stash on this branch
+	LastCommit   *CommitInfo `json:"last_commit,omitempty"`
+}
+
+// CommitInfo describes a commit
+type CommitInfo struct {
+	Hash    string    `json:"hash"`
+	Subject string    `json:"subject"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+}
+
+// handleWorktreeStatus reports whether the session's worktree has pending
+// changes and how it compares with its base branch: the one the session
+// would merge into, or the base query parameter
+func (h *Handler) handleWorktreeStatus(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dir := sess.Directory
+	if gitOutput(dir, "rev-parse", "--is-inside-work-tree") != "true" {
+		http.Error(w, "Not a git repository", http.StatusConflict)
+		return
+	}
+	// Experiments compare with the branch their parent merges into
+	repo := dir
+	if sess.ParentID != "" {
+		if parent, ok := h.manager.Get(sess.ParentID); ok {
+			repo = parent.Directory
+		}
+	}
+	base := h.mergeTarget(repo, r.URL.Query().Get("base"))
+	if !branchExists(dir, base) {
+		http.Error(w, fmt.Sprintf("No base branch %q", base), http.StatusBadRequest)
+		return
+	}
+
+	status := WorktreeStatus{
+		Branch: gitOutput(dir, "branch", "--show-current"),
+		Base:   base,
+	}
+	if changes := gitOutput(dir, "status", "--porcelain"); changes != "" {
+		status.Dirty = true
+		status.ChangedFiles = len(strings.Split(changes, "\n"))
+	}
+	// Prints "<behind>\t<ahead>" for base...HEAD
+	if counts := strings.Fields(gitOutput(dir, "rev-list", "--left-right", "--count", base+"...HEAD")); len(counts) == 2 {
+		status.Behind, _ = strconv.Atoi(counts[0])
+		status.Ahead, _ = strconv.Atoi(counts[1])
+	}
+	status.Stashes = len(branchStashes(dir, status.Branch))
+	if fields := strings.Split(gitOutput(dir, "log", "-1", "--format=%H%x00%s%x00%an%x00%aI"), "\x00"); len(fields) == 4 {
+		commit := &CommitInfo{Hash: fields[0], Subject: fields[1], Author: fields[2]}
+		commit.Time, _ = time.Parse(time.RFC3339, fields[3])
+		status.LastCommit = commit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
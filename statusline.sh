@@ -0,0 +1,22 @@
+#!/bin/sh
+# Claude Code statusLine command that reports model, cost and context usage
+# to claudex and prints the line claudex returns.
+#
+# ~/.claude/settings.json:
+#   {"statusLine": {"type": "command", "command": "~/.claudex/statusline.sh"}}
+#
+# claudex sets CLAUDEX_SESSION_ID and CLAUDEX_URL in the sessions it starts,
+# and CLAUDEX_SOCKET when it listens on a Unix domain socket.
+
+if [ -z "$CLAUDEX_SESSION_ID" ]; then
+    cat > /dev/null
+    exit 0
+fi
+
+set --
+if [ -n "$CLAUDEX_SOCKET" ]; then
+    set -- --unix-socket "$CLAUDEX_SOCKET"
+fi
+
+curl "$@" -s -m 2 -X POST -H "Content-Type: application/json" --data-binary @- \
+    "${CLAUDEX_URL:-http://localhost:9090}/api/v1/sessions/$CLAUDEX_SESSION_ID/statusline"
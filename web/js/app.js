@@ -18,6 +18,7 @@ class Claudex {
         // Split tree: { type: 'pane', paneId, sessionId } or { type: 'split', direction, children: [node, node] }
         this.splitTree = null;
         this.primarySessionId = null; // The session that was originally opened (for saving layout)
+        this.lastSeq = new Map(); // sessionId -> last output sequence number received
 
         // Sidebar split
         this.sidebarSplit = null;
@@ -70,7 +71,7 @@ class Claudex {
     // Check if we're in a git worktree
     async checkWorktree() {
         try {
-            const response = await fetch('/api/worktree');
+            const response = await fetch('/api/v1/worktree');
             const info = await response.json();
 
             if (info.is_worktree) {
@@ -85,7 +86,7 @@ class Claudex {
                     if (!confirm(`Merge "${info.branch}" into master and close this worktree?`)) return;
 
                     try {
-                        const res = await fetch('/api/worktree/merge', { method: 'POST' });
+                        const res = await fetch('/api/v1/worktree/merge', { method: 'POST' });
                         if (res.ok) {
                             alert('Merged successfully! The server will restart.');
                             // Server will be gone, try to redirect to main repo
@@ -104,7 +105,7 @@ class Claudex {
                     if (!confirm(`Discard all changes in "${info.branch}" and close this worktree?`)) return;
 
                     try {
-                        const res = await fetch('/api/worktree/discard', { method: 'POST' });
+                        const res = await fetch('/api/v1/worktree/discard', { method: 'POST' });
                         if (res.ok) {
                             alert('Worktree discarded! The server will stop.');
                             window.location.href = '/';
@@ -125,7 +126,7 @@ class Claudex {
     // Client state persistence (server-side)
     async loadClientState() {
         try {
-            const response = await fetch('/api/client-state');
+            const response = await fetch('/api/v1/client-state');
             this.clientState = await response.json();
         } catch (err) {
             console.error('Failed to load client state:', err);
@@ -140,7 +141,7 @@ class Claudex {
         }
         this._saveStateTimeout = setTimeout(async () => {
             try {
-                await fetch('/api/client-state', {
+                await fetch('/api/v1/client-state', {
                     method: 'PUT',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify(this.clientState)
@@ -158,6 +159,19 @@ class Claudex {
 
         this.ws.onopen = () => {
             console.log('WebSocket connected');
+            this.ws.send(JSON.stringify({ type: 'hello', data: { versions: [1] } }));
+
+            // Resubscribe open panes after a reconnect, replaying only missed output
+            const subscribed = new Set();
+            this.panes.forEach(pane => {
+                if (!pane.sessionId || subscribed.has(pane.sessionId)) return;
+                subscribed.add(pane.sessionId);
+                this.ws.send(JSON.stringify({
+                    type: 'subscribe',
+                    session_id: pane.sessionId,
+                    data: { since_seq: this.lastSeq.get(pane.sessionId) || 0 }
+                }));
+            });
         };
 
         this.ws.onmessage = (event) => {
@@ -176,13 +190,30 @@ class Claudex {
     }
 
     handleMessage(msg) {
+        // Output and status of panes besides the main one; this client shows only the main pane
+        if (msg.pane_id && (msg.type === 'output' || msg.type === 'status')) {
+            return;
+        }
         switch (msg.type) {
             case 'output':
+            case 'screen':
+                // A screen snapshot redraws the terminal; it replaces the scrollback replay
+                if (msg.seq) {
+                    this.lastSeq.set(msg.session_id, msg.seq);
+                }
                 this.handleOutput(msg.session_id, msg.data);
                 break;
             case 'status':
                 this.handleStatus(msg.session_id, msg.status);
                 break;
+            case 'resync':
+                // The server dropped output we were too slow for; catch up from the last chunk we saw
+                this.ws.send(JSON.stringify({
+                    type: 'subscribe',
+                    session_id: msg.session_id,
+                    data: { since_seq: this.lastSeq.get(msg.session_id) || 0 }
+                }));
+                break;
         }
     }
 
@@ -289,7 +320,7 @@ class Claudex {
     // Sessions management
     async loadSessions() {
         try {
-            const response = await fetch('/api/sessions');
+            const response = await fetch('/api/v1/sessions');
             let sessions = await response.json();
 
             const list = document.getElementById('sessions-list');
@@ -456,7 +487,7 @@ class Claudex {
 
     async createSession(name) {
         try {
-            const response = await fetch('/api/sessions/create', {
+            const response = await fetch('/api/v1/sessions/create', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ name })
@@ -480,7 +511,7 @@ class Claudex {
 
     async createExperiment(parentId) {
         try {
-            const response = await fetch('/api/sessions/experiment', {
+            const response = await fetch('/api/v1/sessions/experiment', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ parent_id: parentId })
@@ -558,7 +589,7 @@ class Claudex {
 
     async deleteSession(sessionId) {
         try {
-            await fetch(`/api/sessions/${sessionId}`, {
+            await fetch(`/api/v1/sessions/${sessionId}`, {
                 method: 'DELETE'
             });
 
@@ -605,7 +636,7 @@ class Claudex {
         const sessionIds = Array.from(this.sessions.keys());
         for (const sessionId of sessionIds) {
             try {
-                await fetch(`/api/sessions/${sessionId}`, { method: 'DELETE' });
+                await fetch(`/api/v1/sessions/${sessionId}`, { method: 'DELETE' });
             } catch (err) {
                 console.error('Failed to delete session:', sessionId, err);
             }
@@ -630,7 +661,7 @@ class Claudex {
 
         this.showConfirm(`Merge "${session.name}" into "${parentName}"?`, async () => {
             try {
-                const response = await fetch(`/api/sessions/${sessionId}/merge`, {
+                const response = await fetch(`/api/v1/sessions/${sessionId}/merge`, {
                     method: 'POST'
                 });
 
@@ -668,7 +699,7 @@ class Claudex {
 
         this.showConfirm(`Discard "${session.name}" and all its changes?`, async () => {
             try {
-                const response = await fetch(`/api/sessions/${sessionId}/discard`, {
+                const response = await fetch(`/api/v1/sessions/${sessionId}/discard`, {
                     method: 'POST'
                 });
 
@@ -711,7 +742,7 @@ class Claudex {
 
     async updateSessionName(sessionId, newName) {
         try {
-            await fetch(`/api/sessions/${sessionId}/name`, {
+            await fetch(`/api/v1/sessions/${sessionId}/name`, {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ name: newName })
@@ -1198,7 +1229,7 @@ class Claudex {
         // Create a new session with the same directory
         // Mark it as a split child so it doesn't get its own robot in 3D view
         try {
-            const response = await fetch('/api/sessions/create', {
+            const response = await fetch('/api/v1/sessions/create', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({
@@ -1839,7 +1870,7 @@ class Claudex {
         // Claude state callback
         this.world3d.fetchClaudeState = async (sessionId) => {
             try {
-                const response = await fetch(`/api/sessions/${sessionId}/claude-state`);
+                const response = await fetch(`/api/v1/sessions/${sessionId}/claude-state`);
                 if (response.ok) {
                     return await response.json();
                 }
@@ -1979,7 +2010,7 @@ class Claudex {
 
         // Save to server
         try {
-            await fetch(`/api/sessions/${this.customizingSessionId}/customize`, {
+            await fetch(`/api/v1/sessions/${this.customizingSessionId}/customize`, {
                 method: 'PUT',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({
@@ -2008,7 +2039,7 @@ class Claudex {
         }
 
         try {
-            const response = await fetch('/api/sessions/create', {
+            const response = await fetch('/api/v1/sessions/create', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ name, hex_q: q, hex_r: r })